@@ -0,0 +1,137 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"faxsender/src/document"
+	"faxsender/src/utilities"
+	"faxsender/src/utilities/config"
+	"fmt"
+	"io"
+	"time"
+)
+
+// loadCoverPageTemplate loads the cover page template chosen for a fax and
+// checks that the cover page can be added to its document. A queued or
+// scheduled fax is checked when it is created, so it doesn't fail only when
+// it is sent.
+//
+// Parameters:
+//   - transmission: The transmission naming the template.
+//   - fileModel: The content type of the document.
+//
+// Returns:
+//   - string: The text of the template.
+//   - error: An ApiError if the template doesn't exist or the document isn't a PDF document.
+func loadCoverPageTemplate(transmission Transmission, fileModel SendFileInfo) (string, error) {
+	if fileModel.ContentType != utilities.PDF_CONTENT_TYPE {
+		return "", NewApiError(ERROR_CODE_COVER_PAGE_FAILED, "a cover page can only be added to a PDF document")
+	}
+
+	templateText, err := document.LoadCoverPageTemplate(transmission.CoverPageTemplate)
+	if err != nil {
+		return "", coverPageError(err)
+	}
+	return templateText, nil
+}
+
+// addCoverPage adds the cover page chosen for a fax before the first page of its document.
+// Steps:
+// 1. Load the cover page template, the document must be a PDF document.
+// 2. Read the document and the authenticated user, who is the sender.
+// 3. Render the cover page for the recipient and prepend it to the document.
+// 4. Switch off the cover page of the fax server.
+//
+// Parameters:
+//   - ctx: The context of the send.
+//   - provider: The fax provider, it authenticates the sender.
+//   - contact: The recipient.
+//   - transmission: The transmission, without a cover page template the document is unchanged.
+//   - file: The document.
+//   - fileModel: The content type of the document.
+//
+// Returns:
+//   - io.Reader: The document with the cover page.
+//   - Transmission: The transmission without the cover page template.
+//   - error: An ApiError if the cover page can't be added.
+func addCoverPage(ctx context.Context, provider FaxProvider, contact Contact, transmission Transmission,
+	file io.Reader, fileModel SendFileInfo) (io.Reader, Transmission, error) {
+
+	if transmission.CoverPageTemplate == "" {
+		return file, transmission, nil
+	}
+
+	templateText, err := loadCoverPageTemplate(transmission, fileModel)
+	if err != nil {
+		return nil, transmission, err
+	}
+
+	contents, err := io.ReadAll(file)
+	if err != nil {
+		return nil, transmission, err
+	}
+
+	sender, err := provider.Authenticate(ctx)
+	if err != nil {
+		return nil, transmission, err
+	}
+
+	contents, err = document.PrependCoverPage(contents, templateText, newCoverPageData(*sender, contact, transmission))
+	if err != nil {
+		return nil, transmission, coverPageError(err)
+	}
+
+	transmission.CoverPageTemplate = ""
+	transmission.IsCoverPage = utilities.WITHOUT_COVER
+	return bytes.NewReader(contents), transmission, nil
+}
+
+// newCoverPageData builds the fields of a cover page.
+//
+// Parameters:
+//   - sender: The authenticated user.
+//   - contact: The recipient.
+//   - transmission: The transmission, its title is the title of the cover page.
+//
+// Returns:
+//   - document.CoverPageData: The fields of the cover page, without the page count.
+func newCoverPageData(sender AuthResponse, contact Contact, transmission Transmission) document.CoverPageData {
+	return document.CoverPageData{
+		Sender: document.CoverPageParty{
+			FirstName: sender.FirstName,
+			LastName:  sender.LastName,
+			Company:   sender.Company,
+			Email:     sender.Email,
+			Phone:     sender.Phone,
+		},
+		Recipient: document.CoverPageParty{
+			FirstName:   contact.FirstName,
+			LastName:    contact.LastName,
+			Email:       contact.Email,
+			Phone:       contact.Phone,
+			Address:     contact.Address,
+			Description: contact.Description,
+			Custom1:     contact.Custom1,
+			Custom2:     contact.Custom2,
+			Custom3:     contact.Custom3,
+		},
+		Title:  transmission.Title,
+		Date:   time.Now().Format(document.COVER_PAGE_DATE_FORMAT),
+		Notice: (*config.Inst()).GetCoverPageNotice(),
+	}
+}
+
+// coverPageError converts an error of the document package into an ApiError.
+func coverPageError(err error) error {
+	switch {
+	case errors.Is(err, document.ErrCoverPageTemplateNotFound):
+		return NewApiError(ERROR_CODE_NOT_FOUND, err.Error())
+	case errors.Is(err, document.ErrCoverPageTemplateInvalid),
+		errors.Is(err, document.ErrNotPdf),
+		errors.Is(err, document.ErrPdfEncrypted),
+		errors.Is(err, document.ErrPdfDamaged):
+		return NewApiError(ERROR_CODE_COVER_PAGE_FAILED, fmt.Sprintf("the cover page can't be added: %v", err))
+	}
+	return err
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"faxsender/src/document"
+	"faxsender/src/utilities"
+	"faxsender/src/utilities/config"
+	"fmt"
+	"io"
+)
+
+// convertDocument converts a document the fax server can't send as it is,
+// a text file, an image or an office document, into a PDF document. When the
+// transmission asks for a TIFF upload format, images are converted to fax
+// TIFF images instead and TIFF images are kept, other documents are rejected.
+// Documents that aren't converted are returned unread.
+//
+// Parameters:
+//   - ctx: The context of the send, cancelling it stops the conversion.
+//   - file: The document.
+//   - fileModel: The content type of the document.
+//   - transmission: The transmission, its upload format chooses the conversion.
+//
+// Returns:
+//   - io.Reader: The converted document, or the unread document.
+//   - SendFileInfo: The content type of the returned document.
+//   - error: An ApiError if the document can't be converted.
+func convertDocument(ctx context.Context, file io.Reader, fileModel SendFileInfo, transmission Transmission) (io.Reader, SendFileInfo, error) {
+	if convert, err := needsConversion(fileModel, transmission); !convert || err != nil {
+		return file, fileModel, err
+	}
+
+	contents, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fileModel, err
+	}
+
+	converted, fileModel, err := convertDocumentContents(ctx, contents, fileModel, transmission)
+	if err != nil {
+		return nil, fileModel, err
+	}
+	return bytes.NewReader(converted), fileModel, nil
+}
+
+// convertDocumentSource converts the document of a source like convertDocument,
+// the source of the converted document holds it in memory.
+func convertDocumentSource(ctx context.Context, source DocumentSource, fileModel SendFileInfo, transmission Transmission) (DocumentSource, SendFileInfo, error) {
+	if convert, err := needsConversion(fileModel, transmission); !convert || err != nil {
+		return source, fileModel, err
+	}
+
+	file, err := source()
+	if err != nil {
+		return nil, fileModel, fmt.Errorf("error opening the document: %v", err)
+	}
+	defer file.Close()
+
+	contents, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fileModel, err
+	}
+
+	converted, fileModel, err := convertDocumentContents(ctx, contents, fileModel, transmission)
+	if err != nil {
+		return nil, fileModel, err
+	}
+	return BytesDocumentSource(converted), fileModel, nil
+}
+
+// needsConversion reports whether a document is converted before it is sent
+// with the upload format of the transmission.
+//
+// Returns:
+//   - bool: true if the document is converted.
+//   - error: An ApiError if the upload format is unknown or the document can't be sent in it.
+func needsConversion(fileModel SendFileInfo, transmission Transmission) (bool, error) {
+	switch transmission.UploadFormat {
+	case "", utilities.UPLOAD_FORMAT_PDF:
+		return document.NeedsConversion(fileModel.ContentType), nil
+	case utilities.UPLOAD_FORMAT_TIFF_G3, utilities.UPLOAD_FORMAT_TIFF_G4:
+	default:
+		return false, NewApiError(ERROR_CODE_INVALID_REQUEST, fmt.Sprintf("unknown upload format '%s'", transmission.UploadFormat))
+	}
+
+	switch transmission.FaxResolution {
+	case "", utilities.FAX_RESOLUTION_STANDARD, utilities.FAX_RESOLUTION_FINE:
+	default:
+		return false, NewApiError(ERROR_CODE_INVALID_REQUEST, fmt.Sprintf("unknown fax resolution '%s'", transmission.FaxResolution))
+	}
+
+	if fileModel.ContentType == utilities.TIFF_CONTENT_TYPE {
+		return false, nil
+	}
+	if !document.IsFaxTiffImage(fileModel.ContentType) {
+		return false, NewApiError(ERROR_CODE_CONVERSION_FAILED, "only PNG, JPEG and TIFF images can be sent as TIFF images")
+	}
+	return true, nil
+}
+
+// convertDocumentContents converts the contents of a document with the
+// converter of the configuration, caching the result in the conversions
+// directory. Images are converted to fax TIFF images when the transmission
+// asks for a TIFF upload format.
+func convertDocumentContents(ctx context.Context, contents []byte, fileModel SendFileInfo, transmission Transmission) ([]byte, SendFileInfo, error) {
+	cacheDir, err := utilities.GetConversionsPath()
+	if err != nil {
+		return nil, fileModel, err
+	}
+
+	conf := *config.Inst()
+	converter := document.NewDocumentConverter(conf.GetOfficeConverter(), conf.GetConversionTimeout(),
+		document.PageSizeByName(conf.GetPaperSize()), cacheDir)
+
+	if transmission.UploadFormat == utilities.UPLOAD_FORMAT_TIFF_G3 || transmission.UploadFormat == utilities.UPLOAD_FORMAT_TIFF_G4 {
+		tiff, err := converter.ConvertToFaxTiff(contents, fileModel.ContentType, document.FaxTiffOptions{
+			Group4: transmission.UploadFormat == utilities.UPLOAD_FORMAT_TIFF_G4,
+			Fine:   transmission.FaxResolution == utilities.FAX_RESOLUTION_FINE,
+			Dither: transmission.Dithering,
+		})
+		if err != nil {
+			return nil, fileModel, conversionError(err)
+		}
+		return tiff, SendFileInfo{ContentType: utilities.TIFF_CONTENT_TYPE}, nil
+	}
+
+	pdf, err := converter.ConvertToPdf(ctx, contents, fileModel.ContentType)
+	if err != nil {
+		return nil, fileModel, conversionError(err)
+	}
+	return pdf, SendFileInfo{ContentType: utilities.PDF_CONTENT_TYPE}, nil
+}
+
+// conversionError converts an error of the document conversion into an ApiError.
+func conversionError(err error) error {
+	switch {
+	case errors.Is(err, document.ErrConverterUnavailable):
+		return NewApiError(ERROR_CODE_CONVERTER_UNAVAILABLE, err.Error())
+	case errors.Is(err, document.ErrConversionFailed):
+		return NewApiError(ERROR_CODE_CONVERSION_FAILED, err.Error())
+	}
+	return err
+}
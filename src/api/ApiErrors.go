@@ -0,0 +1,295 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ICTStep identifies the ICT API call an error belongs to.
+type ICTStep string
+
+// Constants for the steps of the ICT API calls, the first ones are the six
+// steps of the send pipeline.
+const (
+	ICT_STEP_CONTACT      ICTStep = "contact"
+	ICT_STEP_DOCUMENT     ICTStep = "document"
+	ICT_STEP_UPLOAD       ICTStep = "upload"
+	ICT_STEP_PROGRAM      ICTStep = "program"
+	ICT_STEP_TRANSMISSION ICTStep = "transmission"
+	ICT_STEP_SEND         ICTStep = "send"
+
+	ICT_STEP_AUTHENTICATE        ICTStep = "authenticate"
+	ICT_STEP_LIST_ACCOUNTS       ICTStep = "list_accounts"
+	ICT_STEP_LIST_CONTACTS       ICTStep = "list_contacts"
+	ICT_STEP_LIST_TRANSMISSIONS  ICTStep = "list_transmissions"
+	ICT_STEP_TRANSMISSION_STATUS ICTStep = "transmission_status"
+)
+
+// Constants for the stable error codes returned in the JSON error envelope.
+const (
+	ERROR_CODE_INVALID_REQUEST       = "invalid_request"
+	ERROR_CODE_SETTINGS_NOT_FOUND    = "settings_not_found"
+	ERROR_CODE_INTERNAL              = "internal_error"
+	ERROR_CODE_AUTHENTICATION_FAILED = "authentication_failed"
+	ERROR_CODE_ICT_UNREACHABLE       = "ict_unreachable"
+	ERROR_CODE_ICT_INVALID_RESPONSE  = "ict_invalid_response"
+	ERROR_CODE_ICT_SERVER_ERROR      = "ict_server_error"
+	ERROR_CODE_ICT_REQUEST_FAILED    = "ict_request_failed"
+	ERROR_CODE_INVALID_FAX_NUMBER    = "invalid_fax_number"
+	ERROR_CODE_DOCUMENT_REJECTED     = "document_rejected"
+	ERROR_CODE_UPLOAD_REJECTED       = "upload_rejected"
+	ERROR_CODE_PROGRAM_FAILED        = "program_failed"
+	ERROR_CODE_TRANSMISSION_REJECTED = "transmission_rejected"
+	ERROR_CODE_SEND_FAILED           = "send_failed"
+	ERROR_CODE_CANCELED              = "canceled"
+	ERROR_CODE_UPLOAD_TOO_LARGE      = "upload_too_large"
+	ERROR_CODE_PROVIDER_NOT_FOUND    = "provider_not_found"
+	ERROR_CODE_NOT_FOUND             = "not_found"
+	ERROR_CODE_CONFLICT              = "conflict"
+	ERROR_CODE_COVER_PAGE_FAILED     = "cover_page_failed"
+	ERROR_CODE_CONVERSION_FAILED     = "conversion_failed"
+	ERROR_CODE_CONVERTER_UNAVAILABLE = "converter_unavailable"
+	ERROR_CODE_UNAUTHORIZED          = "unauthorized"
+)
+
+// STATUS_CLIENT_CLOSED_REQUEST is the HTTP status code used when the client
+// cancelled the request before it finished.
+const STATUS_CLIENT_CLOSED_REQUEST = 499
+
+// MAX_ICT_ERROR_BODY_SIZE limits how much of an ICT error response is kept.
+const MAX_ICT_ERROR_BODY_SIZE = 4096
+
+// ICTError represents a failed ICT API call.
+type ICTError struct {
+	Step       ICTStep
+	StatusCode int
+	Body       string
+	Err        error
+}
+
+// newICTStatusError creates an ICTError from a non 200 ICT response.
+// It reads a limited part of the response body, the caller still closes it.
+//
+// Parameters:
+//   - step: The step of the failed call.
+//   - resp: The ICT response.
+//
+// Returns:
+//   - *ICTError: The error with the status code and the response body.
+func newICTStatusError(step ICTStep, resp *http.Response) *ICTError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, MAX_ICT_ERROR_BODY_SIZE))
+
+	return &ICTError{
+		Step:       step,
+		StatusCode: resp.StatusCode,
+		Body:       strings.TrimSpace(string(body)),
+	}
+}
+
+// wrapICTError wraps an error of a step into an ICTError.
+// ICTErrors are returned as they are, so an authentication failure during a
+// step keeps the authenticate step.
+//
+// Parameters:
+//   - step: The step of the failed call.
+//   - err: The error to wrap.
+//
+// Returns:
+//   - error: The wrapped error, or nil if err is nil.
+func wrapICTError(step ICTStep, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var ictErr *ICTError
+	if errors.As(err, &ictErr) {
+		return err
+	}
+
+	return &ICTError{
+		Step: step,
+		Err:  err,
+	}
+}
+
+// Error returns the error message.
+func (e *ICTError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("ICT %s step failed: %v", e.Step, e.Err)
+	}
+	return fmt.Sprintf("ICT %s step failed with status code: %d", e.Step, e.StatusCode)
+}
+
+// Unwrap returns the underlying error.
+func (e *ICTError) Unwrap() error {
+	return e.Err
+}
+
+// Code returns the stable error code of the failure. A failure without a
+// status code is a transport error when the ICT server couldn't be reached,
+// otherwise the server answered with a body that couldn't be read. Only a
+// bad request or an unprocessable contact is an invalid fax number, the other
+// client errors of the contact step are generic request failures.
+//
+// Returns:
+//   - string: One of the ERROR_CODE_* constants.
+func (e *ICTError) Code() string {
+	switch {
+	case errors.Is(e.Err, context.Canceled):
+		return ERROR_CODE_CANCELED
+	case e.StatusCode == 0 && isTransportError(e.Err):
+		return ERROR_CODE_ICT_UNREACHABLE
+	case e.StatusCode == 0:
+		return ERROR_CODE_ICT_INVALID_RESPONSE
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return ERROR_CODE_AUTHENTICATION_FAILED
+	case e.StatusCode >= http.StatusInternalServerError:
+		return ERROR_CODE_ICT_SERVER_ERROR
+	}
+
+	switch e.Step {
+	case ICT_STEP_AUTHENTICATE:
+		return ERROR_CODE_AUTHENTICATION_FAILED
+	case ICT_STEP_CONTACT:
+		if e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity {
+			return ERROR_CODE_INVALID_FAX_NUMBER
+		}
+		return ERROR_CODE_ICT_REQUEST_FAILED
+	case ICT_STEP_DOCUMENT:
+		return ERROR_CODE_DOCUMENT_REJECTED
+	case ICT_STEP_UPLOAD:
+		return ERROR_CODE_UPLOAD_REJECTED
+	case ICT_STEP_PROGRAM:
+		return ERROR_CODE_PROGRAM_FAILED
+	case ICT_STEP_TRANSMISSION:
+		return ERROR_CODE_TRANSMISSION_REJECTED
+	case ICT_STEP_SEND:
+		return ERROR_CODE_SEND_FAILED
+	default:
+		return ERROR_CODE_ICT_REQUEST_FAILED
+	}
+}
+
+// isTransportError checks if an error is the failure of the connection to the
+// ICT server, e.g. a refused connection, a timeout or a connection reset while
+// the response was read.
+func isTransportError(err error) bool {
+	var netErr net.Error
+	var urlErr *url.Error
+	return errors.As(err, &netErr) || errors.As(err, &urlErr)
+}
+
+// ApiError is the JSON error envelope returned by the routes.
+// The "error" field keeps the message for clients of the old envelope.
+type ApiError struct {
+	Message    string  `json:"error"`
+	Code       string  `json:"code"`
+	Step       ICTStep `json:"step,omitempty"`
+	ICTStatus  int     `json:"ict_status,omitempty"`
+	ICTBody    string  `json:"ict_body,omitempty"`
+	HTTPStatus int     `json:"-"`
+}
+
+// NewApiError creates a new ApiError with the given code and message.
+//
+// Parameters:
+//   - code: One of the ERROR_CODE_* constants.
+//   - message: The error message.
+//
+// Returns:
+//   - *ApiError: The created error.
+func NewApiError(code string, message string) *ApiError {
+	return &ApiError{
+		Message:    message,
+		Code:       code,
+		HTTPStatus: httpStatusForErrorCode(code),
+	}
+}
+
+// Error returns the error message.
+func (e *ApiError) Error() string {
+	if e.Step != "" {
+		return fmt.Sprintf("%s (%s, step: %s)", e.Message, e.Code, e.Step)
+	}
+	return fmt.Sprintf("%s (%s)", e.Message, e.Code)
+}
+
+// ToApiError converts any error into an ApiError.
+// Steps:
+// 1. Return ApiErrors as they are.
+// 2. Convert ICTErrors keeping the step, the ICT status code and body.
+// 3. Treat a cancelled context as a cancelled request.
+// 4. Treat any other error as an internal error.
+//
+// Parameters:
+//   - err: The error to convert.
+//
+// Returns:
+//   - *ApiError: The converted error.
+func ToApiError(err error) *ApiError {
+	var apiErr *ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var ictErr *ICTError
+	if errors.As(err, &ictErr) {
+		converted := NewApiError(ictErr.Code(), ictErr.Error())
+		converted.Step = ictErr.Step
+		converted.ICTStatus = ictErr.StatusCode
+		converted.ICTBody = ictErr.Body
+		return converted
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return NewApiError(ERROR_CODE_CANCELED, err.Error())
+	}
+
+	return NewApiError(ERROR_CODE_INTERNAL, err.Error())
+}
+
+// httpStatusForErrorCode returns the HTTP status code used for an error code.
+func httpStatusForErrorCode(code string) int {
+	switch code {
+	case ERROR_CODE_INVALID_REQUEST:
+		return http.StatusBadRequest
+	case ERROR_CODE_SETTINGS_NOT_FOUND:
+		return http.StatusPreconditionFailed
+	case ERROR_CODE_UNAUTHORIZED:
+		return http.StatusUnauthorized
+	case ERROR_CODE_NOT_FOUND:
+		return http.StatusNotFound
+	case ERROR_CODE_CONFLICT:
+		return http.StatusConflict
+	case ERROR_CODE_INVALID_FAX_NUMBER,
+		ERROR_CODE_DOCUMENT_REJECTED,
+		ERROR_CODE_UPLOAD_REJECTED,
+		ERROR_CODE_PROGRAM_FAILED,
+		ERROR_CODE_TRANSMISSION_REJECTED,
+		ERROR_CODE_SEND_FAILED,
+		ERROR_CODE_ICT_REQUEST_FAILED,
+		ERROR_CODE_COVER_PAGE_FAILED,
+		ERROR_CODE_CONVERSION_FAILED:
+		return http.StatusUnprocessableEntity
+	case ERROR_CODE_CONVERTER_UNAVAILABLE:
+		return http.StatusNotImplemented
+	case ERROR_CODE_AUTHENTICATION_FAILED,
+		ERROR_CODE_ICT_SERVER_ERROR,
+		ERROR_CODE_ICT_INVALID_RESPONSE:
+		return http.StatusBadGateway
+	case ERROR_CODE_ICT_UNREACHABLE:
+		return http.StatusGatewayTimeout
+	case ERROR_CODE_CANCELED:
+		return STATUS_CLIENT_CLOSED_REQUEST
+	case ERROR_CODE_UPLOAD_TOO_LARGE:
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,583 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"faxsender/src/utilities"
+	"faxsender/src/utilities/logger"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Constants for the local fax history.
+const (
+	FAX_HISTORY_SOURCE_APP      = "app"
+	FAX_HISTORY_SOURCE_ICT      = "ict"
+	FAX_HISTORY_SYNC_INTERVAL   = 5 * time.Minute
+	FAX_HISTORY_SYNC_WINDOW     = 30 * 24 * time.Hour
+	FAX_HISTORY_FILE_PERMISSION = 0600
+)
+
+// Constants for the lock of the fax history. The daemon and the UI both change
+// the history file, a process holds the lock file during a read and write cycle.
+// A lock older than the lease is left by a crashed process and is taken over.
+const (
+	FAX_HISTORY_LOCK_EXTENSION = ".lock"
+	FAX_HISTORY_LOCK_LEASE     = 30 * time.Second
+	FAX_HISTORY_LOCK_TIMEOUT   = 2 * FAX_HISTORY_LOCK_LEASE
+	FAX_HISTORY_LOCK_RETRY     = 10 * time.Millisecond
+)
+
+// Constants for the query parameters of the fax history search, the dates are RFC 3339 timestamps.
+const (
+	FAX_HISTORY_PARAM_FROM   = "from"
+	FAX_HISTORY_PARAM_TO     = "to"
+	FAX_HISTORY_PARAM_NUMBER = "number"
+	FAX_HISTORY_PARAM_TITLE  = "title"
+	FAX_HISTORY_PARAM_STATUS = "status"
+	FAX_HISTORY_PARAM_OFFSET = "offset"
+	FAX_HISTORY_PARAM_LIMIT  = "limit"
+)
+
+// FaxHistoryRecord represents a fax of the local fax history.
+// Faxes sent through this app are recorded when they are sent, the print
+// transmissions missing locally are added by the sync with the ICT API.
+type FaxHistoryRecord struct {
+	TransmissionID int       `json:"transmission_id"`
+	Title          string    `json:"title"`
+	DestinationFax string    `json:"contact_phone"`
+	RecipientName  string    `json:"recipient_name,omitempty"`
+	CallerID       string    `json:"account_phone,omitempty"`
+	AccountID      string    `json:"account_id,omitempty"`
+	DocumentHash   string    `json:"document_hash,omitempty"`
+	Status         string    `json:"status"`
+	IsFinal        bool      `json:"is_final"`
+	Source         string    `json:"source"`
+	SentAt         time.Time `json:"sent_at"`
+	LastRun        time.Time `json:"last_run"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// FaxHistoryQuery holds the filters and the page of a fax history search,
+// empty filters match every fax and a zero limit returns every matching fax.
+type FaxHistoryQuery struct {
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Number string    `json:"number"`
+	Title  string    `json:"title"`
+	Status string    `json:"status"`
+	Offset int       `json:"offset"`
+	Limit  int       `json:"limit"`
+}
+
+// FaxHistoryPage represents one page of the faxes matching a fax history search, the newest first.
+type FaxHistoryPage struct {
+	Records []FaxHistoryRecord `json:"records"`
+	Offset  int                `json:"offset"`
+	Limit   int                `json:"limit"`
+	Total   int                `json:"total"`
+}
+
+// Matches checks if a fax of the history matches all filters of the query.
+// The number matches any part of the destination fax ignoring formatting,
+// the title matches any part of the title ignoring case and the status must
+// be equal ignoring case. The date range includes From and excludes To.
+//
+// Parameters:
+//   - record: The fax of the history.
+//
+// Returns:
+//   - bool: True if the fax matches the query.
+func (q FaxHistoryQuery) Matches(record FaxHistoryRecord) bool {
+	if !q.From.IsZero() && record.SentAt.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !record.SentAt.Before(q.To) {
+		return false
+	}
+
+	number := normalizeFaxNumber(q.Number)
+	if number != "" && !strings.Contains(normalizeFaxNumber(record.DestinationFax), number) {
+		return false
+	}
+
+	title := strings.ToLower(strings.TrimSpace(q.Title))
+	if title != "" && !strings.Contains(strings.ToLower(record.Title), title) {
+		return false
+	}
+
+	status := strings.TrimSpace(q.Status)
+	if status != "" && !strings.EqualFold(record.Status, status) {
+		return false
+	}
+
+	return true
+}
+
+// Values encodes the query as the query parameters of the fax history route.
+//
+// Returns:
+//   - url.Values: The query parameters, empty filters are left out.
+func (q FaxHistoryQuery) Values() url.Values {
+	values := url.Values{}
+	if !q.From.IsZero() {
+		values.Set(FAX_HISTORY_PARAM_FROM, q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		values.Set(FAX_HISTORY_PARAM_TO, q.To.Format(time.RFC3339))
+	}
+	if q.Number != "" {
+		values.Set(FAX_HISTORY_PARAM_NUMBER, q.Number)
+	}
+	if q.Title != "" {
+		values.Set(FAX_HISTORY_PARAM_TITLE, q.Title)
+	}
+	if q.Status != "" {
+		values.Set(FAX_HISTORY_PARAM_STATUS, q.Status)
+	}
+	if q.Offset > 0 {
+		values.Set(FAX_HISTORY_PARAM_OFFSET, strconv.Itoa(q.Offset))
+	}
+	if q.Limit > 0 {
+		values.Set(FAX_HISTORY_PARAM_LIMIT, strconv.Itoa(q.Limit))
+	}
+	return values
+}
+
+// ParseFaxHistoryQuery decodes a query from the query parameters of the fax history route.
+//
+// Parameters:
+//   - values: The query parameters.
+//
+// Returns:
+//   - FaxHistoryQuery: The decoded query.
+//   - error: An ApiError if a date is not an RFC 3339 timestamp or the page is invalid.
+func ParseFaxHistoryQuery(values url.Values) (FaxHistoryQuery, error) {
+	query := FaxHistoryQuery{
+		Number: values.Get(FAX_HISTORY_PARAM_NUMBER),
+		Title:  values.Get(FAX_HISTORY_PARAM_TITLE),
+		Status: values.Get(FAX_HISTORY_PARAM_STATUS),
+	}
+
+	for name, target := range map[string]*int{FAX_HISTORY_PARAM_OFFSET: &query.Offset, FAX_HISTORY_PARAM_LIMIT: &query.Limit} {
+		value := values.Get(name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return query, NewApiError(ERROR_CODE_INVALID_REQUEST, fmt.Sprintf("the %s '%s' is invalid", name, value))
+		}
+		*target = parsed
+	}
+
+	for name, target := range map[string]*time.Time{FAX_HISTORY_PARAM_FROM: &query.From, FAX_HISTORY_PARAM_TO: &query.To} {
+		value := values.Get(name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return query, NewApiError(ERROR_CODE_INVALID_REQUEST, fmt.Sprintf("the %s date '%s' is invalid", name, value))
+		}
+		*target = parsed
+	}
+
+	return query, nil
+}
+
+// normalizeFaxNumber keeps the digits of a fax number.
+func normalizeFaxNumber(number string) string {
+	var digits strings.Builder
+	for _, r := range number {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	return digits.String()
+}
+
+// faxHistoryMutex serializes the changes of the fax history in this process,
+// the lock file of the history those of different processes, see lockFaxHistory.
+var faxHistoryMutex sync.Mutex
+
+// lockFaxHistory locks the fax history in this process and in the others
+// sharing the working directory, waiting until the lock is released.
+//
+// Returns:
+//   - func(): Releases the lock.
+//   - error: An error if the lock file can not be created or is held past the timeout.
+func lockFaxHistory() (func(), error) {
+	historyFilePath, err := utilities.GetHistoryPath()
+	if err != nil {
+		return nil, err
+	}
+	lockFilePath := historyFilePath + FAX_HISTORY_LOCK_EXTENSION
+
+	faxHistoryMutex.Lock()
+
+	deadline := time.Now().Add(FAX_HISTORY_LOCK_TIMEOUT)
+	for {
+		locked, err := utilities.CreateLockFile(lockFilePath, FAX_HISTORY_LOCK_LEASE)
+		if err != nil {
+			faxHistoryMutex.Unlock()
+			return nil, fmt.Errorf("error locking the fax history: %v", err)
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			faxHistoryMutex.Unlock()
+			return nil, fmt.Errorf("the fax history is locked by another process")
+		}
+		time.Sleep(FAX_HISTORY_LOCK_RETRY)
+	}
+
+	return func() {
+		logIfError(utilities.RemoveLockFile(lockFilePath))
+		faxHistoryMutex.Unlock()
+	}, nil
+}
+
+// loadFaxHistory reads the fax history, a missing file is an empty history.
+func loadFaxHistory() ([]FaxHistoryRecord, error) {
+	historyFilePath, err := utilities.GetHistoryPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(historyFilePath)
+	if os.IsNotExist(err) {
+		return []FaxHistoryRecord{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]FaxHistoryRecord, 0)
+	err = json.Unmarshal(data, &records)
+	if err != nil {
+		return nil, fmt.Errorf("the fax history file '%s' is corrupted: %v", historyFilePath, err)
+	}
+	return records, nil
+}
+
+// saveFaxHistory writes the fax history.
+func saveFaxHistory(records []FaxHistoryRecord) error {
+	historyFilePath, err := utilities.GetHistoryPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return utilities.WriteFileAtomic(historyFilePath, data, FAX_HISTORY_FILE_PERMISSION)
+}
+
+// findFaxHistoryRecord returns the index of the fax with the transmission ID, -1 if there is none.
+func findFaxHistoryRecord(records []FaxHistoryRecord, transmissionID int) int {
+	for i, record := range records {
+		if record.TransmissionID == transmissionID {
+			return i
+		}
+	}
+	return -1
+}
+
+// RecordSentFax adds a sent fax to the fax history, or replaces the fax with
+// the same transmission ID.
+//
+// Parameters:
+//   - record: The sent fax.
+//
+// Returns:
+//   - error: An error if the fax history can not be read or written.
+func RecordSentFax(record FaxHistoryRecord) error {
+	unlock, err := lockFaxHistory()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	records, err := loadFaxHistory()
+	if err != nil {
+		return err
+	}
+
+	record.UpdatedAt = time.Now()
+	if index := findFaxHistoryRecord(records, record.TransmissionID); index >= 0 {
+		records[index] = record
+	} else {
+		records = append(records, record)
+	}
+
+	return saveFaxHistory(records)
+}
+
+// UpdateFaxHistoryStatus updates the status of a fax of the history, faxes
+// missing in the history are ignored.
+//
+// Parameters:
+//   - faxStatus: The fetched status of the transmission.
+//
+// Returns:
+//   - error: An error if the fax history can not be read or written.
+func UpdateFaxHistoryStatus(faxStatus FaxStatus) error {
+	unlock, err := lockFaxHistory()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	records, err := loadFaxHistory()
+	if err != nil {
+		return err
+	}
+
+	index := findFaxHistoryRecord(records, faxStatus.TransmissionID)
+	if index < 0 {
+		return nil
+	}
+
+	record := &records[index]
+	if record.Status == faxStatus.Status && record.LastRun.Equal(faxStatus.DateTime) {
+		return nil
+	}
+
+	record.Status = faxStatus.Status
+	record.IsFinal = faxStatus.IsFinal
+	record.LastRun = faxStatus.DateTime
+	record.UpdatedAt = time.Now()
+
+	return saveFaxHistory(records)
+}
+
+// MergeFaxHistory merges the transmissions queried from the fax provider into the fax history.
+// Steps:
+// 1. Update the status, the caller ID and the last run of the known faxes.
+// 2. Add the print transmissions missing in the history.
+// 3. Write the history if anything changed.
+//
+// Parameters:
+//   - faxes: The transmissions queried from the fax provider.
+//
+// Returns:
+//   - int: The number of added or changed faxes.
+//   - error: An error if the fax history can not be read or written.
+func MergeFaxHistory(faxes []FaxData) (int, error) {
+	unlock, err := lockFaxHistory()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	records, err := loadFaxHistory()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	changed := 0
+	for _, fax := range faxes {
+		if fax.TransmissionID <= 0 {
+			continue
+		}
+
+		index := findFaxHistoryRecord(records, fax.TransmissionID)
+		if index < 0 {
+			if fax.IsPrint != utilities.WITH_PRINT {
+				continue
+			}
+
+			records = append(records, FaxHistoryRecord{
+				TransmissionID: fax.TransmissionID,
+				Title:          fax.Title,
+				DestinationFax: fax.DestinationFax,
+				CallerID:       fax.CallerID,
+				AccountID:      fax.AccountID,
+				Status:         fax.Status,
+				IsFinal:        IsFinalFaxStatus(fax.Status),
+				Source:         FAX_HISTORY_SOURCE_ICT,
+				SentAt:         fax.DateTime,
+				LastRun:        fax.DateTime,
+				UpdatedAt:      now,
+			})
+			changed++
+			continue
+		}
+
+		record := &records[index]
+		if record.Status == fax.Status && record.CallerID == fax.CallerID && record.LastRun.Equal(fax.DateTime) {
+			continue
+		}
+
+		record.Status = fax.Status
+		record.IsFinal = IsFinalFaxStatus(fax.Status)
+		record.CallerID = fax.CallerID
+		record.LastRun = fax.DateTime
+		if record.DestinationFax == "" {
+			record.DestinationFax = fax.DestinationFax
+		}
+		record.UpdatedAt = now
+		changed++
+	}
+
+	if changed == 0 {
+		return 0, nil
+	}
+	return changed, saveFaxHistory(records)
+}
+
+// FaxHistorySyncStart returns the time the sync with the fax provider starts from.
+// An empty history is synced in full, otherwise only the transmissions of
+// the sync window are queried.
+//
+// Returns:
+//   - time.Time: The start of the synced transmissions, zero for all of them.
+//   - error: An error if the fax history can not be read.
+func FaxHistorySyncStart() (time.Time, error) {
+	faxHistoryMutex.Lock()
+	records, err := loadFaxHistory()
+	faxHistoryMutex.Unlock()
+	if err != nil || len(records) == 0 {
+		return time.Time{}, err
+	}
+	return time.Now().Add(-FAX_HISTORY_SYNC_WINDOW), nil
+}
+
+// SearchFaxHistory returns one page of the faxes of the history matching the query, the newest first.
+//
+// Parameters:
+//   - query: The filters and the page of the search.
+//
+// Returns:
+//   - *FaxHistoryPage: The requested page.
+//   - error: An error if the fax history can not be read.
+func SearchFaxHistory(query FaxHistoryQuery) (*FaxHistoryPage, error) {
+	faxHistoryMutex.Lock()
+	records, err := loadFaxHistory()
+	faxHistoryMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]FaxHistoryRecord, 0)
+	for _, record := range records {
+		if query.Matches(record) {
+			result = append(result, record)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].SentAt.After(result[j].SentAt)
+	})
+
+	page := &FaxHistoryPage{Offset: query.Offset, Limit: query.Limit, Total: len(result)}
+
+	start := query.Offset
+	if start < 0 {
+		start = 0
+	}
+	if start > len(result) {
+		start = len(result)
+	}
+	end := len(result)
+	if query.Limit > 0 && start+query.Limit < end {
+		end = start + query.Limit
+	}
+
+	page.Records = result[start:end]
+	return page, nil
+}
+
+// newDocumentHashReader hashes a document while it is read.
+//
+// Parameters:
+//   - file: Reader of the document.
+//
+// Returns:
+//   - io.Reader: The reader to read the document from.
+//   - hash.Hash: The hash of the read part of the document.
+func newDocumentHashReader(file io.Reader) (io.Reader, hash.Hash) {
+	documentHash := sha256.New()
+	return io.TeeReader(file, documentHash), documentHash
+}
+
+// hashDocumentSource hashes a document read from its source.
+//
+// Parameters:
+//   - source: The source of the document.
+//
+// Returns:
+//   - string: The hex encoded SHA-256 hash of the document.
+//   - error: An error if the document can not be read.
+func hashDocumentSource(source DocumentSource) (string, error) {
+	file, err := source()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	documentHash := sha256.New()
+	if _, err := io.Copy(documentHash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(documentHash.Sum(nil)), nil
+}
+
+// newSentFaxRecord builds the fax history record of a fax sent through this app.
+func newSentFaxRecord(transmissionID int, contact Contact, transmission Transmission, documentHash string) FaxHistoryRecord {
+	now := time.Now()
+	return FaxHistoryRecord{
+		TransmissionID: transmissionID,
+		Title:          transmission.Title,
+		DestinationFax: contact.Phone,
+		RecipientName:  strings.TrimSpace(contact.FirstName + " " + contact.LastName),
+		AccountID:      transmission.AccountID,
+		DocumentHash:   documentHash,
+		Source:         FAX_HISTORY_SOURCE_APP,
+		SentAt:         now,
+		LastRun:        now,
+	}
+}
+
+// RunFaxHistorySync syncs the fax history with the ICT transmissions list
+// until the context is cancelled.
+//
+// Parameters:
+//   - ctx: The context of the sync, cancelling it stops the sync.
+//   - api: The API the history is synced with.
+//   - interval: The time between two syncs, the default is used if zero.
+func RunFaxHistorySync(ctx context.Context, api IApiUICalls, interval time.Duration) {
+	if interval <= 0 {
+		interval = FAX_HISTORY_SYNC_INTERVAL
+	}
+
+	for {
+		err := api.SyncFaxHistory(ctx)
+		if err != nil && ToApiError(err).Code != ERROR_CODE_SETTINGS_NOT_FOUND {
+			logger.Inst().Error(fmt.Sprintf("error syncing the fax history: %v", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
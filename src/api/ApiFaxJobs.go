@@ -0,0 +1,505 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"faxsender/src/utilities"
+	"faxsender/src/utilities/logger"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Constants for the files of a stored fax job.
+const (
+	FAX_JOB_FILE_EXTENSION       = ".json"
+	FAX_JOB_DOCUMENT_EXTENSION   = ".doc"
+	FAX_JOB_ID_LENGTH            = 32
+	FAX_JOB_FILE_PERMISSION      = 0600
+	FAX_JOB_DIRECTORY_PERMISSION = 0700
+)
+
+// Constants for the locks of the fax jobs. A process running a job holds its
+// lock file and refreshes it, a lock older than the lease is left by a crashed
+// process and may be taken over. A job older than the maximum age is no longer
+// resumed, its fax would arrive too late.
+const (
+	FAX_JOB_LOCK_EXTENSION = ".lock"
+	FAX_JOB_LOCK_LEASE     = 2 * time.Minute
+	FAX_JOB_LOCK_REFRESH   = FAX_JOB_LOCK_LEASE / 4
+	FAX_JOB_MAX_AGE        = 24 * time.Hour
+)
+
+// FaxJobCheckpoint holds the ICT IDs obtained so far by the send pipeline.
+// A zero ID or a false flag means the step has not finished yet.
+// ContactReused marks a contact that existed before the send, it is never rolled back.
+type FaxJobCheckpoint struct {
+	ContactID      int  `json:"contact_id"`
+	ContactReused  bool `json:"contact_reused,omitempty"`
+	DocumentID     int  `json:"document_id"`
+	Uploaded       bool `json:"uploaded"`
+	ProgramID      int  `json:"program_id"`
+	TransmissionID int  `json:"transmission_id"`
+	Sent           bool `json:"sent"`
+}
+
+// FaxJob represents a send request persisted under the working directory,
+// so the send pipeline can resume from the first step that didn't finish.
+// A job with an owner, e.g. a queued or a scheduled fax, is resumed and
+// removed by its owner only, see WithFaxJobOwner.
+type FaxJob struct {
+	ID           string           `json:"id"`
+	Owner        string           `json:"owner,omitempty"`
+	Contact      Contact          `json:"contact"`
+	Document     DocumentRecord   `json:"document"`
+	Transmission Transmission     `json:"transmission"`
+	FileModel    SendFileInfo     `json:"file_model"`
+	Checkpoint   FaxJobCheckpoint `json:"checkpoint"`
+	LastError    string           `json:"last_error,omitempty"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+}
+
+// faxJobOwnerKey is the context key of the owner of the fax job of a send.
+type faxJobOwnerKey struct{}
+
+// WithFaxJobOwner returns a context whose sends store their fax job for the
+// given owner. The ID of an owned job is derived from the owner instead of the
+// request, so the owner finds its job again even if the document it sends
+// changes, e.g. by a new cover page. An owned job is kept after it is sent,
+// the owner removes it once it has recorded the result, see RemoveFaxJob and
+// DiscardOwnedFaxJob.
+//
+// Parameters:
+//   - ctx: The parent context.
+//   - owner: The owner of the job, e.g. QUEUED_FAX_JOB_OWNER_PREFIX followed by the ID of the queued fax.
+//
+// Returns:
+//   - context.Context: The context carrying the owner.
+func WithFaxJobOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, faxJobOwnerKey{}, owner)
+}
+
+// faxJobOwner returns the owner of the fax job of a send, empty if the job has no owner.
+func faxJobOwner(ctx context.Context) string {
+	owner, _ := ctx.Value(faxJobOwnerKey{}).(string)
+	return owner
+}
+
+// ownedFaxJobID returns the ID of the fax job of an owner.
+func ownedFaxJobID(owner string) string {
+	ownerHash := sha256.Sum256([]byte(owner))
+	return hex.EncodeToString(ownerHash[:])[:FAX_JOB_ID_LENGTH]
+}
+
+// ownedFaxJobDiscarder is implemented by the calls that can discard the fax
+// job of an owner, see ApiServerDirectCalls.DiscardOwnedFaxJob.
+type ownedFaxJobDiscarder interface {
+	DiscardOwnedFaxJob(ctx context.Context, owner string) error
+}
+
+// discardOwnedFaxJob discards the fax job of an owner that gives its fax up,
+// so the job is never resumed. Without calls able to delete its ICT objects
+// the job is only removed.
+//
+// Parameters:
+//   - ctx: The context of the call.
+//   - calls: The calls the owner sends its faxes with.
+//   - owner: The owner of the job.
+func discardOwnedFaxJob(ctx context.Context, calls IApiUICalls, owner string) {
+	discarder, ok := calls.(ownedFaxJobDiscarder)
+	if !ok {
+		logIfError(RemoveFaxJob(ownedFaxJobID(owner)))
+		return
+	}
+
+	err := discarder.DiscardOwnedFaxJob(ctx, owner)
+	if err != nil {
+		logger.Inst().Error(fmt.Sprintf("error discarding the fax job of %s: %v", owner, err))
+	}
+}
+
+// newFaxJobHash creates the hash used to calculate the ID of a send request.
+// The ID is a hash of the request, so sending the same request again after a
+// failure finds and resumes the stored job instead of starting over. The
+// document is written to the hash after the request fields.
+//
+// Parameters:
+//   - contact: Contact information for the fax transmission.
+//   - document: Document information for the fax transmission.
+//   - transmission: Transmission information for the fax.
+//   - fileModel: Information about the document file content type.
+//
+// Returns:
+//   - hash.Hash: The hash with the request fields written.
+func newFaxJobHash(contact Contact, document DocumentRecord, transmission Transmission, fileModel SendFileInfo) hash.Hash {
+	jobHash := sha256.New()
+
+	request, _ := json.Marshal([]interface{}{contact, document, transmission, fileModel})
+	jobHash.Write(request)
+
+	return jobHash
+}
+
+// getFaxJobFilePath returns the path of a file of the job in the jobs directory.
+func getFaxJobFilePath(jobID string, extension string) (string, error) {
+	jobsPath, err := utilities.GetJobsPath()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(jobsPath, jobID+extension), nil
+}
+
+// CreateFaxJob loads the stored job of a send request or creates a new one.
+//
+// Parameters:
+//   - contact: Contact information for the fax transmission.
+//   - document: Document information for the fax transmission.
+//   - transmission: Transmission information for the fax.
+//   - fileContents: Contents of the document file.
+//   - fileModel: Information about the document file content type.
+//
+// Returns:
+//   - *FaxJob: The stored or created job.
+//   - error: An error if the job can not be stored.
+func CreateFaxJob(contact Contact, document DocumentRecord, transmission Transmission, fileContents []byte, fileModel SendFileInfo) (*FaxJob, error) {
+	return CreateFaxJobFromReader(contact, document, transmission, bytes.NewReader(fileContents), fileModel)
+}
+
+// CreateFaxJobFromReader loads the stored job of a send request or creates a
+// new one, streaming the document to the jobs directory.
+// Steps:
+// 1. Stream the document into a temporary file while hashing it with the request.
+// 2. If a job with the calculated ID is stored, drop the file and return the job with its checkpoint.
+// 3. Otherwise move the file to the document of the job and store the new job.
+//
+// Parameters:
+//   - contact: Contact information for the fax transmission.
+//   - document: Document information for the fax transmission.
+//   - transmission: Transmission information for the fax.
+//   - file: Reader of the document file, it is read to the end.
+//   - fileModel: Information about the document file content type.
+//
+// Returns:
+//   - *FaxJob: The stored or created job.
+//   - error: An error if the document can not be read or the job can not be stored.
+func CreateFaxJobFromReader(contact Contact, document DocumentRecord, transmission Transmission, file io.Reader, fileModel SendFileInfo) (*FaxJob, error) {
+	return createFaxJob("", contact, document, transmission, file, fileModel)
+}
+
+// createFaxJob loads the stored job of a send request or creates a new one,
+// see CreateFaxJobFromReader. The ID of the job of an owner is derived from
+// the owner, see WithFaxJobOwner.
+func createFaxJob(owner string, contact Contact, document DocumentRecord, transmission Transmission, file io.Reader, fileModel SendFileInfo) (*FaxJob, error) {
+	spoolFile, err := createSpoolFile()
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(spoolFile.Name())
+
+	jobHash := newFaxJobHash(contact, document, transmission, fileModel)
+
+	_, err = io.Copy(io.MultiWriter(spoolFile, jobHash), file)
+	closeErr := spoolFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	jobID := hex.EncodeToString(jobHash.Sum(nil))[:FAX_JOB_ID_LENGTH]
+	if owner != "" {
+		jobID = ownedFaxJobID(owner)
+	}
+
+	job, err := LoadFaxJob(jobID)
+	if err == nil {
+		return job, nil
+	}
+
+	now := time.Now()
+	job = &FaxJob{
+		ID:           jobID,
+		Owner:        owner,
+		Contact:      contact,
+		Document:     document,
+		Transmission: transmission,
+		FileModel:    fileModel,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	documentFilePath, err := getFaxJobFilePath(jobID, FAX_JOB_DOCUMENT_EXTENSION)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Rename(spoolFile.Name(), documentFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return job, SaveFaxJob(job)
+}
+
+// SaveFaxJob writes the job and its checkpoint to the jobs directory.
+//
+// Parameters:
+//   - job: The job to save.
+//
+// Returns:
+//   - error: An error if the job can not be written.
+func SaveFaxJob(job *FaxJob) error {
+	jobFilePath, err := getFaxJobFilePath(job.ID, FAX_JOB_FILE_EXTENSION)
+	if err != nil {
+		return err
+	}
+
+	job.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return utilities.WriteFileAtomic(jobFilePath, data, FAX_JOB_FILE_PERMISSION)
+}
+
+// LoadFaxJob reads a job from the jobs directory.
+//
+// Parameters:
+//   - jobID: The ID of the job.
+//
+// Returns:
+//   - *FaxJob: The loaded job.
+//   - error: An error if the job is not stored or can not be read.
+func LoadFaxJob(jobID string) (*FaxJob, error) {
+	jobFilePath, err := getFaxJobFilePath(jobID, FAX_JOB_FILE_EXTENSION)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(jobFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var job FaxJob
+	err = json.Unmarshal(data, &job)
+	if err != nil {
+		return nil, fmt.Errorf("the job file '%s' is corrupted: %v", jobFilePath, err)
+	}
+
+	return &job, nil
+}
+
+// FaxJobDocumentSource returns the source of the document stored with a job.
+//
+// Parameters:
+//   - jobID: The ID of the job.
+//
+// Returns:
+//   - DocumentSource: The source reading the document from the jobs directory.
+//   - error: An error if the jobs directory can not be found.
+func FaxJobDocumentSource(jobID string) (DocumentSource, error) {
+	documentFilePath, err := getFaxJobFilePath(jobID, FAX_JOB_DOCUMENT_EXTENSION)
+	if err != nil {
+		return nil, err
+	}
+
+	return FileDocumentSource(documentFilePath), nil
+}
+
+// RemoveFaxJob removes a finished job and its document from the jobs directory.
+//
+// Parameters:
+//   - jobID: The ID of the job.
+//
+// Returns:
+//   - error: An error if the files can not be removed.
+func RemoveFaxJob(jobID string) error {
+	for _, extension := range []string{FAX_JOB_FILE_EXTENSION, FAX_JOB_DOCUMENT_EXTENSION} {
+		filePath, err := getFaxJobFilePath(jobID, extension)
+		if err != nil {
+			return err
+		}
+
+		err = os.Remove(filePath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadUnfinishedFaxJobs reads all jobs stored in the jobs directory.
+// Jobs are removed once they finish, so every stored job is unfinished.
+//
+// Returns:
+//   - []*FaxJob: The stored jobs, corrupted job files are skipped.
+//   - error: An error if the jobs directory can not be read.
+func LoadUnfinishedFaxJobs() ([]*FaxJob, error) {
+	jobsPath, err := utilities.GetJobsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(jobsPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*FaxJob, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), FAX_JOB_FILE_EXTENSION) {
+			continue
+		}
+
+		job, err := LoadFaxJob(strings.TrimSuffix(entry.Name(), FAX_JOB_FILE_EXTENSION))
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// IsExpired checks if the job is older than FAX_JOB_MAX_AGE.
+func (j *FaxJob) IsExpired(now time.Time) bool {
+	return now.Sub(j.CreatedAt) > FAX_JOB_MAX_AGE
+}
+
+// lockFaxJob creates the lock file of a job, so only one process runs it even
+// if the daemon and the UI share the jobs directory. The lock is refreshed in
+// the background until the returned function releases it.
+//
+// Parameters:
+//   - jobID: The ID of the job.
+//
+// Returns:
+//   - func(): Releases the lock.
+//   - error: A conflict ApiError if the job is already running, or an error if the lock file can not be created.
+func lockFaxJob(jobID string) (func(), error) {
+	lockFilePath, err := getFaxJobFilePath(jobID, FAX_JOB_LOCK_EXTENSION)
+	if err != nil {
+		return nil, err
+	}
+
+	locked, err := utilities.CreateLockFile(lockFilePath, FAX_JOB_LOCK_LEASE)
+	if err != nil {
+		return nil, fmt.Errorf("error locking the fax job: %v", err)
+	}
+	if !locked {
+		return nil, NewApiError(ERROR_CODE_CONFLICT, fmt.Sprintf("the fax job %s is already running", jobID))
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(FAX_JOB_LOCK_REFRESH)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				logIfError(utilities.RefreshLockFile(lockFilePath))
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		logIfError(utilities.RemoveLockFile(lockFilePath))
+	}, nil
+}
+
+// rollbackFromCheckpoint creates a rollback of the ICT objects in a checkpoint.
+// A sent transmission can't be taken back, so nothing is deleted once the
+// checkpoint is sent.
+//
+// Parameters:
+//   - client: The ICT client used to delete the objects.
+//   - checkpoint: The checkpoint with the IDs created so far.
+//
+// Returns:
+//   - *ictRollback: The rollback tracking the created objects.
+func rollbackFromCheckpoint(client *ICTClient, checkpoint FaxJobCheckpoint) *ictRollback {
+	rollback := newICTRollback(client)
+	if checkpoint.Sent {
+		return rollback
+	}
+
+	if checkpoint.ContactID != 0 && !checkpoint.ContactReused {
+		rollback.track(ICT_CONTACT_WITH_ID_API_PATH, checkpoint.ContactID)
+	}
+	if checkpoint.DocumentID != 0 {
+		rollback.track(ICT_DOCUMENT_WITH_ID_API_PATH, checkpoint.DocumentID)
+	}
+	if checkpoint.ProgramID != 0 {
+		rollback.track(ICT_PROGRAM_WITH_ID_API_PATH, checkpoint.ProgramID)
+	}
+	if checkpoint.TransmissionID != 0 {
+		rollback.track(ICT_TRANSMISSION_WITH_ID_API_PATH, checkpoint.TransmissionID)
+	}
+
+	return rollback
+}
+
+// isInterruptedSend checks if the send step has been cancelled. The request
+// may have reached the ICT server, so the transmission may be going out and
+// must not be deleted, the job is resumed instead.
+//
+// Parameters:
+//   - err: The error of the failed step.
+//
+// Returns:
+//   - bool: True if the send step has been cancelled.
+func isInterruptedSend(err error) bool {
+	var ictErr *ICTError
+	return errors.As(err, &ictErr) && ictErr.Step == ICT_STEP_SEND && errors.Is(err, context.Canceled)
+}
+
+// isResumableICTError checks if a failed step can be resumed later.
+// Network failures, server errors and throttled requests are resumable.
+// Requests rejected by the ICT server, unreadable responses and the failures
+// of the application, e.g. a document that can't be read, are not.
+//
+// Parameters:
+//   - err: The error of the failed step.
+//
+// Returns:
+//   - bool: True if the job should be kept to resume it.
+func isResumableICTError(err error) bool {
+	var ictErr *ICTError
+	if !errors.As(err, &ictErr) {
+		return isTransportError(err)
+	}
+
+	switch ictErr.Code() {
+	case ERROR_CODE_ICT_UNREACHABLE, ERROR_CODE_ICT_SERVER_ERROR:
+		return true
+	}
+
+	return ictErr.StatusCode == http.StatusTooManyRequests || ictErr.StatusCode == http.StatusRequestTimeout
+}
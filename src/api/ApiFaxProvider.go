@@ -0,0 +1,216 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FaxProvider is a fax backend the application sends faxes through.
+// The ICT API is one implementation, other backends are added with
+// RegisterFaxProvider and selected with the fax_provider option of config.yaml.
+type FaxProvider interface {
+	// Authenticate authenticates against the backend, reusing a cached session if possible.
+	// Returns:
+	//   - *AuthResponse: The authenticated user.
+	//   - error: An error if the authentication fails.
+	Authenticate(ctx context.Context) (*AuthResponse, error)
+	// ListAccounts retrieves the accounts the user can send faxes from.
+	// Returns:
+	//   - []AccountResponse: The accounts of the user.
+	//   - error: An error if the request fails.
+	ListAccounts(ctx context.Context) ([]AccountResponse, error)
+	// SendDocument sends a document to one recipient.
+	// Returns:
+	//   - int: The ID of the sent transmission.
+	//   - error: An error if the fax can not be sent.
+	SendDocument(ctx context.Context, contact Contact, document DocumentRecord, transmission Transmission,
+		file io.Reader, fileModel SendFileInfo) (int, error)
+	// GetStatus retrieves the status of a sent transmission.
+	// Returns:
+	//   - *FaxStatus: The status of the transmission.
+	//   - error: An error if the request fails.
+	GetStatus(ctx context.Context, transmissionID int) (*FaxStatus, error)
+	// ListTransmissions retrieves the transmissions of the user.
+	// Returns:
+	//   - []FaxResponse: The transmissions of the user.
+	//   - error: An error if the request fails.
+	ListTransmissions(ctx context.Context) ([]FaxResponse, error)
+}
+
+// FaxBroadcaster is implemented by providers that can send one document to
+// many recipients more efficiently than sending it to each one.
+type FaxBroadcaster interface {
+	// BroadcastDocument sends a document to many recipients.
+	// Returns:
+	//   - []BroadcastResult: The result of each recipient, in the order of contacts.
+	//   - error: An error if no recipient can be sent.
+	BroadcastDocument(ctx context.Context, contacts []Contact, document DocumentRecord, transmission Transmission,
+		source DocumentSource, fileModel SendFileInfo) ([]BroadcastResult, error)
+}
+
+// FaxTransmissionQuerier is implemented by providers that can filter and
+// page the transmissions on the server, the others are queried on the client.
+type FaxTransmissionQuerier interface {
+	// QueryTransmissions retrieves one page of the transmissions matching a query.
+	// Returns:
+	//   - *TransmissionPage: The requested page, the newest first.
+	//   - error: An error if the request fails.
+	QueryTransmissions(ctx context.Context, query TransmissionQuery) (*TransmissionPage, error)
+}
+
+// FaxContactDirectory is implemented by providers storing contacts the
+// recipients of a fax can be picked from.
+type FaxContactDirectory interface {
+	// SearchContacts searches the stored contacts by phone number, name or email.
+	// Returns:
+	//   - []ContactResponse: At most limit matching contacts.
+	//   - error: An error if the request fails.
+	SearchContacts(ctx context.Context, text string, limit int) ([]ContactResponse, error)
+}
+
+// FaxJobRunner is implemented by providers that can resume the stored jobs
+// left unfinished by a previous run.
+type FaxJobRunner interface {
+	// RunFaxJob runs the send pipeline of a stored job.
+	// Returns:
+	//   - int: The ID of the sent transmission.
+	//   - error: An error if the job fails.
+	RunFaxJob(ctx context.Context, job *FaxJob) (int, error)
+
+	// DiscardFaxJob deletes the objects created for a stored job and removes it.
+	// Returns:
+	//   - error: An error if the job can not be removed.
+	DiscardFaxJob(ctx context.Context, job *FaxJob) error
+}
+
+// FaxProviderFactory creates a provider for the saved user data.
+type FaxProviderFactory func(userData UserData) (FaxProvider, error)
+
+var (
+	faxProvidersMutex sync.RWMutex
+	faxProviders      = map[string]FaxProviderFactory{
+		FAX_PROVIDER_ICT: newICTFaxProvider,
+	}
+)
+
+// RegisterFaxProvider adds a provider to the registry, replacing any provider
+// registered under the same name.
+//
+// Parameters:
+//   - name: The name used in the fax_provider option of config.yaml.
+//   - factory: Creates the provider for the saved user data.
+func RegisterFaxProvider(name string, factory FaxProviderFactory) {
+	faxProvidersMutex.Lock()
+	defer faxProvidersMutex.Unlock()
+
+	faxProviders[strings.ToLower(name)] = factory
+}
+
+// FaxProviderNames returns the names of the registered providers, sorted.
+//
+// Returns:
+//   - []string: The names of the providers.
+func FaxProviderNames() []string {
+	faxProvidersMutex.RLock()
+	defer faxProvidersMutex.RUnlock()
+
+	names := make([]string, 0, len(faxProviders))
+	for name := range faxProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewFaxProvider creates the registered provider with the given name.
+//
+// Parameters:
+//   - name: The name of the provider, case insensitive.
+//   - userData: User data containing the credentials and the hostname of the backend.
+//
+// Returns:
+//   - FaxProvider: The created provider.
+//   - error: An ApiError if no provider is registered with the name.
+func NewFaxProvider(name string, userData UserData) (FaxProvider, error) {
+	faxProvidersMutex.RLock()
+	factory, ok := faxProviders[strings.ToLower(name)]
+	faxProvidersMutex.RUnlock()
+
+	if !ok {
+		return nil, NewApiError(ERROR_CODE_PROVIDER_NOT_FOUND,
+			fmt.Sprintf("the fax provider '%s' is not registered, expected one of %s", name, strings.Join(FaxProviderNames(), ", ")))
+	}
+
+	return factory(userData)
+}
+
+// broadcastDocument sends a document to many recipients using the provider.
+// Providers implementing FaxBroadcaster broadcast on their own, the document
+// is sent to each recipient in turn otherwise.
+//
+// Parameters:
+//   - ctx: The context of the call, cancelling it stops the broadcast.
+//   - provider: The provider to send the document with.
+//   - contacts: The recipients of the fax.
+//   - document: Document information for the fax transmissions.
+//   - transmission: Transmission information shared by the recipients.
+//   - source: The source of the document file, opened again for every recipient.
+//   - fileModel: Information about the document file content type.
+//
+// Returns:
+//   - []BroadcastResult: The result of each recipient, in the order of contacts.
+//   - error: An error if the broadcast has no recipients.
+func broadcastDocument(ctx context.Context, provider FaxProvider, contacts []Contact, document DocumentRecord,
+	transmission Transmission, source DocumentSource, fileModel SendFileInfo) ([]BroadcastResult, error) {
+
+	// Each recipient gets its own cover page, so the document can't be shared.
+	if broadcaster, ok := provider.(FaxBroadcaster); ok && transmission.CoverPageTemplate == "" {
+		return broadcaster.BroadcastDocument(ctx, contacts, document, transmission, source, fileModel)
+	}
+
+	if len(contacts) == 0 {
+		return nil, NewApiError(ERROR_CODE_INVALID_REQUEST, "the broadcast has no recipients")
+	}
+
+	results := make([]BroadcastResult, 0, len(contacts))
+	for _, contact := range contacts {
+		if ctx.Err() != nil {
+			results = append(results, BroadcastResult{Phone: contact.Phone, Error: ToApiError(ctx.Err())})
+			continue
+		}
+
+		transmissionID, err := sendDocumentFromSource(ctx, provider, contact, document, transmission, source, fileModel)
+
+		result := BroadcastResult{
+			Phone:          contact.Phone,
+			TransmissionID: transmissionID,
+		}
+		if err != nil {
+			result.Error = ToApiError(err)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// sendDocumentFromSource opens the document source and sends it to one recipient.
+func sendDocumentFromSource(ctx context.Context, provider FaxProvider, contact Contact, document DocumentRecord,
+	transmission Transmission, source DocumentSource, fileModel SendFileInfo) (int, error) {
+
+	file, err := source()
+	if err != nil {
+		return 0, fmt.Errorf("error opening the document: %v", err)
+	}
+	defer file.Close()
+
+	reader, transmission, err := addCoverPage(ctx, provider, contact, transmission, file, fileModel)
+	if err != nil {
+		return 0, err
+	}
+	return provider.SendDocument(ctx, contact, document, transmission, reader, fileModel)
+}
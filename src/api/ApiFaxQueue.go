@@ -0,0 +1,443 @@
+package api
+
+import (
+	"context"
+	"faxsender/src/utilities/config"
+	"faxsender/src/utilities/logger"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Constants for the workers of the outbound queue.
+const (
+	FAX_QUEUE_POLL_INTERVAL  = 5 * time.Second
+	FAX_QUEUE_RETRY_DELAY    = time.Minute
+	FAX_QUEUE_MAX_ATTEMPTS   = 5
+	FAX_QUEUE_RETENTION      = 7 * 24 * time.Hour
+	FAX_QUEUE_WAKE_QUEUE_LEN = 1
+)
+
+// QUEUED_FAX_JOB_OWNER_PREFIX prefixes the ID of a queued fax to name the
+// owner of its fax job, see WithFaxJobOwner.
+const QUEUED_FAX_JOB_OWNER_PREFIX = "queue/"
+
+// FaxQueue sends the queued faxes with a pool of workers.
+// The queue is read from disk on every run, so faxes queued by another
+// process are picked up within the poll interval. The daemon and the UI may
+// both run a queue on the same working directory, a worker claims a fax
+// before sending it.
+// The progress of every fax is published as the events of its send job, the
+// delivery of a sent fax is followed in the background.
+type FaxQueue struct {
+	api      IApiUICalls
+	workers  int
+	interval time.Duration
+	wake     chan struct{}
+
+	inFlight      map[string]bool
+	inFlightMutex sync.Mutex
+
+	followers sync.WaitGroup
+}
+
+// NewFaxQueue creates a new FaxQueue.
+//
+// Parameters:
+//   - api: The API the queued faxes are sent with.
+//   - workers: The number of faxes sent in parallel, the configured number is used if zero.
+//   - interval: The maximum time between two reads of the queue, the default is used if zero.
+//
+// Returns:
+//   - *FaxQueue: The created queue.
+func NewFaxQueue(api IApiUICalls, workers int, interval time.Duration) *FaxQueue {
+	if interval <= 0 {
+		interval = FAX_QUEUE_POLL_INTERVAL
+	}
+
+	return &FaxQueue{
+		api:      api,
+		workers:  workers,
+		interval: interval,
+		wake:     make(chan struct{}, FAX_QUEUE_WAKE_QUEUE_LEN),
+		inFlight: make(map[string]bool),
+	}
+}
+
+// Wake makes the queue read the queued faxes again, e.g. after a fax has been queued.
+func (q *FaxQueue) Wake() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends the queued faxes until the context is cancelled.
+// Steps:
+// 1. Make the faxes left in the sending state by a previous run queued again.
+// 2. Discard the fax jobs of the faxes that have been sent or have failed.
+// 3. Remove the sent and failed faxes older than the retention time.
+// 4. Start the workers.
+// 5. Hand the due faxes to the workers, then wait until the next fax comes due,
+// the poll interval expires or the queue is woken.
+// 6. Wait for the workers and the delivery followers to finish once the context is cancelled.
+//
+// Parameters:
+//   - ctx: The context of the queue, cancelling it stops the workers.
+func (q *FaxQueue) Run(ctx context.Context) {
+	q.recoverInterrupted()
+	q.discardOrphanedFaxJobs(ctx)
+	logIfError(PruneQueuedFaxes(time.Now().Add(-FAX_QUEUE_RETENTION)))
+
+	workers := q.workers
+	if workers <= 0 {
+		workers = (*config.Inst()).GetQueueWorkers()
+	}
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx, jobs)
+		}()
+	}
+
+	logger.Inst().Info(fmt.Sprintf("the outbound queue started with %d workers", workers))
+
+	for {
+		nextDue := q.dispatch(ctx, jobs)
+
+		delay := q.interval
+		if !nextDue.IsZero() && time.Until(nextDue) < delay {
+			delay = time.Until(nextDue)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			close(jobs)
+			wg.Wait()
+			q.followers.Wait()
+			return
+		case <-q.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// recoverInterrupted makes the faxes a crashed run was sending queued again,
+// faxes claimed by a running process are left alone.
+// Their fax job is kept on failures, so sending them again resumes the job.
+func (q *FaxQueue) recoverInterrupted() {
+	queuedFaxesMutex.Lock()
+	defer queuedFaxesMutex.Unlock()
+
+	queuedFaxes, err := LoadQueuedFaxes()
+	if err != nil {
+		logger.Inst().Error(fmt.Sprintf("error loading the queued faxes: %v", err))
+		return
+	}
+
+	for _, queuedFax := range queuedFaxes {
+		if queuedFax.Status == QUEUED_FAX_STATUS_SENDING && !isQueuedFaxClaimed(queuedFax.ID) {
+			logger.Inst().Info(fmt.Sprintf("recovering the queued fax %s", queuedFax.ID))
+			queuedFax.Status = QUEUED_FAX_STATUS_QUEUED
+			logIfError(SaveQueuedFax(queuedFax))
+		}
+	}
+}
+
+// discardOrphanedFaxJobs discards the fax jobs whose queued fax no longer
+// needs them: a previous run was stopped after it finished the fax but before
+// it removed the job. The job of a sent fax has been sent, so it is only removed.
+//
+// Parameters:
+//   - ctx: The context of the queue.
+func (q *FaxQueue) discardOrphanedFaxJobs(ctx context.Context) {
+	jobs, err := LoadUnfinishedFaxJobs()
+	if err != nil {
+		logger.Inst().Error(fmt.Sprintf("error loading the fax jobs: %v", err))
+		return
+	}
+
+	for _, job := range jobs {
+		if !strings.HasPrefix(job.Owner, QUEUED_FAX_JOB_OWNER_PREFIX) {
+			continue
+		}
+
+		queuedFax, err := LoadQueuedFax(strings.TrimPrefix(job.Owner, QUEUED_FAX_JOB_OWNER_PREFIX))
+		if err == nil && !queuedFax.IsFinal() {
+			continue
+		}
+
+		logger.Inst().Info(fmt.Sprintf("discarding the fax job %s of %s", job.ID, job.Owner))
+		discardOwnedFaxJob(ctx, q.api, job.Owner)
+	}
+}
+
+// dispatch hands the due queued faxes to the workers, the oldest first.
+//
+// Parameters:
+//   - ctx: The context of the queue, cancelling it stops handing out faxes.
+//   - jobs: The channel the workers read the IDs of the faxes to send from.
+//
+// Returns:
+//   - time.Time: The time the next queued fax comes due, zero if there is none.
+func (q *FaxQueue) dispatch(ctx context.Context, jobs chan<- string) time.Time {
+	queuedFaxes, err := LoadQueuedFaxes()
+	if err != nil {
+		logger.Inst().Error(fmt.Sprintf("error loading the queued faxes: %v", err))
+		return time.Time{}
+	}
+
+	var nextDue time.Time
+	for _, queuedFax := range queuedFaxes {
+		if queuedFax.Status != QUEUED_FAX_STATUS_QUEUED {
+			continue
+		}
+
+		if queuedFax.NextAttemptAt.After(time.Now()) {
+			if nextDue.IsZero() || queuedFax.NextAttemptAt.Before(nextDue) {
+				nextDue = queuedFax.NextAttemptAt
+			}
+			continue
+		}
+
+		if !q.startFlight(queuedFax.ID) {
+			continue
+		}
+
+		select {
+		case jobs <- queuedFax.ID:
+		case <-ctx.Done():
+			q.endFlight(queuedFax.ID)
+			return nextDue
+		}
+	}
+
+	return nextDue
+}
+
+// work sends the faxes handed out by the dispatcher until the channel is closed.
+func (q *FaxQueue) work(ctx context.Context, jobs <-chan string) {
+	for queuedID := range jobs {
+		q.send(ctx, queuedID)
+		q.endFlight(queuedID)
+	}
+}
+
+// startFlight marks a fax as handed to a worker.
+//
+// Returns:
+//   - bool: False if a worker already has the fax.
+func (q *FaxQueue) startFlight(queuedID string) bool {
+	q.inFlightMutex.Lock()
+	defer q.inFlightMutex.Unlock()
+
+	if q.inFlight[queuedID] {
+		return false
+	}
+	q.inFlight[queuedID] = true
+	return true
+}
+
+// endFlight marks a fax as no longer handed to a worker.
+func (q *FaxQueue) endFlight(queuedID string) {
+	q.inFlightMutex.Lock()
+	defer q.inFlightMutex.Unlock()
+
+	delete(q.inFlight, queuedID)
+}
+
+// send sends one queued fax.
+// Steps:
+// 1. Claim the fax and mark it as sending, the claim is refreshed until the send ends.
+// 2. Send the fax with the stored document, the fax job of the send is owned by the queued fax.
+// 3. Mark the fax as sent with its transmission ID and remove the document,
+// then remove the job and follow the delivery of the fax.
+// 4. Retry it later if the failure is transient, keeping the job so the retry resumes it.
+// 5. Otherwise mark it as failed and discard its job, so the job is never resumed.
+// The steps of the send and its outcome are published as the events of the job.
+//
+// Parameters:
+//   - ctx: The context of the send, cancelling it makes the fax queued again.
+//   - queuedID: The ID of the queued fax.
+func (q *FaxQueue) send(ctx context.Context, queuedID string) {
+	claimed, err := ClaimQueuedFax(queuedID)
+	if err != nil {
+		logger.Inst().Error(fmt.Sprintf("error claiming the queued fax %s: %v", queuedID, err))
+		return
+	}
+	if !claimed {
+		return
+	}
+	defer func() {
+		logIfError(ReleaseQueuedFax(queuedID))
+	}()
+
+	queuedFax, ok := q.startSending(queuedID)
+	if !ok {
+		return
+	}
+
+	logger.Inst().Info(fmt.Sprintf("sending the queued fax %s", queuedID))
+
+	owner := QUEUED_FAX_JOB_OWNER_PREFIX + queuedID
+	sendCtx := WithSendProgress(WithFaxJobOwner(ctx, owner), func(step ICTStep) {
+		publishJobEvent(newJobStepEvent(queuedID, step))
+	})
+
+	stopRefresh := q.refreshClaim(queuedID)
+	transmissionID, err := q.sendDocument(sendCtx, queuedFax)
+	stopRefresh()
+
+	q.finishSending(ctx, queuedFax, transmissionID, err)
+
+	switch queuedFax.Status {
+	case QUEUED_FAX_STATUS_SENT:
+		// The job is kept until the fax is saved as sent, so a crash in
+		// between doesn't send the fax again.
+		logIfError(RemoveFaxJob(ownedFaxJobID(owner)))
+
+		q.followers.Add(1)
+		go func() {
+			defer q.followers.Done()
+			followJobDeliveryOnce(ctx, q.api, queuedID, transmissionID)
+		}()
+	case QUEUED_FAX_STATUS_FAILED:
+		discardOwnedFaxJob(ctx, q.api, owner)
+	}
+}
+
+// finishSending records the result of a send of a queued fax and publishes it.
+// A conflict means the job of the fax is run by another process, the fax is
+// retried later without counting the attempt.
+//
+// Parameters:
+//   - ctx: The context of the send.
+//   - queuedFax: The sent fax, its status is updated.
+//   - transmissionID: The ID of the sent transmission.
+//   - err: The error of the send, nil if it has been sent.
+func (q *FaxQueue) finishSending(ctx context.Context, queuedFax *QueuedFax, transmissionID int, err error) {
+	queuedFaxesMutex.Lock()
+	defer queuedFaxesMutex.Unlock()
+
+	queuedID := queuedFax.ID
+	if err == nil {
+		logger.Inst().Info(fmt.Sprintf("the queued fax %s has been sent as transmission %d", queuedID, transmissionID))
+		queuedFax.Status = QUEUED_FAX_STATUS_SENT
+		queuedFax.TransmissionID = transmissionID
+		queuedFax.LastError = ""
+		logIfError(SaveQueuedFax(queuedFax))
+		logIfError(RemoveQueuedFaxDocument(queuedID))
+
+		publishJobEvent(newJobSentEvent(queuedID, transmissionID))
+		return
+	}
+
+	queuedFax.Status = QUEUED_FAX_STATUS_QUEUED
+	queuedFax.LastError = err.Error()
+
+	switch {
+	case ctx.Err() != nil:
+		queuedFax.Attempts--
+	case ToApiError(err).Code == ERROR_CODE_CONFLICT:
+		queuedFax.Attempts--
+		queuedFax.NextAttemptAt = time.Now().Add(FAX_QUEUE_RETRY_DELAY)
+		logger.Inst().Info(fmt.Sprintf("the job of the queued fax %s is running, retrying at %v", queuedID, queuedFax.NextAttemptAt))
+	case isTransientSendError(err) && queuedFax.Attempts < FAX_QUEUE_MAX_ATTEMPTS:
+		queuedFax.NextAttemptAt = time.Now().Add(FAX_QUEUE_RETRY_DELAY)
+		logger.Inst().Error(fmt.Sprintf("the queued fax %s failed, retrying at %v: %v", queuedID, queuedFax.NextAttemptAt, err))
+		publishJobEvent(JobEvent{
+			JobID:   queuedID,
+			Type:    JOB_EVENT_RETRYING,
+			Message: fmt.Sprintf("the send failed, it is retried at %s", queuedFax.NextAttemptAt.Format(time.RFC3339)),
+			Error:   err.Error(),
+		})
+	default:
+		queuedFax.Status = QUEUED_FAX_STATUS_FAILED
+		logger.Inst().Error(fmt.Sprintf("the queued fax %s failed: %v", queuedID, err))
+		publishJobEvent(newJobFailedEvent(queuedID, err.Error()))
+	}
+
+	logIfError(SaveQueuedFax(queuedFax))
+
+	if queuedFax.Status == QUEUED_FAX_STATUS_FAILED {
+		logIfError(RemoveQueuedFaxDocument(queuedID))
+	}
+}
+
+// refreshClaim refreshes the claim of a fax in the background until the returned function is called.
+func (q *FaxQueue) refreshClaim(queuedID string) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(QUEUED_FAX_CLAIM_REFRESH)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				logIfError(RefreshQueuedFaxClaim(queuedID))
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// startSending marks a due fax as sending.
+//
+// Parameters:
+//   - queuedID: The ID of the queued fax.
+//
+// Returns:
+//   - *QueuedFax: The queued fax.
+//   - bool: False if the fax is no longer queued.
+func (q *FaxQueue) startSending(queuedID string) (*QueuedFax, bool) {
+	queuedFaxesMutex.Lock()
+	defer queuedFaxesMutex.Unlock()
+
+	queuedFax, err := LoadQueuedFax(queuedID)
+	if err != nil || queuedFax.Status != QUEUED_FAX_STATUS_QUEUED {
+		return nil, false
+	}
+
+	queuedFax.Status = QUEUED_FAX_STATUS_SENDING
+	queuedFax.Attempts++
+	if err := SaveQueuedFax(queuedFax); err != nil {
+		logger.Inst().Error(fmt.Sprintf("error saving the queued fax %s: %v", queuedID, err))
+		return nil, false
+	}
+
+	return queuedFax, true
+}
+
+// sendDocument sends a queued fax with its stored document.
+func (q *FaxQueue) sendDocument(ctx context.Context, queuedFax *QueuedFax) (int, error) {
+	source, err := QueuedFaxDocumentSource(queuedFax.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := source()
+	if err != nil {
+		return 0, fmt.Errorf("error opening the document of the queued fax: %v", err)
+	}
+	defer file.Close()
+
+	return q.api.SendFaxReader(ctx, queuedFax.Contact, queuedFax.Document, queuedFax.Transmission, file, queuedFax.FileModel)
+}
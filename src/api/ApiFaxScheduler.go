@@ -0,0 +1,349 @@
+package api
+
+import (
+	"context"
+	"faxsender/src/utilities/logger"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Constants for the scheduler of the scheduled faxes.
+const (
+	FAX_SCHEDULER_POLL_INTERVAL  = 30 * time.Second
+	SCHEDULED_FAX_RETRY_DELAY    = 5 * time.Minute
+	SCHEDULED_FAX_MAX_ATTEMPTS   = 5
+	FAX_SCHEDULER_WAKE_QUEUE_LEN = 1
+)
+
+// SCHEDULED_FAX_JOB_OWNER_PREFIX prefixes the ID of a scheduled fax to name
+// the owner of its fax job, see WithFaxJobOwner.
+const SCHEDULED_FAX_JOB_OWNER_PREFIX = "scheduled/"
+
+// FaxScheduler sends the scheduled faxes when they come due.
+// The scheduled faxes are read from disk on every run, so faxes scheduled by
+// another process are picked up within the poll interval. The events of a
+// send are published to the job of the scheduled fax, see JobEvent.
+type FaxScheduler struct {
+	api      IApiUICalls
+	interval time.Duration
+	wake     chan struct{}
+
+	followers sync.WaitGroup
+}
+
+// NewFaxScheduler creates a new FaxScheduler.
+//
+// Parameters:
+//   - api: The API the due faxes are sent with.
+//   - interval: The maximum time between two runs, the default is used if zero.
+//
+// Returns:
+//   - *FaxScheduler: The created scheduler.
+func NewFaxScheduler(api IApiUICalls, interval time.Duration) *FaxScheduler {
+	if interval <= 0 {
+		interval = FAX_SCHEDULER_POLL_INTERVAL
+	}
+
+	return &FaxScheduler{
+		api:      api,
+		interval: interval,
+		wake:     make(chan struct{}, FAX_SCHEDULER_WAKE_QUEUE_LEN),
+	}
+}
+
+// Wake makes the scheduler run again, e.g. after a fax has been scheduled or rescheduled.
+func (s *FaxScheduler) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends the scheduled faxes when they come due until the context is cancelled.
+// Steps:
+// 1. Make the faxes left in the sending state by a previous run pending again.
+// 2. Discard the fax jobs of the faxes that have been sent, failed or cancelled.
+// 3. Send the due faxes.
+// 4. Wait until the next fax comes due, the poll interval expires or the scheduler is woken.
+// 5. Wait for the delivery followers to finish once the context is cancelled.
+//
+// Parameters:
+//   - ctx: The context of the scheduler, cancelling it stops the scheduler.
+func (s *FaxScheduler) Run(ctx context.Context) {
+	s.recoverInterrupted()
+	s.discardOrphanedFaxJobs(ctx)
+
+	for {
+		nextDue := s.RunDue(ctx, time.Now())
+
+		delay := s.interval
+		if !nextDue.IsZero() && time.Until(nextDue) < delay {
+			delay = time.Until(nextDue)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.followers.Wait()
+			return
+		case <-s.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// recoverInterrupted makes the faxes a previous run was sending pending again.
+// Their fax job is kept on failures, so sending them again resumes the job.
+func (s *FaxScheduler) recoverInterrupted() {
+	scheduledFaxesMutex.Lock()
+	defer scheduledFaxesMutex.Unlock()
+
+	scheduledFaxes, err := LoadScheduledFaxes()
+	if err != nil {
+		logger.Inst().Error(fmt.Sprintf("error loading the scheduled faxes: %v", err))
+		return
+	}
+
+	for _, scheduledFax := range scheduledFaxes {
+		if scheduledFax.Status == SCHEDULED_FAX_STATUS_SENDING {
+			scheduledFax.Status = SCHEDULED_FAX_STATUS_PENDING
+			logIfError(SaveScheduledFax(scheduledFax))
+		}
+	}
+}
+
+// discardOrphanedFaxJobs discards the fax jobs whose scheduled fax no longer
+// needs them: a previous run was stopped after it finished the fax but before
+// it removed the job, or the fax has been cancelled.
+//
+// Parameters:
+//   - ctx: The context of the scheduler.
+func (s *FaxScheduler) discardOrphanedFaxJobs(ctx context.Context) {
+	jobs, err := LoadUnfinishedFaxJobs()
+	if err != nil {
+		logger.Inst().Error(fmt.Sprintf("error loading the fax jobs: %v", err))
+		return
+	}
+
+	for _, job := range jobs {
+		if !strings.HasPrefix(job.Owner, SCHEDULED_FAX_JOB_OWNER_PREFIX) {
+			continue
+		}
+
+		scheduledFax, err := LoadScheduledFax(strings.TrimPrefix(job.Owner, SCHEDULED_FAX_JOB_OWNER_PREFIX))
+		if err == nil && scheduledFax.Status != SCHEDULED_FAX_STATUS_FAILED {
+			continue
+		}
+
+		logger.Inst().Info(fmt.Sprintf("discarding the fax job %s of %s", job.ID, job.Owner))
+		discardOwnedFaxJob(ctx, s.api, job.Owner)
+	}
+}
+
+// RunDue sends the pending faxes due at the given time, one after the other.
+//
+// Parameters:
+//   - ctx: The context of the run, cancelling it stops sending.
+//   - now: The time the due faxes are compared to.
+//
+// Returns:
+//   - time.Time: The send time of the next pending fax, zero if there is none.
+func (s *FaxScheduler) RunDue(ctx context.Context, now time.Time) time.Time {
+	scheduledFaxes, err := LoadScheduledFaxes()
+	if err != nil {
+		logger.Inst().Error(fmt.Sprintf("error loading the scheduled faxes: %v", err))
+		return time.Time{}
+	}
+
+	var nextDue time.Time
+	for _, scheduledFax := range scheduledFaxes {
+		if scheduledFax.Status != SCHEDULED_FAX_STATUS_PENDING {
+			continue
+		}
+
+		if scheduledFax.SendAt.After(now) {
+			if nextDue.IsZero() || scheduledFax.SendAt.Before(nextDue) {
+				nextDue = scheduledFax.SendAt
+			}
+			continue
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		retryAt := s.send(ctx, scheduledFax.ID)
+		if !retryAt.IsZero() && (nextDue.IsZero() || retryAt.Before(nextDue)) {
+			nextDue = retryAt
+		}
+	}
+
+	return nextDue
+}
+
+// send sends one due fax.
+// Steps:
+// 1. Mark the fax as sending, unless it has been rescheduled or cancelled meanwhile.
+// 2. Send the fax with the stored document, the fax job of the send is owned by the scheduled fax.
+// 3. Remove the fax and then its job when it has been sent, and follow its delivery.
+// 4. Retry it later if the failure is transient, keeping the job so the retry resumes it.
+// 5. Otherwise mark it as failed and discard its job, so the job is never resumed.
+// The steps and the result of the send are published as events of the job of the fax.
+//
+// Parameters:
+//   - ctx: The context of the send, cancelling it makes the fax pending again.
+//   - scheduledID: The ID of the scheduled fax.
+//
+// Returns:
+//   - time.Time: The time the fax is retried at, zero if it is not retried.
+func (s *FaxScheduler) send(ctx context.Context, scheduledID string) time.Time {
+	scheduledFax, ok := s.startSending(scheduledID)
+	if !ok {
+		return time.Time{}
+	}
+
+	logger.Inst().Info(fmt.Sprintf("sending the scheduled fax %s", scheduledID))
+
+	owner := SCHEDULED_FAX_JOB_OWNER_PREFIX + scheduledID
+	sendCtx := WithSendProgress(WithFaxJobOwner(ctx, owner), func(step ICTStep) {
+		publishJobEvent(newJobStepEvent(scheduledID, step))
+	})
+
+	transmissionID, err := s.sendDocument(sendCtx, scheduledFax)
+	retryAt := s.finishSending(ctx, scheduledFax, transmissionID, err)
+
+	switch {
+	case err == nil:
+		logIfError(RemoveFaxJob(ownedFaxJobID(owner)))
+
+		s.followers.Add(1)
+		go func() {
+			defer s.followers.Done()
+			followJobDeliveryOnce(ctx, s.api, scheduledID, transmissionID)
+		}()
+	case scheduledFax.Status == SCHEDULED_FAX_STATUS_FAILED:
+		discardOwnedFaxJob(ctx, s.api, owner)
+	}
+
+	return retryAt
+}
+
+// finishSending records the result of a send of a scheduled fax and publishes it.
+//
+// Parameters:
+//   - ctx: The context of the send.
+//   - scheduledFax: The sent fax, its status is updated.
+//   - transmissionID: The ID of the sent transmission.
+//   - err: The error of the send, nil if it has been sent.
+//
+// Returns:
+//   - time.Time: The time the fax is retried at, zero if it is not retried.
+func (s *FaxScheduler) finishSending(ctx context.Context, scheduledFax *ScheduledFax, transmissionID int, err error) time.Time {
+	scheduledFaxesMutex.Lock()
+	defer scheduledFaxesMutex.Unlock()
+
+	scheduledID := scheduledFax.ID
+	if err == nil {
+		logger.Inst().Info(fmt.Sprintf("the scheduled fax %s has been sent as transmission %d", scheduledID, transmissionID))
+		logIfError(RemoveScheduledFax(scheduledID))
+
+		publishJobEvent(newJobSentEvent(scheduledID, transmissionID))
+		return time.Time{}
+	}
+
+	scheduledFax.Status = SCHEDULED_FAX_STATUS_PENDING
+	scheduledFax.LastError = err.Error()
+
+	switch {
+	case ctx.Err() != nil:
+		scheduledFax.Attempts--
+	case isTransientSendError(err) && scheduledFax.Attempts < SCHEDULED_FAX_MAX_ATTEMPTS:
+		scheduledFax.SendAt = time.Now().Add(SCHEDULED_FAX_RETRY_DELAY)
+		logger.Inst().Error(fmt.Sprintf("the scheduled fax %s failed, retrying at %v: %v", scheduledID, scheduledFax.SendAt, err))
+		publishJobEvent(JobEvent{
+			JobID:   scheduledID,
+			Type:    JOB_EVENT_RETRYING,
+			Message: fmt.Sprintf("the send failed, it is retried at %s", scheduledFax.SendAt.Format(time.RFC3339)),
+			Error:   err.Error(),
+		})
+	default:
+		scheduledFax.Status = SCHEDULED_FAX_STATUS_FAILED
+		logger.Inst().Error(fmt.Sprintf("the scheduled fax %s failed: %v", scheduledID, err))
+		publishJobEvent(newJobFailedEvent(scheduledID, err.Error()))
+	}
+
+	logIfError(SaveScheduledFax(scheduledFax))
+
+	if scheduledFax.Status != SCHEDULED_FAX_STATUS_PENDING {
+		return time.Time{}
+	}
+	return scheduledFax.SendAt
+}
+
+// startSending marks a due fax as sending.
+//
+// Parameters:
+//   - scheduledID: The ID of the scheduled fax.
+//
+// Returns:
+//   - *ScheduledFax: The scheduled fax.
+//   - bool: False if the fax is no longer pending and due.
+func (s *FaxScheduler) startSending(scheduledID string) (*ScheduledFax, bool) {
+	scheduledFaxesMutex.Lock()
+	defer scheduledFaxesMutex.Unlock()
+
+	scheduledFax, err := LoadScheduledFax(scheduledID)
+	if err != nil || scheduledFax.Status != SCHEDULED_FAX_STATUS_PENDING || scheduledFax.SendAt.After(time.Now()) {
+		return nil, false
+	}
+
+	scheduledFax.Status = SCHEDULED_FAX_STATUS_SENDING
+	scheduledFax.Attempts++
+	if err := SaveScheduledFax(scheduledFax); err != nil {
+		logger.Inst().Error(fmt.Sprintf("error saving the scheduled fax %s: %v", scheduledID, err))
+		return nil, false
+	}
+
+	return scheduledFax, true
+}
+
+// sendDocument sends a scheduled fax with its stored document.
+func (s *FaxScheduler) sendDocument(ctx context.Context, scheduledFax *ScheduledFax) (int, error) {
+	source, err := ScheduledFaxDocumentSource(scheduledFax.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := source()
+	if err != nil {
+		return 0, fmt.Errorf("error opening the document of the scheduled fax: %v", err)
+	}
+	defer file.Close()
+
+	return s.api.SendFaxReader(ctx, scheduledFax.Contact, scheduledFax.Document, scheduledFax.Transmission, file, scheduledFax.FileModel)
+}
+
+// isTransientSendError checks if a failed scheduled or queued fax should be retried later.
+// Unreachable or failing servers, failed authentications and missing settings
+// may be fixed meanwhile, requests rejected by the server are not retried.
+//
+// Parameters:
+//   - err: The error of the failed send.
+//
+// Returns:
+//   - bool: True if the fax should be retried.
+func isTransientSendError(err error) bool {
+	apiErr := ToApiError(err)
+
+	switch apiErr.Code {
+	case ERROR_CODE_ICT_UNREACHABLE, ERROR_CODE_ICT_SERVER_ERROR, ERROR_CODE_AUTHENTICATION_FAILED, ERROR_CODE_SETTINGS_NOT_FOUND:
+		return true
+	}
+
+	return apiErr.ICTStatus == http.StatusTooManyRequests || apiErr.ICTStatus == http.StatusRequestTimeout
+}
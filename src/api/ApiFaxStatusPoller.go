@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Constants for the default polling of the transmission status.
+const (
+	FAX_STATUS_POLL_INTERVAL = 10 * time.Second
+	FAX_STATUS_POLL_TIMEOUT  = 30 * time.Minute
+	QUEUED_FAX_POLL_INTERVAL = 2 * time.Second
+)
+
+// FaxStatusPoller follows a transmission or a queued fax until it reaches a final state.
+type FaxStatusPoller struct {
+	api      IApiUICalls
+	interval time.Duration
+	timeout  time.Duration
+}
+
+// NewFaxStatusPoller creates a new FaxStatusPoller.
+//
+// Parameters:
+//   - api: The API used to fetch the status of the transmission.
+//   - interval: The time between two status requests, the default is used if zero.
+//   - timeout: The time after which polling stops, the default is used if zero.
+//
+// Returns:
+//   - *FaxStatusPoller: The created poller.
+func NewFaxStatusPoller(api IApiUICalls, interval time.Duration, timeout time.Duration) *FaxStatusPoller {
+	if interval <= 0 {
+		interval = FAX_STATUS_POLL_INTERVAL
+	}
+	if timeout <= 0 {
+		timeout = FAX_STATUS_POLL_TIMEOUT
+	}
+
+	return &FaxStatusPoller{
+		api:      api,
+		interval: interval,
+		timeout:  timeout,
+	}
+}
+
+// Follow polls the status of a transmission until it reaches a final state.
+// Steps:
+// 1. Fetch the status of the transmission.
+// 2. Call onChange whenever the status differs from the previous one.
+// 3. Return when the status is final, the timeout expires or the context is cancelled.
+//
+// Parameters:
+//   - ctx: The context of the polling, cancelling it stops the polling.
+//   - transmissionID: The ID of the transmission to follow.
+//   - onChange: Called with every new status, it may be nil.
+//
+// Returns:
+//   - *FaxStatus: The last fetched status.
+//   - error: An error if fetching the status fails, the timeout expires or the context is cancelled.
+func (p *FaxStatusPoller) Follow(ctx context.Context, transmissionID int, onChange func(FaxStatus)) (*FaxStatus, error) {
+	deadline := time.Now().Add(p.timeout)
+
+	var lastStatus *FaxStatus
+	for {
+		faxStatus, err := p.api.GetFaxStatus(ctx, transmissionID)
+		if err != nil {
+			return lastStatus, err
+		}
+
+		if onChange != nil && (lastStatus == nil || lastStatus.Status != faxStatus.Status) {
+			onChange(*faxStatus)
+		}
+		lastStatus = faxStatus
+
+		if faxStatus.IsFinal {
+			return faxStatus, nil
+		}
+
+		if time.Now().Add(p.interval).After(deadline) {
+			return faxStatus, fmt.Errorf("the transmission %d did not reach a final state in %v", transmissionID, p.timeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return faxStatus, ctx.Err()
+		case <-time.After(p.interval):
+		}
+	}
+}
+
+// FollowQueuedFax polls the state of a queued fax until it has been sent or has failed.
+// Steps:
+// 1. Fetch the queued fax.
+// 2. Call onChange whenever its state differs from the previous one.
+// 3. Return when the state is final, the timeout expires or the context is cancelled.
+//
+// Parameters:
+//   - ctx: The context of the polling, cancelling it stops the polling.
+//   - queuedID: The job ID of the queued fax to follow.
+//   - onChange: Called with every new state, it may be nil.
+//
+// Returns:
+//   - *QueuedFax: The last fetched queued fax.
+//   - error: An error if fetching the queued fax fails, the timeout expires or the context is cancelled.
+func (p *FaxStatusPoller) FollowQueuedFax(ctx context.Context, queuedID string, onChange func(QueuedFax)) (*QueuedFax, error) {
+	deadline := time.Now().Add(p.timeout)
+
+	var lastQueuedFax *QueuedFax
+	for {
+		queuedFax, err := p.api.GetQueuedFax(ctx, queuedID)
+		if err != nil {
+			return lastQueuedFax, err
+		}
+
+		if onChange != nil && (lastQueuedFax == nil || lastQueuedFax.Status != queuedFax.Status) {
+			onChange(*queuedFax)
+		}
+		lastQueuedFax = queuedFax
+
+		if queuedFax.IsFinal() {
+			return queuedFax, nil
+		}
+
+		if time.Now().Add(p.interval).After(deadline) {
+			return queuedFax, fmt.Errorf("the queued fax %s was not sent in %v", queuedID, p.timeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return queuedFax, ctx.Err()
+		case <-time.After(p.interval):
+		}
+	}
+}
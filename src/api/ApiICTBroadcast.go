@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"errors"
+)
+
+// BroadcastResult represents the result of a broadcast for one recipient.
+type BroadcastResult struct {
+	Phone          string    `json:"phone"`
+	TransmissionID int       `json:"transmission_id,omitempty"`
+	Error          *ApiError `json:"error,omitempty"`
+}
+
+// BroadcastFaxICT sends one document to many recipients using the ICT API.
+// The document is created and uploaded once, and shared by the transmissions.
+// Steps:
+// 1. Check the account ID, then create a Document Record, upload the document file and create a Program.
+// 2. For each recipient create a Contact and a Transmission, and send it.
+// 3. If a recipient fails, delete the objects created for it and continue.
+// 4. If the broadcast is cancelled, the remaining recipients are reported as cancelled.
+// 5. If no recipient succeeds, delete the shared Document Record and Program too.
+//
+// Parameters:
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
+//   - contacts: The recipients of the fax.
+//   - document: Document information for the fax transmissions.
+//   - transmission: Transmission information, including AccountID, shared by the recipients.
+//   - source: The source of the document file to be uploaded.
+//   - fileModel: Information about the document file content type.
+//
+// Returns:
+//   - []BroadcastResult: The result of each recipient, in the order of contacts.
+//   - error: An ICTError if a shared step fails, the recipients are not sent then.
+func (c *ICTClient) BroadcastFaxICT(ctx context.Context, contacts []Contact, document DocumentRecord,
+	transmission Transmission, source DocumentSource, fileModel SendFileInfo) ([]BroadcastResult, error) {
+
+	if len(contacts) == 0 {
+		return nil, NewApiError(ERROR_CODE_INVALID_REQUEST, "the broadcast has no recipients")
+	}
+
+	accountID, err := parseAccountID(transmission.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	shared := newICTRollback(c)
+
+	// Step 1: Create Document Record
+	documentID, err := c.CreateDocumentRecord(ctx, document)
+	if err != nil {
+		return nil, err
+	}
+	shared.track(ICT_DOCUMENT_WITH_ID_API_PATH, documentID)
+
+	// Step 2: Upload Document File
+	err = c.UploadDocumentFile(ctx, documentID, source, fileModel.ContentType)
+	if err != nil {
+		return nil, shared.run(err)
+	}
+
+	// Step 3: Create Program
+	programID, err := c.CreateProgram(ctx, documentID)
+	if err != nil {
+		return nil, shared.run(err)
+	}
+	shared.track(ICT_PROGRAM_WITH_ID_API_PATH, programID)
+
+	results := make([]BroadcastResult, 0, len(contacts))
+	sentCount := 0
+	for _, contact := range contacts {
+		if ctx.Err() != nil {
+			results = append(results, BroadcastResult{Phone: contact.Phone, Error: ToApiError(ctx.Err())})
+			continue
+		}
+
+		transmissionID, err := c.sendToRecipient(ctx, contact, transmission, accountID, programID)
+
+		result := BroadcastResult{
+			Phone:          contact.Phone,
+			TransmissionID: transmissionID,
+		}
+		if err != nil {
+			result.Error = ToApiError(err)
+		} else {
+			sentCount++
+		}
+		results = append(results, result)
+	}
+
+	if sentCount == 0 {
+		shared.run(errors.New("no recipient of the broadcast has been sent"))
+	}
+
+	return results, nil
+}
+
+// sendToRecipient reuses or creates the Contact of one recipient of a
+// broadcast, creates its Transmission and sends it. The created objects are
+// deleted if a step fails, a reused contact is kept.
+//
+// Parameters:
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
+//   - contact: The recipient.
+//   - transmission: Transmission information shared by the recipients.
+//   - accountID: The ID of the associated account.
+//   - programID: The ID of the shared program.
+//
+// Returns:
+//   - int: The ID of the sent transmission.
+//   - error: An ICTError if any step fails.
+func (c *ICTClient) sendToRecipient(ctx context.Context, contact Contact, transmission Transmission, accountID, programID int) (int, error) {
+	rollback := newICTRollback(c)
+
+	contactID, created, err := c.findOrCreateContact(ctx, contact)
+	if err != nil {
+		return 0, err
+	}
+	if created {
+		rollback.track(ICT_CONTACT_WITH_ID_API_PATH, contactID)
+	}
+
+	transmissionID, err := c.CreateTransmission(ctx, transmission, contactID, accountID, programID)
+	if err != nil {
+		return 0, rollback.run(err)
+	}
+	rollback.track(ICT_TRANSMISSION_WITH_ID_API_PATH, transmissionID)
+
+	err = c.SendTransmission(ctx, transmissionID)
+	if err != nil {
+		return 0, rollback.run(err)
+	}
+
+	return transmissionID, nil
+}
@@ -0,0 +1,343 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Constants controlling the lifetime of the cached ICT bearer token.
+const (
+	ICT_TOKEN_DEFAULT_LIFETIME = 30 * time.Minute
+	ICT_TOKEN_EXPIRY_MARGIN    = 30 * time.Second
+	ICT_REQUEST_TIMEOUT        = 10 * time.Second
+)
+
+// ICTClient is a reusable client for the ICT API.
+// It holds the user data, one shared http.Client and a cached bearer token,
+// and re-authenticates on its own when the token expires or a call returns 401.
+// Transient failures are retried following its retry policy.
+type ICTClient struct {
+	userData    UserData
+	httpClient  *http.Client
+	retryPolicy RetryPolicy
+
+	mutex        sync.Mutex
+	authResponse *AuthResponse
+	tokenExpiry  time.Time
+}
+
+// NewICTClient creates a new ICTClient for the given user data.
+//
+// Parameters:
+//   - userData: User data containing the credentials and the ICT hostname.
+//
+// Returns:
+//   - *ICTClient: The created client, without any cached token, using the default retry policy.
+func NewICTClient(userData UserData) *ICTClient {
+	return &ICTClient{
+		userData: userData,
+		httpClient: &http.Client{
+			Timeout: ICT_REQUEST_TIMEOUT,
+		},
+		retryPolicy: DefaultRetryPolicy(),
+	}
+}
+
+// SetRetryPolicy replaces the retry policy of the client.
+//
+// Parameters:
+//   - policy: The new retry policy.
+func (c *ICTClient) SetRetryPolicy(policy RetryPolicy) {
+	c.retryPolicy = policy
+}
+
+// GetUserData returns the user data the client was created with.
+func (c *ICTClient) GetUserData() UserData {
+	return c.userData
+}
+
+// buildRequestURL constructs the complete URL for an ICT API endpoint.
+//
+// Parameters:
+//   - uriPath: URI path for the API endpoint.
+//
+// Returns:
+//   - string: The constructed URL.
+func (c *ICTClient) buildRequestURL(uriPath string) string {
+	return buildICTReqeustURL(&c.userData, uriPath)
+}
+
+// GetAuthResponse returns the cached authentication response, authenticating
+// against the ICT API first if there is no valid token.
+//
+// Parameters:
+//   - ctx: The context of the call, it cancels the authentication request.
+//
+// Returns:
+//   - *AuthResponse: The cached authentication response.
+//   - error: An error if the authentication fails.
+func (c *ICTClient) GetAuthResponse(ctx context.Context) (*AuthResponse, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.authResponse != nil && time.Now().Before(c.tokenExpiry) {
+		return c.authResponse, nil
+	}
+
+	return c.authenticateLocked(ctx)
+}
+
+// InvalidateToken drops the cached token so the next call authenticates again.
+func (c *ICTClient) InvalidateToken() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.authResponse = nil
+	c.tokenExpiry = time.Time{}
+}
+
+// getToken returns a valid bearer token, authenticating if required.
+func (c *ICTClient) getToken(ctx context.Context) (string, error) {
+	authResponse, err := c.GetAuthResponse(ctx)
+	if err != nil {
+		return "", err
+	}
+	return authResponse.Token, nil
+}
+
+// authenticateLocked authenticates against the ICT API and caches the token.
+// The caller must hold c.mutex.
+func (c *ICTClient) authenticateLocked(ctx context.Context) (*AuthResponse, error) {
+	authResponse, err := c.AuthenticateICT(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.authResponse = authResponse
+	c.tokenExpiry = calculateTokenExpiry(authResponse.Token, time.Now())
+	return authResponse, nil
+}
+
+// doAuthenticated makes an authenticated request to the ICT API.
+// Steps:
+// 1. Get a valid bearer token from the cache or authenticate.
+// 2. Build and send the request with the bearer token.
+// 3. If the response is 401, drop the token, authenticate again and retry once.
+// 4. Retry transient failures with backoff; only idempotent methods are retried
+// when the ICT server may have processed the request.
+//
+// Parameters:
+//   - ctx: The context of the call, it cancels the request.
+//   - method: The HTTP method of the request.
+//   - uriPath: URI path for the API endpoint.
+//   - contentType: Content type of the request body.
+//   - body: The request body, it is sent again on retry.
+//
+// Returns:
+//   - *http.Response: The HTTP response.
+//   - error: An error if the request fails.
+func (c *ICTClient) doAuthenticated(ctx context.Context, method, uriPath, contentType string, body []byte) (*http.Response, error) {
+	return c.doAuthenticatedStream(ctx, method, uriPath, contentType, func() (io.Reader, error) {
+		return bytes.NewReader(body), nil
+	})
+}
+
+// doAuthenticatedStream makes an authenticated request to the ICT API with a
+// streamed body, see doAuthenticated.
+//
+// Parameters:
+//   - ctx: The context of the call, it cancels the request.
+//   - method: The HTTP method of the request.
+//   - uriPath: URI path for the API endpoint.
+//   - contentType: Content type of the request body.
+//   - newBody: Opens a new request body for every attempt.
+//
+// Returns:
+//   - *http.Response: The HTTP response.
+//   - error: An error if the request fails.
+func (c *ICTClient) doAuthenticatedStream(ctx context.Context, method, uriPath, contentType string,
+	newBody func() (io.Reader, error)) (*http.Response, error) {
+
+	return c.doWithRetry(ctx, method+" "+uriPath, isIdempotentMethod(method), func() (*http.Response, error) {
+		return c.doAuthenticatedOnce(ctx, method, uriPath, contentType, newBody)
+	})
+}
+
+// doAuthenticatedOnce makes one attempt of an authenticated request, including
+// the single retry after a 401 response.
+func (c *ICTClient) doAuthenticatedOnce(ctx context.Context, method, uriPath, contentType string,
+	newBody func() (io.Reader, error)) (*http.Response, error) {
+
+	resp, err := c.sendAuthenticated(ctx, method, uriPath, contentType, newBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+
+	resp.Body.Close()
+	c.InvalidateToken()
+
+	return c.sendAuthenticated(ctx, method, uriPath, contentType, newBody)
+}
+
+// sendAuthenticated sends a single authenticated request to the ICT API.
+// A body implementing io.Closer is closed by the HTTP client once it has been sent.
+func (c *ICTClient) sendAuthenticated(ctx context.Context, method, uriPath, contentType string,
+	newBody func() (io.Reader, error)) (*http.Response, error) {
+
+	authToken, err := c.getToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := newBody()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.buildRequestURL(uriPath), body)
+	if err != nil {
+		if closer, ok := body.(io.Closer); ok {
+			closer.Close()
+		}
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	return c.httpClient.Do(req)
+}
+
+// getJSON makes an authenticated GET request and decodes the JSON response.
+//
+// Parameters:
+//   - ctx: The context of the call, it cancels the request.
+//   - uriPath: URI path for the API endpoint.
+//   - to: Destination for the decoded response.
+//   - step: The step reported in the returned ICTError.
+//
+// Returns:
+//   - error: An ICTError if the request or decoding fails.
+func (c *ICTClient) getJSON(ctx context.Context, uriPath string, to interface{}, step ICTStep) error {
+	_, err := c.getJSONWithHeader(ctx, uriPath, to, step)
+	return err
+}
+
+// getJSONWithHeader is getJSON also returning the headers of the response.
+func (c *ICTClient) getJSONWithHeader(ctx context.Context, uriPath string, to interface{}, step ICTStep) (http.Header, error) {
+	resp, err := c.doAuthenticated(ctx, http.MethodGet, uriPath, "", nil)
+	if err != nil {
+		return nil, wrapICTError(step, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newICTStatusError(step, resp)
+	}
+
+	return resp.Header, wrapICTError(step, json.NewDecoder(resp.Body).Decode(to))
+}
+
+// postForID makes an authenticated POST request and reads the ID the ICT API
+// returns in the response body.
+//
+// Parameters:
+//   - ctx: The context of the call, it cancels the request.
+//   - uriPath: URI path for the API endpoint.
+//   - body: The request body.
+//   - step: The step reported in the returned ICTError.
+//
+// Returns:
+//   - int: The ID returned by the API.
+//   - error: An ICTError if the request fails.
+func (c *ICTClient) postForID(ctx context.Context, uriPath string, body []byte, step ICTStep) (int, error) {
+	resp, err := c.doAuthenticated(ctx, http.MethodPost, uriPath, "", body)
+	if err != nil {
+		return 0, wrapICTError(step, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, newICTStatusError(step, resp)
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, wrapICTError(step, fmt.Errorf("error reading response body: %w", err))
+	}
+
+	id, err := parseICTID(respBody)
+	return id, wrapICTError(step, err)
+}
+
+// parseICTID converts an ID returned by the ICT API into an integer.
+func parseICTID(body []byte) (int, error) {
+	id, err := strconv.Atoi(strings.TrimSpace(string(body)))
+	if err != nil {
+		return 0, fmt.Errorf("error converting ID '%s': %v", string(body), err)
+	}
+	return id, nil
+}
+
+// calculateTokenExpiry returns the time a token should be treated as expired.
+// If the token is a JWT with an "exp" claim it is used, otherwise the default
+// token lifetime is applied. A small margin is removed to avoid racing the server.
+//
+// Parameters:
+//   - token: The bearer token returned by the ICT API.
+//   - now: The time the token was issued.
+//
+// Returns:
+//   - time.Time: The expiry time of the token.
+func calculateTokenExpiry(token string, now time.Time) time.Time {
+	expiry := now.Add(ICT_TOKEN_DEFAULT_LIFETIME)
+
+	exp, err := readJWTExpiry(token)
+	if err == nil {
+		expiry = exp
+	}
+
+	return expiry.Add(-ICT_TOKEN_EXPIRY_MARGIN)
+}
+
+// readJWTExpiry reads the "exp" claim of a JWT without verifying it.
+func readJWTExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("the token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, err
+	}
+
+	if claims.Exp == 0 {
+		return time.Time{}, errors.New("the token has no exp claim")
+	}
+
+	return time.Unix(claims.Exp, 0), nil
+}
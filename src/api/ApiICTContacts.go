@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"faxsender/src/utilities/logger"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Constants for the contact search.
+const (
+	CONTACT_SEARCH_DEFAULT_LIMIT = 10
+	CONTACT_SEARCH_MAX_LIMIT     = 50
+	CONTACT_SEARCH_PARAM_TEXT    = "search"
+	CONTACT_SEARCH_PARAM_LIMIT   = "limit"
+)
+
+// Constants for the query parameters of the ICT contacts list.
+// Servers ignoring them send the full list, which is filtered on the client.
+const (
+	ICT_CONTACT_QUERY_PARAM_SEARCH = "search"
+	ICT_CONTACT_QUERY_PARAM_PHONE  = "phone"
+)
+
+// ContactMatches checks if a contact matches a search text.
+// The digits of the text match any part of the phone number ignoring
+// formatting, the text matches any part of the name or the email ignoring case.
+//
+// Parameters:
+//   - contact: The contact stored on the ICT server.
+//   - text: The search text, an empty text matches every contact.
+//
+// Returns:
+//   - bool: True if the contact matches the text.
+func ContactMatches(contact ContactResponse, text string) bool {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "" {
+		return true
+	}
+
+	if digits := normalizeFaxNumber(text); digits != "" && strings.Contains(normalizeFaxNumber(contact.Phone), digits) {
+		return true
+	}
+
+	name := strings.ToLower(contact.FirstName + " " + contact.LastName)
+	return strings.Contains(name, text) || strings.Contains(strings.ToLower(contact.Email), text)
+}
+
+// listContactsICT retrieves the contacts of the ICT API with the given query parameters.
+func (c *ICTClient) listContactsICT(ctx context.Context, values url.Values) ([]ContactResponse, error) {
+	uriPath := ICT_CONTACTS_API_PATH
+	if len(values) > 0 {
+		uriPath += "?" + values.Encode()
+	}
+
+	var contactResponse []ContactResponse
+	err := c.getJSON(ctx, uriPath, &contactResponse, ICT_STEP_LIST_CONTACTS)
+	if err != nil {
+		return nil, err
+	}
+	return contactResponse, nil
+}
+
+// SearchContactsICT searches the contacts stored on the ICT server.
+// Steps:
+// 1. Make an authenticated HTTP GET request to the contacts API with the search text.
+// 2. Keep the contacts matching the text, in case the server ignored it.
+// 3. Return at most limit contacts.
+//
+// Parameters:
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
+//   - text: The search text matched against the phone number, the name and the email.
+//   - limit: The maximum number of returned contacts, the default is used if zero.
+//
+// Returns:
+//   - []ContactResponse: The matching contacts.
+//   - error: An ICTError if fetching the contacts fails.
+func (c *ICTClient) SearchContactsICT(ctx context.Context, text string, limit int) ([]ContactResponse, error) {
+	if limit <= 0 {
+		limit = CONTACT_SEARCH_DEFAULT_LIMIT
+	}
+	if limit > CONTACT_SEARCH_MAX_LIMIT {
+		limit = CONTACT_SEARCH_MAX_LIMIT
+	}
+
+	values := url.Values{}
+	if text = strings.TrimSpace(text); text != "" {
+		values.Set(ICT_CONTACT_QUERY_PARAM_SEARCH, text)
+	}
+
+	contactResponses, err := c.listContactsICT(ctx, values)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]ContactResponse, 0)
+	for _, contact := range contactResponses {
+		if len(result) == limit {
+			break
+		}
+		if ContactMatches(contact, text) {
+			result = append(result, contact)
+		}
+	}
+	return result, nil
+}
+
+// FindContactByPhoneICT looks up a contact stored on the ICT server by its phone number.
+// The phone numbers are compared ignoring formatting.
+//
+// Parameters:
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
+//   - phone: The phone number of the contact.
+//
+// Returns:
+//   - int: The ID of the first matching contact.
+//   - bool: False if no contact has the phone number.
+//   - error: An ICTError if fetching the contacts fails.
+func (c *ICTClient) FindContactByPhoneICT(ctx context.Context, phone string) (int, bool, error) {
+	digits := normalizeFaxNumber(phone)
+	if digits == "" {
+		return 0, false, nil
+	}
+
+	contactResponses, err := c.listContactsICT(ctx, url.Values{ICT_CONTACT_QUERY_PARAM_PHONE: {phone}})
+	if err != nil {
+		return 0, false, err
+	}
+
+	for _, contact := range contactResponses {
+		if normalizeFaxNumber(contact.Phone) != digits {
+			continue
+		}
+
+		contactID, err := strconv.Atoi(contact.ContactID)
+		if err == nil && contactID > 0 {
+			return contactID, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// findOrCreateContact reuses the ICT contact with the phone number of the
+// recipient, creating a contact only when none exists.
+// A failed lookup doesn't fail the send, the contact is created instead.
+//
+// Parameters:
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
+//   - contact: The recipient.
+//
+// Returns:
+//   - int: The ID of the reused or created contact.
+//   - bool: True if the contact was created, only created contacts are rolled back.
+//   - error: An ICTError if the contact can not be created.
+func (c *ICTClient) findOrCreateContact(ctx context.Context, contact Contact) (int, bool, error) {
+	contactID, found, err := c.FindContactByPhoneICT(ctx, contact.Phone)
+	if err != nil {
+		if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+			return 0, false, err
+		}
+		logger.Inst().Error(fmt.Sprintf("looking up the contact of '%s' failed, creating it: %v", contact.Phone, err))
+	}
+	if found {
+		return contactID, false, nil
+	}
+
+	contactID, err = c.CreateContact(ctx, contact)
+	if err != nil {
+		return 0, false, err
+	}
+	return contactID, true, nil
+}
@@ -2,15 +2,16 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"faxsender/src/utilities"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"net/http"
 	"net/url"
+	"os"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -25,6 +26,20 @@ const (
 	ICT_PROGRAMS_API_PATH              = "api/programs/sendfax"
 	ICT_DOCUMENS_WITH_ID_API_PATH      = "api/documents/%d/media"
 	ICT_TRANMISSTIONS_WITH_ID_API_PATH = "api/transmissions/%d/send"
+
+	ICT_CONTACT_WITH_ID_API_PATH      = "api/contacts/%d"
+	ICT_DOCUMENT_WITH_ID_API_PATH     = "api/documents/%d"
+	ICT_PROGRAM_WITH_ID_API_PATH      = "api/programs/%d"
+	ICT_TRANSMISSION_WITH_ID_API_PATH = "api/transmissions/%d"
+)
+
+// Constants for the final transmission states reported by the ICT API.
+const (
+	ICT_STATUS_DONE      = "done"
+	ICT_STATUS_COMPLETED = "completed"
+	ICT_STATUS_FAILED    = "failed"
+	ICT_STATUS_BUSY      = "busy"
+	ICT_STATUS_NO_ANSWER = "no answer"
 )
 
 // buildICTRequestURL constructs the complete URL for an ICT API endpoint.
@@ -44,42 +59,52 @@ func buildICTReqeustURL(userData *UserData, uriPath string) string {
 }
 
 // AuthenticateICT performs user authentication with the ICT API.
+// It always authenticates, use GetAuthResponse to get the cached token.
 // Steps:
 // 1. Marshal user data into JSON.
 // 2. Build the authentication URL.
-// 3. Make an HTTP POST request to the authentication API.
+// 3. Make an HTTP POST request to the authentication API, retrying transient failures.
 // 4. Check if the authentication was successful (status code 200).
 // 5. Decode the response body into an AuthResponse struct.
 //
 // Parameters:
-//   - userData: User data containing authentication information.
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
 //
 // Returns:
 //   - *AuthResponse: Authentication response containing user details.
-//   - error: An error if authentication fails or any other error occurs.
-func AuthenticateICT(userData UserData) (*AuthResponse, error) {
+//   - error: An ICTError if authentication fails or any other error occurs.
+func (c *ICTClient) AuthenticateICT(ctx context.Context) (*AuthResponse, error) {
 
-	bodyBytes, err := json.Marshal(userData)
+	bodyBytes, err := json.Marshal(c.userData)
 	if err != nil {
-		return nil, err
+		return nil, wrapICTError(ICT_STEP_AUTHENTICATE, err)
 	}
 
-	authURL := buildICTReqeustURL(&userData, ICT_AUTHENTICATION_API_PATH)
-	resp, err := http.Post(authURL, utilities.JSON_CONTENT_TYPE, bytes.NewBuffer(bodyBytes))
+	authURL := c.buildRequestURL(ICT_AUTHENTICATION_API_PATH)
+
+	// Authenticating has no side effects, so it is retried like an idempotent call.
+	resp, err := c.doWithRetry(ctx, "POST "+ICT_AUTHENTICATION_API_PATH, true, func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, authURL, bytes.NewReader(bodyBytes))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", utilities.JSON_CONTENT_TYPE)
 
+		return c.httpClient.Do(req)
+	})
 	if err != nil {
-		return nil, err
+		return nil, wrapICTError(ICT_STEP_AUTHENTICATE, err)
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Authentication failed with status code: %d", resp.StatusCode)
+		return nil, newICTStatusError(ICT_STEP_AUTHENTICATE, resp)
 	}
 
 	var authResponse AuthResponse
 	if err := json.NewDecoder(resp.Body).Decode(&authResponse); err != nil {
-		return nil, err
+		return nil, wrapICTError(ICT_STEP_AUTHENTICATE, err)
 	}
 
 	return &authResponse, nil
@@ -87,303 +112,451 @@ func AuthenticateICT(userData UserData) (*AuthResponse, error) {
 
 // TransmissionsICT retrieves fax transmissions from the ICT API.
 // Steps:
-// 1. Build the URL for the transmissions API.
-// 2. Create an authenticated HTTP GET request.
-// 3. Make the HTTP request and check for success (status code 200).
-// 4. Decode the response body into a slice of FaxResponse structs.
-// 5. Parse the DateTime field in each response into a time.Time field.
+// 1. Make an authenticated HTTP GET request to the transmissions API.
+// 2. Decode the response body into a slice of FaxResponse structs.
+// 3. Parse the DateTime field in each response into a time.Time field.
 //
 // Parameters:
-//   - userData: User data containing ICT API access information.
-//   - authToken: Authentication token for making authenticated requests.
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
 //
 // Returns:
 //   - []FaxResponse: A slice of FaxResponse structs representing fax transmissions.
 //   - error: An error if fetching transmissions fails or any other error occurs.
-func TransmissionsICT(userData UserData, authToken string) ([]FaxResponse, error) {
-
-	faxURL := buildICTReqeustURL(&userData, ICT_TRANSMISSION_API_PATH)
+func (c *ICTClient) TransmissionsICT(ctx context.Context) ([]FaxResponse, error) {
 
-	req, err := http.NewRequest("GET", faxURL, nil)
+	var faxResponse []FaxResponse
+	err := c.getJSON(ctx, ICT_TRANSMISSION_API_PATH, &faxResponse, ICT_STEP_LIST_TRANSMISSIONS)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+authToken)
+	parseFaxResponseDates(faxResponse)
+	return faxResponse, nil
+}
 
-	client := &http.Client{
-		Timeout: time.Second * 10, // Set a reasonable timeout
-	}
+// QueryTransmissionsICT retrieves one page of the fax transmissions matching a query from the ICT API.
+// Steps:
+// 1. Make an authenticated HTTP GET request to the transmissions API with the query parameters.
+// 2. Return the page as sent if the server reports the number of matching transmissions.
+// 3. Otherwise the server ignored the query parameters and sent the full list,
+// filter and page it on the client.
+//
+// Parameters:
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
+//   - query: The filters and the page.
+//
+// Returns:
+//   - *TransmissionPage: The requested page, the newest first.
+//   - error: An error if fetching transmissions fails or any other error occurs.
+func (c *ICTClient) QueryTransmissionsICT(ctx context.Context, query TransmissionQuery) (*TransmissionPage, error) {
+	query = query.Normalize()
 
-	resp, err := client.Do(req)
+	var faxResponse []FaxResponse
+	uriPath := ICT_TRANSMISSION_API_PATH + "?" + query.ictValues().Encode()
+	header, err := c.getJSONWithHeader(ctx, uriPath, &faxResponse, ICT_STEP_LIST_TRANSMISSIONS)
 	if err != nil {
 		return nil, err
 	}
 
-	defer resp.Body.Close()
+	parseFaxResponseDates(faxResponse)
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Fetching faxes failed with status code: %d", resp.StatusCode)
+	total, err := strconv.Atoi(header.Get(ICT_TOTAL_COUNT_HEADER))
+	if err != nil {
+		return PageTransmissions(faxResponse, query), nil
 	}
 
-	var faxResponse []FaxResponse
-	if err := json.NewDecoder(resp.Body).Decode(&faxResponse); err != nil {
-		return nil, err
+	if len(faxResponse) > query.Limit {
+		faxResponse = faxResponse[:query.Limit]
 	}
 
+	return &TransmissionPage{
+		Faxes:  ConvertFilteredFaxResponsesToFaxData(faxResponse),
+		Offset: query.Offset,
+		Limit:  query.Limit,
+		Total:  total,
+	}, nil
+}
+
+// parseFaxResponseDates parses the Unix timestamp of the last run of each transmission.
+func parseFaxResponseDates(faxResponse []FaxResponse) {
 	for i, response := range faxResponse {
 		lastRunTimestamp, err := strconv.ParseInt(response.DateTime, 10, 64)
 		if err == nil {
 			faxResponse[i].DateTimeParsed = time.Unix(lastRunTimestamp, 0)
 		}
 	}
-
-	return faxResponse, nil
 }
 
 // AccountsICT retrieves account information from the ICT API.
 // Steps:
-// 1. Build the URL for the accounts API.
-// 2. Create an authenticated HTTP GET request.
-// 3. Make the HTTP request and check for success (status code 200).
-// 4. Decode the response body into a slice of AccountResponse structs.
+// 1. Make an authenticated HTTP GET request to the accounts API.
+// 2. Decode the response body into a slice of AccountResponse structs.
 //
 // Parameters:
-//   - userData: User data containing ICT API access information.
-//   - authToken: Authentication token for making authenticated requests.
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
 //
 // Returns:
 //   - []AccountResponse: A slice of AccountResponse structs representing account information.
 //   - error: An error if fetching accounts fails or any other error occurs.
-func AccountsICT(userData UserData, authToken string) ([]AccountResponse, error) {
+func (c *ICTClient) AccountsICT(ctx context.Context) ([]AccountResponse, error) {
 
-	accountURL := buildICTReqeustURL(&userData, ICT_ACCOUNTS_API_PATH)
-
-	req, err := http.NewRequest("GET", accountURL, nil)
+	var accountResponse []AccountResponse
+	err := c.getJSON(ctx, ICT_ACCOUNTS_API_PATH, &accountResponse, ICT_STEP_LIST_ACCOUNTS)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+authToken)
+	return accountResponse, nil
+}
+
+// SendFaxICT sends a fax using various ICT API endpoints.
+// It is SendFaxReaderICT for a document held in memory.
+//
+// Parameters:
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
+//   - contact: Contact information for the fax transmission.
+//   - document: Document information for the fax transmission.
+//   - transmission: Transmission information, including AccountID, for the fax.
+//   - fileContents: Contents of the document file to be uploaded.
+//   - fileModel: Information about the document file content type.
+//
+// Returns:
+//   - int: The ID of the sent transmission.
+//   - error: An ICTError carrying the failed step if any step of the fax transmission process fails.
+func (c *ICTClient) SendFaxICT(ctx context.Context, contact Contact, document DocumentRecord,
+	transmission Transmission, fileContents []byte, fileModel SendFileInfo) (int, error) {
+
+	return c.SendFaxReaderICT(ctx, contact, document, transmission, bytes.NewReader(fileContents), fileModel)
+}
+
+// SendFaxReaderICT sends a fax using various ICT API endpoints, streaming the
+// document instead of holding it in memory.
+// Steps:
+// 1. Check the account ID, so a request that can't be sent is never stored.
+// 2. Load the stored job of the request, or of the owner of the context, or stream the document into a new one.
+// 3. Run the send pipeline of the job from the first step that didn't finish.
+//
+// Parameters:
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
+//   - contact: Contact information for the fax transmission.
+//   - document: Document information for the fax transmission.
+//   - transmission: Transmission information, including AccountID, for the fax.
+//   - file: Reader of the document file to be uploaded.
+//   - fileModel: Information about the document file content type.
+//
+// Returns:
+//   - int: The ID of the sent transmission.
+//   - error: An invalid_request ApiError if the account ID is not a number, or an ICTError carrying
+//     the failed step if any step of the fax transmission process fails.
+func (c *ICTClient) SendFaxReaderICT(ctx context.Context, contact Contact, document DocumentRecord,
+	transmission Transmission, file io.Reader, fileModel SendFileInfo) (int, error) {
+
+	if _, err := parseAccountID(transmission.AccountID); err != nil {
+		return 0, err
+	}
 
-	client := &http.Client{
-		Timeout: time.Second * 10, // Set a reasonable timeout
+	job, err := createFaxJob(faxJobOwner(ctx), contact, document, transmission, file, fileModel)
+	if err != nil {
+		var apiErr *ApiError
+		if errors.As(err, &apiErr) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("error storing the fax job: %v", err)
 	}
 
-	resp, err := client.Do(req)
+	return c.RunFaxJob(ctx, job)
+}
 
+// RunFaxJob runs the send pipeline of a stored job.
+// Steps:
+// 1. Lock the job and reload it, another process may have advanced or finished it.
+// 2. Run the steps of the pipeline that didn't finish, saving the checkpoint after each one.
+// 3. If all steps finish, remove the job, unless it has an owner, see WithFaxJobOwner.
+// 4. If a step fails with a resumable error, or the send step is cancelled, keep the job so a retry resumes it.
+// 5. Otherwise, or if an earlier step was cancelled, delete the ICT objects created for the job and remove it.
+//
+// Parameters:
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
+//   - job: The job to run.
+//
+// Returns:
+//   - int: The ID of the sent transmission.
+//   - error: An ICTError carrying the failed step if any step of the fax transmission process fails,
+//     or a conflict ApiError if the job is running in another process or has already finished.
+func (c *ICTClient) RunFaxJob(ctx context.Context, job *FaxJob) (int, error) {
+	unlock, err := lockFaxJob(job.ID)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
+	defer unlock()
 
-	defer resp.Body.Close()
+	stored, err := LoadFaxJob(job.ID)
+	if os.IsNotExist(err) {
+		return 0, NewApiError(ERROR_CODE_CONFLICT, fmt.Sprintf("the fax job %s has already finished", job.ID))
+	}
+	if err != nil {
+		return 0, err
+	}
+	*job = *stored
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Fetching accounts failed with status code: %d", resp.StatusCode)
+	err = c.runFaxJobSteps(ctx, job)
+	if err == nil {
+		if job.Owner == "" {
+			logIfError(RemoveFaxJob(job.ID))
+		}
+		return job.Checkpoint.TransmissionID, nil
 	}
 
-	var accountResponse []AccountResponse
-	if err := json.NewDecoder(resp.Body).Decode(&accountResponse); err != nil {
-		return nil, err
+	if (isResumableICTError(err) && !errors.Is(err, context.Canceled)) || isInterruptedSend(err) {
+		job.LastError = err.Error()
+		logIfError(SaveFaxJob(job))
+		return 0, err
 	}
 
-	return accountResponse, nil
+	rollbackFromCheckpoint(c, job.Checkpoint).run(err)
+	logIfError(RemoveFaxJob(job.ID))
+	return 0, err
 }
 
-// SendFaxICT sends a fax using various ICT API endpoints.
+// runFaxJobSteps runs the six steps of the send pipeline, skipping the steps
+// already recorded in the checkpoint of the job.
+// Each step is reported to the progress function of the context, see WithSendProgress.
 // Steps:
-// 1. Convert the AccountID in the Transmission struct to an integer.
-// 2. Create a Contact, Document Record, and Program sequentially.
-// 3. Upload the document file.
-// 4. Create a Transmission with the provided data.
-// 5. Send the created Transmission.
+// 1. Reuse the Contact with the phone number of the recipient or create one, and create a Document Record.
+// 2. Upload the document file stored with the job.
+// 3. Create a Program and a Transmission with the provided data.
+// 4. Send the created Transmission.
 //
 // Parameters:
-//   - userData: User data containing ICT API access information.
-//   - authToken: Authentication token for making authenticated requests.
-//   - contact: Contact information for the fax transmission.
-//   - document: Document information for the fax transmission.
-//   - transmission: Transmission information, including AccountID, for the fax.
-//   - fileContents: Contents of the document file to be uploaded.
-//   - fileModel: Information about the document file content type.
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
+//   - job: The job to run, its checkpoint is updated and saved after each step.
 //
 // Returns:
-//   - error: An error if any step of the fax transmission process fails.
+//   - error: An error if any step fails.
+func (c *ICTClient) runFaxJobSteps(ctx context.Context, job *FaxJob) error {
+	checkpoint := &job.Checkpoint
+	accountID, err := parseAccountID(job.Transmission.AccountID)
+	if err != nil {
+		return err
+	}
 
-func SendFaxICT(userData UserData, authToken string, contact Contact, document DocumentRecord,
-	transmission Transmission, fileContents []byte, fileModel SendFileInfo) error {
+	// Step 1: Find or Create Contact
+	if checkpoint.ContactID == 0 {
+		contactID, created, err := c.findOrCreateContact(ctx, job.Contact)
+		if err != nil {
+			return err
+		}
 
-	accountID, _ := strconv.Atoi(transmission.AccountID)
-	contentType := fileModel.ContentType
-	// Step 1: Create Contact
-	contactID, err := CreateContact(userData, authToken, contact)
-	if err != nil {
-		return fmt.Errorf("Failed to create contact: %v", err)
+		checkpoint.ContactID = contactID
+		checkpoint.ContactReused = !created
+		if err := SaveFaxJob(job); err != nil {
+			return err
+		}
 	}
+	reportSendProgress(ctx, ICT_STEP_CONTACT)
 
 	// Step 2: Create Document Record
-	documentID, err := CreateDocumentRecord(userData, authToken, document)
-	if err != nil {
-		return fmt.Errorf("Failed to create document record: %v", err)
+	if checkpoint.DocumentID == 0 {
+		documentID, err := c.CreateDocumentRecord(ctx, job.Document)
+		if err != nil {
+			return err
+		}
+
+		checkpoint.DocumentID = documentID
+		if err := SaveFaxJob(job); err != nil {
+			return err
+		}
 	}
+	reportSendProgress(ctx, ICT_STEP_DOCUMENT)
 
 	// Step 3: Upload Document File
-	err = UploadDocumentFile(userData, authToken, documentID, fileContents, contentType)
-	if err != nil {
-		return fmt.Errorf("Failed to upload document file: %v", err)
+	if !checkpoint.Uploaded {
+		documentSource, err := FaxJobDocumentSource(job.ID)
+		if err != nil {
+			return fmt.Errorf("error reading the document of the fax job: %v", err)
+		}
+
+		err = c.UploadDocumentFile(ctx, checkpoint.DocumentID, documentSource, job.FileModel.ContentType)
+		if err != nil {
+			return err
+		}
+
+		checkpoint.Uploaded = true
+		if err := SaveFaxJob(job); err != nil {
+			return err
+		}
 	}
+	reportSendProgress(ctx, ICT_STEP_UPLOAD)
 
 	// Step 4: Create Program
-	programID, err := CreateProgram(userData, authToken, documentID)
-	if err != nil {
-		return fmt.Errorf("Failed to create program: %v", err)
+	if checkpoint.ProgramID == 0 {
+		programID, err := c.CreateProgram(ctx, checkpoint.DocumentID)
+		if err != nil {
+			return err
+		}
+
+		checkpoint.ProgramID = programID
+		if err := SaveFaxJob(job); err != nil {
+			return err
+		}
 	}
+	reportSendProgress(ctx, ICT_STEP_PROGRAM)
 
 	// Step 5: Create Transmission
-	transmissionID, err := CreateTransmission(userData, authToken, transmission, contactID, accountID, programID)
-	if err != nil {
-		return fmt.Errorf("Failed to create transmission: %v", err)
+	if checkpoint.TransmissionID == 0 {
+		transmissionID, err := c.CreateTransmission(ctx, job.Transmission, checkpoint.ContactID, accountID, checkpoint.ProgramID)
+		if err != nil {
+			return err
+		}
+
+		checkpoint.TransmissionID = transmissionID
+		if err := SaveFaxJob(job); err != nil {
+			return err
+		}
 	}
+	reportSendProgress(ctx, ICT_STEP_TRANSMISSION)
 
 	// Step 6: Send Transmission
-	err = SendTransmission(userData, authToken, transmissionID)
-	if err != nil {
-		return fmt.Errorf("Failed to send transmission: %v", err)
+	if !checkpoint.Sent {
+		err := c.SendTransmission(ctx, checkpoint.TransmissionID)
+		if err != nil {
+			return err
+		}
+
+		// The transmission is sent even if the checkpoint can't be saved,
+		// so the error is only logged.
+		checkpoint.Sent = true
+		logIfError(SaveFaxJob(job))
 	}
+	reportSendProgress(ctx, ICT_STEP_SEND)
 
 	return nil
 }
 
-// CreateContact creates a contact using the ICT API.
+// DiscardFaxJob gives up a stored job that will not be run again.
 // Steps:
-// 1. Build the URL for creating a contact.
-// 2. Marshal the contact data into JSON.
-// 3. Make an authenticated POST request and check for success (status code 200).
-// 4. Read and convert the response body (contact ID) into an integer.
+// 1. Lock the job, so it is not discarded while another process runs it.
+// 2. Delete the ICT objects created for the job, nothing is deleted once it is sent.
+// 3. Remove the job.
 //
 // Parameters:
-//   - userData: User data containing ICT API access information.
-//   - authToken: Authentication token for making authenticated requests.
-//   - contact: Contact information to be created.
+//   - ctx: The context of the call.
+//   - job: The job to discard.
 //
 // Returns:
-//   - int: The ID of the created contact.
-//   - error: An error if the creation process fails.
-func CreateContact(userData UserData, authToken string, contact Contact) (int, error) {
-	url := buildICTReqeustURL(&userData, ICT_CONTACTS_API_PATH)
-
-	bodyBytes, err := json.Marshal(contact)
+//   - error: A conflict ApiError if the job is running, or an error if the job can not be removed.
+func (c *ICTClient) DiscardFaxJob(ctx context.Context, job *FaxJob) error {
+	unlock, err := lockFaxJob(job.ID)
 	if err != nil {
-		return 0, fmt.Errorf("error marshaling contact data: %v", err)
+		return err
 	}
+	defer unlock()
 
-	resp, err := makeAuthenticatedPostRequest(url, authToken, bodyBytes)
-	if err != nil {
-		return 0, fmt.Errorf("error making authenticated POST request: %v", err)
+	stored, err := LoadFaxJob(job.ID)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err == nil {
+		rollbackFromCheckpoint(c, stored.Checkpoint).run(fmt.Errorf("the fax job %s has been discarded", job.ID))
 	}
 
-	defer resp.Body.Close()
+	return RemoveFaxJob(job.ID)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("CreateContact API call failed with status code: %d", resp.StatusCode)
+// TransmissionStatusICT retrieves a single transmission from the ICT API.
+// Steps:
+// 1. Make an authenticated HTTP GET request to the transmission API.
+// 2. Decode the response body into a TransmissionResponse struct.
+//
+// Parameters:
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
+//   - transmissionID: The ID of the transmission.
+//
+// Returns:
+//   - *TransmissionResponse: The transmission with its current status.
+//   - error: An ICTError if fetching the transmission fails.
+func (c *ICTClient) TransmissionStatusICT(ctx context.Context, transmissionID int) (*TransmissionResponse, error) {
+	transmissionUrl := fmt.Sprintf(ICT_TRANSMISSION_WITH_ID_API_PATH, transmissionID)
+
+	var transmissionResponse TransmissionResponse
+	err := c.getJSON(ctx, transmissionUrl, &transmissionResponse, ICT_STEP_TRANSMISSION_STATUS)
+	if err != nil {
+		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	return &transmissionResponse, nil
+}
 
+// CreateContact creates a contact using the ICT API.
+// Steps:
+// 1. Marshal the contact data into JSON.
+// 2. Make an authenticated POST request and check for success (status code 200).
+// 3. Read and convert the response body (contact ID) into an integer.
+//
+// Parameters:
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
+//   - contact: Contact information to be created.
+//
+// Returns:
+//   - int: The ID of the created contact.
+//   - error: An ICTError if the creation process fails.
+func (c *ICTClient) CreateContact(ctx context.Context, contact Contact) (int, error) {
+	bodyBytes, err := json.Marshal(contact)
 	if err != nil {
-		return 0, fmt.Errorf("error reading response body: %v", err)
+		return 0, wrapICTError(ICT_STEP_CONTACT, fmt.Errorf("error marshaling contact data: %v", err))
 	}
 
-	contactID, _ := strconv.Atoi(string(body))
-
-	return contactID, nil
+	return c.postForID(ctx, ICT_CONTACTS_API_PATH, bodyBytes, ICT_STEP_CONTACT)
 }
 
 // CreateDocumentRecord creates a document record using the ICT API.
 // Steps:
-// 1. Build the URL for creating a document record.
-// 2. Marshal the document data into JSON.
-// 3. Make an authenticated POST request and check for success (status code 200).
-// 4. Read and convert the response body (document ID) into an integer.
+// 1. Marshal the document data into JSON.
+// 2. Make an authenticated POST request and check for success (status code 200).
+// 3. Read and convert the response body (document ID) into an integer.
 //
 // Parameters:
-//   - userData: User data containing ICT API access information.
-//   - authToken: Authentication token for making authenticated requests.
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
 //   - document: Document information to be created.
 //
 // Returns:
 //   - int: The ID of the created document record.
-//   - error: An error if the creation process fails.
-func CreateDocumentRecord(userData UserData, authToken string, document DocumentRecord) (int, error) {
-
-	url := buildICTReqeustURL(&userData, ICT_Document_API_PATH)
-
+//   - error: An ICTError if the creation process fails.
+func (c *ICTClient) CreateDocumentRecord(ctx context.Context, document DocumentRecord) (int, error) {
 	bodyBytes, err := json.Marshal(document)
-
-	if err != nil {
-		return 0, err
-	}
-
-	resp, err := makeAuthenticatedPostRequest(url, authToken, bodyBytes)
-
 	if err != nil {
-		return 0, fmt.Errorf("error making authenticated POST request: %v", err)
+		return 0, wrapICTError(ICT_STEP_DOCUMENT, err)
 	}
 
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("CreateDocumentRecord API call failed with status code: %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-
-	if err != nil {
-		return 0, fmt.Errorf("error reading response body: %v", err)
-	}
-
-	documentID, _ := strconv.Atoi(string(body))
-
-	return documentID, nil
+	return c.postForID(ctx, ICT_Document_API_PATH, bodyBytes, ICT_STEP_DOCUMENT)
 }
 
 // UploadDocumentFile uploads a document file to the ICT API.
 // Steps:
-// 1. Build the URL for uploading a document file.
-// 2. Create a multipart form and add the file field.
-// 3. Make an authenticated POST request with the multipart form.
-// 4. Check for success (status code 200).
+// 1. Stream the document through a pipe as the file field of a multipart form.
+// 2. Make an authenticated PUT request with the multipart form, the document is
+// opened again for every attempt.
+// 3. Check for success (status code 200).
 //
 // Parameters:
-//   - userData: User data containing ICT API access information.
-//   - authToken: Authentication token for making authenticated requests.
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
 //   - documentID: The ID of the document to which the file will be attached.
-//   - fileContents: Contents of the document file to be uploaded.
+//   - source: The source of the document file to be uploaded.
 //   - contentType: Content type of the document file.
 //
 // Returns:
-//   - error: An error if the upload process fails.
-func UploadDocumentFile(userData UserData, authToken string, documentID int, fileContents []byte, contentType string) error {
+//   - error: An ICTError if the upload process fails.
+func (c *ICTClient) UploadDocumentFile(ctx context.Context, documentID int, source DocumentSource, contentType string) error {
 	documentUrl := fmt.Sprintf(ICT_DOCUMENS_WITH_ID_API_PATH, documentID)
-	url := buildICTReqeustURL(&userData, documentUrl)
-
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-
-	fileField, _ := writer.CreateFormFile("file", "filename.txt")
-	fileField.Write(fileContents)
-
-	writer.Close()
 
-	req, err := makeAuthenticatedPostRequestWithBody(url, authToken, contentType, body)
+	resp, err := c.doAuthenticatedStream(ctx, http.MethodPut, documentUrl, contentType, newMultipartFileBody(source))
 	if err != nil {
-		return fmt.Errorf("error making request: %v", err)
+		return wrapICTError(ICT_STEP_UPLOAD, err)
 	}
+	defer resp.Body.Close()
 
-	defer req.Body.Close()
-
-	if req.StatusCode != http.StatusOK {
-		return fmt.Errorf("Uploading document file failed with status code: %d", req.StatusCode)
+	if resp.StatusCode != http.StatusOK {
+		return newICTStatusError(ICT_STEP_UPLOAD, resp)
 	}
 
 	return nil
@@ -391,69 +564,35 @@ func UploadDocumentFile(userData UserData, authToken string, documentID int, fil
 
 // CreateProgram creates a program using the ICT API.
 // Steps:
-// 1. Build the URL for creating a program.
-// 2. Marshal the program data into JSON.
-// 3. Make an authenticated POST request and check for success (status code 200).
-// 4. Read and convert the response body (program ID) into an integer.
+// 1. Marshal the program data into JSON.
+// 2. Make an authenticated POST request and check for success (status code 200).
+// 3. Read and convert the response body (program ID) into an integer.
 //
 // Parameters:
-//   - userData: User data containing ICT API access information.
-//   - authToken: Authentication token for making authenticated requests.
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
 //   - documentID: The ID of the document associated with the program.
 //
 // Returns:
 //   - int: The ID of the created program.
-//   - error: An error if the creation process fails.
-func CreateProgram(userData UserData, authToken string, documentID int) (int, error) {
-
-	url := buildICTReqeustURL(&userData, ICT_PROGRAMS_API_PATH)
-
+//   - error: An ICTError if the creation process fails.
+func (c *ICTClient) CreateProgram(ctx context.Context, documentID int) (int, error) {
 	bodyBytes, err := json.Marshal(map[string]int{"document_id": documentID})
-
-	if err != nil {
-		return 0, err
-	}
-
-	resp, err := makeAuthenticatedPostRequest(url, authToken, bodyBytes)
-
-	if err != nil {
-		return 0, fmt.Errorf("error making authenticated POST request: %v", err)
-	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		errorBody, _ := io.ReadAll(resp.Body)
-		fmt.Printf("Error response body: %s\n", errorBody)
-		return 0, fmt.Errorf("CreateProgram API call failed with status code: %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-
 	if err != nil {
-		return 0, fmt.Errorf("error reading response body: %v", err)
+		return 0, wrapICTError(ICT_STEP_PROGRAM, err)
 	}
 
-	programID, err := strconv.Atoi(strings.TrimSpace(string(body)))
-
-	if err != nil {
-		return 0, fmt.Errorf("error converting program ID: %v", err)
-	}
-
-	return programID, nil
+	return c.postForID(ctx, ICT_PROGRAMS_API_PATH, bodyBytes, ICT_STEP_PROGRAM)
 }
 
 // CreateTransmission creates a transmission using the ICT API.
 // Steps:
-// 1. Build the URL for creating a transmission.
-// 2. Convert the contact and program IDs to strings.
-// 3. Marshal the transmission data into JSON.
-// 4. Make an authenticated POST request and check for success (status code 200).
-// 5. Read and convert the response body (transmission ID) into an integer.
+// 1. Convert the contact and program IDs to strings.
+// 2. Marshal the transmission data into JSON.
+// 3. Make an authenticated POST request and check for success (status code 200).
+// 4. Read and convert the response body (transmission ID) into an integer.
 //
 // Parameters:
-//   - userData: User data containing ICT API access information.
-//   - authToken: Authentication token for making authenticated requests.
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
 //   - transmission: Transmission information to be created.
 //   - contactID: The ID of the associated contact.
 //   - accountID: The ID of the associated account.
@@ -461,138 +600,75 @@ func CreateProgram(userData UserData, authToken string, documentID int) (int, er
 //
 // Returns:
 //   - int: The ID of the created transmission.
-//   - error: An error if the creation process fails.
-func CreateTransmission(userData UserData, authToken string, transmission Transmission, contactID, _, programID int) (int, error) {
-
-	url := buildICTReqeustURL(&userData, ICT_TRANSMISSION_API_PATH)
-
+//   - error: An ICTError if the creation process fails.
+func (c *ICTClient) CreateTransmission(ctx context.Context, transmission Transmission, contactID, _, programID int) (int, error) {
 	transmission.ContactID = strconv.Itoa(contactID)
 	transmission.ProgramID = strconv.Itoa(programID)
 
-	convertedTransmission := convertTransmission(transmission)
-
-	bodyBytes, err := json.Marshal(convertedTransmission)
+	convertedTransmission, err := convertTransmission(transmission)
 	if err != nil {
 		return 0, err
 	}
 
-	resp, err := makeAuthenticatedPostRequest(url, authToken, bodyBytes)
-
-	if err != nil {
-		return 0, fmt.Errorf("error making authenticated POST request: %v", err)
-	}
-
-	defer resp.Body.Close()
-
-	fmt.Println("Transmission Request Body:", string(bodyBytes))
-
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("CreateTransmission API call failed with status code: %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-
+	bodyBytes, err := json.Marshal(convertedTransmission)
 	if err != nil {
-		return 0, fmt.Errorf("error reading response body: %v", err)
+		return 0, wrapICTError(ICT_STEP_TRANSMISSION, err)
 	}
 
-	fmt.Println("Transmission Response body is:", string(body))
-
-	transmissionID, _ := strconv.Atoi(string(body))
-
-	return transmissionID, nil
+	return c.postForID(ctx, ICT_TRANSMISSION_API_PATH, bodyBytes, ICT_STEP_TRANSMISSION)
 }
 
 // SendTransmission sends a transmission using the ICT API.
 // Steps:
-// 1. Build the URL for sending a transmission.
+// 1. Build the URI path for sending a transmission.
 // 2. Make an authenticated POST request and check for success (status code 200).
 //
 // Parameters:
-//   - userData: User data containing ICT API access information.
-//   - authToken: Authentication token for making authenticated requests.
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
 //   - transmissionID: The ID of the transmission to be sent.
 //
 // Returns:
-//   - error: An error if the sending process fails.
-func SendTransmission(userData UserData, authToken string, transmissionID int) error {
+//   - error: An ICTError if the sending process fails.
+func (c *ICTClient) SendTransmission(ctx context.Context, transmissionID int) error {
 	transmissionUrl := fmt.Sprintf(ICT_TRANMISSTIONS_WITH_ID_API_PATH, transmissionID)
-	url := buildICTReqeustURL(&userData, transmissionUrl)
 
-	resp, err := makeAuthenticatedPostRequest(url, authToken, nil)
+	resp, err := c.doAuthenticated(ctx, http.MethodPost, transmissionUrl, "", nil)
 	if err != nil {
-		return err
+		return wrapICTError(ICT_STEP_SEND, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Sending transmission failed with status code: %d", resp.StatusCode)
+		return newICTStatusError(ICT_STEP_SEND, resp)
 	}
 
 	return nil
 }
 
-// makeAuthenticatedPostRequest makes an authenticated HTTP POST request to the provided URL.
+// DeleteICTObject deletes an object created on the ICT server.
 // Steps:
-// 1. Create a new HTTP POST request.
-// 2. Set the necessary headers (content type and authorization).
-// 3. Make the request using an HTTP client with a timeout.
-// 4. Return the HTTP response.
+// 1. Build the URI path of the object from the path pattern and the ID.
+// 2. Make an authenticated DELETE request and check for success (status code 200 or 204).
 //
 // Parameters:
-//   - url: The URL for the POST request.
-//   - authToken: Authentication token for making authenticated requests.
-//   - body: The request body.
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
+//   - uriPathPattern: One of the ICT_*_WITH_ID_API_PATH patterns of a deletable object.
+//   - id: The ID of the object.
 //
 // Returns:
-//   - *http.Response: The HTTP response.
-//   - error: An error if the request fails.
-func makeAuthenticatedPostRequest(url, authToken string, body []byte) (*http.Response, error) {
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+//   - error: An error if the deletion fails.
+func (c *ICTClient) DeleteICTObject(ctx context.Context, uriPathPattern string, id int) error {
+	uriPath := fmt.Sprintf(uriPathPattern, id)
 
+	resp, err := c.doAuthenticated(ctx, http.MethodDelete, uriPath, "", nil)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("error deleting '%s': %v", uriPath, err)
 	}
+	defer resp.Body.Close()
 
-	req.Header.Set("Content-Type", "")
-	req.Header.Set("Authorization", "Bearer "+authToken)
-
-	client := &http.Client{
-		Timeout: time.Second * 10,
-	}
-
-	return client.Do(req)
-}
-
-// makeAuthenticatedPostRequestWithBody makes an authenticated HTTP PUT request with a body.
-// Steps:
-// 1. Create a new HTTP PUT request.
-// 2. Set the necessary headers (content type and authorization).
-// 3. Make the request using an HTTP client with a timeout.
-// 4. Return the HTTP response.
-//
-// Parameters:
-//   - url: The URL for the PUT request.
-//   - authToken: Authentication token for making authenticated requests.
-//   - contentType: Content type of the request body.
-//   - body: The request body.
-//
-// Returns:
-//   - *http.Response: The HTTP response.
-//   - error: An error if the request fails.
-func makeAuthenticatedPostRequestWithBody(url, authToken, contentType string, body io.Reader) (*http.Response, error) {
-	req, err := http.NewRequest("PUT", url, body)
-
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Content-Type", contentType)
-	req.Header.Set("Authorization", "Bearer "+authToken)
-
-	client := &http.Client{
-		Timeout: time.Second * 10,
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("deleting '%s' failed with status code: %d", uriPath, resp.StatusCode)
 	}
 
-	return client.Do(req)
+	return nil
 }
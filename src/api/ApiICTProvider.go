@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"io"
+)
+
+// FAX_PROVIDER_ICT is the name of the ICT provider in the registry.
+const FAX_PROVIDER_ICT = "ict"
+
+// The ICT client is the FaxProvider of the ICT API.
+var (
+	_ FaxProvider    = (*ICTClient)(nil)
+	_ FaxBroadcaster = (*ICTClient)(nil)
+	_ FaxJobRunner   = (*ICTClient)(nil)
+
+	_ FaxTransmissionQuerier = (*ICTClient)(nil)
+	_ FaxContactDirectory    = (*ICTClient)(nil)
+)
+
+// newICTFaxProvider creates an ICT client using the retry policy of config.yaml.
+//
+// Parameters:
+//   - userData: User data containing the credentials and the ICT hostname.
+//
+// Returns:
+//   - FaxProvider: The created client.
+//   - error: Always nil.
+func newICTFaxProvider(userData UserData) (FaxProvider, error) {
+	client := NewICTClient(userData)
+	client.SetRetryPolicy(LoadRetryPolicy())
+	return client, nil
+}
+
+// Authenticate returns the cached authentication response of the ICT API,
+// see GetAuthResponse.
+func (c *ICTClient) Authenticate(ctx context.Context) (*AuthResponse, error) {
+	return c.GetAuthResponse(ctx)
+}
+
+// ListAccounts retrieves the accounts of the user from the ICT API, see AccountsICT.
+func (c *ICTClient) ListAccounts(ctx context.Context) ([]AccountResponse, error) {
+	return c.AccountsICT(ctx)
+}
+
+// SendDocument sends a fax through the ICT send pipeline, see SendFaxReaderICT.
+func (c *ICTClient) SendDocument(ctx context.Context, contact Contact, document DocumentRecord, transmission Transmission,
+	file io.Reader, fileModel SendFileInfo) (int, error) {
+
+	return c.SendFaxReaderICT(ctx, contact, document, transmission, file, fileModel)
+}
+
+// BroadcastDocument sends one document to many recipients, see BroadcastFaxICT.
+func (c *ICTClient) BroadcastDocument(ctx context.Context, contacts []Contact, document DocumentRecord, transmission Transmission,
+	source DocumentSource, fileModel SendFileInfo) ([]BroadcastResult, error) {
+
+	return c.BroadcastFaxICT(ctx, contacts, document, transmission, source, fileModel)
+}
+
+// GetStatus retrieves the status of a transmission from the ICT API, see TransmissionStatusICT.
+func (c *ICTClient) GetStatus(ctx context.Context, transmissionID int) (*FaxStatus, error) {
+	transmissionResponse, err := c.TransmissionStatusICT(ctx, transmissionID)
+	if err != nil {
+		return nil, err
+	}
+	return ConvertTransmissionResponseToFaxStatus(transmissionID, *transmissionResponse), nil
+}
+
+// ListTransmissions retrieves the transmissions of the user from the ICT API, see TransmissionsICT.
+func (c *ICTClient) ListTransmissions(ctx context.Context) ([]FaxResponse, error) {
+	return c.TransmissionsICT(ctx)
+}
+
+// SearchContacts searches the contacts stored on the ICT server, see SearchContactsICT.
+func (c *ICTClient) SearchContacts(ctx context.Context, text string, limit int) ([]ContactResponse, error) {
+	return c.SearchContactsICT(ctx, text, limit)
+}
+
+// QueryTransmissions retrieves one page of the transmissions of the user from
+// the ICT API, see QueryTransmissionsICT.
+func (c *ICTClient) QueryTransmissions(ctx context.Context, query TransmissionQuery) (*TransmissionPage, error) {
+	return c.QueryTransmissionsICT(ctx, query)
+}
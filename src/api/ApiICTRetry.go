@@ -0,0 +1,235 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"faxsender/src/utilities"
+	"faxsender/src/utilities/config"
+	"faxsender/src/utilities/logger"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ICT_RETRY_BASE_DELAY is the delay before the first retry, it doubles with
+// every further attempt up to the maximum delay.
+const ICT_RETRY_BASE_DELAY = 500 * time.Millisecond
+
+// RetryPolicy controls how failed ICT calls are retried.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy used without a configuration.
+//
+// Returns:
+//   - RetryPolicy: The default policy.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: utilities.DEFAULT_ICT_RETRY_MAX_ATTEMPTS,
+		BaseDelay:   ICT_RETRY_BASE_DELAY,
+		MaxDelay:    utilities.DEFAULT_ICT_RETRY_MAX_DELAY,
+	}
+}
+
+// LoadRetryPolicy returns the retry policy configured in config.yaml.
+//
+// Returns:
+//   - RetryPolicy: The configured policy.
+func LoadRetryPolicy() RetryPolicy {
+	cfg := *config.Inst()
+
+	return RetryPolicy{
+		MaxAttempts: cfg.GetICTRetryMaxAttempts(),
+		BaseDelay:   ICT_RETRY_BASE_DELAY,
+		MaxDelay:    cfg.GetICTRetryMaxDelay(),
+	}
+}
+
+// Backoff returns the delay before the given retry using exponential backoff
+// with full jitter: a random delay between zero and BaseDelay * 2^(attempt-1),
+// capped at MaxDelay.
+//
+// Parameters:
+//   - attempt: The number of the retry, starting at 1.
+//
+// Returns:
+//   - time.Duration: The delay before the retry.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.MaxDelay
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	// Stop doubling before the shift overflows.
+	if attempt < 32 {
+		exponential := p.BaseDelay << uint(attempt-1)
+		if exponential > 0 && exponential < p.MaxDelay {
+			delay = exponential
+		}
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// retryDelay returns the delay before retrying a failed attempt. The
+// Retry-After header of a 429 or 503 response is honoured, capped at MaxDelay.
+//
+// Parameters:
+//   - attempt: The number of the retry, starting at 1.
+//   - resp: The response of the failed attempt, or nil.
+//
+// Returns:
+//   - time.Duration: The delay before the retry.
+func (p RetryPolicy) retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		retryAfter, ok := ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if ok {
+			if retryAfter > p.MaxDelay {
+				return p.MaxDelay
+			}
+			return retryAfter
+		}
+	}
+
+	return p.Backoff(attempt)
+}
+
+// ParseRetryAfter parses the value of a Retry-After header, given either as
+// a number of seconds or as an HTTP date.
+//
+// Parameters:
+//   - value: The value of the header.
+//   - now: The current time, used for HTTP dates.
+//
+// Returns:
+//   - time.Duration: The delay requested by the server.
+//   - bool: False if the header is missing or invalid.
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	if date.Before(now) {
+		return 0, true
+	}
+	return date.Sub(now), true
+}
+
+// isRetryableICTResponse checks if a failed attempt may be sent again.
+// Idempotent requests are retried on network errors, timeouts and server
+// errors. Other requests are retried only when the ICT server can't have
+// processed them: on 429 and 503, and when the connection could not be opened.
+//
+// Parameters:
+//   - idempotent: True if sending the request twice has the same effect as once.
+//   - resp: The response of the attempt, or nil.
+//   - err: The error of the attempt, or nil.
+//
+// Returns:
+//   - bool: True if the attempt should be retried.
+func isRetryableICTResponse(idempotent bool, resp *http.Response, err error) bool {
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return false
+		}
+
+		var ictErr *ICTError
+		if errors.As(err, &ictErr) {
+			// A failed authentication has already been retried on its own.
+			return false
+		}
+
+		if idempotent {
+			return true
+		}
+
+		var opErr *net.OpError
+		return errors.As(err, &opErr) && opErr.Op == "dial"
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusRequestTimeout, http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+
+	return false
+}
+
+// isIdempotentMethod checks if requests with the HTTP method can be repeated safely.
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// doWithRetry sends a request until it succeeds, fails permanently or the
+// retry policy runs out of attempts.
+// Steps:
+// 1. Send the request.
+// 2. If the attempt failed with a retryable error, log it and wait for the backoff delay.
+// 3. Stop waiting if the context is cancelled.
+//
+// Parameters:
+//   - ctx: The context of the call, cancelling it stops the retries.
+//   - description: Describes the request in the log.
+//   - idempotent: True if sending the request twice has the same effect as once.
+//   - send: Sends one attempt of the request.
+//
+// Returns:
+//   - *http.Response: The response of the last attempt.
+//   - error: The error of the last attempt.
+func (c *ICTClient) doWithRetry(ctx context.Context, description string, idempotent bool,
+	send func() (*http.Response, error)) (*http.Response, error) {
+
+	for attempt := 1; ; attempt++ {
+		resp, err := send()
+
+		if attempt >= c.retryPolicy.MaxAttempts || !isRetryableICTResponse(idempotent, resp, err) {
+			return resp, err
+		}
+
+		delay := c.retryPolicy.retryDelay(attempt, resp)
+
+		reason := fmt.Sprintf("%v", err)
+		if err == nil {
+			reason = fmt.Sprintf("status code %d", resp.StatusCode)
+			resp.Body.Close()
+		}
+		logger.Inst().Info(fmt.Sprintf("retrying %s in %v (attempt %d of %d) after %s",
+			description, delay, attempt+1, c.retryPolicy.MaxAttempts, reason))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"faxsender/src/utilities/logger"
+	"fmt"
+	"time"
+)
+
+// ICT_ROLLBACK_TIMEOUT limits the time spent deleting the objects of a failed send.
+// The rollback doesn't use the context of the send, so it still runs after a cancel.
+const ICT_ROLLBACK_TIMEOUT = 30 * time.Second
+
+// ictCreatedObject is an object created on the ICT server by the send pipeline.
+type ictCreatedObject struct {
+	uriPathPattern string
+	id             int
+}
+
+// ictRollback tracks the ICT objects created by the send pipeline, so they can
+// be deleted when a later step fails.
+type ictRollback struct {
+	client  *ICTClient
+	created []ictCreatedObject
+}
+
+// newICTRollback creates an empty rollback for the given client.
+//
+// Parameters:
+//   - client: The ICT client used to delete the objects.
+//
+// Returns:
+//   - *ictRollback: The created rollback.
+func newICTRollback(client *ICTClient) *ictRollback {
+	return &ictRollback{
+		client: client,
+	}
+}
+
+// track records an object created on the ICT server.
+//
+// Parameters:
+//   - uriPathPattern: The ICT_*_WITH_ID_API_PATH pattern used to delete the object.
+//   - id: The ID of the created object.
+func (r *ictRollback) track(uriPathPattern string, id int) {
+	r.created = append(r.created, ictCreatedObject{
+		uriPathPattern: uriPathPattern,
+		id:             id,
+	})
+}
+
+// run deletes the tracked objects in the reverse order of their creation.
+// Steps:
+// 1. Delete every tracked object, the newest first.
+// 2. Log the objects that could not be deleted.
+// 3. Return the original error of the failed step.
+//
+// Parameters:
+//   - cause: The error of the failed step.
+//
+// Returns:
+//   - error: The cause, rollback failures never hide it.
+func (r *ictRollback) run(cause error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ICT_ROLLBACK_TIMEOUT)
+	defer cancel()
+
+	for i := len(r.created) - 1; i >= 0; i-- {
+		object := r.created[i]
+
+		err := r.client.DeleteICTObject(ctx, object.uriPathPattern, object.id)
+		if err != nil {
+			logger.Inst().Error(fmt.Sprintf("rollback after '%v' failed: %v", cause, err))
+			continue
+		}
+
+		logger.Inst().Info(fmt.Sprintf("rollback deleted '%s'", fmt.Sprintf(object.uriPathPattern, object.id)))
+	}
+
+	r.created = nil
+	return cause
+}
+
+// logIfError logs the error if it is not nil.
+//
+// Parameters:
+//   - err: The error to log.
+func logIfError(err error) {
+	if err != nil {
+		logger.Inst().Error(err.Error())
+	}
+}
@@ -0,0 +1,475 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"faxsender/src/utilities/logger"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Constants for the event types of a send job. A send job is a fax of the
+// outbound queue or a scheduled fax, its ID is the ID of the queued or the
+// scheduled fax. Only the jobs of the queued faxes can be streamed, the
+// events of both are sent to the webhooks.
+const (
+	JOB_EVENT_QUEUED   = "queued"
+	JOB_EVENT_STEP     = "step"
+	JOB_EVENT_RETRYING = "retrying"
+	JOB_EVENT_SENT     = "sent"
+	JOB_EVENT_STATUS   = "status"
+	JOB_EVENT_FAILED   = "failed"
+)
+
+// Constants for the event streams of the send jobs.
+const (
+	JOB_EVENTS_RETENTION       = time.Hour
+	JOB_EVENTS_SYNC_INTERVAL   = QUEUED_FAX_POLL_INTERVAL
+	JOB_EVENTS_KEEPALIVE       = 15 * time.Second
+	SENT_FAX_FOLLOWER_INTERVAL = FAX_QUEUE_POLL_INTERVAL
+	EVENT_STREAM_CONTENT_TYPE  = "text/event-stream"
+	LAST_EVENT_ID_HEADER       = "Last-Event-ID"
+	SSE_DATA_FIELD             = "data:"
+
+	// SEND_FAX_PARAM_ASYNC makes POST send_fax queue the fax and return its send job at once.
+	SEND_FAX_PARAM_ASYNC = "async"
+
+	// JOB_EVENTS_PARAM_LAST_EVENT_ID replaces the Last-Event-ID header for the
+	// clients that can't set it on their first request.
+	JOB_EVENTS_PARAM_LAST_EVENT_ID = "last_event_id"
+)
+
+// JobEvent is an event of a send job, streamed by GET /jobs/:id/events.
+// The events of a job are numbered from 1, a client reconnecting with the
+// Last-Event-ID header only gets the events it missed. The last event of a
+// job is final, the stream ends after it.
+type JobEvent struct {
+	ID             int        `json:"id"`
+	JobID          string     `json:"job_id"`
+	Type           string     `json:"type"`
+	Step           ICTStep    `json:"step,omitempty"`
+	Message        string     `json:"message"`
+	TransmissionID int        `json:"transmission_id,omitempty"`
+	FaxStatus      *FaxStatus `json:"fax_status,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	Final          bool       `json:"final"`
+	Time           time.Time  `json:"time"`
+}
+
+// jobStepMessages describes the steps of the send pipeline once they are done.
+var jobStepMessages = map[ICTStep]string{
+	ICT_STEP_CONTACT:      "contact created",
+	ICT_STEP_DOCUMENT:     "document record created",
+	ICT_STEP_UPLOAD:       "document uploaded",
+	ICT_STEP_PROGRAM:      "program created",
+	ICT_STEP_TRANSMISSION: "transmission created",
+	ICT_STEP_SEND:         "transmission sent",
+}
+
+// jobEventLog holds the events of a send job. changed is closed and replaced
+// whenever an event is added, so the streams waiting on it wake up.
+type jobEventLog struct {
+	events    []JobEvent
+	changed   chan struct{}
+	updatedAt time.Time
+}
+
+// The event logs are kept in memory, a job queued before the daemon started
+// gets its events from the stored state of the queued fax, see syncJobEvents.
+var (
+	jobEventLogs      = make(map[string]*jobEventLog)
+	jobEventLogsMutex sync.Mutex
+)
+
+// sendProgressKey is the context key of the function reporting the steps of the send pipeline.
+type sendProgressKey struct{}
+
+// WithSendProgress returns a context reporting the steps of the send pipeline
+// run with it. The steps restored from the checkpoint of a resumed fax job are
+// reported too, so every send reports all the steps.
+//
+// Parameters:
+//   - ctx: The context of the send.
+//   - onStep: Called after each step of the pipeline.
+//
+// Returns:
+//   - context.Context: The context to send the fax with.
+func WithSendProgress(ctx context.Context, onStep func(step ICTStep)) context.Context {
+	return context.WithValue(ctx, sendProgressKey{}, onStep)
+}
+
+// reportSendProgress reports a finished step of the send pipeline to the
+// function of the context, if any.
+func reportSendProgress(ctx context.Context, step ICTStep) {
+	if onStep, ok := ctx.Value(sendProgressKey{}).(func(step ICTStep)); ok {
+		onStep(step)
+	}
+}
+
+// newJobStepEvent creates the event of a finished step of the send pipeline.
+func newJobStepEvent(jobID string, step ICTStep) JobEvent {
+	return JobEvent{JobID: jobID, Type: JOB_EVENT_STEP, Step: step, Message: jobStepMessages[step]}
+}
+
+// publishJobEvent adds an event to the log of its job and wakes the streams
+// following the job. The events published after the final event are dropped.
+//
+// Parameters:
+//   - event: The event, its ID and time are set here.
+func publishJobEvent(event JobEvent) {
+	jobEventLogsMutex.Lock()
+	defer jobEventLogsMutex.Unlock()
+
+	publishJobEventLocked(event)
+}
+
+// publishJobEventLocked adds an event to the log of its job, the caller holds jobEventLogsMutex.
+func publishJobEventLocked(event JobEvent) {
+	now := time.Now()
+
+	log, ok := jobEventLogs[event.JobID]
+	if !ok {
+		pruneJobEventLogs(now.Add(-JOB_EVENTS_RETENTION))
+		log = &jobEventLog{changed: make(chan struct{})}
+		jobEventLogs[event.JobID] = log
+	}
+	if log.isFinal() {
+		return
+	}
+
+	event.ID = len(log.events) + 1
+	event.Time = now
+	log.events = append(log.events, event)
+	log.updatedAt = now
+
+	close(log.changed)
+	log.changed = make(chan struct{})
+
+	notifyWebhooks(event)
+}
+
+// pruneJobEventLogs removes the logs of the finished jobs last updated before
+// the given time, the caller holds jobEventLogsMutex.
+func pruneJobEventLogs(before time.Time) {
+	for jobID, log := range jobEventLogs {
+		if log.isFinal() && log.updatedAt.Before(before) {
+			delete(jobEventLogs, jobID)
+		}
+	}
+}
+
+// isFinal checks if the final event of the job has been published.
+func (l *jobEventLog) isFinal() bool {
+	return len(l.events) > 0 && l.events[len(l.events)-1].Final
+}
+
+// hasEvent checks if an event of the given type has been published.
+func (l *jobEventLog) hasEvent(eventType string) bool {
+	for _, event := range l.events {
+		if event.Type == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// jobEventsAfter returns the events of a job following the given event.
+//
+// Parameters:
+//   - jobID: The ID of the job.
+//   - lastEventID: The ID of the last event the caller has, zero for all the events.
+//
+// Returns:
+//   - []JobEvent: The events following lastEventID.
+//   - <-chan struct{}: Closed when the next event is published, nil once the
+//     final event has been published or if the job has no events.
+func jobEventsAfter(jobID string, lastEventID int) ([]JobEvent, <-chan struct{}) {
+	jobEventLogsMutex.Lock()
+	defer jobEventLogsMutex.Unlock()
+
+	log, ok := jobEventLogs[jobID]
+	if !ok {
+		return nil, nil
+	}
+
+	var events []JobEvent
+	if lastEventID >= 0 && lastEventID < len(log.events) {
+		events = append(events, log.events[lastEventID:]...)
+	}
+
+	if log.isFinal() {
+		return events, nil
+	}
+	return events, log.changed
+}
+
+// syncJobEvents adds the events of the stored state of a queued fax the log of
+// its job misses. They are missed when the fax was queued before the daemon
+// started, or when another process sends it or follows its delivery. The
+// final status of a fax whose delivery has been followed to the end is
+// restored from the queued fax. The delivery itself is only followed by the
+// queue that sent the fax and by the follower of the daemon, see RunSentFaxFollower.
+//
+// Parameters:
+//   - jobID: The ID of the queued fax.
+//
+// Returns:
+//   - error: An ApiError if the queued fax doesn't exist, or an error if it can not be read.
+func syncJobEvents(jobID string) error {
+	queuedFaxesMutex.Lock()
+	defer queuedFaxesMutex.Unlock()
+
+	queuedFax, err := LoadQueuedFax(jobID)
+	if err != nil {
+		return err
+	}
+
+	jobEventLogsMutex.Lock()
+	defer jobEventLogsMutex.Unlock()
+
+	log, ok := jobEventLogs[jobID]
+	if !ok {
+		publishJobEventLocked(newJobQueuedEvent(jobID))
+		log = jobEventLogs[jobID]
+	}
+
+	switch queuedFax.Status {
+	case QUEUED_FAX_STATUS_SENT:
+		if !log.hasEvent(JOB_EVENT_SENT) {
+			publishJobEventLocked(newJobSentEvent(jobID, queuedFax.TransmissionID))
+		}
+		if queuedFax.DeliveryFollowed && !log.isFinal() {
+			publishJobEventLocked(newJobFinalStatusEvent(jobID, queuedFax.FaxStatus, queuedFax.DeliveryError))
+		}
+	case QUEUED_FAX_STATUS_FAILED:
+		if !log.isFinal() {
+			publishJobEventLocked(newJobFailedEvent(jobID, queuedFax.LastError))
+		}
+	}
+
+	return nil
+}
+
+// RunSentFaxFollower follows the delivery of the sent queued faxes until the
+// context is cancelled, so their final status is published and sent to the
+// webhooks even if the process that sent them stopped, or is the UI. A fax
+// is followed by one poller at a time, see followJobDeliveryOnce, the end of
+// its delivery is saved with the queued fax and it is not followed again after a restart.
+//
+// Parameters:
+//   - ctx: The context of the follower, cancelling it stops following.
+//   - api: The API the status is fetched with.
+//   - interval: The time between two reads of the queue, the default is used if zero.
+func RunSentFaxFollower(ctx context.Context, api IApiUICalls, interval time.Duration) {
+	if interval <= 0 {
+		interval = SENT_FAX_FOLLOWER_INTERVAL
+	}
+
+	for {
+		followSentFaxes(ctx, api)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// followSentFaxes starts following the delivery of the sent queued faxes that
+// are not followed yet.
+//
+// Parameters:
+//   - ctx: The context of the follower.
+//   - api: The API the status is fetched with.
+func followSentFaxes(ctx context.Context, api IApiUICalls) {
+	queuedFaxes, err := LoadQueuedFaxes()
+	if err != nil {
+		logger.Inst().Error(fmt.Sprintf("error loading the queued faxes: %v", err))
+		return
+	}
+
+	for _, queuedFax := range queuedFaxes {
+		if queuedFax.Status != QUEUED_FAX_STATUS_SENT || queuedFax.DeliveryFollowed {
+			continue
+		}
+
+		if err := syncJobEvents(queuedFax.ID); err != nil {
+			logger.Inst().Error(fmt.Sprintf("error syncing the events of the queued fax %s: %v", queuedFax.ID, err))
+			continue
+		}
+		go followJobDeliveryOnce(ctx, api, queuedFax.ID, queuedFax.TransmissionID)
+	}
+}
+
+// newJobQueuedEvent creates the first event of a job.
+func newJobQueuedEvent(jobID string) JobEvent {
+	return JobEvent{JobID: jobID, Type: JOB_EVENT_QUEUED, Message: "the fax has been queued"}
+}
+
+// newJobSentEvent creates the event of a fax handed to the fax server.
+func newJobSentEvent(jobID string, transmissionID int) JobEvent {
+	return JobEvent{
+		JobID:          jobID,
+		Type:           JOB_EVENT_SENT,
+		Message:        fmt.Sprintf("the fax has been sent as transmission %d", transmissionID),
+		TransmissionID: transmissionID,
+	}
+}
+
+// newJobFailedEvent creates the final event of a fax that could not be sent.
+func newJobFailedEvent(jobID string, lastError string) JobEvent {
+	return JobEvent{JobID: jobID, Type: JOB_EVENT_FAILED, Message: "the fax could not be sent", Error: lastError, Final: true}
+}
+
+// The jobs whose delivery is followed in this process, so each is polled once.
+var (
+	followedJobs      = make(map[string]bool)
+	followedJobsMutex sync.Mutex
+)
+
+// followJobDeliveryOnce follows the delivery of a sent fax, see followJobDelivery,
+// unless it is already followed in this process.
+//
+// Parameters:
+//   - ctx: The context of the polling, cancelling it stops following without a final event.
+//   - api: The API the status is fetched with.
+//   - jobID: The ID of the queued or the scheduled fax.
+//   - transmissionID: The ID of the transmission of the fax.
+func followJobDeliveryOnce(ctx context.Context, api IApiUICalls, jobID string, transmissionID int) {
+	followedJobsMutex.Lock()
+	if followedJobs[jobID] {
+		followedJobsMutex.Unlock()
+		return
+	}
+	followedJobs[jobID] = true
+	followedJobsMutex.Unlock()
+
+	defer func() {
+		followedJobsMutex.Lock()
+		delete(followedJobs, jobID)
+		followedJobsMutex.Unlock()
+	}()
+
+	followJobDelivery(ctx, api, jobID, transmissionID)
+}
+
+// followJobDelivery publishes the delivery status changes of a sent fax until
+// the status is final. The last status is the final event of the job, it
+// carries the error if the status could not be followed to the end. The end
+// of the delivery of a queued fax is saved with it.
+//
+// Parameters:
+//   - ctx: The context of the polling, cancelling it stops following without a final event.
+//   - api: The API the status is fetched with.
+//   - jobID: The ID of the queued or the scheduled fax.
+//   - transmissionID: The ID of the transmission of the fax.
+func followJobDelivery(ctx context.Context, api IApiUICalls, jobID string, transmissionID int) {
+	faxStatus, err := NewFaxStatusPoller(api, 0, 0).Follow(ctx, transmissionID, func(faxStatus FaxStatus) {
+		if !faxStatus.IsFinal {
+			publishJobEvent(newJobStatusEvent(jobID, &faxStatus))
+		}
+	})
+	if ctx.Err() != nil {
+		return
+	}
+
+	deliveryError := ""
+	if err != nil {
+		deliveryError = err.Error()
+	}
+	publishJobEvent(newJobFinalStatusEvent(jobID, faxStatus, deliveryError))
+	logIfError(saveQueuedFaxDelivery(jobID, faxStatus, deliveryError))
+}
+
+// newJobFinalStatusEvent creates the final event of a sent fax, the status may be nil.
+//
+// Parameters:
+//   - jobID: The ID of the job.
+//   - faxStatus: The last delivery status.
+//   - deliveryError: The error that stopped following the status, empty if the status is final.
+//
+// Returns:
+//   - JobEvent: The final status event.
+func newJobFinalStatusEvent(jobID string, faxStatus *FaxStatus, deliveryError string) JobEvent {
+	event := newJobStatusEvent(jobID, faxStatus)
+	event.Final = true
+	if deliveryError != "" {
+		event.Message = "the delivery status is no longer followed"
+		event.Error = deliveryError
+	}
+	return event
+}
+
+// newJobStatusEvent creates the event of a delivery status, the status may be nil.
+func newJobStatusEvent(jobID string, faxStatus *FaxStatus) JobEvent {
+	event := JobEvent{JobID: jobID, Type: JOB_EVENT_STATUS, FaxStatus: faxStatus}
+	if faxStatus != nil {
+		event.TransmissionID = faxStatus.TransmissionID
+		event.Message = fmt.Sprintf("the transmission is %s", faxStatus.Status)
+	}
+	return event
+}
+
+// followJobEvents calls onEvent with the events of a job until its final event.
+// Steps:
+// 1. Add the events of the stored state of the queued fax the log misses.
+// 2. Pass the events following lastEventID to onEvent.
+// 3. Wait for the next event, syncing the stored state again at every sync
+// interval, and call onIdle when no event came.
+//
+// Parameters:
+//   - ctx: The context of the stream, cancelling it stops following.
+//   - jobID: The ID of the queued fax.
+//   - lastEventID: The ID of the last event the caller has, zero for all the events.
+//   - onEvent: Called with every event, an error stops following.
+//   - onIdle: Called when no event came during a sync interval, it may be nil.
+//
+// Returns:
+//   - error: An ApiError if the job doesn't exist, the error of a callback, or the error of the context.
+func followJobEvents(ctx context.Context, jobID string, lastEventID int, onEvent func(JobEvent) error, onIdle func() error) error {
+	for {
+		if err := syncJobEvents(jobID); err != nil {
+			return err
+		}
+
+		events, changed := jobEventsAfter(jobID, lastEventID)
+		for _, event := range events {
+			if err := onEvent(event); err != nil {
+				return err
+			}
+			lastEventID = event.ID
+		}
+		if changed == nil {
+			return nil
+		}
+
+		timer := time.NewTimer(JOB_EVENTS_SYNC_INTERVAL)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+			if onIdle != nil {
+				if err := onIdle(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// writeJobEvent writes an event in the Server-Sent Events format, the JSON
+// data holds no line break.
+func writeJobEvent(w io.Writer, event JobEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
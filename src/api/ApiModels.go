@@ -1,10 +1,14 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"faxsender/src/utilities"
+	"fmt"
+	"io"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,14 +16,26 @@ import (
 const (
 	EMPTY_FIELD string = "N/A"
 
-	API_UI_AUTHENTICATION    = "authentication"
-	API_UI_SAVE_SETTINGS     = "save_settings"
-	API_UI_LOAD_SETTINGS     = "load_settings"
-	API_UI_LOAD_ACCOUNT_INFO = "load_account_info"
-	API_UI_LOGOUT            = "logout"
-	API_UI_GET_LAST_FAXES    = "load_faxes"
-	API_UI_GET_ALL_ACCOUNTS  = "load_accounts"
-	API_UI_SEND_FAX          = "send_fax"
+	API_UI_AUTHENTICATION     = "authentication"
+	API_UI_SAVE_SETTINGS      = "save_settings"
+	API_UI_LOAD_SETTINGS      = "load_settings"
+	API_UI_LOAD_ACCOUNT_INFO  = "load_account_info"
+	API_UI_LOGOUT             = "logout"
+	API_UI_TRANSMISSIONS      = "transmissions"
+	API_UI_CONTACTS           = "contacts"
+	API_UI_COVER_PAGES        = "cover_pages"
+	API_UI_GET_ALL_ACCOUNTS   = "load_accounts"
+	API_UI_SEND_FAX           = "send_fax"
+	API_UI_FAX_STATUS         = "fax_status"
+	API_UI_BROADCAST_FAX      = "broadcast_fax"
+	API_UI_SCHEDULED_FAXES    = "scheduled_faxes"
+	API_UI_QUEUE              = "queue"
+	API_UI_JOBS               = "jobs"
+	API_UI_JOB_EVENTS         = "events"
+	API_UI_FAX_HISTORY        = "fax_history"
+	API_UI_SYNC_FAX_HISTORY   = "fax_history/sync"
+	API_UI_WEBHOOKS           = "webhooks"
+	API_UI_WEBHOOK_DELIVERIES = "deliveries"
 )
 
 // AccountInfo represents user account information shown on the second tab.
@@ -32,22 +48,38 @@ type AccountInfo struct {
 	Company   string `json:"company"`
 }
 
-// IApiUICalls represents the interface as dependency injection for the api calls
+// IApiUICalls represents the interface as dependency injection for the api calls.
+// Cancelling the context of a call aborts its in-flight request.
 type IApiUICalls interface {
-	GetAccountInfo() (*AccountInfo, error)
-	SaveSettings(userData UserData) error
-	LoadSettings() (*UserData, error)
-	Logout() error
-	GetLastFaxes(count int) ([]FaxData, error)
-	GetAllAccounts() ([]AccountResponse, error)
-	SendFax(contact Contact, document DocumentRecord, transmission Transmission, file []byte, fileModel SendFileInfo) error
+	GetAccountInfo(ctx context.Context) (*AccountInfo, error)
+	SaveSettings(ctx context.Context, userData UserData) error
+	LoadSettings(ctx context.Context) (*UserData, error)
+	Logout(ctx context.Context) error
+	QueryTransmissions(ctx context.Context, query TransmissionQuery) (*TransmissionPage, error)
+	GetAllAccounts(ctx context.Context) ([]AccountResponse, error)
+	SearchContacts(ctx context.Context, text string, limit int) ([]ContactResponse, error)
+	GetCoverPageTemplates(ctx context.Context) ([]string, error)
+	SendFax(ctx context.Context, contact Contact, document DocumentRecord, transmission Transmission, file []byte, fileModel SendFileInfo) (int, error)
+	SendFaxReader(ctx context.Context, contact Contact, document DocumentRecord, transmission Transmission, file io.Reader, fileModel SendFileInfo) (int, error)
+	GetFaxStatus(ctx context.Context, transmissionID int) (*FaxStatus, error)
+	BroadcastFax(ctx context.Context, contacts []Contact, document DocumentRecord, transmission Transmission, file []byte, fileModel SendFileInfo) ([]BroadcastResult, error)
+	ScheduleFax(ctx context.Context, contact Contact, document DocumentRecord, transmission Transmission, file io.Reader, fileModel SendFileInfo, sendAt time.Time) (*ScheduledFax, error)
+	GetScheduledFaxes(ctx context.Context) ([]ScheduledFax, error)
+	RescheduleFax(ctx context.Context, scheduledID string, sendAt time.Time) (*ScheduledFax, error)
+	CancelScheduledFax(ctx context.Context, scheduledID string) error
+	EnqueueFax(ctx context.Context, contact Contact, document DocumentRecord, transmission Transmission, file io.Reader, fileModel SendFileInfo) (*QueuedFax, error)
+	GetQueuedFax(ctx context.Context, queuedID string) (*QueuedFax, error)
+	GetQueuedFaxes(ctx context.Context) ([]QueuedFax, error)
+	FollowJobEvents(ctx context.Context, jobID string, lastEventID int, onEvent func(JobEvent)) error
+	SearchFaxHistory(ctx context.Context, query FaxHistoryQuery) (*FaxHistoryPage, error)
+	SyncFaxHistory(ctx context.Context) error
 }
 
 // UserData represents user credentials to log in.
 type UserData struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Hostname string `json:"host"`
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Hostname string `json:"host" binding:"required"`
 }
 
 // Contact represents contact information for fax destination.
@@ -55,7 +87,7 @@ type Contact struct {
 	FirstName   string `json:"first_name"`
 	LastName    string `json:"last_name"`
 	Email       string `json:"email"`
-	Phone       string `json:"phone"`
+	Phone       string `json:"phone" binding:"required"`
 	Address     string `json:"address"`
 	Custom1     string `json:"custom1"`
 	Custom2     string `json:"custom2"`
@@ -84,6 +116,18 @@ type Transmission struct {
 	IsPrint     string `json:"is_print"`
 	IsCoverPage string `json:"is_coverpage"`
 	TryAllowed  string `json:"try_allowed"`
+
+	// CoverPageTemplate names the local cover page template added before the
+	// first page of the document, the cover page of the fax server isn't used then.
+	CoverPageTemplate string `json:"cover_page_template,omitempty"`
+
+	// UploadFormat is the format images are uploaded in, one of the
+	// utilities.UPLOAD_FORMAT_* constants, PDF when empty. The TIFF formats
+	// are rendered with the FaxResolution, standard when empty, and with
+	// dithering instead of a threshold when Dithering is set.
+	UploadFormat  string `json:"upload_format,omitempty"`
+	FaxResolution string `json:"fax_resolution,omitempty"`
+	Dithering     bool   `json:"dithering,omitempty"`
 }
 
 // ConvertedTransmission represents the converted transmission data.
@@ -122,26 +166,73 @@ type AccountResponse struct {
 	Company   string `json:"company"`
 }
 
-// FaxData represents fax-related data shown on the third tab.
+// ContactResponse represents a contact stored on the ICT server.
+type ContactResponse struct {
+	ContactID   string `json:"contact_id"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	Email       string `json:"email"`
+	Phone       string `json:"phone" binding:"required"`
+	Address     string `json:"address"`
+	Description string `json:"description"`
+}
+
+// FaxData represents a transmission returned by the transmission query.
 type FaxData struct {
+	TransmissionID int       `json:"transmission_id"`
 	DateTime       time.Time `json:"last_run"`
 	Title          string    `json:"title"`
 	DestinationFax string    `json:"contact_phone"`
 	CallerID       string    `json:"account_phone"`
+	AccountID      string    `json:"account_id,omitempty"`
 	Status         string    `json:"status"`
+	IsPrint        string    `json:"is_print"`
 }
 
 // FaxResponse represents the response containing fax details from api call.
 type FaxResponse struct {
+	TransmissionID string `json:"transmission_id"`
 	DateTime       string `json:"last_run"`
 	Title          string `json:"title"`
 	DestinationFax string `json:"contact_phone"`
 	CallerID       string `json:"account_phone"`
+	AccountID      string `json:"account_id"`
 	Status         string `json:"status"`
 	Is_Print       string `json:"is_print"`
 	DateTimeParsed time.Time
 }
 
+// TransmissionResponse represents the response containing a single transmission from api call.
+type TransmissionResponse struct {
+	TransmissionID string `json:"transmission_id"`
+	Title          string `json:"title"`
+	Status         string `json:"status"`
+	Response       string `json:"response"`
+	TryAllowed     string `json:"try_allowed"`
+	TryDone        string `json:"try_done"`
+	DateTime       string `json:"last_run"`
+	DestinationFax string `json:"contact_phone"`
+	CallerID       string `json:"account_phone"`
+}
+
+// FaxStatus represents the delivery status of a sent fax.
+type FaxStatus struct {
+	TransmissionID int       `json:"transmission_id"`
+	Title          string    `json:"title"`
+	Status         string    `json:"status"`
+	Response       string    `json:"response"`
+	TryDone        int       `json:"try_done"`
+	DateTime       time.Time `json:"last_run"`
+	DestinationFax string    `json:"contact_phone"`
+	IsFinal        bool      `json:"is_final"`
+}
+
+// SendResult represents the response of the send fax api call.
+type SendResult struct {
+	Message        string `json:"message"`
+	TransmissionID int    `json:"transmission_id"`
+}
+
 // SendFileInfo represents information about the file Content-Type.
 type SendFileInfo struct {
 	ContentType string `json:"content_type"`
@@ -233,9 +324,9 @@ func ConvertAuthResponseToAccountInfo(res AuthResponse) *AccountInfo {
 // Steps:
 // 1. Create a slice of FaxData with the same length as the provided filtered fax responses.
 // 2. Iterate over each FaxResponse in the provided list, converting each response to a FaxData instance.
-// 3. Parse the DateTime field of each FaxResponse to a Unix timestamp and convert it to a time.Time object.
+// 3. Parse the DateTime field of each FaxResponse to a Unix timestamp and convert it to a time.Time object,
+// it is left zero if the timestamp is invalid.
 // 4. Populate the FaxData fields with values from the corresponding FaxResponse.
-// 5. Append the converted FaxData to the result slice.
 //
 // Parameters:
 //   - res: A slice of FaxResponse containing filtered fax response data.
@@ -246,37 +337,128 @@ func ConvertFilteredFaxResponsesToFaxData(res []FaxResponse) []FaxData {
 	faxDataList := make([]FaxData, len(res))
 
 	for i, response := range res {
+		transmissionID, _ := strconv.Atoi(response.TransmissionID)
+		faxDataList[i] = FaxData{
+			TransmissionID: transmissionID,
+			Title:          response.Title,
+			DestinationFax: response.DestinationFax,
+			CallerID:       response.CallerID,
+			AccountID:      response.AccountID,
+			Status:         response.Status,
+			IsPrint:        response.Is_Print,
+		}
+
 		lastRunTimestamp, err := strconv.ParseInt(response.DateTime, 10, 64)
 		if err == nil {
-			lastRunTime := time.Unix(lastRunTimestamp, 0)
-			faxDataList[i] = FaxData{
-				DateTime:       lastRunTime,
-				Title:          response.Title,
-				DestinationFax: response.DestinationFax,
-				CallerID:       response.CallerID,
-				Status:         response.Status,
-			}
+			faxDataList[i].DateTime = time.Unix(lastRunTimestamp, 0)
 		}
 	}
 
 	return faxDataList
 }
 
+// ConvertTransmissionResponseToFaxStatus converts TransmissionResponse to FaxStatus.
+//
+// Steps:
+// 1. Parse the numeric and timestamp fields of the response.
+// 2. Check if the status is a final state of the transmission.
+//
+// Parameters:
+//   - transmissionID: The ID of the transmission.
+//   - res: TransmissionResponse containing the transmission data.
+//
+// Returns:
+//   - *FaxStatus: A pointer to the FaxStatus struct with values converted from the TransmissionResponse.
+func ConvertTransmissionResponseToFaxStatus(transmissionID int, res TransmissionResponse) *FaxStatus {
+	tryDone, _ := strconv.Atoi(res.TryDone)
+
+	faxStatus := &FaxStatus{
+		TransmissionID: transmissionID,
+		Title:          res.Title,
+		Status:         res.Status,
+		Response:       res.Response,
+		TryDone:        tryDone,
+		DestinationFax: res.DestinationFax,
+		IsFinal:        IsFinalFaxStatus(res.Status),
+	}
+
+	lastRunTimestamp, err := strconv.ParseInt(res.DateTime, 10, 64)
+	if err == nil {
+		faxStatus.DateTime = time.Unix(lastRunTimestamp, 0)
+	}
+
+	return faxStatus
+}
+
+// IsFinalFaxStatus checks if a transmission status is a final state.
+//
+// Parameters:
+//   - status: The status reported by the ICT API.
+//
+// Returns:
+//   - bool: True if the transmission will not change anymore.
+func IsFinalFaxStatus(status string) bool {
+	normalized := strings.ToLower(strings.TrimSpace(status))
+	normalized = strings.ReplaceAll(normalized, "_", " ")
+
+	switch normalized {
+	case ICT_STATUS_DONE, ICT_STATUS_COMPLETED, ICT_STATUS_FAILED, ICT_STATUS_BUSY, ICT_STATUS_NO_ANSWER, "noanswer":
+		return true
+	}
+	return false
+}
+
+// IsDeliveredFaxStatus checks if a transmission status means the fax was delivered.
+//
+// Parameters:
+//   - status: The status reported by the ICT API.
+//
+// Returns:
+//   - bool: True if the transmission completed successfully.
+func IsDeliveredFaxStatus(status string) bool {
+	normalized := strings.ToLower(strings.TrimSpace(status))
+
+	return normalized == ICT_STATUS_DONE || normalized == ICT_STATUS_COMPLETED
+}
+
+// parseAccountID converts the account ID of a transmission to its int value.
+//
+// Parameters:
+//   - accountID: The account ID of the transmission.
+//
+// Returns:
+//   - int: The account ID.
+//   - error: An invalid_request ApiError if the account ID is not a number.
+func parseAccountID(accountID string) (int, error) {
+	parsed, err := strconv.Atoi(strings.TrimSpace(accountID))
+	if err != nil {
+		return 0, NewApiError(ERROR_CODE_INVALID_REQUEST, fmt.Sprintf("the account ID '%s' is not a number", accountID))
+	}
+
+	return parsed, nil
+}
+
 // convertTransmission converts Transmission to ConvertedTransmission (string fields to int fields).
 //
 // Steps:
-// 1. Convert string fields of the provided Transmission to their corresponding int values.
-// 2. Create an instance of ConvertedTransmission using the converted int values.
+// 1. Convert the account ID, it must be a number.
+// 2. Convert the other string fields of the provided Transmission to their corresponding int values.
+// 3. Create an instance of ConvertedTransmission using the converted int values.
 //
 // Parameters:
 //   - transmission: The original Transmission instance with string fields.
 //
 // Returns:
 //   - ConvertedTransmission: An instance of ConvertedTransmission with int fields.
-func convertTransmission(transmission Transmission) ConvertedTransmission {
+//   - error: An invalid_request ApiError if the account ID is not a number.
+func convertTransmission(transmission Transmission) (ConvertedTransmission, error) {
+	accountID, err := parseAccountID(transmission.AccountID)
+	if err != nil {
+		return ConvertedTransmission{}, err
+	}
+
 	contactID, _ := strconv.Atoi(transmission.ContactID)
 	programID, _ := strconv.Atoi(transmission.ProgramID)
-	accountID, _ := strconv.Atoi(transmission.AccountID)
 	isPrint, _ := strconv.Atoi(transmission.IsPrint)
 	isCoverPage, _ := strconv.Atoi(transmission.IsCoverPage)
 	tryAllowed, _ := strconv.Atoi(transmission.TryAllowed)
@@ -291,5 +473,5 @@ func convertTransmission(transmission Transmission) ConvertedTransmission {
 		TryAllowed:  tryAllowed,
 	}
 
-	return converted
+	return converted, nil
 }
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"encoding/json"
+	"faxsender/src/utilities"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Constants for the OpenAPI document of the v2 API.
+const (
+	OPENAPI_VERSION     = "3.0.3"
+	OPENAPI_API_VERSION = "2.0.0"
+	OPENAPI_SCHEMAS_REF = "#/components/schemas/"
+	OPENAPI_BEARER_AUTH = "bearerAuth"
+)
+
+// openApiSchemaObject is a schema, or any other object, of the OpenAPI document.
+type openApiSchemaObject map[string]interface{}
+
+// openApiParameter is a path or query parameter of an operation.
+type openApiParameter struct {
+	Name        string              `json:"name"`
+	In          string              `json:"in"`
+	Description string              `json:"description,omitempty"`
+	Required    bool                `json:"required,omitempty"`
+	Schema      openApiSchemaObject `json:"schema"`
+}
+
+// timeType is the type of the time fields, written as RFC 3339 strings.
+var timeType = reflect.TypeOf(time.Time{})
+
+// rawMessageType is the type of the JSON documents embedded as they are, written as objects.
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// generateOpenApiDocument generates the OpenAPI document of the v2 API from its routes.
+// Steps:
+// 1. Describe every route as an operation of its path.
+// 2. Generate the schemas of the request and response bodies from the Go
+// types, so the document follows the models.
+// 3. Require the API token on every operation.
+//
+// Parameters:
+//   - routes: The routes of the v2 API.
+//
+// Returns:
+//   - the OpenAPI document, marshaled as JSON by the route serving it
+func generateOpenApiDocument(routes []v2Route) openApiSchemaObject {
+	schemas := openApiSchemaObject{}
+	paths := openApiSchemaObject{}
+	errorResponse := openApiSchemaObject{
+		"description": "Error",
+		"content":     jsonContent(openApiSchema(reflect.TypeOf(ErrorEnvelope{}), schemas)),
+	}
+
+	for _, route := range routes {
+		operation := openApiSchemaObject{
+			"operationId": route.operationID,
+			"summary":     route.summary,
+			"responses": openApiSchemaObject{
+				httpStatusKey(route.status): openApiResponse(route, schemas),
+				"default":                   errorResponse,
+			},
+		}
+
+		if len(route.parameters) > 0 {
+			operation["parameters"] = route.parameters
+		}
+
+		if route.request != nil {
+			schema := openApiSchema(reflect.TypeOf(route.request), schemas)
+			content := jsonContent(schema)
+			if route.multipart {
+				content = multipartFaxContent(schema)
+			}
+			operation["requestBody"] = openApiSchemaObject{"required": true, "content": content}
+		}
+
+		openApiPath := openApiPathTemplate(route.path)
+		item, ok := paths[openApiPath].(openApiSchemaObject)
+		if !ok {
+			item = openApiSchemaObject{}
+			paths[openApiPath] = item
+		}
+		item[strings.ToLower(route.method)] = operation
+	}
+
+	return openApiSchemaObject{
+		"openapi": OPENAPI_VERSION,
+		"info": openApiSchemaObject{
+			"title":   utilities.APP_NAME + " daemon API",
+			"version": OPENAPI_API_VERSION,
+		},
+		"servers":  []openApiSchemaObject{{"url": utilities.API_V2_PATHS}},
+		"security": []openApiSchemaObject{{OPENAPI_BEARER_AUTH: []string{}}},
+		"paths":    paths,
+		"components": openApiSchemaObject{
+			"schemas": schemas,
+			"securitySchemes": openApiSchemaObject{
+				OPENAPI_BEARER_AUTH: openApiSchemaObject{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "The API token stored in the " + utilities.API_TOKEN_FILE_NAME + " file of the daemon",
+				},
+			},
+		},
+	}
+}
+
+// openApiResponse describes the success response of an operation.
+func openApiResponse(route v2Route, schemas openApiSchemaObject) openApiSchemaObject {
+	response := openApiSchemaObject{"description": http.StatusText(route.status)}
+	if route.response == nil {
+		return response
+	}
+
+	schema := openApiSchema(reflect.TypeOf(route.response), schemas)
+	if route.eventStream {
+		response["content"] = eventStreamContent(schema)
+	} else {
+		response["content"] = jsonContent(schema)
+	}
+	return response
+}
+
+// jsonContent describes a JSON body.
+func jsonContent(schema openApiSchemaObject) openApiSchemaObject {
+	return openApiSchemaObject{utilities.JSON_CONTENT_TYPE: openApiSchemaObject{"schema": schema}}
+}
+
+// eventStreamContent describes a stream of Server-Sent Events, the data of
+// every event is a JSON object of the schema.
+func eventStreamContent(eventSchema openApiSchemaObject) openApiSchemaObject {
+	return openApiSchemaObject{EVENT_STREAM_CONTENT_TYPE: openApiSchemaObject{"schema": eventSchema}}
+}
+
+// multipartFaxContent describes the multipart body of POST /faxes, the fax
+// part holds the JSON metadata and the document part the file.
+func multipartFaxContent(faxSchema openApiSchemaObject) openApiSchemaObject {
+	return openApiSchemaObject{
+		"multipart/form-data": openApiSchemaObject{
+			"schema": openApiSchemaObject{
+				"type":     "object",
+				"required": []string{V2_FAX_FIELD_NAME, V2_DOCUMENT_FIELD_NAME},
+				"properties": openApiSchemaObject{
+					V2_FAX_FIELD_NAME:      faxSchema,
+					V2_DOCUMENT_FIELD_NAME: openApiSchemaObject{"type": "string", "format": "binary"},
+				},
+			},
+			"encoding": openApiSchemaObject{
+				V2_FAX_FIELD_NAME: openApiSchemaObject{"contentType": utilities.JSON_CONTENT_TYPE},
+			},
+		},
+	}
+}
+
+// openApiSchema generates the schema of a Go type. The structs are added to
+// the schemas of the components and referenced, their properties are the JSON
+// fields and their required fields are tagged as required.
+//
+// Parameters:
+//   - t: The Go type.
+//   - schemas: The schemas of the components, completed with the structs.
+//
+// Returns:
+//   - the schema, or the reference to the schema of a struct
+func openApiSchema(t reflect.Type, schemas openApiSchemaObject) openApiSchemaObject {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return openApiSchemaObject{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return openApiSchemaObject{"type": "object"}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return openApiSchemaObject{"type": "string", "format": "byte"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return openApiSchemaObject{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return openApiSchemaObject{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return openApiSchemaObject{"type": "number"}
+	case reflect.String:
+		return openApiSchemaObject{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return openApiSchemaObject{"type": "array", "items": openApiSchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return openApiSchemaObject{"type": "object", "additionalProperties": openApiSchema(t.Elem(), schemas)}
+	case reflect.Struct:
+		return openApiStructSchema(t, schemas)
+	}
+	return openApiSchemaObject{}
+}
+
+// openApiStructSchema adds the schema of a struct to the schemas of the
+// components, once, and returns the reference to it.
+func openApiStructSchema(t reflect.Type, schemas openApiSchemaObject) openApiSchemaObject {
+	ref := openApiSchemaObject{"$ref": OPENAPI_SCHEMAS_REF + t.Name()}
+	if _, ok := schemas[t.Name()]; ok {
+		return ref
+	}
+
+	properties := openApiSchemaObject{}
+	schema := openApiSchemaObject{"type": "object", "properties": properties}
+	// The struct is added before its fields, so recursive types end.
+	schemas[t.Name()] = schema
+
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := jsonFieldName(field)
+		if name == "" {
+			continue
+		}
+
+		properties[name] = openApiSchema(field.Type, schemas)
+		if field.Tag.Get(REQUIRED_TAG) == REQUIRED {
+			required = append(required, name)
+		}
+	}
+
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return ref
+}
+
+// jsonFieldName returns the JSON name of a struct field, or empty if the
+// field isn't marshaled.
+func jsonFieldName(field reflect.StructField) string {
+	if field.PkgPath != "" || field.Anonymous {
+		return ""
+	}
+
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	}
+	return name
+}
+
+// openApiPathTemplate converts a Gin path to an OpenAPI path template,
+// ":id" becomes "{id}".
+func openApiPathTemplate(ginPath string) string {
+	segments := strings.Split("/"+ginPath, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// httpStatusKey returns the key of a status code in the responses of an operation.
+func httpStatusKey(status int) string {
+	return strconv.Itoa(status)
+}
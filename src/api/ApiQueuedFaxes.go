@@ -0,0 +1,396 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"faxsender/src/utilities"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Constants for the states of a queued fax.
+const (
+	QUEUED_FAX_STATUS_QUEUED  = "queued"
+	QUEUED_FAX_STATUS_SENDING = "sending"
+	QUEUED_FAX_STATUS_SENT    = "sent"
+	QUEUED_FAX_STATUS_FAILED  = "failed"
+)
+
+// Constants for the claims of the queued faxes. A process sending a fax holds
+// its lock file and refreshes it, a lock older than the lease is left by a
+// crashed process and may be taken over.
+const (
+	QUEUED_FAX_LOCK_EXTENSION = ".lock"
+	QUEUED_FAX_CLAIM_LEASE    = 2 * time.Minute
+	QUEUED_FAX_CLAIM_REFRESH  = QUEUED_FAX_CLAIM_LEASE / 4
+)
+
+// QueuedFax represents a send request of the outbound queue stored under the
+// working directory. Sent and failed faxes are kept for a while, so their
+// state can still be read after the document has been removed.
+type QueuedFax struct {
+	ID               string         `json:"id"`
+	Status           string         `json:"status"`
+	Contact          Contact        `json:"contact"`
+	Document         DocumentRecord `json:"document"`
+	Transmission     Transmission   `json:"transmission"`
+	FileModel        SendFileInfo   `json:"file_model"`
+	TransmissionID   int            `json:"transmission_id,omitempty"`
+	Attempts         int            `json:"attempts"`
+	LastError        string         `json:"last_error,omitempty"`
+	NextAttemptAt    time.Time      `json:"next_attempt_at"`
+	FaxStatus        *FaxStatus     `json:"fax_status,omitempty"`
+	DeliveryError    string         `json:"delivery_error,omitempty"`
+	DeliveryFollowed bool           `json:"delivery_followed,omitempty"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+}
+
+// IsFinal checks if the queued fax has been sent or has failed.
+func (q *QueuedFax) IsFinal() bool {
+	return q.Status == QUEUED_FAX_STATUS_SENT || q.Status == QUEUED_FAX_STATUS_FAILED
+}
+
+// queuedFaxesMutex serializes the changes of the queued faxes in this process,
+// so the workers and the routes don't overwrite each other. The workers of
+// different processes are kept apart by the lock files of the faxes.
+var queuedFaxesMutex sync.Mutex
+
+// getQueuedFaxFilePath returns the path of a file of the queued fax.
+func getQueuedFaxFilePath(queuedID string, extension string) (string, error) {
+	queuePath, err := utilities.GetQueuePath()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(queuePath, queuedID+extension), nil
+}
+
+// CreateQueuedFax stores a send request in the outbound queue.
+// Steps:
+// 1. Create the queue directory if it doesn't exist.
+// 2. Stream the document to the document file of the queued fax.
+// 3. Store the request as queued.
+//
+// Parameters:
+//   - contact: Contact information for the fax transmission.
+//   - document: Document information for the fax transmission.
+//   - transmission: Transmission information for the fax.
+//   - file: Reader of the document file, it is read to the end.
+//   - fileModel: Information about the document file content type.
+//
+// Returns:
+//   - *QueuedFax: The stored queued fax.
+//   - error: An error if the document can not be read or the queued fax can not be stored.
+func CreateQueuedFax(contact Contact, document DocumentRecord, transmission Transmission, file io.Reader,
+	fileModel SendFileInfo) (*QueuedFax, error) {
+
+	queuePath, err := utilities.GetQueuePath()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(queuePath, FAX_JOB_DIRECTORY_PERMISSION)
+	if err != nil {
+		return nil, err
+	}
+
+	queuedID, err := newStoredFaxID()
+	if err != nil {
+		return nil, err
+	}
+
+	documentFilePath, err := getQueuedFaxFilePath(queuedID, FAX_JOB_DOCUMENT_EXTENSION)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeDocumentFile(documentFilePath, file)
+	if err != nil {
+		os.Remove(documentFilePath)
+		return nil, err
+	}
+
+	now := time.Now()
+	queuedFax := &QueuedFax{
+		ID:            queuedID,
+		Status:        QUEUED_FAX_STATUS_QUEUED,
+		Contact:       contact,
+		Document:      document,
+		Transmission:  transmission,
+		FileModel:     fileModel,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+
+	err = SaveQueuedFax(queuedFax)
+	if err != nil {
+		os.Remove(documentFilePath)
+		return nil, err
+	}
+
+	return queuedFax, nil
+}
+
+// SaveQueuedFax writes the queued fax to the queue directory.
+//
+// Parameters:
+//   - queuedFax: The queued fax to save.
+//
+// Returns:
+//   - error: An error if the queued fax can not be written.
+func SaveQueuedFax(queuedFax *QueuedFax) error {
+	queuedFilePath, err := getQueuedFaxFilePath(queuedFax.ID, FAX_JOB_FILE_EXTENSION)
+	if err != nil {
+		return err
+	}
+
+	queuedFax.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(queuedFax, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return utilities.WriteFileAtomic(queuedFilePath, data, FAX_JOB_FILE_PERMISSION)
+}
+
+// LoadQueuedFax reads a queued fax from the queue directory.
+//
+// Parameters:
+//   - queuedID: The ID of the queued fax.
+//
+// Returns:
+//   - *QueuedFax: The loaded queued fax.
+//   - error: An ApiError if the queued fax doesn't exist, or an error if it can not be read.
+func LoadQueuedFax(queuedID string) (*QueuedFax, error) {
+	if !isValidStoredFaxID(queuedID) {
+		return nil, NewApiError(ERROR_CODE_NOT_FOUND, fmt.Sprintf("the queued fax '%s' doesn't exist", queuedID))
+	}
+
+	queuedFilePath, err := getQueuedFaxFilePath(queuedID, FAX_JOB_FILE_EXTENSION)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(queuedFilePath)
+	if os.IsNotExist(err) {
+		return nil, NewApiError(ERROR_CODE_NOT_FOUND, fmt.Sprintf("the queued fax '%s' doesn't exist", queuedID))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var queuedFax QueuedFax
+	err = json.Unmarshal(data, &queuedFax)
+	if err != nil {
+		return nil, fmt.Errorf("the queued fax file '%s' is corrupted: %v", queuedFilePath, err)
+	}
+
+	return &queuedFax, nil
+}
+
+// LoadQueuedFaxes reads all queued faxes, the oldest first.
+//
+// Returns:
+//   - []*QueuedFax: The stored queued faxes, corrupted files are skipped.
+//   - error: An error if the queue directory can not be read.
+func LoadQueuedFaxes() ([]*QueuedFax, error) {
+	queuePath, err := utilities.GetQueuePath()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(queuePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	queuedFaxes := make([]*QueuedFax, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), FAX_JOB_FILE_EXTENSION) {
+			continue
+		}
+
+		queuedFax, err := LoadQueuedFax(strings.TrimSuffix(entry.Name(), FAX_JOB_FILE_EXTENSION))
+		if err != nil {
+			continue
+		}
+		queuedFaxes = append(queuedFaxes, queuedFax)
+	}
+
+	sort.Slice(queuedFaxes, func(i, j int) bool {
+		return queuedFaxes[i].CreatedAt.Before(queuedFaxes[j].CreatedAt)
+	})
+
+	return queuedFaxes, nil
+}
+
+// QueuedFaxDocumentSource returns the source of the document of a queued fax.
+//
+// Parameters:
+//   - queuedID: The ID of the queued fax.
+//
+// Returns:
+//   - DocumentSource: The source reading the document from the queue directory.
+//   - error: An error if the queue directory can not be found.
+func QueuedFaxDocumentSource(queuedID string) (DocumentSource, error) {
+	documentFilePath, err := getQueuedFaxFilePath(queuedID, FAX_JOB_DOCUMENT_EXTENSION)
+	if err != nil {
+		return nil, err
+	}
+
+	return FileDocumentSource(documentFilePath), nil
+}
+
+// RemoveQueuedFaxDocument removes the document of a queued fax once it is no longer needed.
+//
+// Parameters:
+//   - queuedID: The ID of the queued fax.
+//
+// Returns:
+//   - error: An error if the document can not be removed.
+func RemoveQueuedFaxDocument(queuedID string) error {
+	documentFilePath, err := getQueuedFaxFilePath(queuedID, FAX_JOB_DOCUMENT_EXTENSION)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(documentFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ClaimQueuedFax creates the lock file of a queued fax, so only one process
+// sends it even if the daemon and the UI both run the queue. A lock whose
+// lease has expired is taken over, see utilities.CreateLockFile.
+//
+// Parameters:
+//   - queuedID: The ID of the queued fax.
+//
+// Returns:
+//   - bool: False if another worker holds the fax.
+//   - error: An error if the lock file can not be created.
+func ClaimQueuedFax(queuedID string) (bool, error) {
+	lockFilePath, err := getQueuedFaxFilePath(queuedID, QUEUED_FAX_LOCK_EXTENSION)
+	if err != nil {
+		return false, err
+	}
+
+	return utilities.CreateLockFile(lockFilePath, QUEUED_FAX_CLAIM_LEASE)
+}
+
+// RefreshQueuedFaxClaim extends the lease of the lock of a queued fax.
+//
+// Parameters:
+//   - queuedID: The ID of the queued fax.
+//
+// Returns:
+//   - error: An error if the lock file can not be touched.
+func RefreshQueuedFaxClaim(queuedID string) error {
+	lockFilePath, err := getQueuedFaxFilePath(queuedID, QUEUED_FAX_LOCK_EXTENSION)
+	if err != nil {
+		return err
+	}
+
+	return utilities.RefreshLockFile(lockFilePath)
+}
+
+// ReleaseQueuedFax removes the lock file of a queued fax.
+//
+// Parameters:
+//   - queuedID: The ID of the queued fax.
+//
+// Returns:
+//   - error: An error if the lock file can not be removed.
+func ReleaseQueuedFax(queuedID string) error {
+	lockFilePath, err := getQueuedFaxFilePath(queuedID, QUEUED_FAX_LOCK_EXTENSION)
+	if err != nil {
+		return err
+	}
+
+	return utilities.RemoveLockFile(lockFilePath)
+}
+
+// isQueuedFaxClaimed checks if a worker holds the lock of a queued fax within its lease.
+func isQueuedFaxClaimed(queuedID string) bool {
+	lockFilePath, err := getQueuedFaxFilePath(queuedID, QUEUED_FAX_LOCK_EXTENSION)
+	if err != nil {
+		return false
+	}
+
+	return utilities.IsLockFileHeld(lockFilePath, QUEUED_FAX_CLAIM_LEASE)
+}
+
+// PruneQueuedFaxes removes the sent and failed faxes last updated before the given time.
+//
+// Parameters:
+//   - before: The time the removed faxes were last updated before.
+//
+// Returns:
+//   - error: An error if the queue directory can not be read.
+func PruneQueuedFaxes(before time.Time) error {
+	queuedFaxesMutex.Lock()
+	defer queuedFaxesMutex.Unlock()
+
+	queuedFaxes, err := LoadQueuedFaxes()
+	if err != nil {
+		return err
+	}
+
+	for _, queuedFax := range queuedFaxes {
+		if !queuedFax.IsFinal() || !queuedFax.UpdatedAt.Before(before) {
+			continue
+		}
+
+		logIfError(RemoveQueuedFaxDocument(queuedFax.ID))
+
+		queuedFilePath, err := getQueuedFaxFilePath(queuedFax.ID, FAX_JOB_FILE_EXTENSION)
+		if err != nil {
+			return err
+		}
+		logIfError(os.Remove(queuedFilePath))
+	}
+
+	return nil
+}
+
+// saveQueuedFaxDelivery saves the end of the delivery of a sent queued fax, so
+// it is not followed again and its final status can be restored.
+//
+// Parameters:
+//   - queuedID: The ID of the queued fax, a scheduled fax has none and is ignored.
+//   - faxStatus: The last delivery status, nil if none has been read.
+//   - deliveryError: The error that stopped following the status, empty if the status is final.
+//
+// Returns:
+//   - error: An error if the queued fax can not be read or written.
+func saveQueuedFaxDelivery(queuedID string, faxStatus *FaxStatus, deliveryError string) error {
+	queuedFaxesMutex.Lock()
+	defer queuedFaxesMutex.Unlock()
+
+	queuedFax, err := LoadQueuedFax(queuedID)
+	var apiErr *ApiError
+	if errors.As(err, &apiErr) && apiErr.Code == ERROR_CODE_NOT_FOUND {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	queuedFax.FaxStatus = faxStatus
+	queuedFax.DeliveryError = deliveryError
+	queuedFax.DeliveryFollowed = true
+	return SaveQueuedFax(queuedFax)
+}
@@ -0,0 +1,357 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"faxsender/src/utilities"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Constants for the states of a scheduled fax.
+const (
+	SCHEDULED_FAX_STATUS_PENDING = "pending"
+	SCHEDULED_FAX_STATUS_SENDING = "sending"
+	SCHEDULED_FAX_STATUS_FAILED  = "failed"
+)
+
+// STORED_FAX_ID_SIZE is the number of random bytes of the ID of a scheduled or queued fax.
+const STORED_FAX_ID_SIZE = 16
+
+// ScheduledFax represents a send request stored under the working directory
+// until it comes due.
+type ScheduledFax struct {
+	ID           string         `json:"id"`
+	SendAt       time.Time      `json:"send_at"`
+	Status       string         `json:"status"`
+	Contact      Contact        `json:"contact"`
+	Document     DocumentRecord `json:"document"`
+	Transmission Transmission   `json:"transmission"`
+	FileModel    SendFileInfo   `json:"file_model"`
+	Attempts     int            `json:"attempts"`
+	LastError    string         `json:"last_error,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+}
+
+// RescheduleRequest is the body of the reschedule route.
+type RescheduleRequest struct {
+	SendAt time.Time `json:"send_at"`
+}
+
+// scheduledFaxesMutex serializes the changes of the scheduled faxes in this
+// process, so the scheduler and the routes don't overwrite each other.
+var scheduledFaxesMutex sync.Mutex
+
+// getScheduledFaxFilePath returns the path of a file of the scheduled fax.
+func getScheduledFaxFilePath(scheduledID string, extension string) (string, error) {
+	scheduledPath, err := utilities.GetScheduledPath()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(scheduledPath, scheduledID+extension), nil
+}
+
+// newStoredFaxID returns a new random ID for a scheduled or queued fax.
+func newStoredFaxID() (string, error) {
+	id := make([]byte, STORED_FAX_ID_SIZE)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// isValidStoredFaxID checks that an ID can't point outside the directory of the stored faxes.
+func isValidStoredFaxID(id string) bool {
+	_, err := hex.DecodeString(id)
+	return err == nil && len(id) == 2*STORED_FAX_ID_SIZE
+}
+
+// CreateScheduledFax stores a send request to be sent at the given time.
+// Steps:
+// 1. Create the scheduled faxes directory if it doesn't exist.
+// 2. Stream the document to the document file of the scheduled fax.
+// 3. Store the request as pending.
+//
+// Parameters:
+//   - contact: Contact information for the fax transmission.
+//   - document: Document information for the fax transmission.
+//   - transmission: Transmission information for the fax.
+//   - file: Reader of the document file, it is read to the end.
+//   - fileModel: Information about the document file content type.
+//   - sendAt: The time the fax is sent at.
+//
+// Returns:
+//   - *ScheduledFax: The stored scheduled fax.
+//   - error: An error if the document can not be read or the scheduled fax can not be stored.
+func CreateScheduledFax(contact Contact, document DocumentRecord, transmission Transmission, file io.Reader,
+	fileModel SendFileInfo, sendAt time.Time) (*ScheduledFax, error) {
+
+	if sendAt.IsZero() {
+		return nil, NewApiError(ERROR_CODE_INVALID_REQUEST, "the send time of the fax is missing")
+	}
+
+	scheduledPath, err := utilities.GetScheduledPath()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(scheduledPath, FAX_JOB_DIRECTORY_PERMISSION)
+	if err != nil {
+		return nil, err
+	}
+
+	scheduledID, err := newStoredFaxID()
+	if err != nil {
+		return nil, err
+	}
+
+	documentFilePath, err := getScheduledFaxFilePath(scheduledID, FAX_JOB_DOCUMENT_EXTENSION)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeDocumentFile(documentFilePath, file)
+	if err != nil {
+		os.Remove(documentFilePath)
+		return nil, err
+	}
+
+	now := time.Now()
+	scheduledFax := &ScheduledFax{
+		ID:           scheduledID,
+		SendAt:       sendAt,
+		Status:       SCHEDULED_FAX_STATUS_PENDING,
+		Contact:      contact,
+		Document:     document,
+		Transmission: transmission,
+		FileModel:    fileModel,
+		CreatedAt:    now,
+	}
+
+	err = SaveScheduledFax(scheduledFax)
+	if err != nil {
+		os.Remove(documentFilePath)
+		return nil, err
+	}
+
+	return scheduledFax, nil
+}
+
+// writeDocumentFile streams a document to a file only readable by the owner.
+func writeDocumentFile(filePath string, file io.Reader) error {
+	documentFile, err := os.OpenFile(filePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, FAX_JOB_FILE_PERMISSION)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(documentFile, file)
+	closeErr := documentFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// SaveScheduledFax writes the scheduled fax to the scheduled faxes directory.
+//
+// Parameters:
+//   - scheduledFax: The scheduled fax to save.
+//
+// Returns:
+//   - error: An error if the scheduled fax can not be written.
+func SaveScheduledFax(scheduledFax *ScheduledFax) error {
+	scheduledFilePath, err := getScheduledFaxFilePath(scheduledFax.ID, FAX_JOB_FILE_EXTENSION)
+	if err != nil {
+		return err
+	}
+
+	scheduledFax.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(scheduledFax, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return utilities.WriteFileAtomic(scheduledFilePath, data, FAX_JOB_FILE_PERMISSION)
+}
+
+// LoadScheduledFax reads a scheduled fax from the scheduled faxes directory.
+//
+// Parameters:
+//   - scheduledID: The ID of the scheduled fax.
+//
+// Returns:
+//   - *ScheduledFax: The loaded scheduled fax.
+//   - error: An ApiError if the scheduled fax doesn't exist, or an error if it can not be read.
+func LoadScheduledFax(scheduledID string) (*ScheduledFax, error) {
+	if !isValidStoredFaxID(scheduledID) {
+		return nil, NewApiError(ERROR_CODE_NOT_FOUND, fmt.Sprintf("the scheduled fax '%s' doesn't exist", scheduledID))
+	}
+
+	scheduledFilePath, err := getScheduledFaxFilePath(scheduledID, FAX_JOB_FILE_EXTENSION)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(scheduledFilePath)
+	if os.IsNotExist(err) {
+		return nil, NewApiError(ERROR_CODE_NOT_FOUND, fmt.Sprintf("the scheduled fax '%s' doesn't exist", scheduledID))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var scheduledFax ScheduledFax
+	err = json.Unmarshal(data, &scheduledFax)
+	if err != nil {
+		return nil, fmt.Errorf("the scheduled fax file '%s' is corrupted: %v", scheduledFilePath, err)
+	}
+
+	return &scheduledFax, nil
+}
+
+// LoadScheduledFaxes reads all scheduled faxes, the earliest first.
+//
+// Returns:
+//   - []*ScheduledFax: The stored scheduled faxes, corrupted files are skipped.
+//   - error: An error if the scheduled faxes directory can not be read.
+func LoadScheduledFaxes() ([]*ScheduledFax, error) {
+	scheduledPath, err := utilities.GetScheduledPath()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(scheduledPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	scheduledFaxes := make([]*ScheduledFax, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), FAX_JOB_FILE_EXTENSION) {
+			continue
+		}
+
+		scheduledFax, err := LoadScheduledFax(strings.TrimSuffix(entry.Name(), FAX_JOB_FILE_EXTENSION))
+		if err != nil {
+			continue
+		}
+		scheduledFaxes = append(scheduledFaxes, scheduledFax)
+	}
+
+	sort.Slice(scheduledFaxes, func(i, j int) bool {
+		return scheduledFaxes[i].SendAt.Before(scheduledFaxes[j].SendAt)
+	})
+
+	return scheduledFaxes, nil
+}
+
+// ScheduledFaxDocumentSource returns the source of the document of a scheduled fax.
+//
+// Parameters:
+//   - scheduledID: The ID of the scheduled fax.
+//
+// Returns:
+//   - DocumentSource: The source reading the document from the scheduled faxes directory.
+//   - error: An error if the scheduled faxes directory can not be found.
+func ScheduledFaxDocumentSource(scheduledID string) (DocumentSource, error) {
+	documentFilePath, err := getScheduledFaxFilePath(scheduledID, FAX_JOB_DOCUMENT_EXTENSION)
+	if err != nil {
+		return nil, err
+	}
+
+	return FileDocumentSource(documentFilePath), nil
+}
+
+// RemoveScheduledFax removes a scheduled fax and its document.
+//
+// Parameters:
+//   - scheduledID: The ID of the scheduled fax.
+//
+// Returns:
+//   - error: An error if the files can not be removed.
+func RemoveScheduledFax(scheduledID string) error {
+	for _, extension := range []string{FAX_JOB_FILE_EXTENSION, FAX_JOB_DOCUMENT_EXTENSION} {
+		filePath, err := getScheduledFaxFilePath(scheduledID, extension)
+		if err != nil {
+			return err
+		}
+
+		err = os.Remove(filePath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RescheduleScheduledFax moves a pending or failed scheduled fax to a new time.
+// A failed scheduled fax becomes pending again.
+//
+// Parameters:
+//   - scheduledID: The ID of the scheduled fax.
+//   - sendAt: The new time the fax is sent at.
+//
+// Returns:
+//   - *ScheduledFax: The rescheduled fax.
+//   - error: An ApiError if the fax doesn't exist or is being sent.
+func RescheduleScheduledFax(scheduledID string, sendAt time.Time) (*ScheduledFax, error) {
+	if sendAt.IsZero() {
+		return nil, NewApiError(ERROR_CODE_INVALID_REQUEST, "the send time of the fax is missing")
+	}
+
+	scheduledFaxesMutex.Lock()
+	defer scheduledFaxesMutex.Unlock()
+
+	scheduledFax, err := LoadScheduledFax(scheduledID)
+	if err != nil {
+		return nil, err
+	}
+
+	if scheduledFax.Status == SCHEDULED_FAX_STATUS_SENDING {
+		return nil, NewApiError(ERROR_CODE_CONFLICT, "the scheduled fax is being sent")
+	}
+
+	scheduledFax.SendAt = sendAt
+	scheduledFax.Status = SCHEDULED_FAX_STATUS_PENDING
+	scheduledFax.Attempts = 0
+	scheduledFax.LastError = ""
+
+	return scheduledFax, SaveScheduledFax(scheduledFax)
+}
+
+// CancelScheduledFax removes a scheduled fax that is not being sent.
+//
+// Parameters:
+//   - scheduledID: The ID of the scheduled fax.
+//
+// Returns:
+//   - error: An ApiError if the fax doesn't exist or is being sent.
+func CancelScheduledFax(scheduledID string) error {
+	scheduledFaxesMutex.Lock()
+	defer scheduledFaxesMutex.Unlock()
+
+	scheduledFax, err := LoadScheduledFax(scheduledID)
+	if err != nil {
+		return err
+	}
+
+	if scheduledFax.Status == SCHEDULED_FAX_STATUS_SENDING {
+		return NewApiError(ERROR_CODE_CONFLICT, "the scheduled fax is being sent")
+	}
+
+	return RemoveScheduledFax(scheduledID)
+}
@@ -1,171 +1,751 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"faxsender/src/utilities"
+	"faxsender/src/utilities/config"
 	"faxsender/src/utilities/logger"
+	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"path"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// directCall is shared by all routes, so the fax provider and its cached session
+// are reused between requests.
+var directCall = &ApiServerDirectCalls{}
+
+// faxScheduler sends the scheduled faxes of the daemon with the shared directCall.
+var faxScheduler = NewFaxScheduler(directCall, 0)
+
+// faxQueue sends the queued faxes of this process with the shared directCall,
+// the number of workers is read from the config when it starts.
+var faxQueue = NewFaxQueue(directCall, 0, 0)
+
 // InitRouters initializes API routes on the provided Gin router.
-// It defines paths for various API endpoints and assigns routes for each endpoint.
+// It defines paths for various API endpoints and assigns routes for each endpoint,
+// the v1 routes and the resources of the v2 API with its OpenAPI document.
+// The routes pass the context of the request to the provider calls, so a client
+// disconnecting cancels the calls it started. Every route requires the API token.
 //
 // Parameters:
 //   - router: A pointer to the Gin router.
-func InitRouters(router *gin.Engine) {
+//   - apiToken: The token of the daemon REST API, see LoadOrCreateApiToken.
+func InitRouters(router *gin.Engine, apiToken string) {
+	router.Use(ApiTokenMiddleware(apiToken))
+	router.NoRoute(routeNotFound)
+	initV2Routers(router)
 
 	authtenticationPath := path.Join(utilities.API_PATHS, API_UI_AUTHENTICATION)
 	saveSettings := path.Join(utilities.API_PATHS, API_UI_SAVE_SETTINGS)
 	loadSettings := path.Join(utilities.API_PATHS, API_UI_LOAD_SETTINGS)
 	loadAccountInfo := path.Join(utilities.API_PATHS, API_UI_LOAD_ACCOUNT_INFO)
 	logout := path.Join(utilities.API_PATHS, API_UI_LOGOUT)
-	getLastFaxes := path.Join(utilities.API_PATHS, API_UI_GET_LAST_FAXES)
+	transmissions := path.Join(utilities.API_PATHS, API_UI_TRANSMISSIONS)
 	loadAllAccounts := path.Join(utilities.API_PATHS, API_UI_GET_ALL_ACCOUNTS)
+	contacts := path.Join(utilities.API_PATHS, API_UI_CONTACTS)
+	coverPages := path.Join(utilities.API_PATHS, API_UI_COVER_PAGES)
 	sendFax := path.Join(utilities.API_PATHS, API_UI_SEND_FAX)
+	faxStatus := path.Join(utilities.API_PATHS, API_UI_FAX_STATUS, ":id")
+	broadcastFax := path.Join(utilities.API_PATHS, API_UI_BROADCAST_FAX)
+	scheduledFaxes := path.Join(utilities.API_PATHS, API_UI_SCHEDULED_FAXES)
+	scheduledFax := path.Join(utilities.API_PATHS, API_UI_SCHEDULED_FAXES, ":id")
+	queue := path.Join(utilities.API_PATHS, API_UI_QUEUE)
+	queuedFax := path.Join(utilities.API_PATHS, API_UI_QUEUE, ":id")
+	job := path.Join(utilities.API_PATHS, API_UI_JOBS, ":id")
+	jobEvents := path.Join(utilities.API_PATHS, API_UI_JOBS, ":id", API_UI_JOB_EVENTS)
+	faxHistory := path.Join(utilities.API_PATHS, API_UI_FAX_HISTORY)
+	syncFaxHistory := path.Join(utilities.API_PATHS, API_UI_SYNC_FAX_HISTORY)
+	webhooks := path.Join(utilities.API_PATHS, API_UI_WEBHOOKS)
+	webhook := path.Join(utilities.API_PATHS, API_UI_WEBHOOKS, ":id")
+	webhookDeliveries := path.Join(utilities.API_PATHS, API_UI_WEBHOOKS, ":id", API_UI_WEBHOOK_DELIVERIES)
 
 	router.GET(authtenticationPath, routeAuthentication)
 	router.POST(saveSettings, routeSaveSettings)
 	router.GET(loadSettings, routeLoadSettings)
 	router.GET(loadAccountInfo, routeAccountInfo)
 	router.GET(logout, routeLogout)
-	router.GET(getLastFaxes, routeLastFaxes)
+	router.GET(transmissions, routeQueryTransmissions)
 	router.GET(loadAllAccounts, routeLoadAllAccounts)
+	router.GET(contacts, routeSearchContacts)
+	router.GET(coverPages, routeCoverPages)
 	router.POST(sendFax, routeSendFax)
+	router.GET(faxStatus, routeFaxStatus)
+	router.POST(broadcastFax, routeBroadcastFax)
+	router.GET(scheduledFaxes, routeScheduledFaxes)
+	router.PUT(scheduledFax, routeRescheduleFax)
+	router.DELETE(scheduledFax, routeCancelScheduledFax)
+	router.POST(queue, routeEnqueueFax)
+	router.GET(queue, routeQueuedFaxes)
+	router.GET(queuedFax, routeQueuedFax)
+	router.GET(job, routeQueuedFax)
+	router.GET(jobEvents, routeJobEvents)
+	router.GET(faxHistory, routeFaxHistory)
+	router.POST(syncFaxHistory, routeSyncFaxHistory)
+	router.POST(webhooks, routeCreateWebhook)
+	router.GET(webhooks, routeWebhooks)
+	router.GET(webhook, routeWebhook)
+	router.PUT(webhook, routeUpdateWebhook)
+	router.DELETE(webhook, routeDeleteWebhook)
+	router.GET(webhookDeliveries, routeWebhookDeliveries)
+}
+
+// ResumeUnfinishedFaxJobs resumes the fax jobs left unfinished by a previous
+// run of the daemon in the background, using the shared fax provider. The jobs
+// of the queued and the scheduled faxes are resumed by the queue and the scheduler.
+func ResumeUnfinishedFaxJobs() {
+	go directCall.ResumeUnfinishedFaxJobs(context.Background())
+}
+
+// StartFaxScheduler starts the scheduler sending the scheduled faxes in the background.
+func StartFaxScheduler() {
+	go faxScheduler.Run(context.Background())
+}
+
+// StartFaxQueue starts the workers sending the queued faxes in the background,
+// both the daemon and the UI run them. The faxes left queued or sending by a
+// previous run are recovered first.
+func StartFaxQueue() {
+	go faxQueue.Run(context.Background())
+}
+
+// StartSentFaxFollower starts following the delivery of the sent queued faxes
+// in the background, the daemon runs it so the final status of a fax reaches
+// the webhooks even if the UI sent it or the daemon restarted.
+func StartSentFaxFollower() {
+	go RunSentFaxFollower(context.Background(), directCall, 0)
+}
+
+// StartFaxHistorySync starts syncing the fax history with the ICT transmissions
+// list in the background, both the daemon and the UI run it.
+func StartFaxHistorySync() {
+	go RunFaxHistorySync(context.Background(), directCall, 0)
+}
+
+// StartWebhookDeliveries resumes the webhook deliveries left pending by a
+// previous run of the daemon in the background.
+func StartWebhookDeliveries() {
+	go ResumeWebhookDeliveries(context.Background())
+}
+
+// sendFaxForm holds the fields of a send fax request shared by all recipients.
+// The file is the last part of the multipart body, it is read while it arrives.
+type sendFaxForm struct {
+	document     DocumentRecord
+	transmission Transmission
+	fileModel    SendFileInfo
+	sendAt       time.Time
+	file         io.Reader
 }
 
 // routeSendFax handles the API route for sending a fax.
 // It follows these steps:
-// 1. Load user data from the settings file.
-// 2. Authenticate the user and get an authentication token.
-// 3. Parse and handle the multipart form data.
-// 4. Extract relevant form values and files from the request.
-// 5. Unmarshal JSON data into respective structures.
-// 6. Read file contents.
-// 7. Send the fax using user data, authentication token, and other relevant data.
+// 1. Parse the multipart form fields into the contact and the shared fields.
+// 2. Stream the file part to the jobs directory and from there to the fax provider.
+// 3. Return the ID of the sent transmission.
+// A request with a send_at field is stored and sent by the scheduler instead,
+// the scheduled fax is returned then. A request with the async=true query
+// parameter is added to the outbound queue and its send job is returned at
+// once, its progress is streamed by GET /jobs/:id/events.
 //
 // Parameters:
 //   - c: Gin context for the HTTP request.
 func routeSendFax(c *gin.Context) {
-	err := c.Request.ParseMultipartForm(utilities.TWO_GB_SIZE)
+	var contact Contact
+	form, ok := parseSendFaxForm(c, "contact", &contact)
+	if !ok {
+		return
+	}
+
+	if !form.sendAt.IsZero() {
+		scheduled, err := directCall.ScheduleFax(c.Request.Context(), contact, form.document, form.transmission, form.file, form.fileModel, form.sendAt)
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+
+		faxScheduler.Wake()
+		c.JSON(http.StatusAccepted, scheduled)
+		return
+	}
+
+	if c.Query(SEND_FAX_PARAM_ASYNC) == "true" {
+		enqueueFax(c, contact, form)
+		return
+	}
+
+	transmissionID, err := directCall.SendFaxReader(c.Request.Context(), contact, form.document, form.transmission, form.file, form.fileModel)
 	if err != nil {
-		logger.Inst().Error(err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse multipart form"})
+		respondWithError(c, err)
 		return
 	}
+	c.JSON(http.StatusOK, SendResult{
+		Message:        "fax sent successfully",
+		TransmissionID: transmissionID,
+	})
+}
 
-	contactJSON := c.Request.FormValue("contact")
-	documentJSON := c.Request.FormValue("document")
-	transmissionJSON := c.Request.FormValue("transmission")
-	fileModelJSON := c.Request.FormValue("fileModel")
-	file, _, err := c.Request.FormFile("file")
+// routeBroadcastFax handles the API route for sending one fax to many recipients.
+// It follows these steps:
+// 1. Parse the multipart form fields into the contacts and the shared fields.
+// 2. Stream the file part to a temporary file.
+// 3. Broadcast the fax, uploading the document only once.
+// 4. Return the result of each recipient.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeBroadcastFax(c *gin.Context) {
+	var contacts []Contact
+	form, ok := parseSendFaxForm(c, "contacts", &contacts)
+	if !ok {
+		return
+	}
+
+	spoolFilePath, err := spoolDocument(form.file, (*config.Inst()).GetMaxUploadSize())
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	defer os.Remove(spoolFilePath)
+
+	results, err := directCall.broadcastFaxSource(c.Request.Context(), contacts, form.document, form.transmission,
+		FileDocumentSource(spoolFilePath), form.fileModel)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// parseSendFaxForm parses the multipart form of a send fax request without
+// buffering the file.
+// It follows these steps:
+// 1. Limit the size of the request body to the maximum upload size.
+// 2. Read the form fields part by part and unmarshal the JSON data into respective structures.
+// 3. Stop at the file part, which must be the last part, and return it unread.
+// The send_at field is optional, the other fields are required.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+//   - recipientsField: The name of the form field holding the recipients.
+//   - recipients: Target for the unmarshaled recipients.
+//
+// Returns:
+//   - the parsed shared fields with the file part, and false if the request has been rejected.
+func parseSendFaxForm(c *gin.Context, recipientsField string, recipients interface{}) (*sendFaxForm, bool) {
+	maxBodySize := (*config.Inst()).GetMaxUploadSize() + MAX_FORM_FIELDS_OVERLAY
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBodySize)
+
+	reader, err := c.Request.MultipartReader()
 	if err != nil {
 		logger.Inst().Error(err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to get file from request"})
+		respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, "failed to parse multipart form"))
+		return nil, false
+	}
+
+	form := &sendFaxForm{}
+	targets := map[string]interface{}{
+		recipientsField: recipients,
+		"document":      &form.document,
+		"transmission":  &form.transmission,
+		"fileModel":     &form.fileModel,
+	}
+
+	optionalTargets := map[string]interface{}{
+		"send_at": &form.sendAt,
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, "failed to get file from request"))
+			return nil, false
+		}
+		if err != nil {
+			logger.Inst().Error(err.Error())
+			respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, "failed to parse multipart form"))
+			return nil, false
+		}
+
+		if part.FormName() == UPLOAD_FILE_FIELD_NAME {
+			form.file = part
+			break
+		}
+
+		target, ok := targets[part.FormName()]
+		if !ok {
+			target, ok = optionalTargets[part.FormName()]
+		}
+		if !ok {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, MAX_FORM_FIELD_SIZE+1))
+		if err != nil || len(data) > MAX_FORM_FIELD_SIZE {
+			respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, "failed to read the "+part.FormName()+" field"))
+			return nil, false
+		}
+
+		if !unmarshalJSON(string(data), target, "failed to unmarshal "+part.FormName()+" data", c) {
+			return nil, false
+		}
+		delete(targets, part.FormName())
+	}
+
+	for fieldName := range targets {
+		respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, "the "+fieldName+" field should come before the file"))
+		return nil, false
+	}
+
+	return form, true
+}
+
+// routeScheduledFaxes handles the API route for listing the scheduled faxes.
+// It follows these steps:
+// 1. Load the scheduled faxes from the working directory.
+// 2. Return them, the earliest first.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeScheduledFaxes(c *gin.Context) {
+	scheduledFaxes, err := directCall.GetScheduledFaxes(c.Request.Context())
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, scheduledFaxes)
+}
+
+// routeRescheduleFax handles the API route for moving a scheduled fax to a new time.
+// It follows these steps:
+// 1. Decode the new send time from the request body.
+// 2. Reschedule the fax, a failed fax becomes pending again.
+// 3. Wake the scheduler and return the rescheduled fax.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeRescheduleFax(c *gin.Context) {
+	var request RescheduleRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&request)
+	if err != nil {
+		respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, "failed to decode the send time"))
+		return
+	}
+
+	scheduled, err := directCall.RescheduleFax(c.Request.Context(), c.Param("id"), request.SendAt)
+	if err != nil {
+		respondWithError(c, err)
 		return
 	}
 
+	faxScheduler.Wake()
+	c.JSON(http.StatusOK, scheduled)
+}
+
+// routeCancelScheduledFax handles the API route for cancelling a scheduled fax.
+// A fax that is being sent can't be cancelled.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeCancelScheduledFax(c *gin.Context) {
+	err := directCall.CancelScheduledFax(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, "ok")
+}
+
+// routeEnqueueFax handles the API route for adding a fax to the outbound queue.
+// It follows these steps:
+// 1. Parse the multipart form fields into the contact and the shared fields.
+// 2. Stream the file part to the queue directory.
+// 3. Return the queued fax with its ID at once, the queue is woken to send it.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeEnqueueFax(c *gin.Context) {
 	var contact Contact
-	var document DocumentRecord
-	var transmission Transmission
-	var fileModel SendFileInfo
+	form, ok := parseSendFaxForm(c, "contact", &contact)
+	if !ok {
+		return
+	}
 
-	if !unmarshalJSON(contactJSON, &contact, "failed to unmarshal contact data", c, http.StatusBadRequest) {
+	if !form.sendAt.IsZero() {
+		respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, "a queued fax is sent at once, schedule it to send it later"))
 		return
 	}
 
-	if !unmarshalJSON(documentJSON, &document, "failed to unmarshal document data", c, http.StatusBadRequest) {
+	enqueueFax(c, contact, form)
+}
+
+// enqueueFax adds the fax of a parsed send fax form to the outbound queue and
+// returns the queued fax, the Location header points to its send job.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+//   - contact: The recipient of the fax.
+//   - form: The shared fields and the file of the form.
+func enqueueFax(c *gin.Context, contact Contact, form *sendFaxForm) {
+	queued, err := directCall.EnqueueFax(c.Request.Context(), contact, form.document, form.transmission, form.file, form.fileModel)
+	if err != nil {
+		respondWithError(c, err)
 		return
 	}
 
-	if !unmarshalJSON(transmissionJSON, &transmission, "failed to unmarshal transmission data", c, http.StatusBadRequest) {
+	c.Header("Location", path.Join(utilities.API_PATHS, API_UI_JOBS, queued.ID))
+	c.JSON(http.StatusAccepted, queued)
+}
+
+// routeJobEvents handles the API route streaming the events of a send job as
+// Server-Sent Events.
+// It follows these steps:
+// 1. Check that the job exists, the errors are returned before the stream starts.
+// 2. Write the events following the Last-Event-ID header, or the
+// last_event_id query parameter, all the events without them.
+// 3. Write every new event as it is published, a comment line keeps an idle
+// connection open.
+// 4. End the stream after the final event of the job.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeJobEvents(c *gin.Context) {
+	jobID := c.Param("id")
+	if err := syncJobEvents(jobID); err != nil {
+		respondWithError(c, err)
 		return
 	}
 
-	if !unmarshalJSON(fileModelJSON, &fileModel, "failed to unmarshal fileModel data", c, http.StatusBadRequest) {
+	lastEventID := 0
+	value := c.GetHeader(LAST_EVENT_ID_HEADER)
+	if value == "" {
+		value = c.Query(JOB_EVENTS_PARAM_LAST_EVENT_ID)
+	}
+	if value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, "the last event id should be a positive number"))
+			return
+		}
+		lastEventID = parsed
+	}
+
+	c.Header("Content-Type", EVENT_STREAM_CONTENT_TYPE)
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	lastWrite := time.Now()
+	err := followJobEvents(c.Request.Context(), jobID, lastEventID, func(event JobEvent) error {
+		if err := writeJobEvent(c.Writer, event); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		lastWrite = time.Now()
+		return nil
+	}, func() error {
+		if time.Since(lastWrite) < JOB_EVENTS_KEEPALIVE {
+			return nil
+		}
+		if _, err := io.WriteString(c.Writer, ": keepalive\n\n"); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		lastWrite = time.Now()
+		return nil
+	})
+	if err != nil && c.Request.Context().Err() == nil {
+		logger.Inst().Error(fmt.Sprintf("the event stream of the job %s failed: %v", jobID, err))
+	}
+}
+
+// routeQueuedFaxes handles the API route for listing the faxes of the outbound queue.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeQueuedFaxes(c *gin.Context) {
+	queuedFaxes, err := directCall.GetQueuedFaxes(c.Request.Context())
+	if err != nil {
+		respondWithError(c, err)
 		return
 	}
+	c.JSON(http.StatusOK, queuedFaxes)
+}
 
-	fileContents, err := io.ReadAll(file)
+// routeQueuedFax handles the API route for fetching the state of a queued fax.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeQueuedFax(c *gin.Context) {
+	queued, err := directCall.GetQueuedFax(c.Request.Context(), c.Param("id"))
 	if err != nil {
-		logger.Inst().Error(err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read file contents"})
+		respondWithError(c, err)
 		return
 	}
+	c.JSON(http.StatusOK, queued)
+}
 
-	directCall := NewApiServerDirectCalls()
-	err = directCall.SendFax(contact, document, transmission, fileContents, fileModel)
+// routeFaxHistory handles the API route for searching the local fax history.
+// It follows these steps:
+// 1. Decode the filters and the page from the query parameters.
+// 2. Return the page of matching faxes, the newest first.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeFaxHistory(c *gin.Context) {
+	query, err := ParseFaxHistoryQuery(c.Request.URL.Query())
 	if err != nil {
-		logger.Inst().Error(err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "fax sent successfully"})
+
+	records, err := directCall.SearchFaxHistory(c.Request.Context(), query)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, records)
 }
 
-// routeLoadAllAccounts handles the API route for retrieving account information.
+// routeSyncFaxHistory handles the API route for syncing the fax history with
+// the ICT transmissions list at once.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeSyncFaxHistory(c *gin.Context) {
+	err := directCall.SyncFaxHistory(c.Request.Context())
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, "ok")
+}
+
+// routeCreateWebhook handles the API route for adding a webhook subscription.
 // It follows these steps:
-// 1. Load user data from the settings file.
-// 2. Authenticate the user and get an authentication token.
-// 3. Retrieve account information.
+// 1. Decode the URL, the events and the optional secret from the request body.
+// 2. Store the subscription, generating its secret if the body has none.
+// 3. Return the subscription with its secret, the only response holding it.
 //
 // Parameters:
 //   - c: Gin context for the HTTP request.
-func routeLoadAllAccounts(c *gin.Context) {
-	directCall := NewApiServerDirectCalls()
-	accountResponses, err := directCall.GetAllAccounts()
+func routeCreateWebhook(c *gin.Context) {
+	var request WebhookRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&request)
 	if err != nil {
-		logger.Inst().Error(err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, fmt.Sprintf("failed to decode the webhook: %v", err)))
 		return
 	}
-	c.JSON(http.StatusOK, accountResponses)
+
+	subscription, err := CreateWebhookSubscription(request)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	apiPaths := utilities.API_PATHS
+	if isV2Request(c) {
+		apiPaths = utilities.API_V2_PATHS
+	}
+	c.Header("Location", path.Join(apiPaths, API_UI_WEBHOOKS, subscription.ID))
+	c.JSON(http.StatusCreated, subscription)
+}
+
+// routeWebhooks handles the API route for listing the webhook subscriptions, without their secrets.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeWebhooks(c *gin.Context) {
+	subscriptions, err := LoadWebhookSubscriptions()
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, subscriptions)
+}
+
+// routeWebhook handles the API route for fetching a webhook subscription, without its secret.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeWebhook(c *gin.Context) {
+	subscription, err := LoadWebhookSubscription(c.Param("id"))
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, subscription)
+}
+
+// routeUpdateWebhook handles the API route for replacing the URL and the
+// events of a webhook subscription. A secret in the body replaces the secret,
+// it is kept otherwise.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeUpdateWebhook(c *gin.Context) {
+	var request WebhookRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&request)
+	if err != nil {
+		respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, fmt.Sprintf("failed to decode the webhook: %v", err)))
+		return
+	}
+
+	subscription, err := UpdateWebhookSubscription(c.Param("id"), request)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, subscription)
+}
+
+// routeDeleteWebhook handles the API route for removing a webhook subscription.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeDeleteWebhook(c *gin.Context) {
+	err := DeleteWebhookSubscription(c.Param("id"))
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// routeWebhookDeliveries handles the API route for the delivery log of a
+// webhook subscription, the newest deliveries first.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeWebhookDeliveries(c *gin.Context) {
+	deliveries, err := LoadWebhookDeliveries(c.Param("id"))
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
 }
 
-// routeLastFaxes handles the API route for fetching fax transmissions.
+// routeFaxStatus handles the API route for fetching the status of a sent fax.
 // It follows these steps:
-// 1. Load user data from the settings file.
-// 2. Authenticate the user and get an authentication token.
-// 3. Retrieve fax transmissions.
-// 4. Filter fax responses based on print status.
-// 5. Convert and return filtered fax responses as fax data.
+// 1. Parse the transmission ID from the path.
+// 2. Fetch the transmission from the fax provider.
+// 3. Return the status of the transmission.
 //
 // Parameters:
 //   - c: Gin context for the HTTP request.
-func routeLastFaxes(c *gin.Context) {
-	directCall := NewApiServerDirectCalls()
-	faxeList, err := directCall.GetLastFaxes(0)
+func routeFaxStatus(c *gin.Context) {
+	transmissionID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		logger.Inst().Error(err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, "the transmission id should be a number"))
 		return
 	}
-	c.JSON(http.StatusOK, faxeList)
+
+	faxStatus, err := directCall.GetFaxStatus(c.Request.Context(), transmissionID)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, faxStatus)
 }
 
-// routeAuthentication handles the API route for user authentication.
+// routeSearchContacts handles the API route for searching the contacts of the fax provider.
 // It follows these steps:
-// 1. Load user data from the settings file.
-// 2. Authenticate the user and get an authentication token.
+// 1. Read the search text and the limit from the query parameters.
+// 2. Search the contacts by phone number, name or email.
+// 3. Return the matching contacts.
 //
 // Parameters:
 //   - c: Gin context for the HTTP request.
-func routeAuthentication(c *gin.Context) {
-	userData, err := loadUserDataFromFile()
+func routeSearchContacts(c *gin.Context) {
+	limit := 0
+	if value := c.Query(CONTACT_SEARCH_PARAM_LIMIT); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, fmt.Sprintf("the limit '%s' is invalid", value)))
+			return
+		}
+		limit = parsed
+	}
+
+	contactResponses, err := directCall.SearchContacts(c.Request.Context(), c.Query(CONTACT_SEARCH_PARAM_TEXT), limit)
 	if err != nil {
-		logger.Inst().Error(err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "the settings file not found"})
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, contactResponses)
+}
+
+// routeCoverPages handles the API route for listing the cover page templates.
+// It follows these steps:
+// 1. List the templates of the cover page templates directory.
+// 2. Return their names.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeCoverPages(c *gin.Context) {
+	names, err := directCall.GetCoverPageTemplates(c.Request.Context())
+	if err != nil {
+		respondWithError(c, err)
 		return
 	}
+	c.JSON(http.StatusOK, names)
+}
 
-	authResponse, err := AuthenticateICT(*userData)
+// routeLoadAllAccounts handles the API route for listing the accounts the user
+// can send faxes from.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeLoadAllAccounts(c *gin.Context) {
+	accountResponses, err := directCall.GetAllAccounts(c.Request.Context())
 	if err != nil {
-		logger.Inst().Error(err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error in get  key from api the host"})
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, accountResponses)
+}
+
+// routeQueryTransmissions handles the API route for querying fax transmissions.
+// It follows these steps:
+// 1. Parse the filters and the page from the query parameters.
+// 2. Query the transmissions on the provider, or filter and page them here
+// if the provider doesn't support queries.
+// 3. Return the page of transmissions.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeQueryTransmissions(c *gin.Context) {
+	query, err := ParseTransmissionQuery(c.Request.URL.Query())
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	page, err := directCall.QueryTransmissions(c.Request.Context(), query)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// routeAuthentication handles the API route for user authentication, it
+// returns the authenticated user of the saved credentials.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeAuthentication(c *gin.Context) {
+	authResponse, err := directCall.authenticate(c.Request.Context())
+	if err != nil {
+		respondWithError(c, err)
 		return
 	}
 
@@ -183,13 +763,16 @@ func routeAuthentication(c *gin.Context) {
 //   - c: Gin context for the HTTP request.
 func routeSaveSettings(c *gin.Context) {
 	userdata := &UserData{}
-	json.NewDecoder(c.Request.Body).Decode(userdata)
-
-	directCall := NewApiServerDirectCalls()
-	err := directCall.SaveSettings(*userdata)
+	err := json.NewDecoder(c.Request.Body).Decode(userdata)
 	if err != nil {
 		logger.Inst().Error(err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, "failed to decode the user data"))
+		return
+	}
+
+	err = directCall.SaveSettings(c.Request.Context(), *userdata)
+	if err != nil {
+		respondWithError(c, err)
 		return
 	}
 
@@ -204,11 +787,9 @@ func routeSaveSettings(c *gin.Context) {
 // Parameters:
 //   - c: Gin context for the HTTP request.
 func routeLoadSettings(c *gin.Context) {
-	directCall := NewApiServerDirectCalls()
-	userData, err := directCall.LoadSettings()
+	userData, err := directCall.LoadSettings(c.Request.Context())
 	if err != nil {
-		logger.Inst().Error(err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, userData)
@@ -216,18 +797,15 @@ func routeLoadSettings(c *gin.Context) {
 
 // routeAccountInfo handles the API route for fetching account information.
 // It follows these steps:
-// 1. Load user data from the settings file.
-// 2. Authenticate the user and get an authentication token.
-// 3. Convert authentication response to account information.
+// 1. Authenticate with the saved credentials.
+// 2. Convert the authentication response to account information.
 //
 // Parameters:
 //   - c: Gin context for the HTTP request.
 func routeAccountInfo(c *gin.Context) {
-	directCall := NewApiServerDirectCalls()
-	accountInfo, err := directCall.GetAccountInfo()
+	accountInfo, err := directCall.GetAccountInfo(c.Request.Context())
 	if err != nil {
-		logger.Inst().Error(err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, accountInfo)
@@ -242,11 +820,9 @@ func routeAccountInfo(c *gin.Context) {
 // Parameters:
 //   - c: Gin context for the HTTP request.
 func routeLogout(c *gin.Context) {
-	directCall := NewApiServerDirectCalls()
-	err := directCall.Logout()
+	err := directCall.Logout(c.Request.Context())
 	if err != nil {
-		logger.Inst().Error(err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, "ok")
@@ -260,21 +836,42 @@ func routeLogout(c *gin.Context) {
 //  - target: Pointer to the target structure for unmarshaling.
 //  - errorMsg: Error message to be displayed in case of failure.
 //  - c: Gin context for the HTTP request.
-//  - statusCode: HTTP status code to be returned in case of failure.
 //
 // Returns:
 //  - true if unmarshaling is successful, false otherwise.
 
-func unmarshalJSON(data string, target interface{}, errorMsg string, c *gin.Context, statusCode int) bool {
+func unmarshalJSON(data string, target interface{}, errorMsg string, c *gin.Context) bool {
 	err := json.Unmarshal([]byte(data), target)
 	if err != nil {
 		logger.Inst().Error(err.Error())
-		c.JSON(statusCode, gin.H{"error": errorMsg})
+		respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, errorMsg))
 		return false
 	}
 	return true
 }
 
+// respondWithError logs the error and writes it as the JSON error envelope,
+// the envelope of the v2 API for its routes.
+// The error is converted with ToApiError, so ICT failures keep their step,
+// status code and response body.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+//   - err: The error to return.
+func respondWithError(c *gin.Context, err error) {
+	apiErr := ToApiError(err)
+	if apiErr.HTTPStatus == 0 {
+		apiErr.HTTPStatus = httpStatusForErrorCode(apiErr.Code)
+	}
+
+	logger.Inst().Error(apiErr.Error())
+	if isV2Request(c) {
+		respondWithV2Error(c, apiErr)
+		return
+	}
+	c.JSON(apiErr.HTTPStatus, apiErr)
+}
+
 // loadUserDataFromFile retrieves user data from the system settings file.
 // It follows these steps:
 // 1. Get the path of the system settings file.
@@ -1,44 +1,143 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"encoding/hex"
 	"encoding/json"
-	"errors"
+	"faxsender/src/document"
 	"faxsender/src/utilities"
+	"faxsender/src/utilities/config"
+	"faxsender/src/utilities/logger"
+	"fmt"
+	"io"
 	"os"
+	"sync"
+	"time"
 )
 
-// ApiUIDirectCalls represents the interface as dependency injection for the api calls without local server
+// ApiUIDirectCalls represents the interface as dependency injection for the api calls without local server.
+// The calls are delegated to the fax provider selected in config.yaml.
 type ApiServerDirectCalls struct {
+	mutex           sync.Mutex
+	provider        FaxProvider
+	settingsModTime time.Time
+	settingsSize    int64
+
 	IApiUICalls
 }
 
+// NewApiServerDirectCalls returns the direct calls shared by the routes, the
+// queue, the scheduler and the forms of this process, so the settings saved
+// or removed by any of them are used by all the others.
 func NewApiServerDirectCalls() IApiUICalls {
-	return &ApiServerDirectCalls{}
+	return directCall
 }
 
-func (c *ApiServerDirectCalls) GetAccountInfo() (*AccountInfo, error) {
+// getProvider returns the cached fax provider, creating it from the settings
+// file when it is first needed and again whenever the file has been changed
+// or removed, e.g. by the other process. The provider is shared by all the
+// calls, so its session is reused and it authenticates again only once the
+// session has expired.
+//
+// Returns:
+//   - FaxProvider: The fax provider for the saved user data.
+//   - error: An ApiError if the settings file can not be loaded or the provider is unknown.
+func (c *ApiServerDirectCalls) getProvider() (FaxProvider, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	settingsFilePath, _ := utilities.GetSystemSettingsPath()
+	info, err := os.Stat(settingsFilePath)
+	if err != nil {
+		c.provider = nil
+		return nil, NewApiError(ERROR_CODE_SETTINGS_NOT_FOUND, "the settings file not found")
+	}
+
+	if c.provider != nil && info.ModTime().Equal(c.settingsModTime) && info.Size() == c.settingsSize {
+		return c.provider, nil
+	}
+
 	userData, err := loadUserDataFromFile()
 	if err != nil {
-		return nil, errors.New("the settings file not found")
+		return nil, NewApiError(ERROR_CODE_SETTINGS_NOT_FOUND, err.Error())
 	}
 
-	authResponse, err := AuthenticateICT(*userData)
+	provider, err := newConfiguredProvider(*userData)
 	if err != nil {
-		return nil, errors.New("error in get  key from api the host")
+		return nil, err
+	}
+
+	c.provider = provider
+	c.settingsModTime = info.ModTime()
+	c.settingsSize = info.Size()
+	return c.provider, nil
+}
+
+// newConfiguredProvider creates the fax provider selected in config.yaml.
+//
+// Parameters:
+//   - userData: User data containing the credentials and the hostname of the backend.
+//
+// Returns:
+//   - FaxProvider: The created provider.
+//   - error: An ApiError if the provider is unknown or can not be created.
+func newConfiguredProvider(userData UserData) (FaxProvider, error) {
+	provider, err := NewFaxProvider((*config.Inst()).GetFaxProvider(), userData)
+	if err != nil {
+		return nil, ToApiError(err)
+	}
+	return provider, nil
+}
+
+// resetProvider drops the cached fax provider, it is created again from the
+// settings file on the next call.
+func (c *ApiServerDirectCalls) resetProvider() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.provider = nil
+}
+
+func (c *ApiServerDirectCalls) GetAccountInfo(ctx context.Context) (*AccountInfo, error) {
+	authResponse, err := c.authenticate(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	return ConvertAuthResponseToAccountInfo(*authResponse), nil
 }
 
-func (c *ApiServerDirectCalls) SaveSettings(userData UserData) error {
+// authenticate authenticates against the fax provider, reusing its cached session.
+//
+// Parameters:
+//   - ctx: The context of the call, it cancels the authentication request.
+//
+// Returns:
+//   - *AuthResponse: The authenticated user.
+//   - error: An ApiError if the authentication fails.
+func (c *ApiServerDirectCalls) authenticate(ctx context.Context) (*AuthResponse, error) {
+	provider, err := c.getProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	authResponse, err := provider.Authenticate(ctx)
+	if err != nil {
+		return nil, ToApiError(err)
+	}
+	return authResponse, nil
+}
+
+func (c *ApiServerDirectCalls) SaveSettings(ctx context.Context, userData UserData) error {
 	jsonData, err := json.Marshal(userData)
 	if err != nil {
-		return errors.New("Error marshaling UserData to JSON")
+		return NewApiError(ERROR_CODE_INVALID_REQUEST, "Error marshaling UserData to JSON")
 	}
 
 	encryptedData, err := utilities.EncryptData([]byte(jsonData))
 	if err != nil {
-		return errors.New("Error encrypting binary data")
+		return NewApiError(ERROR_CODE_INTERNAL, "Error encrypting binary data")
 	}
 
 	settingsFilePath, _ := utilities.GetSystemSettingsPath()
@@ -46,97 +145,437 @@ func (c *ApiServerDirectCalls) SaveSettings(userData UserData) error {
 	err = os.WriteFile(settingsFilePath, []byte(encryptedData), 0644)
 
 	if err != nil {
-		return errors.New("Error in saving data")
+		return NewApiError(ERROR_CODE_INTERNAL, "Error in saving data")
 	}
 
-	return nil
+	c.resetProvider()
+	_, err = c.getProvider()
+	return err
 }
 
-func (c *ApiServerDirectCalls) LoadSettings() (*UserData, error) {
+func (c *ApiServerDirectCalls) LoadSettings(ctx context.Context) (*UserData, error) {
 	userData, err := loadUserDataFromFile()
 	if err != nil {
-		return nil, errors.New("error in load data from settings file")
+		return nil, NewApiError(ERROR_CODE_SETTINGS_NOT_FOUND, "error in load data from settings file")
 	}
 	return userData, nil
 }
 
-func (c *ApiServerDirectCalls) Logout() error {
+func (c *ApiServerDirectCalls) Logout(ctx context.Context) error {
+	c.resetProvider()
+
 	settingsFilePath, _ := utilities.GetSystemSettingsPath()
 	if utilities.CheckIfFileExists(settingsFilePath) {
 		err := os.Remove(settingsFilePath)
 		if err != nil {
-			return errors.New("error in logout!")
+			return NewApiError(ERROR_CODE_INTERNAL, "error in logout!")
 		}
 	}
 	return nil
 }
 
-func (c *ApiServerDirectCalls) GetLastFaxes(count int) ([]FaxData, error) {
-	userData, err := loadUserDataFromFile()
+// QueryTransmissions retrieves one page of the transmissions matching the
+// query, filtered on the fax provider if it supports it.
+func (c *ApiServerDirectCalls) QueryTransmissions(ctx context.Context, query TransmissionQuery) (*TransmissionPage, error) {
+	provider, err := c.getProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := queryProviderTransmissions(ctx, provider, query)
+	if err != nil {
+		return nil, ToApiError(err)
+	}
+	return page, nil
+}
+
+func (c *ApiServerDirectCalls) GetAllAccounts(ctx context.Context) ([]AccountResponse, error) {
+	provider, err := c.getProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	accountResponses, err := provider.ListAccounts(ctx)
+	if err != nil {
+		return nil, ToApiError(err)
+	}
+	return accountResponses, nil
+}
+
+// SearchContacts searches the contacts stored on the fax provider, a provider
+// without stored contacts finds none.
+func (c *ApiServerDirectCalls) SearchContacts(ctx context.Context, text string, limit int) ([]ContactResponse, error) {
+	provider, err := c.getProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	directory, ok := provider.(FaxContactDirectory)
+	if !ok {
+		return []ContactResponse{}, nil
+	}
+
+	contactResponses, err := directory.SearchContacts(ctx, text, limit)
+	if err != nil {
+		return nil, ToApiError(err)
+	}
+	return contactResponses, nil
+}
+
+// GetCoverPageTemplates lists the names of the cover page templates.
+func (c *ApiServerDirectCalls) GetCoverPageTemplates(ctx context.Context) ([]string, error) {
+	names, err := document.ListCoverPageTemplates()
+	if err != nil {
+		return nil, ToApiError(err)
+	}
+	return names, nil
+}
+
+func (c *ApiServerDirectCalls) SendFax(ctx context.Context, contact Contact, document DocumentRecord, transmission Transmission, fileContents []byte, fileModel SendFileInfo) (int, error) {
+	return c.SendFaxReader(ctx, contact, document, transmission, bytes.NewReader(fileContents), fileModel)
+}
+
+// SendFaxReader sends a fax streaming the document from the reader to the fax
+// provider. The document is rejected once it is larger than the maximum upload
+// size. Text files, images and office documents are converted to PDF first, or
+// images to fax TIFF images with a TIFF upload format, and the chosen cover
+// page is added before the document is sent. The sent fax is recorded in the
+// fax history with the hash of the document.
+func (c *ApiServerDirectCalls) SendFaxReader(ctx context.Context, contact Contact, document DocumentRecord, transmission Transmission, file io.Reader, fileModel SendFileInfo) (int, error) {
+	provider, err := c.getProvider()
+	if err != nil {
+		return 0, err
+	}
+
+	file, fileModel, err = convertDocument(ctx, newMaxSizeReader(file, (*config.Inst()).GetMaxUploadSize()), fileModel, transmission)
+	if err != nil {
+		return 0, ToApiError(err)
+	}
+
+	file, documentHash := newDocumentHashReader(file)
+
+	file, transmission, err = addCoverPage(ctx, provider, contact, transmission, file, fileModel)
+	if err != nil {
+		return 0, ToApiError(err)
+	}
+
+	transmissionID, err := provider.SendDocument(ctx, contact, document, transmission, file, fileModel)
+	if err != nil {
+		return 0, ToApiError(err)
+	}
+
+	logIfError(RecordSentFax(newSentFaxRecord(transmissionID, contact, transmission, hex.EncodeToString(documentHash.Sum(nil)))))
+	return transmissionID, nil
+}
+
+func (c *ApiServerDirectCalls) BroadcastFax(ctx context.Context, contacts []Contact, document DocumentRecord, transmission Transmission, fileContents []byte, fileModel SendFileInfo) ([]BroadcastResult, error) {
+	maxUploadSize := (*config.Inst()).GetMaxUploadSize()
+	if int64(len(fileContents)) > maxUploadSize {
+		return nil, NewApiError(ERROR_CODE_UPLOAD_TOO_LARGE, fmt.Sprintf("the document is larger than %d bytes", maxUploadSize))
+	}
+
+	return c.broadcastFaxSource(ctx, contacts, document, transmission, BytesDocumentSource(fileContents), fileModel)
+}
+
+// broadcastFaxSource sends one fax to many recipients, reading the document
+// from the source. A document that isn't a PDF document or a TIFF image is
+// converted once for all recipients.
+func (c *ApiServerDirectCalls) broadcastFaxSource(ctx context.Context, contacts []Contact, document DocumentRecord, transmission Transmission, source DocumentSource, fileModel SendFileInfo) ([]BroadcastResult, error) {
+	provider, err := c.getProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	source, fileModel, err = convertDocumentSource(ctx, source, fileModel, transmission)
+	if err != nil {
+		return nil, ToApiError(err)
+	}
+
+	results, err := broadcastDocument(ctx, provider, contacts, document, transmission, source, fileModel)
+	if err != nil {
+		return nil, ToApiError(err)
+	}
+
+	c.recordBroadcast(contacts, transmission, source, results)
+	return results, nil
+}
+
+// recordBroadcast records the sent faxes of a broadcast in the fax history.
+func (c *ApiServerDirectCalls) recordBroadcast(contacts []Contact, transmission Transmission, source DocumentSource, results []BroadcastResult) {
+	documentHash, err := hashDocumentSource(source)
+	if err != nil {
+		logger.Inst().Error(fmt.Sprintf("error hashing the broadcast document: %v", err))
+	}
+
+	for i, result := range results {
+		if result.Error != nil || i >= len(contacts) {
+			continue
+		}
+		logIfError(RecordSentFax(newSentFaxRecord(result.TransmissionID, contacts[i], transmission, documentHash)))
+	}
+}
+
+func (c *ApiServerDirectCalls) GetFaxStatus(ctx context.Context, transmissionID int) (*FaxStatus, error) {
+	provider, err := c.getProvider()
 	if err != nil {
-		return nil, errors.New("error in load data from settings file")
+		return nil, err
 	}
 
-	authResponse, err := AuthenticateICT(*userData)
+	faxStatus, err := provider.GetStatus(ctx, transmissionID)
 	if err != nil {
-		return nil, errors.New("error in get  key from api the host")
+		return nil, ToApiError(err)
 	}
 
-	authToken := authResponse.Token
-	faxResponses, err := TransmissionsICT(*userData, authToken)
+	logIfError(UpdateFaxHistoryStatus(*faxStatus))
+	return faxStatus, nil
+}
+
+// ResumeUnfinishedFaxJobs runs the send pipeline of the jobs left unfinished
+// by a previous run, each one from the first step that didn't finish. The jobs
+// of an owner are left to it, see WithFaxJobOwner.
+// Steps:
+// 1. Load the unfinished jobs from the jobs directory.
+// 2. Get the fax provider from the settings file, it must be able to run jobs.
+// 3. Discard the jobs older than FAX_JOB_MAX_AGE, run the others and log the result.
+//
+// Parameters:
+//   - ctx: The context of the resume, cancelling it stops the running job.
+func (c *ApiServerDirectCalls) ResumeUnfinishedFaxJobs(ctx context.Context) {
+	jobs, err := LoadUnfinishedFaxJobs()
 	if err != nil {
-		return nil, errors.New("error fetching fax transmissions")
+		logger.Inst().Error(fmt.Sprintf("error loading the unfinished fax jobs: %v", err))
+		return
+	}
+
+	if len(jobs) == 0 {
+		return
 	}
 
-	filteredFaxResponses := make([]FaxResponse, 0)
-	for _, response := range faxResponses {
-		if response.Is_Print == utilities.WITH_PRINT {
-			filteredFaxResponses = append(filteredFaxResponses, response)
+	provider, err := c.getProvider()
+	if err != nil {
+		logger.Inst().Error(fmt.Sprintf("can not resume %d unfinished fax jobs: %v", len(jobs), err))
+		return
+	}
+
+	runner, ok := provider.(FaxJobRunner)
+	if !ok {
+		logger.Inst().Error(fmt.Sprintf("can not resume %d unfinished fax jobs: the fax provider can not run jobs", len(jobs)))
+		return
+	}
+
+	for _, job := range jobs {
+		if job.Owner != "" {
+			continue
+		}
+
+		if job.IsExpired(time.Now()) {
+			logger.Inst().Info(fmt.Sprintf("discarding the fax job %s created at %s", job.ID, job.CreatedAt.Format(time.RFC3339)))
+			logIfError(runner.DiscardFaxJob(ctx, job))
+			continue
+		}
+
+		logger.Inst().Info(fmt.Sprintf("resuming the fax job %s", job.ID))
+
+		transmissionID, err := runner.RunFaxJob(ctx, job)
+		if err != nil {
+			logger.Inst().Error(fmt.Sprintf("the fax job %s failed: %v", job.ID, err))
+			continue
 		}
+
+		logger.Inst().Info(fmt.Sprintf("the fax job %s has been sent as transmission %d", job.ID, transmissionID))
+	}
+}
+
+// DiscardOwnedFaxJob deletes the ICT objects created for the fax job of an
+// owner and removes the job, e.g. once the owner gives the fax up.
+//
+// Parameters:
+//   - ctx: The context of the call.
+//   - owner: The owner of the job, see WithFaxJobOwner.
+//
+// Returns:
+//   - error: An error if the job is running or can not be removed.
+func (c *ApiServerDirectCalls) DiscardOwnedFaxJob(ctx context.Context, owner string) error {
+	job, err := LoadFaxJob(ownedFaxJobID(owner))
+	if os.IsNotExist(err) {
+		return nil
 	}
-	startIndex := len(filteredFaxResponses) - count
-	if startIndex < 0 {
-		startIndex = 0
+	if err != nil {
+		return err
 	}
 
-	filteredFaxResponses = filteredFaxResponses[startIndex:]
-	return ConvertFilteredFaxResponsesToFaxData(filteredFaxResponses), nil
+	provider, err := c.getProvider()
+	if err != nil {
+		return err
+	}
+
+	runner, ok := provider.(FaxJobRunner)
+	if !ok {
+		return RemoveFaxJob(job.ID)
+	}
+
+	return runner.DiscardFaxJob(ctx, job)
 }
 
-func (c *ApiServerDirectCalls) GetAllAccounts() ([]AccountResponse, error) {
-	userData, err := loadUserDataFromFile()
+// ScheduleFax stores a send request to be sent at the given time by the
+// scheduler of the daemon, its ID is the ID of the send job. The document is
+// rejected once it is larger than the maximum upload size. It is stored
+// converted to its upload format, so a document that can't be converted is rejected now.
+func (c *ApiServerDirectCalls) ScheduleFax(ctx context.Context, contact Contact, document DocumentRecord, transmission Transmission, file io.Reader, fileModel SendFileInfo, sendAt time.Time) (*ScheduledFax, error) {
+	file, fileModel, err := convertDocument(ctx, newMaxSizeReader(file, (*config.Inst()).GetMaxUploadSize()), fileModel, transmission)
 	if err != nil {
-		return nil, errors.New("error in load data from settings file")
+		return nil, ToApiError(err)
 	}
 
-	authResponse, err := AuthenticateICT(*userData)
+	if transmission.CoverPageTemplate != "" {
+		if _, err := loadCoverPageTemplate(transmission, fileModel); err != nil {
+			return nil, err
+		}
+	}
+
+	scheduledFax, err := CreateScheduledFax(contact, document, transmission, file, fileModel, sendAt)
 	if err != nil {
-		return nil, errors.New("error in get  key from api the host")
+		return nil, ToApiError(err)
 	}
 
-	authToken := authResponse.Token
-	accountResponses, err := AccountsICT(*userData, authToken)
+	publishJobEvent(newJobQueuedEvent(scheduledFax.ID))
+	return scheduledFax, nil
+}
+
+func (c *ApiServerDirectCalls) GetScheduledFaxes(ctx context.Context) ([]ScheduledFax, error) {
+	scheduledFaxes, err := LoadScheduledFaxes()
 	if err != nil {
-		return nil, errors.New("error fetching fax transmissions")
+		return nil, ToApiError(err)
 	}
-	return accountResponses, nil
+
+	result := make([]ScheduledFax, 0, len(scheduledFaxes))
+	for _, scheduledFax := range scheduledFaxes {
+		result = append(result, *scheduledFax)
+	}
+	return result, nil
 }
 
-func (c *ApiServerDirectCalls) SendFax(contact Contact, document DocumentRecord, transmission Transmission, fileContents []byte, fileModel SendFileInfo) error {
-	userData, err := loadUserDataFromFile()
+func (c *ApiServerDirectCalls) RescheduleFax(ctx context.Context, scheduledID string, sendAt time.Time) (*ScheduledFax, error) {
+	scheduledFax, err := RescheduleScheduledFax(scheduledID, sendAt)
 	if err != nil {
-		return errors.New("error in load data from settings file")
+		return nil, ToApiError(err)
 	}
+	return scheduledFax, nil
+}
 
-	authResponse, err := AuthenticateICT(*userData)
+// CancelScheduledFax removes a scheduled fax that is not being sent, discards
+// the fax job kept by a failed attempt to send it and ends its send job.
+func (c *ApiServerDirectCalls) CancelScheduledFax(ctx context.Context, scheduledID string) error {
+	err := CancelScheduledFax(scheduledID)
 	if err != nil {
-		return errors.New("error in getting  key from api the host")
+		return ToApiError(err)
 	}
-	authToken := authResponse.Token
 
-	err = SendFaxICT(*userData, authToken, contact, document, transmission, fileContents, fileModel)
+	discardOwnedFaxJob(ctx, c, SCHEDULED_FAX_JOB_OWNER_PREFIX+scheduledID)
+
+	event := newJobFailedEvent(scheduledID, "")
+	event.Message = "the scheduled fax has been cancelled"
+	publishJobEvent(event)
+	return nil
+}
+
+// EnqueueFax stores a send request in the outbound queue and returns at once,
+// the queue workers of this process or of the daemon send it. Its ID is the ID
+// of the send job, see FollowJobEvents. The document is
+// rejected once it is larger than the maximum upload size. It is stored
+// converted to its upload format, so a document that can't be converted is rejected now.
+func (c *ApiServerDirectCalls) EnqueueFax(ctx context.Context, contact Contact, document DocumentRecord, transmission Transmission, file io.Reader, fileModel SendFileInfo) (*QueuedFax, error) {
+	file, fileModel, err := convertDocument(ctx, newMaxSizeReader(file, (*config.Inst()).GetMaxUploadSize()), fileModel, transmission)
+	if err != nil {
+		return nil, ToApiError(err)
+	}
+
+	if transmission.CoverPageTemplate != "" {
+		if _, err := loadCoverPageTemplate(transmission, fileModel); err != nil {
+			return nil, err
+		}
+	}
+
+	queuedFax, err := CreateQueuedFax(contact, document, transmission, file, fileModel)
+	if err != nil {
+		return nil, ToApiError(err)
+	}
+
+	publishJobEvent(newJobQueuedEvent(queuedFax.ID))
+	faxQueue.Wake()
+	return queuedFax, nil
+}
+
+func (c *ApiServerDirectCalls) GetQueuedFax(ctx context.Context, queuedID string) (*QueuedFax, error) {
+	queuedFax, err := LoadQueuedFax(queuedID)
 	if err != nil {
-		return errors.New("error sending the fax")
+		return nil, ToApiError(err)
+	}
+	return queuedFax, nil
+}
+
+// FollowJobEvents calls onEvent with the events of a send job until its final
+// event, the job is a fax of the outbound queue.
+func (c *ApiServerDirectCalls) FollowJobEvents(ctx context.Context, jobID string, lastEventID int, onEvent func(JobEvent)) error {
+	err := followJobEvents(ctx, jobID, lastEventID, func(event JobEvent) error {
+		onEvent(event)
+		return nil
+	}, nil)
+	if err != nil {
+		return ToApiError(err)
 	}
 	return nil
 }
+
+func (c *ApiServerDirectCalls) GetQueuedFaxes(ctx context.Context) ([]QueuedFax, error) {
+	queuedFaxes, err := LoadQueuedFaxes()
+	if err != nil {
+		return nil, ToApiError(err)
+	}
+
+	result := make([]QueuedFax, 0, len(queuedFaxes))
+	for _, queuedFax := range queuedFaxes {
+		result = append(result, *queuedFax)
+	}
+	return result, nil
+}
+
+func (c *ApiServerDirectCalls) SearchFaxHistory(ctx context.Context, query FaxHistoryQuery) (*FaxHistoryPage, error) {
+	page, err := SearchFaxHistory(query)
+	if err != nil {
+		return nil, ToApiError(err)
+	}
+	return page, nil
+}
+
+// SyncFaxHistory merges the transmissions of the sync window into the fax
+// history page by page, updating the status of the recorded faxes.
+func (c *ApiServerDirectCalls) SyncFaxHistory(ctx context.Context) error {
+	provider, err := c.getProvider()
+	if err != nil {
+		return err
+	}
+
+	from, err := FaxHistorySyncStart()
+	if err != nil {
+		return ToApiError(err)
+	}
+
+	query := TransmissionQuery{From: from, Limit: TRANSMISSION_QUERY_MAX_LIMIT}
+	for {
+		page, err := queryProviderTransmissions(ctx, provider, query)
+		if err != nil {
+			return ToApiError(err)
+		}
+
+		_, err = MergeFaxHistory(page.Faxes)
+		if err != nil {
+			return ToApiError(err)
+		}
+
+		query.Offset += len(page.Faxes)
+		if len(page.Faxes) == 0 || query.Offset >= page.Total {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"bytes"
+	"faxsender/src/utilities"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+)
+
+// Constants for streamed uploads.
+const (
+	UPLOAD_FILE_FIELD_NAME  = "file"
+	UPLOAD_FILE_NAME        = "filename.txt"
+	SPOOL_FILE_PATTERN      = "upload-*.spool"
+	MAX_FORM_FIELD_SIZE     = 1 << 20
+	MAX_FORM_FIELDS_OVERLAY = 4 * MAX_FORM_FIELD_SIZE
+)
+
+// DocumentSource opens the contents of a document to upload. It is called
+// again for every attempt of the upload, so retries send the whole document.
+type DocumentSource func() (io.ReadCloser, error)
+
+// BytesDocumentSource creates a DocumentSource reading a document held in memory.
+//
+// Parameters:
+//   - fileContents: Contents of the document file.
+//
+// Returns:
+//   - DocumentSource: The source of the document.
+func BytesDocumentSource(fileContents []byte) DocumentSource {
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(fileContents)), nil
+	}
+}
+
+// FileDocumentSource creates a DocumentSource reading a document from disk.
+//
+// Parameters:
+//   - filePath: The path of the document file.
+//
+// Returns:
+//   - DocumentSource: The source of the document.
+func FileDocumentSource(filePath string) DocumentSource {
+	return func() (io.ReadCloser, error) {
+		return os.Open(filePath)
+	}
+}
+
+// newMultipartPipe creates a multipart body that is written while it is read.
+// Steps:
+// 1. Create a pipe and a multipart writer on its write end.
+// 2. Write the parts in a goroutine, the read end blocks until data is written.
+// 3. Close the pipe with the error of the writer, so the reader sees it.
+//
+// Parameters:
+//   - writeParts: Writes the parts of the body, the writer is closed afterwards.
+//
+// Returns:
+//   - io.ReadCloser: The read end of the body, closing it stops the writer.
+//   - string: The content type of the body, including the boundary.
+func newMultipartPipe(writeParts func(writer *multipart.Writer) error) (io.ReadCloser, string) {
+	pipeReader, pipeWriter := io.Pipe()
+	writer := multipart.NewWriter(pipeWriter)
+
+	go func() {
+		err := writeParts(writer)
+		if err == nil {
+			err = writer.Close()
+		}
+		pipeWriter.CloseWithError(err)
+	}()
+
+	return pipeReader, writer.FormDataContentType()
+}
+
+// newMultipartFileBody creates a body factory streaming a document as the
+// file part of a multipart body.
+//
+// Parameters:
+//   - source: The source of the document.
+//
+// Returns:
+//   - func() (io.Reader, error): Opens a new body for every attempt, the body is an io.ReadCloser.
+func newMultipartFileBody(source DocumentSource) func() (io.Reader, error) {
+	return func() (io.Reader, error) {
+		file, err := source()
+		if err != nil {
+			return nil, fmt.Errorf("error opening the document: %v", err)
+		}
+
+		body, _ := newMultipartPipe(func(writer *multipart.Writer) error {
+			defer file.Close()
+
+			fileField, err := writer.CreateFormFile(UPLOAD_FILE_FIELD_NAME, UPLOAD_FILE_NAME)
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(fileField, file)
+			return err
+		})
+
+		return body, nil
+	}
+}
+
+// maxSizeReader fails once more than the allowed number of bytes has been read.
+type maxSizeReader struct {
+	reader  io.Reader
+	maxSize int64
+	read    int64
+}
+
+// newMaxSizeReader limits the size of an uploaded document.
+//
+// Parameters:
+//   - reader: The reader of the document.
+//   - maxSize: The maximum size in bytes.
+//
+// Returns:
+//   - io.Reader: The limited reader, it returns an ApiError if the document is too large.
+func newMaxSizeReader(reader io.Reader, maxSize int64) io.Reader {
+	return &maxSizeReader{
+		reader:  reader,
+		maxSize: maxSize,
+	}
+}
+
+// Read reads from the underlying reader and checks the size read so far.
+func (m *maxSizeReader) Read(p []byte) (int, error) {
+	n, err := m.reader.Read(p)
+	m.read += int64(n)
+
+	if m.read > m.maxSize {
+		return n, NewApiError(ERROR_CODE_UPLOAD_TOO_LARGE, fmt.Sprintf("the document is larger than %d bytes", m.maxSize))
+	}
+	return n, err
+}
+
+// spoolDocument writes an uploaded document to a temporary file in the jobs
+// directory, so it can be read again for every attempt of the upload.
+//
+// Parameters:
+//   - reader: The reader of the document.
+//   - maxSize: The maximum size in bytes.
+//
+// Returns:
+//   - string: The path of the temporary file, the caller removes it.
+//   - error: An error if the document is too large or can not be written.
+func spoolDocument(reader io.Reader, maxSize int64) (string, error) {
+	spoolFile, err := createSpoolFile()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(spoolFile, newMaxSizeReader(reader, maxSize))
+	closeErr := spoolFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(spoolFile.Name())
+		return "", err
+	}
+
+	return spoolFile.Name(), nil
+}
+
+// createSpoolFile creates a temporary file in the jobs directory.
+// The file is only readable by the owner.
+func createSpoolFile() (*os.File, error) {
+	jobsPath, err := utilities.GetJobsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(jobsPath, FAX_JOB_DIRECTORY_PERMISSION)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.CreateTemp(jobsPath, SPOOL_FILE_PATTERN)
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"faxsender/src/utilities"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Constants for the certificate of the daemon REST API.
+const (
+	TLS_CERTIFICATE_VALIDITY     time.Duration = 10 * 365 * 24 * time.Hour
+	TLS_CERT_FILE_PERMISSION     fs.FileMode   = 0644
+	TLS_KEY_FILE_PERMISSION      fs.FileMode   = 0600
+	TLS_LOCALHOST_NAME           string        = "localhost"
+	PEM_CERTIFICATE_BLOCK        string        = "CERTIFICATE"
+	PEM_EC_PRIVATE_KEY_BLOCK     string        = "EC PRIVATE KEY"
+	TLS_CERTIFICATE_ORGANIZATION string        = utilities.APP_NAME
+)
+
+// ErrCertificateNotPinned is returned by the HTTPS requests of ApiUI when the
+// daemon presents another certificate than the pinned one.
+var ErrCertificateNotPinned = errors.New("the daemon certificate doesn't match the pinned certificate")
+
+// tlsVersions maps the TLS_VERSION_* constants to the versions of the tls package.
+var tlsVersions = map[string]uint16{
+	utilities.TLS_VERSION_1_2: tls.VersionTLS12,
+	utilities.TLS_VERSION_1_3: tls.VersionTLS13,
+}
+
+// LoadOrCreateTLSCertificate returns the certificate the daemon serves HTTPS with.
+// Steps:
+// 1. Load the configured certificate and key files when both are configured.
+// 2. Otherwise load the certificate generated by a previous start.
+// 3. Otherwise generate a self-signed certificate for localhost, the loopback
+// addresses and the bind address, and store it next to the config.
+//
+// Parameters:
+//   - certFile: path of the configured PEM certificate file, or empty
+//   - keyFile: path of the configured PEM private key file, or empty
+//   - bindAddress: address the daemon listens on
+//
+// Returns:
+//   - the certificate
+//   - error if only one file is configured, or the certificate can't be loaded or created
+func LoadOrCreateTLSCertificate(certFile string, keyFile string, bindAddress string) (tls.Certificate, error) {
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return tls.Certificate{}, errors.New("both tls_cert_file and tls_key_file must be configured")
+		}
+		return loadTLSCertificate(certFile, keyFile)
+	}
+
+	certFile, err := utilities.GetTLSCertPath()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyFile, err = utilities.GetTLSKeyPath()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	if utilities.CheckIfFileExists(certFile) && utilities.CheckIfFileExists(keyFile) {
+		return loadTLSCertificate(certFile, keyFile)
+	}
+
+	certPEM, keyPEM, err := generateSelfSignedCertificate(bindAddress)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	// The key is written first, a certificate file is only left with its key.
+	if err := utilities.WriteFileAtomic(keyFile, keyPEM, TLS_KEY_FILE_PERMISSION); err != nil {
+		return tls.Certificate{}, fmt.Errorf("error writing the TLS key file: %v", err)
+	}
+	if err := utilities.WriteFileAtomic(certFile, certPEM, TLS_CERT_FILE_PERMISSION); err != nil {
+		return tls.Certificate{}, fmt.Errorf("error writing the TLS certificate file: %v", err)
+	}
+	return loadTLSCertificate(certFile, keyFile)
+}
+
+// loadTLSCertificate loads a certificate and its key from PEM files, with the
+// parsed leaf certificate.
+func loadTLSCertificate(certFile string, keyFile string) (tls.Certificate, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("error loading the TLS certificate '%s': %v", certFile, err)
+	}
+
+	certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("error parsing the TLS certificate '%s': %v", certFile, err)
+	}
+	return certificate, nil
+}
+
+// generateSelfSignedCertificate generates a self-signed ECDSA P-256 certificate
+// for localhost, the loopback addresses and the bind address.
+//
+// Returns:
+//   - the PEM certificate
+//   - the PEM private key
+//   - error if any
+func generateSelfSignedCertificate(bindAddress string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating the TLS key: %v", err)
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating the TLS certificate serial number: %v", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{Organization: []string{TLS_CERTIFICATE_ORGANIZATION}, CommonName: TLS_LOCALHOST_NAME},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(TLS_CERTIFICATE_VALIDITY),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{TLS_LOCALHOST_NAME},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	if ip := net.ParseIP(bindAddress); ip != nil {
+		if !ip.IsUnspecified() && !ip.IsLoopback() {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		}
+	} else if bindAddress != "" && bindAddress != TLS_LOCALHOST_NAME {
+		template.DNSNames = append(template.DNSNames, bindAddress)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating the TLS certificate: %v", err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error encoding the TLS key: %v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: PEM_CERTIFICATE_BLOCK, Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: PEM_EC_PRIVATE_KEY_BLOCK, Bytes: keyDer})
+	return certPEM, keyPEM, nil
+}
+
+// NewServerTLSConfig creates the TLS configuration of the daemon listener.
+//
+// Parameters:
+//   - certificate: the certificate the daemon serves HTTPS with
+//   - minVersion: one of the TLS_VERSION_* constants
+//
+// Returns:
+//   - the TLS configuration
+func NewServerTLSConfig(certificate tls.Certificate, minVersion string) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tlsVersion(minVersion),
+	}
+}
+
+// tlsVersion returns the version of the tls package of a TLS_VERSION_* constant,
+// TLS 1.2 for the unknown versions.
+func tlsVersion(version string) uint16 {
+	if v, ok := tlsVersions[version]; ok {
+		return v
+	}
+	return tls.VersionTLS12
+}
+
+// LoadDaemonCertificate reads the certificate the daemon serves HTTPS with,
+// so ApiUI can pin it. The configured certificate file is read, or the
+// certificate generated by the daemon when none is configured.
+//
+// Parameters:
+//   - certFile: path of the configured PEM certificate file, or empty
+//
+// Returns:
+//   - the leaf certificate of the daemon
+//   - error if the certificate can't be read
+func LoadDaemonCertificate(certFile string) (*x509.Certificate, error) {
+	if certFile == "" {
+		var err error
+		if certFile, err = utilities.GetTLSCertPath(); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the daemon certificate: %v", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != PEM_CERTIFICATE_BLOCK {
+		return nil, fmt.Errorf("the daemon certificate '%s' isn't a PEM certificate", certFile)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// newPinnedHttpClient creates an HTTP client only accepting a connection to a
+// server presenting the pinned certificate. The certificate isn't verified
+// against the system roots, a self-signed certificate is trusted by its pin.
+//
+// Parameters:
+//   - pinned: the certificate the server must present
+//
+// Returns:
+//   - the HTTP client
+func newPinnedHttpClient(pinned *x509.Certificate) *http.Client {
+	fingerprint := sha256.Sum256(pinned.Raw)
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// The chain isn't verified, VerifyConnection checks the pin instead.
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return ErrCertificateNotPinned
+			}
+			presented := sha256.Sum256(state.PeerCertificates[0].Raw)
+			if !bytes.Equal(presented[:], fingerprint[:]) {
+				return ErrCertificateNotPinned
+			}
+			return nil
+		},
+	}
+	return &http.Client{Transport: transport}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"faxsender/src/utilities"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Constants for the token of the daemon REST API.
+const (
+	API_TOKEN_SIZE            int         = 32
+	API_TOKEN_FILE_PERMISSION fs.FileMode = 0600
+
+	AUTHORIZATION_HEADER string = "Authorization"
+	BEARER_PREFIX        string = "Bearer "
+)
+
+// LoadOrCreateApiToken returns the token of the daemon REST API, generating it
+// at the first start. The token is stored in a file only readable by its owner.
+// Steps:
+// 1. Read the token file if it exists, restricting its permissions if needed.
+// 2. Otherwise generate a random token and write it to a temporary file.
+// 3. Link the temporary file to the token file, so a concurrent start either
+// creates the file or reads the one created by the other process.
+//
+// Returns:
+//   - the token
+//   - error if the token file can't be read or created
+func LoadOrCreateApiToken() (string, error) {
+	tokenPath, err := utilities.GetApiTokenPath()
+	if err != nil {
+		return "", err
+	}
+
+	token, err := readApiToken(tokenPath)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return token, err
+	}
+
+	token, err = generateApiToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := utilities.CreateDirectory(path.Dir(tokenPath)); err != nil {
+		return "", err
+	}
+
+	tempFile, err := os.CreateTemp(path.Dir(tokenPath), utilities.API_TOKEN_FILE_NAME+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("error creating the API token file: %v", err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	// CreateTemp creates the file with the 0600 permission.
+	_, err = tempFile.WriteString(token)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("error writing the API token file: %v", err)
+	}
+
+	err = os.Link(tempFile.Name(), tokenPath)
+	if errors.Is(err, fs.ErrExist) {
+		return readApiToken(tokenPath)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error creating the API token file: %v", err)
+	}
+	return token, nil
+}
+
+// readApiToken reads the token file, the permissions of a file readable by
+// other users are restricted to its owner.
+func readApiToken(tokenPath string) (string, error) {
+	info, err := os.Stat(tokenPath)
+	if err != nil {
+		return "", err
+	}
+
+	if info.Mode().Perm()&^API_TOKEN_FILE_PERMISSION != 0 {
+		if err := os.Chmod(tokenPath, API_TOKEN_FILE_PERMISSION); err != nil {
+			return "", fmt.Errorf("error restricting the permissions of the API token file: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(tokenPath)
+	if err != nil {
+		return "", fmt.Errorf("error reading the API token file: %v", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("the API token file '%s' is empty", tokenPath)
+	}
+	return token, nil
+}
+
+// generateApiToken generates a random token, hex encoded.
+func generateApiToken() (string, error) {
+	data := make([]byte, API_TOKEN_SIZE)
+	if _, err := rand.Read(data); err != nil {
+		return "", fmt.Errorf("error generating the API token: %v", err)
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// ApiTokenMiddleware returns the middleware requiring the API token on every route.
+// The token is sent in the Authorization header as a bearer token, requests
+// without it or with another token are answered with 401 Unauthorized.
+//
+// Parameters:
+//   - token: the token of the daemon REST API
+//
+// Returns:
+//   - the middleware handler
+func ApiTokenMiddleware(token string) gin.HandlerFunc {
+	expected := []byte(token)
+
+	return func(c *gin.Context) {
+		header := c.GetHeader(AUTHORIZATION_HEADER)
+		if !strings.HasPrefix(header, BEARER_PREFIX) ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, BEARER_PREFIX)), expected) != 1 {
+			respondWithError(c, NewApiError(ERROR_CODE_UNAUTHORIZED, "missing or invalid API token"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"context"
+	"faxsender/src/utilities"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Constants for the paging of the transmission query.
+const (
+	TRANSMISSION_QUERY_DEFAULT_LIMIT = 50
+	TRANSMISSION_QUERY_MAX_LIMIT     = 500
+)
+
+// Constants for the query parameters of the transmissions route, the dates are RFC 3339 timestamps.
+const (
+	TRANSMISSION_QUERY_PARAM_OFFSET     = "offset"
+	TRANSMISSION_QUERY_PARAM_LIMIT      = "limit"
+	TRANSMISSION_QUERY_PARAM_FROM       = "from"
+	TRANSMISSION_QUERY_PARAM_TO         = "to"
+	TRANSMISSION_QUERY_PARAM_STATUS     = "status"
+	TRANSMISSION_QUERY_PARAM_ACCOUNT_ID = "account_id"
+	TRANSMISSION_QUERY_PARAM_IS_PRINT   = "is_print"
+)
+
+// Constants for the query parameters of the ICT transmissions list, the dates are Unix timestamps.
+// A server supporting them reports the number of matching transmissions in ICT_TOTAL_COUNT_HEADER.
+const (
+	ICT_QUERY_PARAM_OFFSET     = "offset"
+	ICT_QUERY_PARAM_LIMIT      = "limit"
+	ICT_QUERY_PARAM_FROM       = "last_run_from"
+	ICT_QUERY_PARAM_TO         = "last_run_to"
+	ICT_QUERY_PARAM_STATUS     = "status"
+	ICT_QUERY_PARAM_ACCOUNT_ID = "account_id"
+	ICT_QUERY_PARAM_IS_PRINT   = "is_print"
+	ICT_TOTAL_COUNT_HEADER     = "X-Total-Count"
+)
+
+// TransmissionQuery holds the filters and the page of a transmission query,
+// empty filters match every transmission.
+type TransmissionQuery struct {
+	Offset    int       `json:"offset"`
+	Limit     int       `json:"limit"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Status    string    `json:"status"`
+	AccountID string    `json:"account_id"`
+	IsPrint   string    `json:"is_print"`
+}
+
+// TransmissionPage represents one page of the transmissions matching a query, the newest first.
+type TransmissionPage struct {
+	Faxes  []FaxData `json:"faxes"`
+	Offset int       `json:"offset"`
+	Limit  int       `json:"limit"`
+	Total  int       `json:"total"`
+}
+
+// Normalize returns the query with the page clamped to the allowed range.
+// A limit of zero is the default limit.
+//
+// Returns:
+//   - TransmissionQuery: The normalized query.
+func (q TransmissionQuery) Normalize() TransmissionQuery {
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	if q.Limit <= 0 {
+		q.Limit = TRANSMISSION_QUERY_DEFAULT_LIMIT
+	}
+	if q.Limit > TRANSMISSION_QUERY_MAX_LIMIT {
+		q.Limit = TRANSMISSION_QUERY_MAX_LIMIT
+	}
+	q.Status = strings.TrimSpace(q.Status)
+	q.AccountID = strings.TrimSpace(q.AccountID)
+	return q
+}
+
+// Matches checks if a transmission matches all filters of the query.
+// The status must be equal ignoring case and the date range includes From
+// and excludes To.
+//
+// Parameters:
+//   - response: The transmission listed by the fax provider.
+//
+// Returns:
+//   - bool: True if the transmission matches the query.
+func (q TransmissionQuery) Matches(response FaxResponse) bool {
+	if !q.From.IsZero() && response.DateTimeParsed.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !response.DateTimeParsed.Before(q.To) {
+		return false
+	}
+	if q.Status != "" && !strings.EqualFold(response.Status, q.Status) {
+		return false
+	}
+	if q.AccountID != "" && response.AccountID != q.AccountID {
+		return false
+	}
+	if q.IsPrint != "" && response.Is_Print != q.IsPrint {
+		return false
+	}
+	return true
+}
+
+// Values encodes the query as the query parameters of the transmissions route.
+//
+// Returns:
+//   - url.Values: The query parameters, empty filters are left out.
+func (q TransmissionQuery) Values() url.Values {
+	values := url.Values{}
+	if q.Offset > 0 {
+		values.Set(TRANSMISSION_QUERY_PARAM_OFFSET, strconv.Itoa(q.Offset))
+	}
+	if q.Limit > 0 {
+		values.Set(TRANSMISSION_QUERY_PARAM_LIMIT, strconv.Itoa(q.Limit))
+	}
+	if !q.From.IsZero() {
+		values.Set(TRANSMISSION_QUERY_PARAM_FROM, q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		values.Set(TRANSMISSION_QUERY_PARAM_TO, q.To.Format(time.RFC3339))
+	}
+	if q.Status != "" {
+		values.Set(TRANSMISSION_QUERY_PARAM_STATUS, q.Status)
+	}
+	if q.AccountID != "" {
+		values.Set(TRANSMISSION_QUERY_PARAM_ACCOUNT_ID, q.AccountID)
+	}
+	if q.IsPrint != "" {
+		values.Set(TRANSMISSION_QUERY_PARAM_IS_PRINT, q.IsPrint)
+	}
+	return values
+}
+
+// ictValues encodes the query as the query parameters of the ICT transmissions list.
+func (q TransmissionQuery) ictValues() url.Values {
+	values := url.Values{}
+	values.Set(ICT_QUERY_PARAM_OFFSET, strconv.Itoa(q.Offset))
+	values.Set(ICT_QUERY_PARAM_LIMIT, strconv.Itoa(q.Limit))
+	if !q.From.IsZero() {
+		values.Set(ICT_QUERY_PARAM_FROM, strconv.FormatInt(q.From.Unix(), 10))
+	}
+	if !q.To.IsZero() {
+		values.Set(ICT_QUERY_PARAM_TO, strconv.FormatInt(q.To.Unix(), 10))
+	}
+	if q.Status != "" {
+		values.Set(ICT_QUERY_PARAM_STATUS, q.Status)
+	}
+	if q.AccountID != "" {
+		values.Set(ICT_QUERY_PARAM_ACCOUNT_ID, q.AccountID)
+	}
+	if q.IsPrint != "" {
+		values.Set(ICT_QUERY_PARAM_IS_PRINT, q.IsPrint)
+	}
+	return values
+}
+
+// ParseTransmissionQuery decodes a query from the query parameters of the transmissions route.
+//
+// Parameters:
+//   - values: The query parameters.
+//
+// Returns:
+//   - TransmissionQuery: The decoded query, normalized.
+//   - error: An ApiError if a number, a date or the print flag is invalid.
+func ParseTransmissionQuery(values url.Values) (TransmissionQuery, error) {
+	query := TransmissionQuery{
+		Status:    values.Get(TRANSMISSION_QUERY_PARAM_STATUS),
+		AccountID: values.Get(TRANSMISSION_QUERY_PARAM_ACCOUNT_ID),
+		IsPrint:   values.Get(TRANSMISSION_QUERY_PARAM_IS_PRINT),
+	}
+
+	if query.IsPrint != "" && query.IsPrint != utilities.WITH_PRINT && query.IsPrint != utilities.WITHOUT_PRINT {
+		return query, NewApiError(ERROR_CODE_INVALID_REQUEST, fmt.Sprintf("the print flag '%s' is invalid", query.IsPrint))
+	}
+
+	for name, target := range map[string]*int{TRANSMISSION_QUERY_PARAM_OFFSET: &query.Offset, TRANSMISSION_QUERY_PARAM_LIMIT: &query.Limit} {
+		value := values.Get(name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return query, NewApiError(ERROR_CODE_INVALID_REQUEST, fmt.Sprintf("the %s '%s' is invalid", name, value))
+		}
+		*target = parsed
+	}
+
+	for name, target := range map[string]*time.Time{TRANSMISSION_QUERY_PARAM_FROM: &query.From, TRANSMISSION_QUERY_PARAM_TO: &query.To} {
+		value := values.Get(name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return query, NewApiError(ERROR_CODE_INVALID_REQUEST, fmt.Sprintf("the %s date '%s' is invalid", name, value))
+		}
+		*target = parsed
+	}
+
+	return query.Normalize(), nil
+}
+
+// PageTransmissions filters and pages the full transmissions list on the client.
+// It is the fallback for fax providers without server-side queries.
+// Steps:
+// 1. Keep the transmissions matching the query.
+// 2. Sort them by their last run, the newest first.
+// 3. Return the requested page.
+//
+// Parameters:
+//   - responses: The full transmissions list.
+//   - query: The filters and the page.
+//
+// Returns:
+//   - *TransmissionPage: The requested page.
+func PageTransmissions(responses []FaxResponse, query TransmissionQuery) *TransmissionPage {
+	query = query.Normalize()
+
+	matching := make([]FaxResponse, 0)
+	for _, response := range responses {
+		if query.Matches(response) {
+			matching = append(matching, response)
+		}
+	}
+
+	sort.SliceStable(matching, func(i, j int) bool {
+		return matching[i].DateTimeParsed.After(matching[j].DateTimeParsed)
+	})
+
+	start := query.Offset
+	if start > len(matching) {
+		start = len(matching)
+	}
+	end := start + query.Limit
+	if end > len(matching) {
+		end = len(matching)
+	}
+
+	return &TransmissionPage{
+		Faxes:  ConvertFilteredFaxResponsesToFaxData(matching[start:end]),
+		Offset: query.Offset,
+		Limit:  query.Limit,
+		Total:  len(matching),
+	}
+}
+
+// queryProviderTransmissions queries the transmissions of a fax provider,
+// on the server if the provider supports it and on the client otherwise.
+//
+// Parameters:
+//   - ctx: The context of the call, cancelling it aborts the in-flight request.
+//   - provider: The fax provider.
+//   - query: The filters and the page.
+//
+// Returns:
+//   - *TransmissionPage: The requested page.
+//   - error: An error if the request fails.
+func queryProviderTransmissions(ctx context.Context, provider FaxProvider, query TransmissionQuery) (*TransmissionPage, error) {
+	if querier, ok := provider.(FaxTransmissionQuerier); ok {
+		return querier.QueryTransmissions(ctx, query.Normalize())
+	}
+
+	responses, err := provider.ListTransmissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return PageTransmissions(responses, query), nil
+}
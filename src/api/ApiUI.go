@@ -1,18 +1,44 @@
 package api
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"faxsender/src/utilities"
+	"faxsender/src/utilities/config"
+	"faxsender/src/utilities/logger"
 	"fmt"
 	"io"
 	"mime/multipart"
+	"net"
 	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 // ApiUI represents the configuration for the API server.
 type ApiUI struct {
-	Port int
+	Schema string
+	Host   string
+	Port   int
+	Token  string
+
+	// client performs the requests, http.DefaultClient when it is nil.
+	client *http.Client
+
+	// daemonCertFile is the certificate file pinned on the first request, see
+	// PinDaemonCertificate, pinDaemonCert is false when the pin is fixed.
+	daemonCertFile string
+	pinDaemonCert  bool
+	pinned         *x509.Certificate
+	clientMutex    sync.Mutex
 
 	IApiUICalls
 }
@@ -21,6 +47,10 @@ type ApiUI struct {
 // Steps:
 // 1. Create a new ApiUI instance.
 // 2. Set the port for the ApiUI instance.
+// 3. Connect to the configured bind address, or to the loopback address when
+// the daemon listens on all the interfaces.
+// 4. Load the API token sent with every request.
+// 5. When the daemon serves HTTPS, pin the certificate of the daemon on the first request.
 //
 // Parameters:
 //   - port: port to connect
@@ -28,9 +58,130 @@ type ApiUI struct {
 // Returns:
 //   - the new instance of ApiUI
 func NewApiUI(port int) IApiUICalls {
-	return &ApiUI{
-		Port: port,
+	cfg := *config.Inst()
+
+	token, err := LoadOrCreateApiToken()
+	if err != nil {
+		logger.Inst().Error(fmt.Sprintf("error loading the API token: %v", err))
+	}
+
+	a := &ApiUI{
+		Schema: utilities.HTTP_SCHEMA,
+		Host:   apiHost(cfg.GetBindAddress()),
+		Port:   port,
+		Token:  token,
+	}
+
+	if cfg.GetTLS() {
+		a.PinDaemonCertificate(cfg.GetTLSCertFile())
+	}
+	return a
+}
+
+// PinCertificate switches the calls to HTTPS, only accepting a daemon
+// presenting the given certificate.
+//
+// Parameters:
+//   - certificate: the certificate the daemon serves HTTPS with
+func (a *ApiUI) PinCertificate(certificate *x509.Certificate) {
+	a.clientMutex.Lock()
+	defer a.clientMutex.Unlock()
+
+	a.Schema = utilities.HTTPS_SCHEMA
+	a.pinDaemonCert = false
+	a.pinned = certificate
+	a.client = newPinnedHttpClient(certificate)
+}
+
+// PinDaemonCertificate switches the calls to HTTPS, only accepting a daemon
+// presenting the certificate of the file. The daemon generates its certificate
+// at the first start, so the file is read on the first request and read again
+// when the daemon presents another certificate.
+//
+// Parameters:
+//   - certFile: path of the configured PEM certificate file, or empty for the generated one
+func (a *ApiUI) PinDaemonCertificate(certFile string) {
+	a.clientMutex.Lock()
+	defer a.clientMutex.Unlock()
+
+	a.Schema = utilities.HTTPS_SCHEMA
+	a.daemonCertFile = certFile
+	a.pinDaemonCert = true
+	a.pinned = nil
+	a.client = nil
+}
+
+// httpClient returns the client performing the requests, pinning the
+// certificate of the daemon if it isn't pinned yet.
+//
+// Returns:
+//   - the HTTP client
+//   - error if the certificate of the daemon can't be read yet
+func (a *ApiUI) httpClient() (*http.Client, error) {
+	a.clientMutex.Lock()
+	defer a.clientMutex.Unlock()
+
+	if a.client != nil {
+		return a.client, nil
+	}
+	if !a.pinDaemonCert {
+		return http.DefaultClient, nil
+	}
+
+	certificate, err := LoadDaemonCertificate(a.daemonCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("the certificate of the daemon can't be pinned, is the daemon started? %w", err)
 	}
+
+	a.pinned = certificate
+	a.client = newPinnedHttpClient(certificate)
+	return a.client, nil
+}
+
+// repinDaemonCertificate reads the certificate of the daemon again after it
+// presented another certificate than the pinned one, e.g. a certificate
+// generated again.
+//
+// Returns:
+//   - true if another certificate has been pinned
+func (a *ApiUI) repinDaemonCertificate() bool {
+	a.clientMutex.Lock()
+	defer a.clientMutex.Unlock()
+
+	if !a.pinDaemonCert {
+		return false
+	}
+
+	certificate, err := LoadDaemonCertificate(a.daemonCertFile)
+	if err != nil {
+		// The file is read again on the next request.
+		a.pinned = nil
+		a.client = nil
+		return false
+	}
+	if a.pinned != nil && certificate.Equal(a.pinned) {
+		return false
+	}
+
+	a.pinned = certificate
+	a.client = newPinnedHttpClient(certificate)
+	return true
+}
+
+// apiHost returns the host to connect to the daemon listening on an address,
+// the loopback address for the unspecified addresses. IPv6 addresses are
+// bracketed for the URLs.
+func apiHost(bindAddress string) string {
+	ip := net.ParseIP(bindAddress)
+	switch {
+	case ip == nil:
+		return bindAddress
+	case ip.IsUnspecified():
+		return utilities.LOCALHOST
+	case ip.To4() == nil:
+		return "[" + bindAddress + "]"
+	}
+	return bindAddress
 }
 
 // buildUrl constructs the complete URL for the API endpoint.
@@ -44,18 +195,72 @@ func NewApiUI(port int) IApiUICalls {
 //   - the complete URL
 func (a *ApiUI) buildUrl(endPoint string) string {
 	return utilities.UrlJoin(
-		utilities.HTTP_SCHEMA,
-		utilities.LOCALHOST,
+		a.Schema,
+		a.Host,
 		a.Port,
 		utilities.API_PATHS,
 		endPoint,
 	)
 }
 
+// doRequest makes an HTTP request to the API bound to the given context.
+// Steps:
+// 1. Create the request with the context, so cancelling it aborts the request.
+// 2. Set the content type if there is one, and the API token.
+// 3. Perform the request with the pinned HTTPS client, or the default HTTP client.
+// 4. If the daemon presents another certificate, pin the certificate it
+// serves now and send the request again if its body can be sent again.
+//
+// Parameters:
+//   - ctx: context of the call
+//   - method: HTTP method of the request
+//   - url: complete URL of the API endpoint
+//   - contentType: content type of the body, or empty
+//   - body: body of the request, or nil
+//
+// Returns:
+//   - HTTP response object
+//   - error if any
+func (a *ApiUI) doRequest(ctx context.Context, method, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating HTTP request: %v", err)
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set(AUTHORIZATION_HEADER, BEARER_PREFIX+a.Token)
+
+	client, err := a.httpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil && errors.Is(err, ErrCertificateNotPinned) && a.repinDaemonCertificate() && (body == nil || req.GetBody != nil) {
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, fmt.Errorf("error performing HTTP request: %w", err)
+			}
+		}
+
+		client, err = a.httpClient()
+		if err != nil {
+			return nil, err
+		}
+		resp, err = client.Do(req)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error performing HTTP request: %w", err)
+	}
+	return resp, nil
+}
+
 // readBody reads and parses the response body into the specified struct.
 // Steps:
 // 1. Ensure the response body is closed after the function exits.
-// 2. Check if the API call was successful (status code 200).
+// 2. Check if the API call was successful (status code 200), otherwise read the error envelope.
 // 3. Read the body of the response.
 // 4. Unmarshal the body into the provided struct.
 //
@@ -68,8 +273,8 @@ func (a *ApiUI) buildUrl(endPoint string) string {
 func (a *ApiUI) readBody(resp *http.Response, to interface{}) error {
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("API call failed with status code: %d", resp.StatusCode)
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return readApiError(resp)
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -91,13 +296,16 @@ func (a *ApiUI) readBody(resp *http.Response, to interface{}) error {
 // 2. Make an HTTP GET request to the API.
 // 3. Read and parse the response body into an AccountInfo struct.
 //
+// Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
+//
 // Returns:
 //   - AccountInfo struct
 //   - error if any
-func (a *ApiUI) GetAccountInfo() (*AccountInfo, error) {
+func (a *ApiUI) GetAccountInfo(ctx context.Context) (*AccountInfo, error) {
 	url := a.buildUrl(API_UI_LOAD_ACCOUNT_INFO)
 
-	resp, err := http.Get(url)
+	resp, err := a.doRequest(ctx, http.MethodGet, url, "", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -118,11 +326,12 @@ func (a *ApiUI) GetAccountInfo() (*AccountInfo, error) {
 // 4. Check if the API call was successful (status code 200).
 //
 // Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
 //   - userData: user data to be saved
 //
 // Returns:
 //   - error if any
-func (a *ApiUI) SaveSettings(userData UserData) error {
+func (a *ApiUI) SaveSettings(ctx context.Context, userData UserData) error {
 	url := a.buildUrl(API_UI_SAVE_SETTINGS)
 
 	data, err := json.Marshal(userData)
@@ -130,14 +339,14 @@ func (a *ApiUI) SaveSettings(userData UserData) error {
 		return err
 	}
 
-	resp, err := http.Post(url, "content-type:"+utilities.JSON_CONTENT_TYPE, bytes.NewBuffer(data))
+	resp, err := a.doRequest(ctx, http.MethodPost, url, "content-type:"+utilities.JSON_CONTENT_TYPE, bytes.NewBuffer(data))
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("API call failed with status code: %d", resp.StatusCode)
+		return readApiError(resp)
 	}
 
 	return nil
@@ -149,13 +358,16 @@ func (a *ApiUI) SaveSettings(userData UserData) error {
 // 2. Make an HTTP GET request to the API.
 // 3. Read and parse the response body into a UserData struct.
 //
+// Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
+//
 // Returns:
 //   - UserData struct
 //   - error if any
-func (a *ApiUI) LoadSettings() (*UserData, error) {
+func (a *ApiUI) LoadSettings(ctx context.Context) (*UserData, error) {
 	url := a.buildUrl(API_UI_LOAD_SETTINGS)
 
-	resp, err := http.Get(url)
+	resp, err := a.doRequest(ctx, http.MethodGet, url, "", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -169,51 +381,59 @@ func (a *ApiUI) LoadSettings() (*UserData, error) {
 // Steps:
 // 1. Build the URL for the API endpoint.
 // 2. Make an HTTP GET request to the API.
+// 3. Read the error envelope if the API call failed.
+//
+// Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
 //
 // Returns:
 //   - error if any
-func (a *ApiUI) Logout() error {
+func (a *ApiUI) Logout(ctx context.Context) error {
 	url := a.buildUrl(API_UI_LOGOUT)
 
-	_, err := http.Get(url)
-	return err
+	resp, err := a.doRequest(ctx, http.MethodGet, url, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return readApiError(resp)
+	}
+
+	return nil
 }
 
-// GetLastFaxes retrieves the last N faxes from the API.
+// QueryTransmissions retrieves one page of the transmissions matching a query from the API.
 // Steps:
-// 1. Build the URL for the API endpoint.
+// 1. Build the URL for the API endpoint with the query as query parameters.
 // 2. Make an HTTP GET request to the API.
-// 3. Read and parse the response body into a slice of FaxData.
-// 4. Retrieve the last N faxes from the slice.
+// 3. Read and parse the response body into a TransmissionPage.
 //
 // Parameters:
-//   - count: number of faxes to retrieve
+//   - ctx: context of the call, cancelling it aborts the request
+//   - query: filters and page of the transmissions
 //
 // Returns:
-//   - slice of FaxData
+//   - page of FaxData, the newest first
 //   - error if any
-func (a *ApiUI) GetLastFaxes(count int) ([]FaxData, error) {
-	url := a.buildUrl(API_UI_GET_LAST_FAXES)
+func (a *ApiUI) QueryTransmissions(ctx context.Context, query TransmissionQuery) (*TransmissionPage, error) {
+	url := a.buildUrl(API_UI_TRANSMISSIONS)
+	if values := query.Values(); len(values) > 0 {
+		url += "?" + values.Encode()
+	}
 
-	resp, err := http.Get(url)
+	resp, err := a.doRequest(ctx, http.MethodGet, url, "", nil)
 	if err != nil {
 		return nil, err
 	}
 
-	var allFaxes []FaxData
-	err = a.readBody(resp, &allFaxes)
+	var page TransmissionPage
+	err = a.readBody(resp, &page)
 	if err != nil {
 		return nil, err
 	}
-
-	startIndex := len(allFaxes) - count
-	if startIndex < 0 {
-		startIndex = 0
-	}
-
-	lastFaxes := allFaxes[startIndex:]
-	return lastFaxes, nil
-
+	return &page, nil
 }
 
 // GetAllAccounts retrieves information about all accounts via the API.
@@ -222,13 +442,16 @@ func (a *ApiUI) GetLastFaxes(count int) ([]FaxData, error) {
 // 2. Make an HTTP GET request to the API.
 // 3. Read and parse the response body into a slice of AccountResponse.
 //
+// Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
+//
 // Returns:
 //   - slice of AccountResponse
 //   - error if any
-func (a *ApiUI) GetAllAccounts() ([]AccountResponse, error) {
+func (a *ApiUI) GetAllAccounts(ctx context.Context) ([]AccountResponse, error) {
 	url := a.buildUrl(API_UI_GET_ALL_ACCOUNTS)
 
-	resp, err := http.Get(url)
+	resp, err := a.doRequest(ctx, http.MethodGet, url, "", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -240,14 +463,77 @@ func (a *ApiUI) GetAllAccounts() ([]AccountResponse, error) {
 	return allAccounts, nil
 }
 
-// SendFax sends a fax via the API.
+// SearchContacts searches the contacts of the fax provider via the API.
+// Steps:
+// 1. Build the URL for the API endpoint with the search text and the limit as query parameters.
+// 2. Make an HTTP GET request to the API.
+// 3. Read and parse the response body into a slice of ContactResponse.
+//
+// Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
+//   - text: search text matched against the phone number, the name and the email
+//   - limit: maximum number of contacts, the default is used if zero
+//
+// Returns:
+//   - slice of ContactResponse
+//   - error if any
+func (a *ApiUI) SearchContacts(ctx context.Context, text string, limit int) ([]ContactResponse, error) {
+	values := url.Values{}
+	values.Set(CONTACT_SEARCH_PARAM_TEXT, text)
+	if limit > 0 {
+		values.Set(CONTACT_SEARCH_PARAM_LIMIT, strconv.Itoa(limit))
+	}
+	url := a.buildUrl(API_UI_CONTACTS) + "?" + values.Encode()
+
+	resp, err := a.doRequest(ctx, http.MethodGet, url, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var contactResponses []ContactResponse
+	err = a.readBody(resp, &contactResponses)
+	if err != nil {
+		return nil, err
+	}
+	return contactResponses, nil
+}
+
+// GetCoverPageTemplates lists the cover page templates via the API.
 // Steps:
 // 1. Build the URL for the API endpoint.
-// 2. Create a multipart form with various fields and file attachment.
-// 3. Make an HTTP POST request to the API with the multipart form.
-// 4. Check if the API call was successful (status code 200).
+// 2. Make an HTTP GET request to the API.
+// 3. Read and parse the response body into a slice of template names.
+//
+// Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
+//
+// Returns:
+//   - slice of template names
+//   - error if any
+func (a *ApiUI) GetCoverPageTemplates(ctx context.Context) ([]string, error) {
+	url := a.buildUrl(API_UI_COVER_PAGES)
+
+	resp, err := a.doRequest(ctx, http.MethodGet, url, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	err = a.readBody(resp, &names)
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// SendFax sends a fax via the API.
+// Steps:
+// 1. Create a multipart form with various fields and file attachment.
+// 2. Make an HTTP POST request to the API with the multipart form.
+// 3. Read the ID of the sent transmission, or the error envelope if the call failed.
 //
 // Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
 //   - contact: Contact information for the fax.
 //   - document: DocumentRecord containing details about the document to be faxed.
 //   - transmission: Transmission details for the fax.
@@ -255,54 +541,529 @@ func (a *ApiUI) GetAllAccounts() ([]AccountResponse, error) {
 //   - fileModel: SendFileInfo providing information about the file content type.
 //
 // Returns:
+//   - the ID of the sent transmission
 //   - error if any
-func (a *ApiUI) SendFax(contact Contact, document DocumentRecord, transmission Transmission, file []byte, fileModel SendFileInfo) error {
-	url := a.buildUrl(API_UI_SEND_FAX)
+func (a *ApiUI) SendFax(ctx context.Context, contact Contact, document DocumentRecord, transmission Transmission, file []byte, fileModel SendFileInfo) (int, error) {
+	return a.SendFaxReader(ctx, contact, document, transmission, bytes.NewReader(file), fileModel)
+}
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+// SendFaxReader sends a fax via the API, streaming the file from the reader
+// into the request instead of buffering it.
+// Steps:
+// 1. Write a multipart form with various fields and the file through a pipe.
+// 2. Make an HTTP POST request to the API reading from the pipe.
+// 3. Read the ID of the sent transmission, or the error envelope if the call failed.
+//
+// Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
+//   - contact: Contact information for the fax.
+//   - document: DocumentRecord containing details about the document to be faxed.
+//   - transmission: Transmission details for the fax.
+//   - file: Reader of the contents of the file to be faxed.
+//   - fileModel: SendFileInfo providing information about the file content type.
+//
+// Returns:
+//   - the ID of the sent transmission
+//   - error if any
+func (a *ApiUI) SendFaxReader(ctx context.Context, contact Contact, document DocumentRecord, transmission Transmission, file io.Reader, fileModel SendFileInfo) (int, error) {
+	var sendResult SendResult
+	err := a.postSendFaxForm(ctx, API_UI_SEND_FAX, "contact", contact, document, transmission, file, fileModel, time.Time{}, &sendResult)
+	if err != nil {
+		return 0, err
+	}
 
-	if err := addFormField(writer, "contact", contact); err != nil {
-		return err
+	return sendResult.TransmissionID, nil
+}
+
+// BroadcastFax sends one fax to many recipients via the API.
+// Steps:
+// 1. Create a multipart form with the recipients, the shared fields and file attachment.
+// 2. Make an HTTP POST request to the API with the multipart form.
+// 3. Read the result of each recipient, or the error envelope if the call failed.
+//
+// Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
+//   - contacts: The recipients of the fax.
+//   - document: DocumentRecord containing details about the document to be faxed.
+//   - transmission: Transmission details shared by the recipients.
+//   - file: Byte array containing the contents of the file to be faxed.
+//   - fileModel: SendFileInfo providing information about the file content type.
+//
+// Returns:
+//   - the result of each recipient
+//   - error if any
+func (a *ApiUI) BroadcastFax(ctx context.Context, contacts []Contact, document DocumentRecord, transmission Transmission, file []byte, fileModel SendFileInfo) ([]BroadcastResult, error) {
+	var results []BroadcastResult
+	err := a.postSendFaxForm(ctx, API_UI_BROADCAST_FAX, "contacts", contacts, document, transmission, bytes.NewReader(file), fileModel, time.Time{}, &results)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := addFormField(writer, "document", document); err != nil {
+	return results, nil
+}
+
+// postSendFaxForm posts the multipart form of a send fax request.
+// Steps:
+// 1. Build the URL for the API endpoint.
+// 2. Write a multipart form with various fields and the file through a pipe,
+// the file is the last part so the server can stream it.
+// 3. Make an HTTP POST request to the API reading from the pipe.
+// 4. Read and parse the response body, or the error envelope if the call failed.
+//
+// Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
+//   - endPoint: The API endpoint.
+//   - recipientsField: The name of the form field holding the recipients.
+//   - recipients: The contact or the contacts of the fax.
+//   - document: DocumentRecord containing details about the document to be faxed.
+//   - transmission: Transmission details for the fax.
+//   - file: Reader of the contents of the file to be faxed.
+//   - fileModel: SendFileInfo providing information about the file content type.
+//   - sendAt: The time the fax is scheduled at, the fax is sent at once if zero.
+//   - to: Destination for the parsed response.
+//
+// Returns:
+//   - error if any
+func (a *ApiUI) postSendFaxForm(ctx context.Context, endPoint, recipientsField string, recipients interface{}, document DocumentRecord,
+	transmission Transmission, file io.Reader, fileModel SendFileInfo, sendAt time.Time, to interface{}) error {
+	url := a.buildUrl(endPoint)
+
+	body, contentType := newMultipartPipe(func(writer *multipart.Writer) error {
+		if err := addFormField(writer, recipientsField, recipients); err != nil {
+			return err
+		}
+
+		if err := addFormField(writer, "document", document); err != nil {
+			return err
+		}
+
+		if err := addFormField(writer, "transmission", transmission); err != nil {
+			return err
+		}
+
+		if err := addFormField(writer, "fileModel", fileModel); err != nil {
+			return err
+		}
+
+		if !sendAt.IsZero() {
+			if err := addFormField(writer, "send_at", sendAt); err != nil {
+				return err
+			}
+		}
+
+		return addFileField(writer, UPLOAD_FILE_FIELD_NAME, UPLOAD_FILE_NAME, file)
+	})
+	defer body.Close()
+
+	resp, err := a.doRequest(ctx, http.MethodPost, url, contentType, body)
+	if err != nil {
 		return err
 	}
 
-	if err := addFormField(writer, "transmission", transmission); err != nil {
-		return err
+	return a.readBody(resp, to)
+}
+
+// GetFaxStatus retrieves the status of a sent fax via the API.
+// Steps:
+// 1. Build the URL for the API endpoint with the transmission ID.
+// 2. Make an HTTP GET request to the API.
+// 3. Read and parse the response body into a FaxStatus struct.
+//
+// Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
+//   - transmissionID: The ID of the transmission.
+//
+// Returns:
+//   - FaxStatus struct
+//   - error if any
+func (a *ApiUI) GetFaxStatus(ctx context.Context, transmissionID int) (*FaxStatus, error) {
+	url := a.buildUrl(path.Join(API_UI_FAX_STATUS, strconv.Itoa(transmissionID)))
+
+	resp, err := a.doRequest(ctx, http.MethodGet, url, "", nil)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := addFormField(writer, "fileModel", fileModel); err != nil {
-		return err
+	var faxStatus *FaxStatus = &FaxStatus{}
+	err = a.readBody(resp, faxStatus)
+	if err != nil {
+		return nil, err
+	}
+	return faxStatus, nil
+}
+
+// ScheduleFax schedules a fax to be sent at the given time via the API,
+// streaming the file from the reader into the request.
+// Steps:
+// 1. Write the multipart form of a send fax request with the send_at field through a pipe.
+// 2. Make an HTTP POST request to the API reading from the pipe.
+// 3. Read the scheduled fax, or the error envelope if the call failed.
+//
+// Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
+//   - contact: Contact information for the fax.
+//   - document: DocumentRecord containing details about the document to be faxed.
+//   - transmission: Transmission details for the fax.
+//   - file: Reader of the contents of the file to be faxed.
+//   - fileModel: SendFileInfo providing information about the file content type.
+//   - sendAt: The time the fax is sent at.
+//
+// Returns:
+//   - the scheduled fax
+//   - error if any
+func (a *ApiUI) ScheduleFax(ctx context.Context, contact Contact, document DocumentRecord, transmission Transmission, file io.Reader, fileModel SendFileInfo, sendAt time.Time) (*ScheduledFax, error) {
+	if sendAt.IsZero() {
+		return nil, NewApiError(ERROR_CODE_INVALID_REQUEST, "the send time of the fax is missing")
+	}
+
+	scheduledFax := &ScheduledFax{}
+	err := a.postSendFaxForm(ctx, API_UI_SEND_FAX, "contact", contact, document, transmission, file, fileModel, sendAt, scheduledFax)
+	if err != nil {
+		return nil, err
+	}
+	return scheduledFax, nil
+}
+
+// GetScheduledFaxes retrieves the scheduled faxes via the API.
+// Steps:
+// 1. Build the URL for the API endpoint.
+// 2. Make an HTTP GET request to the API.
+// 3. Read and parse the response body into a slice of ScheduledFax.
+//
+// Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
+//
+// Returns:
+//   - slice of ScheduledFax, the earliest first
+//   - error if any
+func (a *ApiUI) GetScheduledFaxes(ctx context.Context) ([]ScheduledFax, error) {
+	url := a.buildUrl(API_UI_SCHEDULED_FAXES)
+
+	resp, err := a.doRequest(ctx, http.MethodGet, url, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var scheduledFaxes []ScheduledFax
+	err = a.readBody(resp, &scheduledFaxes)
+	if err != nil {
+		return nil, err
+	}
+	return scheduledFaxes, nil
+}
+
+// RescheduleFax moves a scheduled fax to a new time via the API.
+// Steps:
+// 1. Build the URL for the API endpoint with the scheduled fax ID.
+// 2. Make an HTTP PUT request with the new send time.
+// 3. Read and parse the response body into a ScheduledFax struct.
+//
+// Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
+//   - scheduledID: The ID of the scheduled fax.
+//   - sendAt: The new time the fax is sent at.
+//
+// Returns:
+//   - the rescheduled fax
+//   - error if any
+func (a *ApiUI) RescheduleFax(ctx context.Context, scheduledID string, sendAt time.Time) (*ScheduledFax, error) {
+	url := a.buildUrl(path.Join(API_UI_SCHEDULED_FAXES, scheduledID))
+
+	data, err := json.Marshal(RescheduleRequest{SendAt: sendAt})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.doRequest(ctx, http.MethodPut, url, utilities.JSON_CONTENT_TYPE, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
 	}
 
-	if err := addFileField(writer, "file", "filename.txt", file); err != nil {
+	scheduledFax := &ScheduledFax{}
+	err = a.readBody(resp, scheduledFax)
+	if err != nil {
+		return nil, err
+	}
+	return scheduledFax, nil
+}
+
+// CancelScheduledFax cancels a scheduled fax via the API.
+// Steps:
+// 1. Build the URL for the API endpoint with the scheduled fax ID.
+// 2. Make an HTTP DELETE request to the API.
+//
+// Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
+//   - scheduledID: The ID of the scheduled fax.
+//
+// Returns:
+//   - error if any
+func (a *ApiUI) CancelScheduledFax(ctx context.Context, scheduledID string) error {
+	url := a.buildUrl(path.Join(API_UI_SCHEDULED_FAXES, scheduledID))
+
+	resp, err := a.doRequest(ctx, http.MethodDelete, url, "", nil)
+	if err != nil {
 		return err
 	}
-	writer.Close()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return readApiError(resp)
+	}
+
+	return nil
+}
 
-	req, err := http.NewRequest("POST", url, body)
+// EnqueueFax adds a fax to the outbound queue of the daemon via the API,
+// streaming the file from the reader into the request.
+// Steps:
+// 1. Write the multipart form of a send fax request through a pipe.
+// 2. Make an HTTP POST request to the queue endpoint reading from the pipe.
+// 3. Read the queued fax, or the error envelope if the call failed.
+//
+// Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
+//   - contact: Contact information for the fax.
+//   - document: DocumentRecord containing details about the document to be faxed.
+//   - transmission: Transmission details for the fax.
+//   - file: Reader of the contents of the file to be faxed.
+//   - fileModel: SendFileInfo providing information about the file content type.
+//
+// Returns:
+//   - the queued fax with its job ID
+//   - error if any
+func (a *ApiUI) EnqueueFax(ctx context.Context, contact Contact, document DocumentRecord, transmission Transmission, file io.Reader, fileModel SendFileInfo) (*QueuedFax, error) {
+	queuedFax := &QueuedFax{}
+	err := a.postSendFaxForm(ctx, API_UI_QUEUE, "contact", contact, document, transmission, file, fileModel, time.Time{}, queuedFax)
 	if err != nil {
-		return fmt.Errorf("error creating HTTP request: %v", err)
+		return nil, err
 	}
+	return queuedFax, nil
+}
 
-	req.Header.Set("Content-Type", writer.FormDataContentType())
+// GetQueuedFax retrieves the state of a queued fax via the API.
+// Steps:
+// 1. Build the URL for the API endpoint with the job ID.
+// 2. Make an HTTP GET request to the API.
+// 3. Read and parse the response body into a QueuedFax struct.
+//
+// Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
+//   - queuedID: The job ID of the queued fax.
+//
+// Returns:
+//   - the queued fax
+//   - error if any
+func (a *ApiUI) GetQueuedFax(ctx context.Context, queuedID string) (*QueuedFax, error) {
+	url := a.buildUrl(path.Join(API_UI_QUEUE, queuedID))
+
+	resp, err := a.doRequest(ctx, http.MethodGet, url, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	queuedFax := &QueuedFax{}
+	err = a.readBody(resp, queuedFax)
+	if err != nil {
+		return nil, err
+	}
+	return queuedFax, nil
+}
+
+// GetQueuedFaxes retrieves the faxes of the outbound queue via the API.
+// Steps:
+// 1. Build the URL for the API endpoint.
+// 2. Make an HTTP GET request to the API.
+// 3. Read and parse the response body into a slice of QueuedFax.
+//
+// Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
+//
+// Returns:
+//   - slice of QueuedFax, the oldest first
+//   - error if any
+func (a *ApiUI) GetQueuedFaxes(ctx context.Context) ([]QueuedFax, error) {
+	url := a.buildUrl(API_UI_QUEUE)
+
+	resp, err := a.doRequest(ctx, http.MethodGet, url, "", nil)
+	if err != nil {
+		return nil, err
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	var queuedFaxes []QueuedFax
+	err = a.readBody(resp, &queuedFaxes)
 	if err != nil {
-		return fmt.Errorf("error performing HTTP request: %v", err)
+		return nil, err
+	}
+	return queuedFaxes, nil
+}
+
+// FollowJobEvents follows the event stream of a send job via the API until
+// its final event.
+// Steps:
+// 1. Make an HTTP GET request to the events endpoint of the job, asking for
+// the events following the last received one.
+// 2. Read the Server-Sent Events of the stream and pass them to onEvent.
+// 3. Reconnect if the stream ends before the final event, e.g. when the daemon restarts.
+//
+// Parameters:
+//   - ctx: context of the call, cancelling it closes the stream
+//   - jobID: ID of the job, the ID of the queued fax
+//   - lastEventID: ID of the last event the caller has, zero for all the events
+//   - onEvent: called with every event
+//
+// Returns:
+//   - error if any
+func (a *ApiUI) FollowJobEvents(ctx context.Context, jobID string, lastEventID int, onEvent func(JobEvent)) error {
+	for {
+		url := a.buildUrl(path.Join(API_UI_JOBS, jobID, API_UI_JOB_EVENTS)) + "?" + JOB_EVENTS_PARAM_LAST_EVENT_ID + "=" + strconv.Itoa(lastEventID)
+
+		resp, err := a.doRequest(ctx, http.MethodGet, url, "", nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return readApiError(resp)
+		}
+
+		final, err := readJobEventStream(resp.Body, func(event JobEvent) {
+			lastEventID = event.ID
+			onEvent(event)
+		})
+		resp.Body.Close()
+		if final {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		logger.Inst().Info(fmt.Sprintf("the event stream of the job %s ended (%v), reconnecting", jobID, err))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(JOB_EVENTS_SYNC_INTERVAL):
+		}
+	}
+}
+
+// readJobEventStream reads the Server-Sent Events of a job event stream. The
+// comment lines sent to keep the connection alive are skipped.
+//
+// Parameters:
+//   - body: the body of the stream
+//   - onEvent: called with every event
+//
+// Returns:
+//   - true if the final event of the job has been read
+//   - error if the stream can not be read or an event can not be decoded
+func readJobEventStream(body io.Reader, onEvent func(JobEvent)) (bool, error) {
+	scanner := bufio.NewScanner(body)
+
+	var data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, SSE_DATA_FIELD) {
+			data += strings.TrimPrefix(strings.TrimPrefix(line, SSE_DATA_FIELD), " ")
+			continue
+		}
+		if line != "" || data == "" {
+			continue
+		}
+
+		var event JobEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return false, fmt.Errorf("error decoding the job event: %v", err)
+		}
+		data = ""
+
+		onEvent(event)
+		if event.Final {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// SearchFaxHistory searches the local fax history via the API.
+// Steps:
+// 1. Build the URL for the API endpoint with the filters as query parameters.
+// 2. Make an HTTP GET request to the API.
+// 3. Read and parse the response body into a FaxHistoryPage.
+//
+// Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
+//   - query: The filters and the page of the search.
+//
+// Returns:
+//   - page of FaxHistoryRecord, the newest first
+//   - error if any
+func (a *ApiUI) SearchFaxHistory(ctx context.Context, query FaxHistoryQuery) (*FaxHistoryPage, error) {
+	url := a.buildUrl(API_UI_FAX_HISTORY)
+	if values := query.Values(); len(values) > 0 {
+		url += "?" + values.Encode()
+	}
+
+	resp, err := a.doRequest(ctx, http.MethodGet, url, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var page FaxHistoryPage
+	err = a.readBody(resp, &page)
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// SyncFaxHistory syncs the local fax history with the ICT transmissions list via the API.
+//
+// Parameters:
+//   - ctx: context of the call, cancelling it aborts the request
+//
+// Returns:
+//   - error if any
+func (a *ApiUI) SyncFaxHistory(ctx context.Context) error {
+	url := a.buildUrl(API_UI_SYNC_FAX_HISTORY)
+
+	resp, err := a.doRequest(ctx, http.MethodPost, url, "", nil)
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("APIUI call failed with status code: %d", resp.StatusCode)
+		return readApiError(resp)
 	}
 
 	return nil
 }
 
+// readApiError reads the JSON error envelope of a failed API call.
+// Steps:
+// 1. Read the body of the response.
+// 2. Unmarshal it into an ApiError.
+// 3. Fall back to an internal error with the status code if the body is not an envelope.
+//
+// Parameters:
+//   - resp: HTTP response object of the failed call
+//
+// Returns:
+//   - the ApiError as error
+func readApiError(resp *http.Response) error {
+	apiErr := &ApiError{}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || json.Unmarshal(body, apiErr) != nil || apiErr.Code == "" {
+		apiErr = NewApiError(ERROR_CODE_INTERNAL, fmt.Sprintf("API call failed with status code: %d", resp.StatusCode))
+	}
+
+	apiErr.HTTPStatus = resp.StatusCode
+	return apiErr
+}
+
 // addFormField adds a form field to the multipart request.
 // Steps:
 // 1. Create a form field in the multipart request.
@@ -334,22 +1095,25 @@ func addFormField(writer *multipart.Writer, fieldName string, data interface{})
 // addFileField adds a file field to the multipart request.
 // Steps:
 // 1. Create a file field in the multipart request.
-// 2. Write the file content to the file field.
+// 2. Copy the file content from the reader to the file field.
 //
 // Parameters:
 //   - writer: Multipart writer for creating file fields.
 //   - fieldName: Name of the file field.
 //   - fileName: Name of the file.
-//   - file: Byte array containing the file content.
+//   - file: Reader of the file content.
 //
 // Returns:
 //   - error if any
-func addFileField(writer *multipart.Writer, fieldName, fileName string, file []byte) error {
+func addFileField(writer *multipart.Writer, fieldName, fileName string, file io.Reader) error {
 	field, err := writer.CreateFormFile(fieldName, fileName)
 	if err != nil {
 		return fmt.Errorf("error creating %s form field: %v", fieldName, err)
 	}
 
-	field.Write(file)
+	_, err = io.Copy(field, file)
+	if err != nil {
+		return fmt.Errorf("error writing %s form field: %v", fieldName, err)
+	}
 	return nil
 }
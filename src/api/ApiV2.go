@@ -0,0 +1,480 @@
+package api
+
+import (
+	"encoding/json"
+	"faxsender/src/utilities"
+	"faxsender/src/utilities/config"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Constants for the resources of the v2 API.
+const (
+	API_V2_FAXES              = "faxes"
+	API_V2_FAX                = "faxes/:id"
+	API_V2_JOB                = "jobs/:id"
+	API_V2_JOB_EVENTS         = "jobs/:id/events"
+	API_V2_WEBHOOKS           = "webhooks"
+	API_V2_WEBHOOK            = "webhooks/:id"
+	API_V2_WEBHOOK_DELIVERIES = "webhooks/:id/deliveries"
+	API_V2_ACCOUNTS           = "accounts"
+	API_V2_SETTINGS           = "settings"
+	API_V2_SESSION            = "session"
+	API_V2_OPENAPI            = "openapi.json"
+
+	// V2_FAX_FIELD_NAME and V2_DOCUMENT_FIELD_NAME are the parts of the
+	// multipart body of POST /faxes, the fax metadata comes first.
+	V2_FAX_FIELD_NAME      = "fax"
+	V2_DOCUMENT_FIELD_NAME = "document"
+
+	// REQUIRED_TAG marks the required fields of the v2 request bodies, it is
+	// checked by missingRequiredField and published in the OpenAPI document.
+	REQUIRED_TAG = "binding"
+	REQUIRED     = "required"
+)
+
+// FaxRequest is the fax metadata of POST /api/v2/faxes, sent as the JSON fax
+// part of the multipart body before the document part.
+type FaxRequest struct {
+	Recipient         Contact `json:"recipient" binding:"required"`
+	Title             string  `json:"title" binding:"required"`
+	Description       string  `json:"description,omitempty"`
+	AccountID         string  `json:"account_id" binding:"required"`
+	Print             bool    `json:"print,omitempty"`
+	CoverPage         bool    `json:"cover_page,omitempty"`
+	CoverPageTemplate string  `json:"cover_page_template,omitempty"`
+	MaxAttempts       int     `json:"max_attempts,omitempty"`
+	UploadFormat      string  `json:"upload_format,omitempty"`
+	FaxResolution     string  `json:"fax_resolution,omitempty"`
+	Dithering         bool    `json:"dithering,omitempty"`
+}
+
+// Settings is the response of the settings resource, the password is write-only.
+type Settings struct {
+	Username string `json:"username"`
+	Hostname string `json:"host"`
+}
+
+// ErrorEnvelope is the JSON error envelope of every v2 error response.
+type ErrorEnvelope struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes a v2 error, the ICT fields are set for the failures of the ICT server.
+type ErrorDetail struct {
+	Code      string  `json:"code"`
+	Message   string  `json:"message"`
+	Step      ICTStep `json:"step,omitempty"`
+	ICTStatus int     `json:"ict_status,omitempty"`
+	ICTBody   string  `json:"ict_body,omitempty"`
+}
+
+// v2Route describes a route of the v2 API, the routes are registered and the
+// OpenAPI document is generated from the same descriptions.
+type v2Route struct {
+	method      string
+	path        string
+	operationID string
+	summary     string
+	handler     gin.HandlerFunc
+	parameters  []openApiParameter
+
+	// request is the JSON body, or the fax part of a multipart body, nil without a body.
+	request   interface{}
+	multipart bool
+
+	// status is the status code of a success, response its body, nil without a
+	// body. The body of an event stream is a stream of response events.
+	status      int
+	response    interface{}
+	eventStream bool
+}
+
+// v2Routes returns the routes of the v2 API.
+func v2Routes() []v2Route {
+	return []v2Route{
+		{
+			method: http.MethodPost, path: API_V2_FAXES, operationID: "sendFax",
+			summary: "Queue a fax, the document is converted before the response and the fax is sent by its job",
+			handler: routeV2SendFax, request: FaxRequest{}, multipart: true,
+			status: http.StatusAccepted, response: QueuedFax{},
+		},
+		{
+			method: http.MethodGet, path: API_V2_JOB, operationID: "getJob",
+			summary: "Get the state of the send job of a fax",
+			handler: routeQueuedFax, parameters: []openApiParameter{jobIDParameter()},
+			status: http.StatusOK, response: QueuedFax{},
+		},
+		{
+			method: http.MethodGet, path: API_V2_JOB_EVENTS, operationID: "streamJobEvents",
+			summary: "Stream the pipeline steps and the delivery status changes of a send job as Server-Sent Events",
+			handler: routeJobEvents, parameters: jobEventsParameters(),
+			status: http.StatusOK, response: JobEvent{}, eventStream: true,
+		},
+		{
+			method: http.MethodGet, path: API_V2_FAXES, operationID: "listFaxes",
+			summary: "List the sent faxes, the newest first",
+			handler: routeQueryTransmissions, parameters: transmissionQueryParameters(),
+			status: http.StatusOK, response: TransmissionPage{},
+		},
+		{
+			method: http.MethodGet, path: API_V2_FAX, operationID: "getFax",
+			summary: "Get the status of a sent fax",
+			handler: routeFaxStatus, parameters: []openApiParameter{transmissionIDParameter()},
+			status: http.StatusOK, response: FaxStatus{},
+		},
+		{
+			method: http.MethodPost, path: API_V2_WEBHOOKS, operationID: "createWebhook",
+			summary: "Subscribe a URL to the fax events, the signing secret is only returned here",
+			handler: routeCreateWebhook, request: WebhookRequest{},
+			status: http.StatusCreated, response: WebhookSubscription{},
+		},
+		{
+			method: http.MethodGet, path: API_V2_WEBHOOKS, operationID: "listWebhooks",
+			summary: "List the webhook subscriptions",
+			handler: routeWebhooks,
+			status:  http.StatusOK, response: []WebhookSubscription{},
+		},
+		{
+			method: http.MethodGet, path: API_V2_WEBHOOK, operationID: "getWebhook",
+			summary: "Get a webhook subscription",
+			handler: routeWebhook, parameters: []openApiParameter{webhookIDParameter()},
+			status: http.StatusOK, response: WebhookSubscription{},
+		},
+		{
+			method: http.MethodPut, path: API_V2_WEBHOOK, operationID: "putWebhook",
+			summary: "Replace the URL and the events of a webhook subscription, and its secret if one is given",
+			handler: routeUpdateWebhook, parameters: []openApiParameter{webhookIDParameter()}, request: WebhookRequest{},
+			status: http.StatusOK, response: WebhookSubscription{},
+		},
+		{
+			method: http.MethodDelete, path: API_V2_WEBHOOK, operationID: "deleteWebhook",
+			summary: "Remove a webhook subscription",
+			handler: routeDeleteWebhook, parameters: []openApiParameter{webhookIDParameter()},
+			status: http.StatusNoContent,
+		},
+		{
+			method: http.MethodGet, path: API_V2_WEBHOOK_DELIVERIES, operationID: "listWebhookDeliveries",
+			summary: "List the latest deliveries of a webhook subscription with their attempts, the newest first",
+			handler: routeWebhookDeliveries, parameters: []openApiParameter{webhookIDParameter()},
+			status: http.StatusOK, response: []WebhookDelivery{},
+		},
+		{
+			method: http.MethodGet, path: API_V2_ACCOUNTS, operationID: "listAccounts",
+			summary: "List the accounts of the fax server",
+			handler: routeLoadAllAccounts,
+			status:  http.StatusOK, response: []AccountResponse{},
+		},
+		{
+			method: http.MethodGet, path: API_V2_SETTINGS, operationID: "getSettings",
+			summary: "Get the fax server and the user name of the saved credentials",
+			handler: routeV2GetSettings,
+			status:  http.StatusOK, response: Settings{},
+		},
+		{
+			method: http.MethodPut, path: API_V2_SETTINGS, operationID: "putSettings",
+			summary: "Save the credentials of the fax server",
+			handler: routeV2PutSettings, request: UserData{},
+			status: http.StatusOK, response: Settings{},
+		},
+		{
+			method: http.MethodDelete, path: API_V2_SESSION, operationID: "deleteSession",
+			summary: "Log out, removing the saved credentials",
+			handler: routeV2DeleteSession,
+			status:  http.StatusNoContent,
+		},
+	}
+}
+
+// initV2Routers registers the routes of the v2 API and the route serving its
+// OpenAPI document, generated once from the routes.
+//
+// Parameters:
+//   - router: A pointer to the Gin router.
+func initV2Routers(router *gin.Engine) {
+	routes := v2Routes()
+	for _, route := range routes {
+		router.Handle(route.method, path.Join(utilities.API_V2_PATHS, route.path), route.handler)
+	}
+
+	spec := generateOpenApiDocument(routes)
+	router.GET(path.Join(utilities.API_V2_PATHS, API_V2_OPENAPI), func(c *gin.Context) {
+		c.JSON(http.StatusOK, spec)
+	})
+}
+
+// isV2Request returns whether a request is a request of the v2 API.
+func isV2Request(c *gin.Context) bool {
+	return strings.HasPrefix(c.Request.URL.Path, utilities.API_V2_PATHS+"/")
+}
+
+// respondWithV2Error writes an error as the v2 JSON error envelope.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+//   - apiErr: The error to return, with its HTTP status.
+func respondWithV2Error(c *gin.Context, apiErr *ApiError) {
+	c.JSON(apiErr.HTTPStatus, ErrorEnvelope{Error: ErrorDetail{
+		Code:      apiErr.Code,
+		Message:   apiErr.Message,
+		Step:      apiErr.Step,
+		ICTStatus: apiErr.ICTStatus,
+		ICTBody:   apiErr.ICTBody,
+	}})
+}
+
+// routeNotFound answers the unknown routes, with the error envelope under the v2 API.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeNotFound(c *gin.Context) {
+	if isV2Request(c) {
+		respondWithError(c, NewApiError(ERROR_CODE_NOT_FOUND, fmt.Sprintf("the route %s %s doesn't exist", c.Request.Method, c.Request.URL.Path)))
+		return
+	}
+	c.String(http.StatusNotFound, "404 page not found")
+}
+
+// routeV2SendFax handles POST /api/v2/faxes.
+// It follows these steps:
+// 1. Read the fax part and check its required fields.
+// 2. Take the content type of the document from the document part, or from its file name.
+// 3. Stream the document to the outbound queue and return the queued fax at
+// once, the Location header points to its send job.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeV2SendFax(c *gin.Context) {
+	maxBodySize := (*config.Inst()).GetMaxUploadSize() + MAX_FORM_FIELDS_OVERLAY
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBodySize)
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, "the body should be a multipart form with the fax and the document parts"))
+		return
+	}
+
+	part, err := reader.NextPart()
+	if err != nil || part.FormName() != V2_FAX_FIELD_NAME {
+		respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, "the fax part should be the first part"))
+		return
+	}
+
+	var request FaxRequest
+	err = json.NewDecoder(io.LimitReader(part, MAX_FORM_FIELD_SIZE)).Decode(&request)
+	if err != nil {
+		respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, fmt.Sprintf("failed to decode the fax part: %v", err)))
+		return
+	}
+	if field := missingRequiredField(request); field != "" {
+		respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, fmt.Sprintf("the %s field is required", field)))
+		return
+	}
+
+	part, err = reader.NextPart()
+	if err != nil || part.FormName() != V2_DOCUMENT_FIELD_NAME {
+		respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, "the document part should follow the fax part"))
+		return
+	}
+
+	contentType := documentPartContentType(part.Header.Get("Content-Type"), part.FileName())
+	if contentType == "" {
+		respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, "the content type of the document is unknown"))
+		return
+	}
+
+	contact, document, transmission := request.toV1()
+	queued, err := directCall.EnqueueFax(c.Request.Context(), contact, document, transmission, part, SendFileInfo{ContentType: contentType})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.Header("Location", path.Join(utilities.API_V2_PATHS, API_UI_JOBS, queued.ID))
+	c.JSON(http.StatusAccepted, queued)
+}
+
+// documentPartContentType returns the content type of the document part, the
+// generic binary type is replaced by the type of the file name extension.
+func documentPartContentType(header string, fileName string) string {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err == nil && mediaType != "application/octet-stream" {
+		return mediaType
+	}
+	if fileName == "" {
+		return ""
+	}
+	return utilities.GetContentType(utilities.ExtractFileExtension(fileName))
+}
+
+// toV1 converts the fax request to the models shared with the v1 API.
+//
+// Returns:
+//   - the recipient
+//   - the document record
+//   - the transmission
+func (r FaxRequest) toV1() (Contact, DocumentRecord, Transmission) {
+	transmission := Transmission{
+		Title:             r.Title,
+		AccountID:         r.AccountID,
+		IsPrint:           utilities.WITHOUT_PRINT,
+		IsCoverPage:       utilities.WITHOUT_COVER,
+		CoverPageTemplate: r.CoverPageTemplate,
+		UploadFormat:      r.UploadFormat,
+		FaxResolution:     r.FaxResolution,
+		Dithering:         r.Dithering,
+	}
+	if r.Print {
+		transmission.IsPrint = utilities.WITH_PRINT
+	}
+	if r.CoverPage {
+		transmission.IsCoverPage = utilities.WITH_COVER
+	}
+	if r.MaxAttempts > 0 {
+		transmission.TryAllowed = strconv.Itoa(r.MaxAttempts)
+	}
+
+	return r.Recipient, DocumentRecord{Title: r.Title, Description: r.Description}, transmission
+}
+
+// missingRequiredField returns the JSON name of the first required field left
+// empty, the fields of the nested structs are checked too.
+//
+// Parameters:
+//   - value: The decoded request body.
+//
+// Returns:
+//   - the JSON path of the missing field, or empty if all are set
+func missingRequiredField(value interface{}) string {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := jsonFieldName(field)
+		if name == "" {
+			continue
+		}
+
+		// The missing fields of a nested struct are named before the struct.
+		if nested := missingRequiredField(v.Field(i).Interface()); nested != "" {
+			return name + "." + nested
+		}
+		if field.Tag.Get(REQUIRED_TAG) == REQUIRED && v.Field(i).IsZero() {
+			return name
+		}
+	}
+	return ""
+}
+
+// routeV2GetSettings handles GET /api/v2/settings, the password isn't returned.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeV2GetSettings(c *gin.Context) {
+	userData, err := directCall.LoadSettings(c.Request.Context())
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, Settings{Username: userData.Username, Hostname: userData.Hostname})
+}
+
+// routeV2PutSettings handles PUT /api/v2/settings.
+// It follows these steps:
+// 1. Decode the credentials and check their required fields.
+// 2. Save them encrypted to the settings file.
+// 3. Return the saved settings without the password.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeV2PutSettings(c *gin.Context) {
+	var userData UserData
+	err := json.NewDecoder(c.Request.Body).Decode(&userData)
+	if err != nil {
+		respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, fmt.Sprintf("failed to decode the settings: %v", err)))
+		return
+	}
+	if field := missingRequiredField(userData); field != "" {
+		respondWithError(c, NewApiError(ERROR_CODE_INVALID_REQUEST, fmt.Sprintf("the %s field is required", field)))
+		return
+	}
+
+	err = directCall.SaveSettings(c.Request.Context(), userData)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, Settings{Username: userData.Username, Hostname: userData.Hostname})
+}
+
+// routeV2DeleteSession handles DELETE /api/v2/session, removing the saved credentials.
+//
+// Parameters:
+//   - c: Gin context for the HTTP request.
+func routeV2DeleteSession(c *gin.Context) {
+	err := directCall.Logout(c.Request.Context())
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// transmissionQueryParameters describes the query parameters of GET /api/v2/faxes.
+func transmissionQueryParameters() []openApiParameter {
+	integer := openApiSchemaObject{"type": "integer", "minimum": 0}
+	dateTime := openApiSchemaObject{"type": "string", "format": "date-time"}
+	text := openApiSchemaObject{"type": "string"}
+
+	return []openApiParameter{
+		{Name: TRANSMISSION_QUERY_PARAM_OFFSET, In: "query", Description: "Number of faxes to skip", Schema: integer},
+		{Name: TRANSMISSION_QUERY_PARAM_LIMIT, In: "query",
+			Description: fmt.Sprintf("Number of faxes of the page, %d by default and %d at most", TRANSMISSION_QUERY_DEFAULT_LIMIT, TRANSMISSION_QUERY_MAX_LIMIT),
+			Schema:      integer},
+		{Name: TRANSMISSION_QUERY_PARAM_FROM, In: "query", Description: "Earliest last run of the faxes", Schema: dateTime},
+		{Name: TRANSMISSION_QUERY_PARAM_TO, In: "query", Description: "Latest last run of the faxes", Schema: dateTime},
+		{Name: TRANSMISSION_QUERY_PARAM_STATUS, In: "query", Description: "Status of the faxes", Schema: text},
+		{Name: TRANSMISSION_QUERY_PARAM_ACCOUNT_ID, In: "query", Description: "Account the faxes were sent from", Schema: text},
+		{Name: TRANSMISSION_QUERY_PARAM_IS_PRINT, In: "query", Description: "1 for the printed faxes, 0 for the others",
+			Schema: openApiSchemaObject{"type": "string", "enum": []string{utilities.WITH_PRINT, utilities.WITHOUT_PRINT}}},
+	}
+}
+
+// jobIDParameter describes the job ID path parameter.
+func jobIDParameter() openApiParameter {
+	return openApiParameter{Name: "id", In: "path", Required: true, Description: "ID of the send job, the ID of the queued fax",
+		Schema: openApiSchemaObject{"type": "string"}}
+}
+
+// jobEventsParameters describes the parameters of GET /api/v2/jobs/{id}/events.
+func jobEventsParameters() []openApiParameter {
+	lastEventID := openApiSchemaObject{"type": "integer", "minimum": 0}
+	return []openApiParameter{
+		jobIDParameter(),
+		{Name: LAST_EVENT_ID_HEADER, In: "header", Description: "ID of the last received event, the stream starts after it", Schema: lastEventID},
+		{Name: JOB_EVENTS_PARAM_LAST_EVENT_ID, In: "query", Description: "Replaces the " + LAST_EVENT_ID_HEADER + " header", Schema: lastEventID},
+	}
+}
+
+// webhookIDParameter describes the webhook subscription ID path parameter.
+func webhookIDParameter() openApiParameter {
+	return openApiParameter{Name: "id", In: "path", Required: true, Description: "ID of the webhook subscription",
+		Schema: openApiSchemaObject{"type": "string"}}
+}
+
+// transmissionIDParameter describes the transmission ID path parameter.
+func transmissionIDParameter() openApiParameter {
+	return openApiParameter{Name: "id", In: "path", Required: true, Description: "ID of the transmission",
+		Schema: openApiSchemaObject{"type": "integer"}}
+}
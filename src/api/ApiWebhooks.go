@@ -0,0 +1,897 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"faxsender/src/utilities"
+	"faxsender/src/utilities/config"
+	"faxsender/src/utilities/logger"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Constants for the events sent to the webhooks. A subscription receives the
+// events it lists, or all of them when it lists none.
+const (
+	WEBHOOK_EVENT_QUEUED    = "fax.queued"
+	WEBHOOK_EVENT_SENT      = "fax.sent"
+	WEBHOOK_EVENT_DELIVERED = "fax.delivered"
+	WEBHOOK_EVENT_FAILED    = "fax.failed"
+)
+
+// Constants for the states of a webhook delivery.
+const (
+	WEBHOOK_DELIVERY_STATUS_PENDING   = "pending"
+	WEBHOOK_DELIVERY_STATUS_DELIVERED = "delivered"
+	WEBHOOK_DELIVERY_STATUS_FAILED    = "failed"
+)
+
+// Constants for the requests sent to the webhooks. The signature header holds
+// the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret of the
+// subscription, the timestamp is the Unix time of the timestamp header.
+const (
+	WEBHOOK_SIGNATURE_HEADER = "X-Faxsender-Signature"
+	WEBHOOK_TIMESTAMP_HEADER = "X-Faxsender-Timestamp"
+	WEBHOOK_EVENT_HEADER     = "X-Faxsender-Event"
+	WEBHOOK_DELIVERY_HEADER  = "X-Faxsender-Delivery"
+	WEBHOOK_SIGNATURE_PREFIX = "sha256="
+
+	WEBHOOK_SECRET_SIZE        = 32
+	WEBHOOK_DELIVERY_ID_SIZE   = 16
+	WEBHOOK_REQUEST_TIMEOUT    = 10 * time.Second
+	WEBHOOK_RETRY_BASE_DELAY   = time.Second
+	WEBHOOK_RESPONSE_BODY_SIZE = 512
+	WEBHOOK_DELIVERY_LOG_SIZE  = 1000
+
+	WEBHOOK_FILE_PERMISSION fs.FileMode = 0600
+)
+
+// Constants for the lock of the webhook delivery log. The daemon and the UI
+// both publish job events, a process holds the lock file while it checks and
+// changes the log so an event is delivered once. A lock older than the lease
+// is left by a crashed process and is taken over.
+const (
+	WEBHOOK_DELIVERY_LOCK_EXTENSION = ".lock"
+	WEBHOOK_DELIVERY_LOCK_LEASE     = 30 * time.Second
+	WEBHOOK_DELIVERY_LOCK_TIMEOUT   = 2 * WEBHOOK_DELIVERY_LOCK_LEASE
+	WEBHOOK_DELIVERY_LOCK_RETRY     = 10 * time.Millisecond
+)
+
+// webhookEvents lists the events a subscription may list.
+var webhookEvents = []string{WEBHOOK_EVENT_QUEUED, WEBHOOK_EVENT_SENT, WEBHOOK_EVENT_DELIVERED, WEBHOOK_EVENT_FAILED}
+
+// WebhookSubscription is a URL the events of the send jobs are posted to.
+// The secret signing the requests is only returned when it is set, it is
+// write-only afterwards.
+type WebhookSubscription struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookRequest is the body creating or replacing a webhook subscription.
+// A secret is generated when none is given.
+type WebhookRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events,omitempty"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+// WebhookPayload is the JSON body posted to a webhook. Its ID is the ID of
+// the delivery, it is the same for all the attempts of the delivery.
+type WebhookPayload struct {
+	ID             string     `json:"id"`
+	Event          string     `json:"event"`
+	JobID          string     `json:"job_id"`
+	Message        string     `json:"message"`
+	TransmissionID int        `json:"transmission_id,omitempty"`
+	FaxStatus      *FaxStatus `json:"fax_status,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	Time           time.Time  `json:"time"`
+}
+
+// WebhookDelivery is an entry of the delivery log, the delivery of an event
+// to a subscription with all its attempts. The log keeps the latest finished
+// deliveries and the pending ones.
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	URL            string          `json:"url"`
+	Event          string          `json:"event"`
+	JobID          string          `json:"job_id"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	Payload        json.RawMessage `json:"payload"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// webhooksMutex serializes the changes of the webhook subscriptions and
+// webhookDeliveriesMutex the changes of the delivery log in this process, the
+// lock file of the log those of different processes, see lockWebhookDeliveries.
+var (
+	webhooksMutex          sync.Mutex
+	webhookDeliveriesMutex sync.Mutex
+)
+
+// webhookClient posts the webhook requests.
+var webhookClient = &http.Client{Timeout: WEBHOOK_REQUEST_TIMEOUT}
+
+// loadWebhookSubscriptions reads the webhook subscriptions, a missing file is no subscription.
+func loadWebhookSubscriptions() ([]WebhookSubscription, error) {
+	webhooksFilePath, err := utilities.GetWebhooksPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(webhooksFilePath)
+	if os.IsNotExist(err) {
+		return []WebhookSubscription{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := make([]WebhookSubscription, 0)
+	err = json.Unmarshal(data, &subscriptions)
+	if err != nil {
+		return nil, fmt.Errorf("the webhooks file '%s' is corrupted: %v", webhooksFilePath, err)
+	}
+	return subscriptions, nil
+}
+
+// saveWebhookSubscriptions writes the webhook subscriptions, only the user
+// can read them since they hold the secrets.
+func saveWebhookSubscriptions(subscriptions []WebhookSubscription) error {
+	webhooksFilePath, err := utilities.GetWebhooksPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(subscriptions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return utilities.WriteFileAtomic(webhooksFilePath, data, WEBHOOK_FILE_PERMISSION)
+}
+
+// findWebhookSubscription returns the index of the subscription with the ID, -1 if there is none.
+func findWebhookSubscription(subscriptions []WebhookSubscription, subscriptionID string) int {
+	for i, subscription := range subscriptions {
+		if subscription.ID == subscriptionID {
+			return i
+		}
+	}
+	return -1
+}
+
+// newWebhookNotFoundError returns the error of an unknown subscription.
+func newWebhookNotFoundError(subscriptionID string) *ApiError {
+	return NewApiError(ERROR_CODE_NOT_FOUND, fmt.Sprintf("the webhook '%s' doesn't exist", subscriptionID))
+}
+
+// validateWebhookRequest checks the URL and the events of a webhook request.
+//
+// Parameters:
+//   - request: The decoded request body.
+//
+// Returns:
+//   - error: An ApiError describing the invalid field, or nil.
+func validateWebhookRequest(request WebhookRequest) error {
+	if field := missingRequiredField(request); field != "" {
+		return NewApiError(ERROR_CODE_INVALID_REQUEST, fmt.Sprintf("the %s field is required", field))
+	}
+
+	webhookURL, err := url.Parse(request.URL)
+	if err != nil || (webhookURL.Scheme != utilities.HTTP_SCHEMA && webhookURL.Scheme != utilities.HTTPS_SCHEMA) || webhookURL.Host == "" {
+		return NewApiError(ERROR_CODE_INVALID_REQUEST, fmt.Sprintf("the url '%s' should be an absolute http or https URL", request.URL))
+	}
+
+	for _, event := range request.Events {
+		if !isWebhookEvent(event) {
+			return NewApiError(ERROR_CODE_INVALID_REQUEST, fmt.Sprintf("the event '%s' is unknown, the events are %s", event, strings.Join(webhookEvents, ", ")))
+		}
+	}
+	return nil
+}
+
+// isWebhookEvent checks if the event is one of the WEBHOOK_EVENT_* constants.
+func isWebhookEvent(event string) bool {
+	for _, known := range webhookEvents {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+// generateWebhookSecret generates the random secret of a subscription.
+func generateWebhookSecret() (string, error) {
+	data := make([]byte, WEBHOOK_SECRET_SIZE)
+	if _, err := rand.Read(data); err != nil {
+		return "", fmt.Errorf("error generating the webhook secret: %v", err)
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// CreateWebhookSubscription stores a new webhook subscription.
+// Steps:
+// 1. Check the URL and the events of the request.
+// 2. Generate the secret if the request has none.
+// 3. Store the subscription and return it with its secret.
+//
+// Parameters:
+//   - request: The URL, the events and the secret of the subscription.
+//
+// Returns:
+//   - *WebhookSubscription: The stored subscription, with its secret.
+//   - error: An ApiError if the request is invalid, or an error if the subscriptions can not be stored.
+func CreateWebhookSubscription(request WebhookRequest) (*WebhookSubscription, error) {
+	if err := validateWebhookRequest(request); err != nil {
+		return nil, err
+	}
+
+	secret := request.Secret
+	if secret == "" {
+		var err error
+		if secret, err = generateWebhookSecret(); err != nil {
+			return nil, err
+		}
+	}
+
+	subscriptionID, err := newStoredFaxID()
+	if err != nil {
+		return nil, err
+	}
+
+	webhooksMutex.Lock()
+	defer webhooksMutex.Unlock()
+
+	subscriptions, err := loadWebhookSubscriptions()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	subscription := WebhookSubscription{
+		ID:        subscriptionID,
+		URL:       request.URL,
+		Events:    append([]string{}, request.Events...),
+		Secret:    secret,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	err = saveWebhookSubscriptions(append(subscriptions, subscription))
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// LoadWebhookSubscriptions reads the webhook subscriptions without their secrets.
+//
+// Returns:
+//   - []WebhookSubscription: The subscriptions, the oldest first.
+//   - error: An error if the subscriptions can not be read.
+func LoadWebhookSubscriptions() ([]WebhookSubscription, error) {
+	webhooksMutex.Lock()
+	defer webhooksMutex.Unlock()
+
+	subscriptions, err := loadWebhookSubscriptions()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+	return subscriptions, nil
+}
+
+// LoadWebhookSubscription reads a webhook subscription without its secret.
+//
+// Parameters:
+//   - subscriptionID: The ID of the subscription.
+//
+// Returns:
+//   - *WebhookSubscription: The subscription.
+//   - error: An ApiError if the subscription doesn't exist, or an error if it can not be read.
+func LoadWebhookSubscription(subscriptionID string) (*WebhookSubscription, error) {
+	subscription, err := loadWebhookSubscriptionWithSecret(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription.Secret = ""
+	return subscription, nil
+}
+
+// loadWebhookSubscriptionWithSecret reads a webhook subscription with its secret.
+func loadWebhookSubscriptionWithSecret(subscriptionID string) (*WebhookSubscription, error) {
+	webhooksMutex.Lock()
+	defer webhooksMutex.Unlock()
+
+	subscriptions, err := loadWebhookSubscriptions()
+	if err != nil {
+		return nil, err
+	}
+
+	i := findWebhookSubscription(subscriptions, subscriptionID)
+	if i < 0 {
+		return nil, newWebhookNotFoundError(subscriptionID)
+	}
+	return &subscriptions[i], nil
+}
+
+// UpdateWebhookSubscription replaces the URL and the events of a webhook
+// subscription. The secret is replaced when the request has one, it is
+// returned then.
+//
+// Parameters:
+//   - subscriptionID: The ID of the subscription.
+//   - request: The new URL, events and secret of the subscription.
+//
+// Returns:
+//   - *WebhookSubscription: The updated subscription.
+//   - error: An ApiError if the request is invalid or the subscription doesn't
+//     exist, or an error if the subscriptions can not be stored.
+func UpdateWebhookSubscription(subscriptionID string, request WebhookRequest) (*WebhookSubscription, error) {
+	if err := validateWebhookRequest(request); err != nil {
+		return nil, err
+	}
+
+	webhooksMutex.Lock()
+	defer webhooksMutex.Unlock()
+
+	subscriptions, err := loadWebhookSubscriptions()
+	if err != nil {
+		return nil, err
+	}
+
+	i := findWebhookSubscription(subscriptions, subscriptionID)
+	if i < 0 {
+		return nil, newWebhookNotFoundError(subscriptionID)
+	}
+
+	subscriptions[i].URL = request.URL
+	subscriptions[i].Events = append([]string{}, request.Events...)
+	if request.Secret != "" {
+		subscriptions[i].Secret = request.Secret
+	}
+	subscriptions[i].UpdatedAt = time.Now()
+
+	err = saveWebhookSubscriptions(subscriptions)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription := subscriptions[i]
+	if request.Secret == "" {
+		subscription.Secret = ""
+	}
+	return &subscription, nil
+}
+
+// DeleteWebhookSubscription removes a webhook subscription, its pending
+// deliveries fail at their next attempt.
+//
+// Parameters:
+//   - subscriptionID: The ID of the subscription.
+//
+// Returns:
+//   - error: An ApiError if the subscription doesn't exist, or an error if the subscriptions can not be stored.
+func DeleteWebhookSubscription(subscriptionID string) error {
+	webhooksMutex.Lock()
+	defer webhooksMutex.Unlock()
+
+	subscriptions, err := loadWebhookSubscriptions()
+	if err != nil {
+		return err
+	}
+
+	i := findWebhookSubscription(subscriptions, subscriptionID)
+	if i < 0 {
+		return newWebhookNotFoundError(subscriptionID)
+	}
+
+	return saveWebhookSubscriptions(append(subscriptions[:i], subscriptions[i+1:]...))
+}
+
+// subscribes checks if the subscription receives the event.
+func (s WebhookSubscription) subscribes(event string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, subscribed := range s.Events {
+		if subscribed == event {
+			return true
+		}
+	}
+	return false
+}
+
+// loadWebhookDeliveries reads the delivery log, a missing file is an empty log.
+func loadWebhookDeliveries() ([]WebhookDelivery, error) {
+	deliveriesFilePath, err := utilities.GetWebhookDeliveriesPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(deliveriesFilePath)
+	if os.IsNotExist(err) {
+		return []WebhookDelivery{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]WebhookDelivery, 0)
+	err = json.Unmarshal(data, &deliveries)
+	if err != nil {
+		return nil, fmt.Errorf("the webhook delivery log '%s' is corrupted: %v", deliveriesFilePath, err)
+	}
+	return deliveries, nil
+}
+
+// lockWebhookDeliveries locks the delivery log in this process and in the
+// others sharing the working directory, waiting until the lock is released.
+//
+// Returns:
+//   - func(): Releases the lock.
+//   - error: An error if the lock file can not be created or is held past the timeout.
+func lockWebhookDeliveries() (func(), error) {
+	deliveriesFilePath, err := utilities.GetWebhookDeliveriesPath()
+	if err != nil {
+		return nil, err
+	}
+	lockFilePath := deliveriesFilePath + WEBHOOK_DELIVERY_LOCK_EXTENSION
+
+	webhookDeliveriesMutex.Lock()
+
+	deadline := time.Now().Add(WEBHOOK_DELIVERY_LOCK_TIMEOUT)
+	for {
+		locked, err := utilities.CreateLockFile(lockFilePath, WEBHOOK_DELIVERY_LOCK_LEASE)
+		if err != nil {
+			webhookDeliveriesMutex.Unlock()
+			return nil, fmt.Errorf("error locking the webhook delivery log: %v", err)
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			webhookDeliveriesMutex.Unlock()
+			return nil, fmt.Errorf("the webhook delivery log is locked by another process")
+		}
+		time.Sleep(WEBHOOK_DELIVERY_LOCK_RETRY)
+	}
+
+	return func() {
+		logIfError(utilities.RemoveLockFile(lockFilePath))
+		webhookDeliveriesMutex.Unlock()
+	}, nil
+}
+
+// trimWebhookDeliveries drops the oldest finished deliveries until the log
+// has WEBHOOK_DELIVERY_LOG_SIZE entries. The pending deliveries are kept
+// whatever their age, they are still running and their IDs skip the events
+// published again.
+//
+// Parameters:
+//   - deliveries: The log, the oldest first.
+//
+// Returns:
+//   - []WebhookDelivery: The trimmed log, longer than the size when more deliveries are pending.
+func trimWebhookDeliveries(deliveries []WebhookDelivery) []WebhookDelivery {
+	excess := len(deliveries) - WEBHOOK_DELIVERY_LOG_SIZE
+	if excess <= 0 {
+		return deliveries
+	}
+
+	trimmed := make([]WebhookDelivery, 0, WEBHOOK_DELIVERY_LOG_SIZE)
+	for _, delivery := range deliveries {
+		if excess > 0 && delivery.Status != WEBHOOK_DELIVERY_STATUS_PENDING {
+			excess--
+			continue
+		}
+		trimmed = append(trimmed, delivery)
+	}
+	return trimmed
+}
+
+// saveWebhookDeliveries writes the delivery log, keeping the latest finished
+// deliveries and all the pending ones.
+func saveWebhookDeliveries(deliveries []WebhookDelivery) error {
+	deliveriesFilePath, err := utilities.GetWebhookDeliveriesPath()
+	if err != nil {
+		return err
+	}
+
+	deliveries = trimWebhookDeliveries(deliveries)
+
+	data, err := json.MarshalIndent(deliveries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return utilities.WriteFileAtomic(deliveriesFilePath, data, WEBHOOK_FILE_PERMISSION)
+}
+
+// LoadWebhookDeliveries reads the delivery log of a webhook subscription.
+//
+// Parameters:
+//   - subscriptionID: The ID of the subscription.
+//
+// Returns:
+//   - []WebhookDelivery: The deliveries of the subscription, the newest first.
+//   - error: An ApiError if the subscription doesn't exist, or an error if the log can not be read.
+func LoadWebhookDeliveries(subscriptionID string) ([]WebhookDelivery, error) {
+	if _, err := LoadWebhookSubscription(subscriptionID); err != nil {
+		return nil, err
+	}
+
+	webhookDeliveriesMutex.Lock()
+	defer webhookDeliveriesMutex.Unlock()
+
+	deliveries, err := loadWebhookDeliveries()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]WebhookDelivery, 0)
+	for _, delivery := range deliveries {
+		if delivery.SubscriptionID == subscriptionID {
+			result = append(result, delivery)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	return result, nil
+}
+
+// saveWebhookDelivery adds a delivery to the log, or replaces the delivery with the same ID.
+func saveWebhookDelivery(delivery WebhookDelivery) error {
+	unlock, err := lockWebhookDeliveries()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	deliveries, err := loadWebhookDeliveries()
+	if err != nil {
+		return err
+	}
+
+	delivery.UpdatedAt = time.Now()
+	for i := range deliveries {
+		if deliveries[i].ID == delivery.ID {
+			deliveries[i] = delivery
+			return saveWebhookDeliveries(deliveries)
+		}
+	}
+	return saveWebhookDeliveries(append(deliveries, delivery))
+}
+
+// webhookEventOf returns the webhook event of a job event, or empty if the
+// job event isn't sent to the webhooks. The final delivery status is
+// delivered or failed, a status followed until the timeout is neither.
+func webhookEventOf(event JobEvent) string {
+	switch {
+	case event.Type == JOB_EVENT_QUEUED:
+		return WEBHOOK_EVENT_QUEUED
+	case event.Type == JOB_EVENT_SENT:
+		return WEBHOOK_EVENT_SENT
+	case event.Type == JOB_EVENT_FAILED:
+		return WEBHOOK_EVENT_FAILED
+	case event.Type == JOB_EVENT_STATUS && event.Final && event.Error == "" && event.FaxStatus != nil:
+		if IsDeliveredFaxStatus(event.FaxStatus.Status) {
+			return WEBHOOK_EVENT_DELIVERED
+		}
+		return WEBHOOK_EVENT_FAILED
+	}
+	return ""
+}
+
+// webhookDeliveryID derives the ID of the delivery of a job event to a
+// subscription, so the same event is delivered once even if it is published
+// again, e.g. by a stream syncing the stored state of a job.
+func webhookDeliveryID(subscriptionID string, jobID string, event string) string {
+	sum := sha256.Sum256([]byte(subscriptionID + "/" + jobID + "/" + event))
+	return hex.EncodeToString(sum[:WEBHOOK_DELIVERY_ID_SIZE])
+}
+
+// notifyWebhooks delivers a job event to the subscribed webhooks in the
+// background, it is called for every published job event.
+//
+// Parameters:
+//   - event: The published job event.
+func notifyWebhooks(event JobEvent) {
+	webhookEvent := webhookEventOf(event)
+	if webhookEvent == "" {
+		return
+	}
+
+	go deliverWebhookEvent(webhookEvent, event)
+}
+
+// deliverWebhookEvent creates the deliveries of an event to the subscribed
+// webhooks and runs them. The events already in the delivery log are skipped.
+//
+// Parameters:
+//   - webhookEvent: One of the WEBHOOK_EVENT_* constants.
+//   - event: The job event.
+func deliverWebhookEvent(webhookEvent string, event JobEvent) {
+	webhooksMutex.Lock()
+	subscriptions, err := loadWebhookSubscriptions()
+	webhooksMutex.Unlock()
+	if err != nil {
+		logger.Inst().Error(fmt.Sprintf("error loading the webhooks: %v", err))
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		if !subscription.subscribes(webhookEvent) {
+			continue
+		}
+
+		delivery, err := createWebhookDelivery(subscription, webhookEvent, event)
+		if err != nil {
+			logger.Inst().Error(fmt.Sprintf("error creating the %s delivery to the webhook %s: %v", webhookEvent, subscription.ID, err))
+			continue
+		}
+		if delivery != nil {
+			go runWebhookDelivery(context.Background(), delivery)
+		}
+	}
+}
+
+// createWebhookDelivery adds the pending delivery of an event to the log. The
+// log is locked across the processes while the delivery is looked up and
+// added, so the daemon and the UI publishing the same event deliver it once.
+//
+// Returns:
+//   - *WebhookDelivery: The delivery, nil if the log already has it.
+//   - error: An error if the log can not be read or written.
+func createWebhookDelivery(subscription WebhookSubscription, webhookEvent string, event JobEvent) (*WebhookDelivery, error) {
+	deliveryID := webhookDeliveryID(subscription.ID, event.JobID, webhookEvent)
+
+	payload, err := json.Marshal(WebhookPayload{
+		ID:             deliveryID,
+		Event:          webhookEvent,
+		JobID:          event.JobID,
+		Message:        event.Message,
+		TransmissionID: event.TransmissionID,
+		FaxStatus:      event.FaxStatus,
+		Error:          event.Error,
+		Time:           event.Time,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := lockWebhookDeliveries()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	deliveries, err := loadWebhookDeliveries()
+	if err != nil {
+		return nil, err
+	}
+	for _, delivery := range deliveries {
+		if delivery.ID == deliveryID {
+			return nil, nil
+		}
+	}
+
+	now := time.Now()
+	delivery := &WebhookDelivery{
+		ID:             deliveryID,
+		SubscriptionID: subscription.ID,
+		URL:            subscription.URL,
+		Event:          webhookEvent,
+		JobID:          event.JobID,
+		Status:         WEBHOOK_DELIVERY_STATUS_PENDING,
+		NextAttemptAt:  now,
+		Payload:        payload,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	return delivery, saveWebhookDeliveries(append(deliveries, *delivery))
+}
+
+// LoadWebhookRetryPolicy returns the retry policy of the webhook deliveries configured in config.yaml.
+//
+// Returns:
+//   - RetryPolicy: The configured policy.
+func LoadWebhookRetryPolicy() RetryPolicy {
+	cfg := *config.Inst()
+
+	return RetryPolicy{
+		MaxAttempts: cfg.GetWebhookRetryMaxAttempts(),
+		BaseDelay:   WEBHOOK_RETRY_BASE_DELAY,
+		MaxDelay:    cfg.GetWebhookRetryMaxDelay(),
+	}
+}
+
+// runWebhookDelivery posts a delivery until it succeeds, fails permanently or
+// runs out of attempts.
+// Steps:
+// 1. Wait until the next attempt is due.
+// 2. Read the subscription, so a changed URL or secret is used and a deleted
+// subscription ends the delivery.
+// 3. Post the signed payload and record the attempt in the delivery log.
+// 4. Retry the network errors, the timeouts, 429 and the server errors with
+// exponential backoff, honouring Retry-After.
+//
+// Parameters:
+//   - ctx: The context of the delivery, cancelling it leaves the delivery pending.
+//   - delivery: The pending delivery.
+func runWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) {
+	policy := LoadWebhookRetryPolicy()
+
+	for {
+		timer := time.NewTimer(time.Until(delivery.NextAttemptAt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		subscription, err := loadWebhookSubscriptionWithSecret(delivery.SubscriptionID)
+		if err != nil {
+			delivery.Status = WEBHOOK_DELIVERY_STATUS_FAILED
+			delivery.LastError = err.Error()
+			logIfError(saveWebhookDelivery(*delivery))
+			return
+		}
+
+		delivery.Attempts++
+		delivery.URL = subscription.URL
+		resp, err := postWebhook(ctx, subscription, delivery)
+
+		delivery.ResponseStatus = 0
+		if resp != nil {
+			delivery.ResponseStatus = resp.StatusCode
+		}
+
+		switch {
+		case err == nil:
+			delivery.Status = WEBHOOK_DELIVERY_STATUS_DELIVERED
+			delivery.LastError = ""
+			logIfError(saveWebhookDelivery(*delivery))
+			return
+		case ctx.Err() != nil:
+			delivery.Attempts--
+			return
+		case !isRetryableICTResponse(true, resp, unwrapTransportError(err)) || delivery.Attempts >= policy.MaxAttempts:
+			delivery.Status = WEBHOOK_DELIVERY_STATUS_FAILED
+			delivery.LastError = err.Error()
+			logger.Inst().Error(fmt.Sprintf("the %s delivery %s to %s failed after %d attempts: %v",
+				delivery.Event, delivery.ID, delivery.URL, delivery.Attempts, err))
+			logIfError(saveWebhookDelivery(*delivery))
+			return
+		}
+
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = time.Now().Add(policy.retryDelay(delivery.Attempts, resp))
+		logIfError(saveWebhookDelivery(*delivery))
+	}
+}
+
+// webhookStatusError is the error of a webhook answering with a status other than 2xx.
+type webhookStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *webhookStatusError) Error() string {
+	return fmt.Sprintf("the webhook answered %d: %s", e.StatusCode, e.Body)
+}
+
+// unwrapTransportError returns the error of a failed request, nil if the
+// webhook answered, as isRetryableICTResponse expects.
+func unwrapTransportError(err error) error {
+	if _, ok := err.(*webhookStatusError); ok {
+		return nil
+	}
+	return err
+}
+
+// postWebhook posts the payload of a delivery to the subscription.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - subscription: The subscription with its URL and secret.
+//   - delivery: The delivery with its payload.
+//
+// Returns:
+//   - *http.Response: The response with its body closed, nil if the request failed.
+//   - error: The error of the request, or a webhookStatusError if the status isn't 2xx.
+func postWebhook(ctx context.Context, subscription *WebhookSubscription, delivery *WebhookDelivery) (*http.Response, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return nil, fmt.Errorf("error creating the webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", utilities.JSON_CONTENT_TYPE)
+	req.Header.Set("User-Agent", utilities.APP_NAME)
+	req.Header.Set(WEBHOOK_EVENT_HEADER, delivery.Event)
+	req.Header.Set(WEBHOOK_DELIVERY_HEADER, delivery.ID)
+	req.Header.Set(WEBHOOK_TIMESTAMP_HEADER, timestamp)
+	req.Header.Set(WEBHOOK_SIGNATURE_HEADER, SignWebhookPayload(subscription.Secret, timestamp, delivery.Payload))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, WEBHOOK_RESPONSE_BODY_SIZE))
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp, &webhookStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return resp, nil
+}
+
+// SignWebhookPayload computes the signature header of a webhook request, the
+// receivers compute it again with the secret to check the request.
+//
+// Parameters:
+//   - secret: The secret of the subscription.
+//   - timestamp: The value of the timestamp header.
+//   - payload: The body of the request.
+//
+// Returns:
+//   - string: "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<payload>".
+func SignWebhookPayload(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return WEBHOOK_SIGNATURE_PREFIX + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ResumeWebhookDeliveries runs the deliveries left pending by a previous run
+// in the background, the daemon resumes them when it starts.
+func ResumeWebhookDeliveries(ctx context.Context) {
+	webhookDeliveriesMutex.Lock()
+	deliveries, err := loadWebhookDeliveries()
+	webhookDeliveriesMutex.Unlock()
+	if err != nil {
+		logger.Inst().Error(fmt.Sprintf("error loading the webhook delivery log: %v", err))
+		return
+	}
+
+	for i := range deliveries {
+		if deliveries[i].Status == WEBHOOK_DELIVERY_STATUS_PENDING {
+			logger.Inst().Info(fmt.Sprintf("resuming the %s delivery %s", deliveries[i].Event, deliveries[i].ID))
+			go runWebhookDelivery(ctx, &deliveries[i])
+		}
+	}
+}
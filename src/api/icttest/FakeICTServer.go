@@ -0,0 +1,824 @@
+// Package icttest provides an in-process fake of the ICT Core API for tests.
+//
+// The fake server keeps the contacts, documents, programs and transmissions
+// created through it, so tests can check what a client sent and what it
+// deleted again. Failures and latency can be injected per route.
+package icttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"faxsender/src/api"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeRoute identifies a route of the fake server for failure injection,
+// latency and request counting.
+type FakeRoute string
+
+// Constants for the routes of the fake server.
+const (
+	ROUTE_AUTHENTICATE        FakeRoute = "authenticate"
+	ROUTE_ACCOUNTS            FakeRoute = "accounts"
+	ROUTE_CONTACTS            FakeRoute = "contacts"
+	ROUTE_CONTACT_LIST        FakeRoute = "contact_list"
+	ROUTE_DOCUMENTS           FakeRoute = "documents"
+	ROUTE_MEDIA               FakeRoute = "media"
+	ROUTE_PROGRAMS            FakeRoute = "programs"
+	ROUTE_TRANSMISSIONS       FakeRoute = "transmissions"
+	ROUTE_TRANSMISSION_LIST   FakeRoute = "transmission_list"
+	ROUTE_TRANSMISSION_STATUS FakeRoute = "transmission_status"
+	ROUTE_SEND                FakeRoute = "send"
+	ROUTE_DELETE              FakeRoute = "delete"
+)
+
+// Constants for the data served by the fake server.
+const (
+	FAKE_TOKEN_PREFIX                = "fake-token-"
+	FAKE_ACCOUNT_ID                  = "1"
+	FAKE_ACCOUNT_PHONE               = "+15550000000"
+	FAKE_TRANSMISSION_PENDING_STATUS = "pending"
+)
+
+// FakeDocument is a document record created on the fake server.
+type FakeDocument struct {
+	Record      api.DocumentRecord
+	Media       []byte
+	ContentType string
+}
+
+// FakeTransmission is a transmission created on the fake server.
+type FakeTransmission struct {
+	Transmission api.ConvertedTransmission
+	Status       string
+	Sent         bool
+	LastRun      time.Time
+}
+
+// fakeFailure is an injected failure of a route.
+type fakeFailure struct {
+	statusCode int
+	body       string
+	headers    map[string]string
+	times      int
+}
+
+// FakeICTServer is a stateful fake of the ICT Core API running on httptest.
+type FakeICTServer struct {
+	*httptest.Server
+
+	mutex         sync.Mutex
+	username      string
+	password      string
+	nextID        int
+	tokens        map[string]bool
+	contacts      map[int]api.Contact
+	documents     map[int]*FakeDocument
+	programs      map[int]int
+	transmissions map[int]*FakeTransmission
+	accounts      []api.AccountResponse
+	sendStatus    string
+	queries       bool
+	failures      map[FakeRoute][]*fakeFailure
+	latencies     map[FakeRoute]time.Duration
+	requests      map[FakeRoute]int
+}
+
+// NewFakeICTServer starts a fake ICT server accepting the given credentials.
+// The caller closes it with Close.
+//
+// Parameters:
+//   - username: The username accepted by the authenticate route.
+//   - password: The password accepted by the authenticate route.
+//
+// Returns:
+//   - *FakeICTServer: The started server, with one account.
+func NewFakeICTServer(username, password string) *FakeICTServer {
+	s := &FakeICTServer{
+		username:      username,
+		password:      password,
+		tokens:        make(map[string]bool),
+		contacts:      make(map[int]api.Contact),
+		documents:     make(map[int]*FakeDocument),
+		programs:      make(map[int]int),
+		transmissions: make(map[int]*FakeTransmission),
+		accounts: []api.AccountResponse{{
+			AccountID: FAKE_ACCOUNT_ID,
+			Type:      "fax",
+			UserName:  username,
+			Phone:     FAKE_ACCOUNT_PHONE,
+			Email:     username,
+		}},
+		sendStatus: api.ICT_STATUS_DONE,
+		queries:    true,
+		failures:   make(map[FakeRoute][]*fakeFailure),
+		latencies:  make(map[FakeRoute]time.Duration),
+		requests:   make(map[FakeRoute]int),
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// UserData returns the user data a client uses to connect to the fake server.
+func (s *FakeICTServer) UserData() api.UserData {
+	return api.UserData{
+		Username: s.username,
+		Password: s.password,
+		Hostname: s.URL,
+	}
+}
+
+// FailNext makes the next requests of a route fail with the status code.
+//
+// Parameters:
+//   - route: The failing route.
+//   - statusCode: The status code of the failed responses.
+//   - times: The number of requests that fail.
+func (s *FakeICTServer) FailNext(route FakeRoute, statusCode int, times int) {
+	s.FailNextWithHeaders(route, statusCode, times, nil)
+}
+
+// FailNextWithHeaders makes the next requests of a route fail with the status
+// code and the headers, e.g. a Retry-After header.
+//
+// Parameters:
+//   - route: The failing route.
+//   - statusCode: The status code of the failed responses.
+//   - times: The number of requests that fail.
+//   - headers: The headers of the failed responses.
+func (s *FakeICTServer) FailNextWithHeaders(route FakeRoute, statusCode int, times int, headers map[string]string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.failures[route] = append(s.failures[route], &fakeFailure{
+		statusCode: statusCode,
+		body:       fmt.Sprintf("injected failure of %s", route),
+		headers:    headers,
+		times:      times,
+	})
+}
+
+// SetLatency delays every response of a route, a zero delay removes it.
+// A delayed request returns early when the client goes away.
+//
+// Parameters:
+//   - route: The delayed route.
+//   - latency: The delay of the responses.
+func (s *FakeICTServer) SetLatency(route FakeRoute, latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.latencies[route] = latency
+}
+
+// SetSendStatus sets the status of the transmissions sent from now on,
+// the default is the final status done.
+func (s *FakeICTServer) SetSendStatus(status string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sendStatus = status
+}
+
+// SetQuerySupport sets if the transmissions list honors the query parameters,
+// the default is true. Without query support the full list is sent without
+// the total count header, like older ICT servers do.
+func (s *FakeICTServer) SetQuerySupport(supported bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.queries = supported
+}
+
+// SetTransmissionStatus changes the status of a transmission.
+//
+// Parameters:
+//   - transmissionID: The ID of the transmission.
+//   - status: The new status.
+//
+// Returns:
+//   - bool: False if the transmission doesn't exist.
+func (s *FakeICTServer) SetTransmissionStatus(transmissionID int, status string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	transmission, ok := s.transmissions[transmissionID]
+	if ok {
+		transmission.Status = status
+	}
+	return ok
+}
+
+// ExpireTokens invalidates the issued tokens, the next requests return 401.
+func (s *FakeICTServer) ExpireTokens() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.tokens = make(map[string]bool)
+}
+
+// Requests returns the number of requests a route has received.
+func (s *FakeICTServer) Requests(route FakeRoute) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.requests[route]
+}
+
+// Contacts returns the contacts stored on the server by ID.
+func (s *FakeICTServer) Contacts() map[int]api.Contact {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	contacts := make(map[int]api.Contact, len(s.contacts))
+	for id, contact := range s.contacts {
+		contacts[id] = contact
+	}
+	return contacts
+}
+
+// AddContact stores a contact on the server, as if it was created by an earlier send.
+//
+// Returns:
+//   - int: The ID of the contact.
+func (s *FakeICTServer) AddContact(contact api.Contact) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := s.newIDLocked()
+	s.contacts[id] = contact
+	return id
+}
+
+// Document returns a copy of a document stored on the server.
+func (s *FakeICTServer) Document(documentID int) (FakeDocument, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	document, ok := s.documents[documentID]
+	if !ok {
+		return FakeDocument{}, false
+	}
+	return *document, true
+}
+
+// Transmission returns a copy of a transmission stored on the server.
+func (s *FakeICTServer) Transmission(transmissionID int) (FakeTransmission, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	transmission, ok := s.transmissions[transmissionID]
+	if !ok {
+		return FakeTransmission{}, false
+	}
+	return *transmission, true
+}
+
+// TransmissionDocument returns a copy of the document sent by a transmission.
+func (s *FakeICTServer) TransmissionDocument(transmissionID int) (FakeDocument, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	transmission, ok := s.transmissions[transmissionID]
+	if !ok {
+		return FakeDocument{}, false
+	}
+
+	document, ok := s.documents[s.programs[transmission.Transmission.ProgramID]]
+	if !ok {
+		return FakeDocument{}, false
+	}
+	return *document, true
+}
+
+// ObjectCount returns the number of contacts, documents, programs and
+// transmissions stored on the server, it drops back after a rollback.
+func (s *FakeICTServer) ObjectCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.contacts) + len(s.documents) + len(s.programs) + len(s.transmissions)
+}
+
+// serveHTTP dispatches a request to the handler of its route.
+// Steps:
+// 1. Find the route of the request and count it.
+// 2. Wait for the latency of the route.
+// 3. Return an injected failure if there is one.
+// 4. Check the bearer token, except for the authenticate route.
+// 5. Run the handler of the route.
+func (s *FakeICTServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	route, id, handler := s.findRoute(r)
+	if handler == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mutex.Lock()
+	s.requests[route]++
+	latency := s.latencies[route]
+	failure := s.takeFailureLocked(route)
+	s.mutex.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(latency):
+		}
+	}
+
+	if failure != nil {
+		// Read the body so the client doesn't see a reset connection.
+		io.Copy(io.Discard, r.Body)
+		for name, value := range failure.headers {
+			w.Header().Set(name, value)
+		}
+		http.Error(w, failure.body, failure.statusCode)
+		return
+	}
+
+	if route != ROUTE_AUTHENTICATE && !s.isAuthorized(r) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	handler(w, r, id)
+}
+
+// findRoute matches the method and the path of a request to a route.
+func (s *FakeICTServer) findRoute(r *http.Request) (FakeRoute, int, func(http.ResponseWriter, *http.Request, int)) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "api" {
+		return "", 0, nil
+	}
+
+	id := 0
+	if len(parts) > 2 {
+		id, _ = strconv.Atoi(parts[2])
+	}
+
+	switch {
+	case r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "authenticate":
+		return ROUTE_AUTHENTICATE, 0, s.handleAuthenticate
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[1] == "accounts":
+		return ROUTE_ACCOUNTS, 0, s.handleAccounts
+	case r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "contacts":
+		return ROUTE_CONTACTS, 0, s.handleCreateContact
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[1] == "contacts":
+		return ROUTE_CONTACT_LIST, 0, s.handleListContacts
+	case r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "documents":
+		return ROUTE_DOCUMENTS, 0, s.handleCreateDocument
+	case r.Method == http.MethodPut && len(parts) == 4 && parts[1] == "documents" && parts[3] == "media":
+		return ROUTE_MEDIA, id, s.handleUploadMedia
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[1] == "programs" && parts[2] == "sendfax":
+		return ROUTE_PROGRAMS, 0, s.handleCreateProgram
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[1] == "transmissions":
+		return ROUTE_TRANSMISSION_LIST, 0, s.handleListTransmissions
+	case r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "transmissions":
+		return ROUTE_TRANSMISSIONS, 0, s.handleCreateTransmission
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[1] == "transmissions":
+		return ROUTE_TRANSMISSION_STATUS, id, s.handleTransmissionStatus
+	case r.Method == http.MethodPost && len(parts) == 4 && parts[1] == "transmissions" && parts[3] == "send":
+		return ROUTE_SEND, id, s.handleSendTransmission
+	case r.Method == http.MethodDelete && len(parts) == 3:
+		return ROUTE_DELETE, id, s.handleDelete
+	}
+
+	return "", 0, nil
+}
+
+// takeFailureLocked returns the next injected failure of a route, if any.
+// The caller must hold s.mutex.
+func (s *FakeICTServer) takeFailureLocked(route FakeRoute) *fakeFailure {
+	failures := s.failures[route]
+	if len(failures) == 0 {
+		return nil
+	}
+
+	failure := failures[0]
+	failure.times--
+	if failure.times <= 0 {
+		s.failures[route] = failures[1:]
+	}
+	return failure
+}
+
+// isAuthorized checks the bearer token of a request.
+func (s *FakeICTServer) isAuthorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.tokens[token]
+}
+
+// newIDLocked returns the next free object ID. The caller must hold s.mutex.
+func (s *FakeICTServer) newIDLocked() int {
+	s.nextID++
+	return s.nextID
+}
+
+// writeID writes an object ID the way the ICT API returns it.
+func writeID(w http.ResponseWriter, id int) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%d", id)
+}
+
+// writeJSON writes a JSON response.
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+// decodeJSON decodes a JSON request body, answering 400 if it is invalid.
+func decodeJSON(w http.ResponseWriter, r *http.Request, to interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(to); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (s *FakeICTServer) handleAuthenticate(w http.ResponseWriter, r *http.Request, _ int) {
+	var userData api.UserData
+	if !decodeJSON(w, r, &userData) {
+		return
+	}
+
+	if userData.Username != s.username || userData.Password != s.password {
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	s.mutex.Lock()
+	token := FAKE_TOKEN_PREFIX + strconv.Itoa(s.newIDLocked())
+	s.tokens[token] = true
+	s.mutex.Unlock()
+
+	writeJSON(w, api.AuthResponse{
+		Token: token,
+		Email: s.username,
+		Phone: FAKE_ACCOUNT_PHONE,
+	})
+}
+
+func (s *FakeICTServer) handleAccounts(w http.ResponseWriter, r *http.Request, _ int) {
+	s.mutex.Lock()
+	accounts := append([]api.AccountResponse(nil), s.accounts...)
+	s.mutex.Unlock()
+
+	writeJSON(w, accounts)
+}
+
+func (s *FakeICTServer) handleCreateContact(w http.ResponseWriter, r *http.Request, _ int) {
+	var contact api.Contact
+	if !decodeJSON(w, r, &contact) {
+		return
+	}
+
+	if contact.Phone == "" {
+		http.Error(w, "the phone is required", http.StatusUnprocessableEntity)
+		return
+	}
+
+	s.mutex.Lock()
+	id := s.newIDLocked()
+	s.contacts[id] = contact
+	s.mutex.Unlock()
+
+	writeID(w, id)
+}
+
+// handleListContacts lists the contacts by ascending ID, filtered by the
+// search and phone query parameters if they are set.
+func (s *FakeICTServer) handleListContacts(w http.ResponseWriter, r *http.Request, _ int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	search := r.URL.Query().Get(api.ICT_CONTACT_QUERY_PARAM_SEARCH)
+	phone := normalizePhone(r.URL.Query().Get(api.ICT_CONTACT_QUERY_PARAM_PHONE))
+
+	responses := make([]api.ContactResponse, 0, len(s.contacts))
+	for id := 1; id <= s.nextID; id++ {
+		contact, ok := s.contacts[id]
+		if !ok {
+			continue
+		}
+
+		response := api.ContactResponse{
+			ContactID:   strconv.Itoa(id),
+			FirstName:   contact.FirstName,
+			LastName:    contact.LastName,
+			Email:       contact.Email,
+			Phone:       contact.Phone,
+			Address:     contact.Address,
+			Description: contact.Description,
+		}
+		if phone != "" && normalizePhone(contact.Phone) != phone {
+			continue
+		}
+		if !api.ContactMatches(response, search) {
+			continue
+		}
+		responses = append(responses, response)
+	}
+
+	writeJSON(w, responses)
+}
+
+// normalizePhone keeps the digits of a phone number.
+func normalizePhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+}
+
+func (s *FakeICTServer) handleCreateDocument(w http.ResponseWriter, r *http.Request, _ int) {
+	var record api.DocumentRecord
+	if !decodeJSON(w, r, &record) {
+		return
+	}
+
+	s.mutex.Lock()
+	id := s.newIDLocked()
+	s.documents[id] = &FakeDocument{Record: record}
+	s.mutex.Unlock()
+
+	writeID(w, id)
+}
+
+// handleUploadMedia stores the file part of a multipart upload. The content
+// type header of the upload is the content type of the file, so the boundary
+// is found in the body.
+func (s *FakeICTServer) handleUploadMedia(w http.ResponseWriter, r *http.Request, documentID int) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	media, err := readMultipartFile(body, r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	document, ok := s.documents[documentID]
+	if !ok {
+		http.Error(w, "document not found", http.StatusNotFound)
+		return
+	}
+
+	document.Media = media
+	document.ContentType = r.Header.Get("Content-Type")
+	w.WriteHeader(http.StatusOK)
+}
+
+// readMultipartFile reads the first part of a multipart body.
+func readMultipartFile(body []byte, contentType string) ([]byte, error) {
+	boundary := ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		boundary = params["boundary"]
+	}
+
+	if boundary == "" {
+		line := strings.SplitN(string(body), "\r\n", 2)[0]
+		if !strings.HasPrefix(line, "--") {
+			return nil, fmt.Errorf("the upload is not a multipart body")
+		}
+		boundary = strings.TrimPrefix(line, "--")
+	}
+
+	part, err := multipart.NewReader(bytes.NewReader(body), boundary).NextPart()
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(part)
+}
+
+func (s *FakeICTServer) handleCreateProgram(w http.ResponseWriter, r *http.Request, _ int) {
+	var program struct {
+		DocumentID int `json:"document_id"`
+	}
+	if !decodeJSON(w, r, &program) {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	document, ok := s.documents[program.DocumentID]
+	if !ok || document.Media == nil {
+		http.Error(w, "the document has no media", http.StatusUnprocessableEntity)
+		return
+	}
+
+	id := s.newIDLocked()
+	s.programs[id] = program.DocumentID
+	writeID(w, id)
+}
+
+func (s *FakeICTServer) handleCreateTransmission(w http.ResponseWriter, r *http.Request, _ int) {
+	var transmission api.ConvertedTransmission
+	if !decodeJSON(w, r, &transmission) {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, contactOK := s.contacts[transmission.ContactID]
+	_, programOK := s.programs[transmission.ProgramID]
+	if !contactOK || !programOK {
+		http.Error(w, "unknown contact or program", http.StatusUnprocessableEntity)
+		return
+	}
+
+	id := s.newIDLocked()
+	s.transmissions[id] = &FakeTransmission{
+		Transmission: transmission,
+		Status:       FAKE_TRANSMISSION_PENDING_STATUS,
+	}
+	writeID(w, id)
+}
+
+func (s *FakeICTServer) handleSendTransmission(w http.ResponseWriter, r *http.Request, transmissionID int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	transmission, ok := s.transmissions[transmissionID]
+	if !ok {
+		http.Error(w, "transmission not found", http.StatusNotFound)
+		return
+	}
+
+	transmission.Sent = true
+	transmission.Status = s.sendStatus
+	transmission.LastRun = time.Now()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *FakeICTServer) handleListTransmissions(w http.ResponseWriter, r *http.Request, _ int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	responses := make([]api.FaxResponse, 0, len(s.transmissions))
+	for id := 1; id <= s.nextID; id++ {
+		transmission, ok := s.transmissions[id]
+		if !ok {
+			continue
+		}
+
+		responses = append(responses, api.FaxResponse{
+			TransmissionID: strconv.Itoa(id),
+			DateTime:       strconv.FormatInt(transmission.LastRun.Unix(), 10),
+			Title:          transmission.Transmission.Title,
+			DestinationFax: s.contacts[transmission.Transmission.ContactID].Phone,
+			CallerID:       FAKE_ACCOUNT_PHONE,
+			AccountID:      strconv.Itoa(transmission.Transmission.AccountID),
+			Status:         transmission.Status,
+			Is_Print:       strconv.Itoa(transmission.Transmission.IsPrint),
+		})
+	}
+
+	if s.queries && r.URL.RawQuery != "" {
+		responses = queryTransmissions(w, r, responses)
+		if responses == nil {
+			return
+		}
+	}
+
+	writeJSON(w, responses)
+}
+
+// queryTransmissions filters, sorts and pages the transmissions list with the
+// ICT query parameters and sets the total count header.
+// It returns nil after writing an error if a parameter is invalid.
+func queryTransmissions(w http.ResponseWriter, r *http.Request, responses []api.FaxResponse) []api.FaxResponse {
+	values := r.URL.Query()
+
+	numbers := map[string]int64{}
+	for _, name := range []string{api.ICT_QUERY_PARAM_OFFSET, api.ICT_QUERY_PARAM_LIMIT, api.ICT_QUERY_PARAM_FROM, api.ICT_QUERY_PARAM_TO} {
+		if value := values.Get(name); value != "" {
+			number, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				http.Error(w, "invalid "+name, http.StatusBadRequest)
+				return nil
+			}
+			numbers[name] = number
+		}
+	}
+
+	matching := make([]api.FaxResponse, 0, len(responses))
+	for _, response := range responses {
+		lastRun, _ := strconv.ParseInt(response.DateTime, 10, 64)
+		if from, ok := numbers[api.ICT_QUERY_PARAM_FROM]; ok && lastRun < from {
+			continue
+		}
+		if to, ok := numbers[api.ICT_QUERY_PARAM_TO]; ok && lastRun >= to {
+			continue
+		}
+		if status := values.Get(api.ICT_QUERY_PARAM_STATUS); status != "" && !strings.EqualFold(response.Status, status) {
+			continue
+		}
+		if accountID := values.Get(api.ICT_QUERY_PARAM_ACCOUNT_ID); accountID != "" && response.AccountID != accountID {
+			continue
+		}
+		if isPrint := values.Get(api.ICT_QUERY_PARAM_IS_PRINT); isPrint != "" && response.Is_Print != isPrint {
+			continue
+		}
+		matching = append(matching, response)
+	}
+
+	// The newest first, the transmissions are listed by ascending ID.
+	for i, j := 0, len(matching)-1; i < j; i, j = i+1, j-1 {
+		matching[i], matching[j] = matching[j], matching[i]
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		left, _ := strconv.ParseInt(matching[i].DateTime, 10, 64)
+		right, _ := strconv.ParseInt(matching[j].DateTime, 10, 64)
+		return left > right
+	})
+
+	w.Header().Set(api.ICT_TOTAL_COUNT_HEADER, strconv.Itoa(len(matching)))
+
+	start := int(numbers[api.ICT_QUERY_PARAM_OFFSET])
+	if start > len(matching) {
+		start = len(matching)
+	}
+	end := len(matching)
+	if limit, ok := numbers[api.ICT_QUERY_PARAM_LIMIT]; ok && start+int(limit) < end {
+		end = start + int(limit)
+	}
+	return matching[start:end]
+}
+
+func (s *FakeICTServer) handleTransmissionStatus(w http.ResponseWriter, r *http.Request, transmissionID int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	transmission, ok := s.transmissions[transmissionID]
+	if !ok {
+		http.Error(w, "transmission not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, api.TransmissionResponse{
+		TransmissionID: strconv.Itoa(transmissionID),
+		Title:          transmission.Transmission.Title,
+		Status:         transmission.Status,
+		TryAllowed:     strconv.Itoa(transmission.Transmission.TryAllowed),
+		TryDone:        "1",
+		DateTime:       strconv.FormatInt(transmission.LastRun.Unix(), 10),
+		DestinationFax: s.contacts[transmission.Transmission.ContactID].Phone,
+		CallerID:       FAKE_ACCOUNT_PHONE,
+	})
+}
+
+func (s *FakeICTServer) handleDelete(w http.ResponseWriter, r *http.Request, id int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	objectType := strings.Split(strings.Trim(r.URL.Path, "/"), "/")[1]
+
+	deleted := false
+	switch objectType {
+	case "contacts":
+		_, deleted = s.contacts[id]
+		delete(s.contacts, id)
+	case "documents":
+		_, deleted = s.documents[id]
+		delete(s.documents, id)
+	case "programs":
+		_, deleted = s.programs[id]
+		delete(s.programs, id)
+	case "transmissions":
+		_, deleted = s.transmissions[id]
+		delete(s.transmissions, id)
+	}
+
+	if !deleted {
+		http.Error(w, "object not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
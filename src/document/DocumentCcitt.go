@@ -0,0 +1,237 @@
+package document
+
+// ccittCode is a variable length code of the CCITT T.4 and T.6 encodings,
+// the length low bits of bits are the code.
+type ccittCode struct {
+	bits   uint32
+	length uint
+}
+
+// Codes of the CCITT T.4 and T.6 encodings.
+var (
+	ccittEol        = ccittCode{0x001, 12} // "000000000001"
+	ccittPass       = ccittCode{0x1, 4}    // "0001"
+	ccittHorizontal = ccittCode{0x1, 3}    // "001"
+
+	// ccittVertical holds the vertical mode codes of a1 - b1 from -3 to 3.
+	ccittVertical = [7]ccittCode{
+		{0x02, 7}, // VL3 "0000010"
+		{0x02, 6}, // VL2 "000010"
+		{0x2, 3},  // VL1 "010"
+		{0x1, 1},  // V0 "1"
+		{0x3, 3},  // VR1 "011"
+		{0x03, 6}, // VR2 "000011"
+		{0x03, 7}, // VR3 "0000011"
+	}
+)
+
+// ccittWhiteTerminating holds the terminating codes of the white runs of 0 to 63 pixels.
+var ccittWhiteTerminating = [64]ccittCode{
+	{0x35, 8}, {0x07, 6}, {0x07, 4}, {0x08, 4}, {0x0b, 4}, {0x0c, 4}, {0x0e, 4}, {0x0f, 4},
+	{0x13, 5}, {0x14, 5}, {0x07, 5}, {0x08, 5}, {0x08, 6}, {0x03, 6}, {0x34, 6}, {0x35, 6},
+	{0x2a, 6}, {0x2b, 6}, {0x27, 7}, {0x0c, 7}, {0x08, 7}, {0x17, 7}, {0x03, 7}, {0x04, 7},
+	{0x28, 7}, {0x2b, 7}, {0x13, 7}, {0x24, 7}, {0x18, 7}, {0x02, 8}, {0x03, 8}, {0x1a, 8},
+	{0x1b, 8}, {0x12, 8}, {0x13, 8}, {0x14, 8}, {0x15, 8}, {0x16, 8}, {0x17, 8}, {0x28, 8},
+	{0x29, 8}, {0x2a, 8}, {0x2b, 8}, {0x2c, 8}, {0x2d, 8}, {0x04, 8}, {0x05, 8}, {0x0a, 8},
+	{0x0b, 8}, {0x52, 8}, {0x53, 8}, {0x54, 8}, {0x55, 8}, {0x24, 8}, {0x25, 8}, {0x58, 8},
+	{0x59, 8}, {0x5a, 8}, {0x5b, 8}, {0x4a, 8}, {0x4b, 8}, {0x32, 8}, {0x33, 8}, {0x34, 8},
+}
+
+// ccittBlackTerminating holds the terminating codes of the black runs of 0 to 63 pixels.
+var ccittBlackTerminating = [64]ccittCode{
+	{0x37, 10}, {0x02, 3}, {0x03, 2}, {0x02, 2}, {0x03, 3}, {0x03, 4}, {0x02, 4}, {0x03, 5},
+	{0x05, 6}, {0x04, 6}, {0x04, 7}, {0x05, 7}, {0x07, 7}, {0x04, 8}, {0x07, 8}, {0x18, 9},
+	{0x17, 10}, {0x18, 10}, {0x08, 10}, {0x67, 11}, {0x68, 11}, {0x6c, 11}, {0x37, 11}, {0x28, 11},
+	{0x17, 11}, {0x18, 11}, {0xca, 12}, {0xcb, 12}, {0xcc, 12}, {0xcd, 12}, {0x68, 12}, {0x69, 12},
+	{0x6a, 12}, {0x6b, 12}, {0xd2, 12}, {0xd3, 12}, {0xd4, 12}, {0xd5, 12}, {0xd6, 12}, {0xd7, 12},
+	{0x6c, 12}, {0x6d, 12}, {0xda, 12}, {0xdb, 12}, {0x54, 12}, {0x55, 12}, {0x56, 12}, {0x57, 12},
+	{0x64, 12}, {0x65, 12}, {0x52, 12}, {0x53, 12}, {0x24, 12}, {0x37, 12}, {0x38, 12}, {0x27, 12},
+	{0x28, 12}, {0x58, 12}, {0x59, 12}, {0x2b, 12}, {0x2c, 12}, {0x5a, 12}, {0x66, 12}, {0x67, 12},
+}
+
+// ccittWhiteMakeup holds the makeup codes of the white runs of 64 to 1728 pixels, by steps of 64.
+var ccittWhiteMakeup = [27]ccittCode{
+	{0x1b, 5}, {0x12, 5}, {0x17, 6}, {0x37, 7}, {0x36, 8}, {0x37, 8}, {0x64, 8}, {0x65, 8},
+	{0x68, 8}, {0x67, 8}, {0xcc, 9}, {0xcd, 9}, {0xd2, 9}, {0xd3, 9}, {0xd4, 9}, {0xd5, 9},
+	{0xd6, 9}, {0xd7, 9}, {0xd8, 9}, {0xd9, 9}, {0xda, 9}, {0xdb, 9}, {0x98, 9}, {0x99, 9},
+	{0x9a, 9}, {0x18, 6}, {0x9b, 9},
+}
+
+// ccittBlackMakeup holds the makeup codes of the black runs of 64 to 1728 pixels, by steps of 64.
+var ccittBlackMakeup = [27]ccittCode{
+	{0x0f, 10}, {0xc8, 12}, {0xc9, 12}, {0x5b, 12}, {0x33, 12}, {0x34, 12}, {0x35, 12}, {0x6c, 13},
+	{0x6d, 13}, {0x4a, 13}, {0x4b, 13}, {0x4c, 13}, {0x4d, 13}, {0x72, 13}, {0x73, 13}, {0x74, 13},
+	{0x75, 13}, {0x76, 13}, {0x77, 13}, {0x52, 13}, {0x53, 13}, {0x54, 13}, {0x55, 13}, {0x5a, 13},
+	{0x5b, 13}, {0x64, 13}, {0x65, 13},
+}
+
+// ccittExtendedMakeup holds the makeup codes shared by both colors of the
+// runs of 1792 to 2560 pixels, by steps of 64.
+var ccittExtendedMakeup = [13]ccittCode{
+	{0x08, 11}, {0x0c, 11}, {0x0d, 11}, {0x12, 12}, {0x13, 12}, {0x14, 12}, {0x15, 12},
+	{0x16, 12}, {0x17, 12}, {0x1c, 12}, {0x1d, 12}, {0x1e, 12}, {0x1f, 12},
+}
+
+// ccittBitWriter writes the codes most significant bit first.
+type ccittBitWriter struct {
+	out    []byte
+	bits   uint64
+	length uint
+}
+
+// write appends a code.
+func (w *ccittBitWriter) write(code ccittCode) {
+	w.bits = w.bits<<code.length | uint64(code.bits)
+	w.length += code.length
+	for w.length >= 8 {
+		w.length -= 8
+		w.out = append(w.out, byte(w.bits>>w.length))
+	}
+}
+
+// writeRun appends the codes of a run of pixels of one color.
+func (w *ccittBitWriter) writeRun(run int, black bool) {
+	terminating, makeup := &ccittWhiteTerminating, ccittWhiteMakeup[:]
+	if black {
+		terminating, makeup = &ccittBlackTerminating, ccittBlackMakeup[:]
+	}
+
+	for run >= 64 {
+		step := run / 64
+		if step > len(makeup)+len(ccittExtendedMakeup) {
+			step = len(makeup) + len(ccittExtendedMakeup)
+		}
+
+		if step <= len(makeup) {
+			w.write(makeup[step-1])
+		} else {
+			w.write(ccittExtendedMakeup[step-len(makeup)-1])
+		}
+		run -= step * 64
+	}
+	w.write(terminating[run])
+}
+
+// bytes returns the written codes, the last byte is padded with zeros.
+func (w *ccittBitWriter) bytes() []byte {
+	if w.length > 0 {
+		w.out = append(w.out, byte(w.bits<<(8-w.length)))
+		w.length = 0
+	}
+	return w.out
+}
+
+// encodeCcittG3 encodes a bilevel image with the CCITT T.4 one-dimensional
+// (Modified Huffman) encoding, as stored in TIFF files with the Group 3
+// compression: every row starts with an EOL code and there is no RTC sequence.
+//
+// Parameters:
+//   - rows: The rows of the image, true is a black pixel.
+//
+// Returns:
+//   - []byte: The encoded image.
+func encodeCcittG3(rows [][]bool) []byte {
+	w := &ccittBitWriter{}
+	for _, row := range rows {
+		w.write(ccittEol)
+
+		// Every row starts with a white run, empty if its first pixel is black.
+		black := false
+		for start := 0; start < len(row); {
+			end := nextCcittChange(row, start, black)
+			w.writeRun(end-start, black)
+			start, black = end, !black
+		}
+	}
+	return w.bytes()
+}
+
+// encodeCcittG4 encodes a bilevel image with the CCITT T.6 two-dimensional
+// (Modified Modified READ) encoding, ended by an EOFB sequence. The
+// reference line of the first row is white.
+//
+// Parameters:
+//   - rows: The rows of the image, true is a black pixel.
+//   - width: The width of the image.
+//
+// Returns:
+//   - []byte: The encoded image.
+func encodeCcittG4(rows [][]bool, width int) []byte {
+	w := &ccittBitWriter{}
+	reference := make([]bool, width)
+
+	for _, row := range rows {
+		encodeCcittG4Row(w, row, reference)
+		reference = row
+	}
+
+	w.write(ccittEol)
+	w.write(ccittEol)
+	return w.bytes()
+}
+
+// encodeCcittG4Row encodes a row in the two-dimensional coding, it follows
+// the coding procedure of T.6: a0 is the last coded changing element, a1 and
+// a2 the next ones on the row, b1 and b2 the next ones of the reference line.
+func encodeCcittG4Row(w *ccittBitWriter, row []bool, reference []bool) {
+	width := len(row)
+	pixel := func(line []bool, i int) bool {
+		return i >= 0 && i < width && line[i]
+	}
+
+	a0, a0Black := -1, false
+	a1 := nextCcittChange(row, 0, false)
+	b1 := nextCcittChange(reference, 0, false)
+
+	for {
+		b2 := width
+		if b1 < width {
+			b2 = nextCcittChange(reference, b1, pixel(reference, b1))
+		}
+
+		switch {
+		case b2 < a1:
+			w.write(ccittPass)
+			a0 = b2
+		case a1-b1 >= -3 && a1-b1 <= 3:
+			w.write(ccittVertical[a1-b1+3])
+			a0, a0Black = a1, !a0Black
+		default:
+			a2 := width
+			if a1 < width {
+				a2 = nextCcittChange(row, a1, !a0Black)
+			}
+			w.write(ccittHorizontal)
+			w.writeRun(a1-maxInt(a0, 0), a0Black)
+			w.writeRun(a2-a1, !a0Black)
+			a0 = a2
+		}
+
+		if a0 >= width {
+			return
+		}
+
+		// b1 is the first change to the opposite color of a0 after a0.
+		a1 = nextCcittChange(row, a0, a0Black)
+		b1 = nextCcittChange(reference, a0, !a0Black)
+		b1 = nextCcittChange(reference, b1, a0Black)
+	}
+}
+
+// nextCcittChange returns the first position from start whose pixel isn't
+// of the given color, or the width of the line.
+func nextCcittChange(line []bool, start int, black bool) int {
+	i := maxInt(start, 0)
+	for i < len(line) && line[i] == black {
+		i++
+	}
+	return i
+}
+
+// maxInt returns the larger of two integers.
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
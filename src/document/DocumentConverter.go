@@ -0,0 +1,334 @@
+package document
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"faxsender/src/utilities"
+	"faxsender/src/utilities/logger"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Constants for the conversion of documents to PDF documents and fax TIFF images.
+const (
+	CONVERSION_CACHE_EXTENSION      = ".pdf"
+	CONVERSION_CACHE_TIFF_EXTENSION = ".tiff"
+	CONVERSION_CACHE_MAX_AGE        = 30 * 24 * time.Hour
+
+	// OFFICE_CONVERTER_INPUT_NAME is the name, without extension, of the
+	// document given to the office converter, its PDF document gets the same name.
+	OFFICE_CONVERTER_INPUT_NAME = "document"
+)
+
+// Errors returned by the conversion of documents.
+var (
+	ErrConversionFailed     = errors.New("the document can't be converted to PDF")
+	ErrConverterUnavailable = errors.New("no office converter is installed to convert the document to PDF")
+)
+
+// officeConverterNames are the commands searched in the PATH when no office
+// converter is configured.
+var officeConverterNames = []string{"soffice", "libreoffice"}
+
+// officeExtensions maps the content types of the office documents to the
+// file extension they are given for the office converter.
+var officeExtensions = map[string]string{
+	utilities.MS_WORD_CONTENT_TYPE:        utilities.DOCX_FILE_EXTENSION,
+	utilities.MS_WORD_LEGACY_CONTENT_TYPE: utilities.DOC_FILE_EXTENSION,
+	utilities.ODT_CONTENT_TYPE:            utilities.ODT_FILE_EXTENSION,
+}
+
+// DocumentConverter converts documents to PDF documents before they are sent.
+// Text files and images are rendered in process, office documents are
+// converted by a headless office converter. The results are cached by the
+// hash of the converted contents.
+type DocumentConverter struct {
+	officeConverter string
+	timeout         time.Duration
+	pageSize        PageSize
+	cacheDir        string
+}
+
+// NewDocumentConverter creates a new DocumentConverter.
+//
+// Parameters:
+//   - officeConverter: The command name or path of the office converter, empty to search the PATH for LibreOffice.
+//   - timeout: The maximum duration of the conversion of an office document.
+//   - pageSize: The size of the pages rendered from text files and images.
+//   - cacheDir: The directory the converted documents are cached in, empty to disable the cache.
+//
+// Returns:
+//   - *DocumentConverter: The created converter.
+func NewDocumentConverter(officeConverter string, timeout time.Duration, pageSize PageSize, cacheDir string) *DocumentConverter {
+	return &DocumentConverter{
+		officeConverter: officeConverter,
+		timeout:         timeout,
+		pageSize:        pageSize,
+		cacheDir:        cacheDir,
+	}
+}
+
+// NeedsConversion reports whether documents of a content type are converted
+// to PDF documents before they are sent. PDF documents and TIFF images are
+// sent as they are, like documents of unknown content types.
+//
+// Parameters:
+//   - contentType: The content type of the document.
+//
+// Returns:
+//   - bool: true if the document is converted.
+func NeedsConversion(contentType string) bool {
+	switch contentType {
+	case utilities.TEXT_CONTENT_TYPE, utilities.PNG_CONTENT_TYPE, utilities.JPEG_CONTENT_TYPE, utilities.JPG_CONTENT_TYPE:
+		return true
+	}
+
+	_, ok := officeExtensions[contentType]
+	return ok
+}
+
+// ConvertToPdf converts a document to a PDF document.
+// Steps:
+// 1. Return the cached result of a document with the same contents.
+// 2. Render text files and images, run the office converter for office documents.
+// 3. Cache the PDF document.
+//
+// Parameters:
+//   - ctx: The context of the conversion, cancelling it stops the office converter.
+//   - contents: The contents of the document.
+//   - contentType: The content type of the document, NeedsConversion must be true for it.
+//
+// Returns:
+//   - []byte: The contents of the PDF document.
+//   - error: ErrConversionFailed or ErrConverterUnavailable if the document can't be converted.
+func (c *DocumentConverter) ConvertToPdf(ctx context.Context, contents []byte, contentType string) ([]byte, error) {
+	key := c.cacheKey(contents, contentType, c.pageSize)
+	if pdf, ok := c.loadCached(key, CONVERSION_CACHE_EXTENSION); ok {
+		return pdf, nil
+	}
+
+	var pdf []byte
+	var err error
+	switch contentType {
+	case utilities.TEXT_CONTENT_TYPE:
+		pdf = TextToPdf(contents, c.pageSize)
+	case utilities.PNG_CONTENT_TYPE, utilities.JPEG_CONTENT_TYPE, utilities.JPG_CONTENT_TYPE:
+		pdf, err = ImageToPdf(contents, c.pageSize)
+	default:
+		extension, ok := officeExtensions[contentType]
+		if !ok {
+			return nil, fmt.Errorf("%w: documents of type '%s' can't be converted", ErrConversionFailed, contentType)
+		}
+		pdf, err = c.convertOfficeDocument(ctx, contents, extension)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.storeCached(key, CONVERSION_CACHE_EXTENSION, pdf)
+	return pdf, nil
+}
+
+// IsFaxTiffImage reports whether documents of a content type can be
+// converted to fax TIFF images.
+//
+// Parameters:
+//   - contentType: The content type of the document.
+//
+// Returns:
+//   - bool: true for PNG and JPEG images.
+func IsFaxTiffImage(contentType string) bool {
+	switch contentType {
+	case utilities.PNG_CONTENT_TYPE, utilities.JPEG_CONTENT_TYPE, utilities.JPG_CONTENT_TYPE:
+		return true
+	}
+	return false
+}
+
+// ConvertToFaxTiff converts an image to a fax TIFF image with ImageToFaxTiff,
+// the paper size of the converter is used. The results are cached like the
+// PDF documents.
+//
+// Parameters:
+//   - contents: The contents of the image.
+//   - contentType: The content type of the image, IsFaxTiffImage must be true for it.
+//   - options: The compression, resolution and dithering of the TIFF image.
+//
+// Returns:
+//   - []byte: The contents of the TIFF image.
+//   - error: ErrConversionFailed if the image can't be converted.
+func (c *DocumentConverter) ConvertToFaxTiff(contents []byte, contentType string, options FaxTiffOptions) ([]byte, error) {
+	if !IsFaxTiffImage(contentType) {
+		return nil, fmt.Errorf("%w: only PNG and JPEG images can be converted to TIFF images", ErrConversionFailed)
+	}
+
+	options.PageSize = c.pageSize
+	key := c.cacheKey(contents, contentType, options)
+	if tiff, ok := c.loadCached(key, CONVERSION_CACHE_TIFF_EXTENSION); ok {
+		return tiff, nil
+	}
+
+	tiff, err := ImageToFaxTiff(contents, options)
+	if err != nil {
+		return nil, err
+	}
+
+	c.storeCached(key, CONVERSION_CACHE_TIFF_EXTENSION, tiff)
+	return tiff, nil
+}
+
+// convertOfficeDocument converts an office document with the office converter.
+// Steps:
+// 1. Find the office converter.
+// 2. Write the document to a temporary directory.
+// 3. Run the converter with its own profile in the directory, so
+// conversions can run in parallel with each other and with an open office
+// application.
+// 4. Read and check the PDF document it wrote.
+//
+// Parameters:
+//   - ctx: The context of the conversion, cancelling it stops the office converter.
+//   - contents: The contents of the document.
+//   - extension: The file extension of the document.
+//
+// Returns:
+//   - []byte: The contents of the PDF document.
+//   - error: ErrConversionFailed or ErrConverterUnavailable if the document can't be converted.
+func (c *DocumentConverter) convertOfficeDocument(ctx context.Context, contents []byte, extension string) ([]byte, error) {
+	converter, err := c.findOfficeConverter()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "faxsender-conversion-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	inputPath := filepath.Join(dir, OFFICE_CONVERTER_INPUT_NAME+"."+extension)
+	if err := os.WriteFile(inputPath, contents, 0600); err != nil {
+		return nil, err
+	}
+
+	profileURL := "file:///" + strings.TrimPrefix(filepath.ToSlash(filepath.Join(dir, "profile")), "/")
+	err = utilities.ExecuteOnTerminalWithTimeout(ctx, c.timeout, converter, "-env:UserInstallation="+profileURL,
+		"--headless", "--norestore", "--convert-to", utilities.PDF_FILE_EXTENSION, "--outdir", dir, inputPath)
+	switch {
+	case errors.Is(err, utilities.ErrExecutionTimeout):
+		return nil, fmt.Errorf("%w: the office converter didn't finish within %v", ErrConversionFailed, c.timeout)
+	case err != nil && ctx.Err() != nil:
+		return nil, ctx.Err()
+	case err != nil:
+		return nil, fmt.Errorf("%w: the office converter failed: %v", ErrConversionFailed, err)
+	}
+
+	pdf, err := os.ReadFile(filepath.Join(dir, OFFICE_CONVERTER_INPUT_NAME+"."+utilities.PDF_FILE_EXTENSION))
+	if err != nil {
+		return nil, fmt.Errorf("%w: the office converter didn't write a PDF document, the document may be damaged", ErrConversionFailed)
+	}
+
+	if _, err := ParsePdf(pdf); err != nil {
+		return nil, fmt.Errorf("%w: the office converter wrote an invalid PDF document: %v", ErrConversionFailed, err)
+	}
+	return pdf, nil
+}
+
+// findOfficeConverter returns the path of the configured office converter,
+// or of the first LibreOffice command found in the PATH.
+func (c *DocumentConverter) findOfficeConverter() (string, error) {
+	names := officeConverterNames
+	if c.officeConverter != "" {
+		names = []string{c.officeConverter}
+	}
+
+	for _, name := range names {
+		if converterPath, err := exec.LookPath(name); err == nil {
+			return converterPath, nil
+		}
+	}
+	return "", fmt.Errorf("%w: '%s' was not found", ErrConverterUnavailable, strings.Join(names, "', '"))
+}
+
+// cacheKey returns the key of the cached result of a conversion, the hash
+// of everything the result depends on: the contents, their content type and
+// the options of the conversion.
+func (c *DocumentConverter) cacheKey(contents []byte, contentType string, options interface{}) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%v\n", contentType, options)
+	hash.Write(contents)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// loadCached returns a cached result, marking it as used so it is pruned last.
+func (c *DocumentConverter) loadCached(key string, extension string) ([]byte, bool) {
+	if c.cacheDir == "" {
+		return nil, false
+	}
+
+	cachePath := filepath.Join(c.cacheDir, key+extension)
+	contents, err := os.ReadFile(cachePath)
+	if err != nil {
+		return nil, false
+	}
+
+	now := time.Now()
+	_ = os.Chtimes(cachePath, now, now)
+	return contents, true
+}
+
+// storeCached caches a result and removes the results unused for longer
+// than CONVERSION_CACHE_MAX_AGE. Failures are logged, the conversion
+// succeeded anyway.
+func (c *DocumentConverter) storeCached(key string, extension string, contents []byte) {
+	if c.cacheDir == "" {
+		return
+	}
+
+	if err := c.writeCached(key, extension, contents); err != nil {
+		logger.Inst().Error(fmt.Sprintf("error caching the converted document: %v", err))
+		return
+	}
+
+	entries, err := os.ReadDir(c.cacheDir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err == nil && time.Since(info.ModTime()) > CONVERSION_CACHE_MAX_AGE {
+			_ = os.Remove(filepath.Join(c.cacheDir, entry.Name()))
+		}
+	}
+}
+
+// writeCached writes a result to the cache through a temporary file of its own,
+// so parallel conversions of the same document don't write to the same file.
+func (c *DocumentConverter) writeCached(key string, extension string, contents []byte) error {
+	if err := os.MkdirAll(c.cacheDir, 0755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(c.cacheDir, key+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(contents)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), filepath.Join(c.cacheDir, key+extension))
+}
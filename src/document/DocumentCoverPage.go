@@ -0,0 +1,335 @@
+package document
+
+import (
+	"bytes"
+	"errors"
+	"faxsender/src/utilities"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Constants for the cover page templates.
+const (
+	COVER_PAGE_TEMPLATE_EXTENSION    = ".txt"
+	DEFAULT_COVER_PAGE_TEMPLATE_NAME = "default"
+	COVER_PAGE_DATE_FORMAT           = "January 2, 2006"
+)
+
+// Constants for the layout of the cover pages, in points.
+const (
+	COVER_PAGE_MARGIN          = 56.0
+	COVER_PAGE_HEADING_SIZE    = 24.0
+	COVER_PAGE_SUBHEADING_SIZE = 14.0
+	COVER_PAGE_BODY_SIZE       = 11.0
+	COVER_PAGE_LINE_SPACING    = 1.4
+	COVER_PAGE_RULE_WIDTH      = 0.75
+
+	// COVER_PAGE_HEADING_CHAR_WIDTH is a conservative estimate of the width of
+	// a Helvetica-Bold glyph relative to the font size, used to wrap the headings.
+	COVER_PAGE_HEADING_CHAR_WIDTH = 0.6
+)
+
+// DEFAULT_COVER_PAGE_TEMPLATE is written to the templates directory when it
+// has no template. Templates are Go text templates executed with a
+// CoverPageData, each line of the result is drawn as follows:
+//   - "# text": a heading.
+//   - "## text": a subheading.
+//   - "---": a horizontal rule.
+//   - any other line: body text, wrapped to the width of the page.
+const DEFAULT_COVER_PAGE_TEMPLATE = `# FAX
+## {{.Title}}
+
+Date:    {{.Date}}
+Pages:   {{.Pages}} (including this cover page)
+---
+## To
+Name:    {{.Recipient.Name}}
+Fax:     {{.Recipient.Phone}}
+{{- if .Recipient.Email}}
+Email:   {{.Recipient.Email}}
+{{- end}}
+{{- if .Recipient.Address}}
+Address: {{.Recipient.Address}}
+{{- end}}
+{{- if .Recipient.Custom1}}
+         {{.Recipient.Custom1}}
+{{- end}}
+{{- if .Recipient.Custom2}}
+         {{.Recipient.Custom2}}
+{{- end}}
+{{- if .Recipient.Custom3}}
+         {{.Recipient.Custom3}}
+{{- end}}
+
+## From
+Name:    {{.Sender.Name}}
+{{- if .Sender.Company}}
+Company: {{.Sender.Company}}
+{{- end}}
+{{- if .Sender.Phone}}
+Phone:   {{.Sender.Phone}}
+{{- end}}
+{{- if .Sender.Email}}
+Email:   {{.Sender.Email}}
+{{- end}}
+---
+{{- if .Recipient.Description}}
+{{.Recipient.Description}}
+---
+{{- end}}
+
+{{.Notice}}
+`
+
+// Errors returned for the cover page templates.
+var (
+	ErrCoverPageTemplateNotFound = errors.New("the cover page template doesn't exist")
+	ErrCoverPageTemplateInvalid  = errors.New("the cover page template is invalid")
+)
+
+// CoverPageParty holds the fields of the sender or the recipient printed on a cover page.
+type CoverPageParty struct {
+	FirstName   string
+	LastName    string
+	Company     string
+	Email       string
+	Phone       string
+	Address     string
+	Description string
+	Custom1     string
+	Custom2     string
+	Custom3     string
+}
+
+// Name returns the full name of the party.
+func (p CoverPageParty) Name() string {
+	return strings.TrimSpace(p.FirstName + " " + p.LastName)
+}
+
+// CoverPageData holds the fields a cover page template is executed with.
+type CoverPageData struct {
+	Sender    CoverPageParty
+	Recipient CoverPageParty
+	Title     string
+	Pages     int // the number of pages of the fax, including the cover page
+	Date      string
+	Notice    string
+}
+
+// ListCoverPageTemplates lists the names of the cover page templates.
+// The default template is written first if the templates directory has none,
+// so users can copy and edit it.
+//
+// Returns:
+//   - []string: The names of the templates, without extension, in alphabetical order.
+//   - error: An error if the templates directory can't be read.
+func ListCoverPageTemplates() ([]string, error) {
+	dir, err := utilities.GetCoverPagesPath()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	names, err := readCoverPageTemplateNames(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 {
+		defaultPath := path.Join(dir, DEFAULT_COVER_PAGE_TEMPLATE_NAME+COVER_PAGE_TEMPLATE_EXTENSION)
+		if err := utilities.WriteFileAtomic(defaultPath, []byte(DEFAULT_COVER_PAGE_TEMPLATE), 0644); err != nil {
+			return nil, err
+		}
+		names = []string{DEFAULT_COVER_PAGE_TEMPLATE_NAME}
+	}
+	return names, nil
+}
+
+// readCoverPageTemplateNames returns the names of the template files of a directory.
+func readCoverPageTemplateNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != COVER_PAGE_TEMPLATE_EXTENSION {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(entry.Name(), COVER_PAGE_TEMPLATE_EXTENSION))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// LoadCoverPageTemplate reads a cover page template from the templates directory.
+// The default template is used if its file has been deleted.
+//
+// Parameters:
+//   - name: The name of the template, without extension.
+//
+// Returns:
+//   - string: The text of the template.
+//   - error: ErrCoverPageTemplateNotFound if there is no template with the name.
+func LoadCoverPageTemplate(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("%w: '%s'", ErrCoverPageTemplateNotFound, name)
+	}
+
+	dir, err := utilities.GetCoverPagesPath()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path.Join(dir, name+COVER_PAGE_TEMPLATE_EXTENSION))
+	if os.IsNotExist(err) {
+		if name == DEFAULT_COVER_PAGE_TEMPLATE_NAME {
+			return DEFAULT_COVER_PAGE_TEMPLATE, nil
+		}
+		return "", fmt.Errorf("%w: '%s'", ErrCoverPageTemplateNotFound, name)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// RenderCoverPage executes a cover page template and draws the result on a page.
+// Lines that don't fit on the page are left out.
+//
+// Parameters:
+//   - templateText: The text of the template.
+//   - data: The fields the template is executed with.
+//   - size: The size of the page.
+//
+// Returns:
+//   - *PdfPage: The cover page.
+//   - error: ErrCoverPageTemplateInvalid if the template can't be parsed or executed.
+func RenderCoverPage(templateText string, data CoverPageData, size PageSize) (*PdfPage, error) {
+	tmpl, err := template.New("coverpage").Option("missingkey=error").Parse(templateText)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCoverPageTemplateInvalid, err)
+	}
+
+	var text bytes.Buffer
+	if err := tmpl.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCoverPageTemplateInvalid, err)
+	}
+
+	page := NewPdfPage(size)
+	width := size.Width - 2*COVER_PAGE_MARGIN
+	y := size.Height - COVER_PAGE_MARGIN
+
+	for _, line := range strings.Split(strings.TrimRight(text.String(), "\n"), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+
+		font, fontSize, charWidth := PDF_FONT_COURIER, COVER_PAGE_BODY_SIZE, PDF_COURIER_CHAR_WIDTH
+		switch {
+		case strings.HasPrefix(line, "## "):
+			font, fontSize, charWidth = PDF_FONT_HELVETICA_BOLD, COVER_PAGE_SUBHEADING_SIZE, COVER_PAGE_HEADING_CHAR_WIDTH
+			line = strings.TrimSpace(line[3:])
+		case strings.HasPrefix(line, "# "):
+			font, fontSize, charWidth = PDF_FONT_HELVETICA_BOLD, COVER_PAGE_HEADING_SIZE, COVER_PAGE_HEADING_CHAR_WIDTH
+			line = strings.TrimSpace(line[2:])
+		case line == "---":
+			y -= COVER_PAGE_BODY_SIZE * COVER_PAGE_LINE_SPACING / 2
+			if y >= COVER_PAGE_MARGIN {
+				page.Line(COVER_PAGE_MARGIN, y, size.Width-COVER_PAGE_MARGIN, y, COVER_PAGE_RULE_WIDTH)
+			}
+			y -= COVER_PAGE_BODY_SIZE * COVER_PAGE_LINE_SPACING / 2
+			continue
+		}
+
+		for _, wrapped := range WrapText(line, int(width/(fontSize*charWidth))) {
+			y -= fontSize * COVER_PAGE_LINE_SPACING
+			if y < COVER_PAGE_MARGIN {
+				return page, nil
+			}
+			if wrapped != "" {
+				page.Text(COVER_PAGE_MARGIN, y, font, fontSize, wrapped)
+			}
+		}
+	}
+	return page, nil
+}
+
+// PrependCoverPage adds a cover page before the first page of a PDF document.
+// The cover page has the size of the first page and its page count includes
+// itself.
+//
+// Parameters:
+//   - pdf: The contents of the PDF document.
+//   - templateText: The text of the cover page template.
+//   - data: The fields the template is executed with, the page count is set.
+//
+// Returns:
+//   - []byte: The contents of the document with the cover page.
+//   - error: An error if the document can't be read or the template is invalid.
+func PrependCoverPage(pdf []byte, templateText string, data CoverPageData) ([]byte, error) {
+	doc, err := ParsePdf(pdf)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes, err := doc.PageSizes()
+	if err != nil {
+		return nil, err
+	}
+
+	size := PAGE_SIZE_A4
+	if len(sizes) > 0 {
+		size = sizes[0]
+	}
+
+	data.Pages = len(sizes) + 1
+	page, err := RenderCoverPage(templateText, data, size)
+	if err != nil {
+		return nil, err
+	}
+	return doc.PrependPages(page)
+}
+
+// WrapText splits a line into lines of at most maxChars characters.
+// Lines are broken at the last space that fits, words longer than a line
+// are broken anywhere. The spaces inside the lines are kept, so columns
+// aligned with spaces stay aligned in fixed-width fonts.
+//
+// Parameters:
+//   - line: The line to wrap.
+//   - maxChars: The maximum number of characters of a line.
+//
+// Returns:
+//   - []string: The wrapped lines, an empty line is kept as one empty line.
+func WrapText(line string, maxChars int) []string {
+	if maxChars < 1 {
+		maxChars = 1
+	}
+
+	runes := []rune(line)
+	lines := make([]string, 0, 1)
+	for len(runes) > maxChars {
+		end := maxChars
+		for i := maxChars; i > 0; i-- {
+			if runes[i] == ' ' {
+				end = i
+				break
+			}
+		}
+
+		lines = append(lines, strings.TrimRight(string(runes[:end]), " "))
+		runes = runes[end:]
+		for len(runes) > 0 && runes[0] == ' ' {
+			runes = runes[1:]
+		}
+	}
+	return append(lines, string(runes))
+}
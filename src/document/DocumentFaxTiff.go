@@ -0,0 +1,346 @@
+package document
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math"
+	"sort"
+)
+
+// Constants of the fax TIFF images (TIFF-F, RFC 2306).
+const (
+	// FAX_TIFF_WIDTH is the width of a fax scan line in pixels, the same for
+	// A4 and Letter pages.
+	FAX_TIFF_WIDTH = 1728
+
+	// Horizontal and vertical resolutions of the fax images, in pixels per inch.
+	FAX_TIFF_X_RESOLUTION          = 204
+	FAX_TIFF_STANDARD_Y_RESOLUTION = 98
+	FAX_TIFF_FINE_Y_RESOLUTION     = 196
+
+	// FAX_TIFF_THRESHOLD is the luminance from which a pixel is white when the
+	// image isn't dithered.
+	FAX_TIFF_THRESHOLD = 128
+)
+
+// TIFF tags, types and values written in the fax TIFF images.
+const (
+	tiffTagNewSubfileType   = 254
+	tiffTagImageWidth       = 256
+	tiffTagImageLength      = 257
+	tiffTagBitsPerSample    = 258
+	tiffTagCompression      = 259
+	tiffTagPhotometric      = 262
+	tiffTagFillOrder        = 266
+	tiffTagStripOffsets     = 273
+	tiffTagSamplesPerPixel  = 277
+	tiffTagRowsPerStrip     = 278
+	tiffTagStripByteCounts  = 279
+	tiffTagXResolution      = 282
+	tiffTagYResolution      = 283
+	tiffTagT4Options        = 292
+	tiffTagT6Options        = 293
+	tiffTagResolutionUnit   = 296
+	tiffTagPageNumber       = 297
+	tiffTypeShort           = 3
+	tiffTypeLong            = 4
+	tiffTypeRational        = 5
+	tiffCompressionG3       = 3
+	tiffCompressionG4       = 4
+	tiffSubfileTypePage     = 2
+	tiffPhotometricWhiteIs0 = 0
+	tiffResolutionUnitInch  = 2
+)
+
+// FaxTiffOptions are the options of the conversion of images to fax TIFF images.
+type FaxTiffOptions struct {
+	// Group4 compresses the pages with CCITT T.6 (Group 4) instead of CCITT T.4 (Group 3).
+	Group4 bool
+
+	// Fine uses the fine vertical resolution of 196 lines per inch instead of 98.
+	Fine bool
+
+	// Dither renders the gray levels with Floyd-Steinberg dithering instead of a threshold.
+	Dither bool
+
+	// PageSize is the paper size the pages are cut to.
+	PageSize PageSize
+}
+
+// yResolution returns the vertical resolution of the options, in lines per inch.
+func (o FaxTiffOptions) yResolution() int {
+	if o.Fine {
+		return FAX_TIFF_FINE_Y_RESOLUTION
+	}
+	return FAX_TIFF_STANDARD_Y_RESOLUTION
+}
+
+// ImageToFaxTiff converts a PNG or JPEG image to a multi-page bilevel TIFF-F image.
+// Steps:
+// 1. Scale the image down to the width of the paper at the fax resolution,
+// smaller images are kept at one image pixel per fax pixel.
+// 2. Convert it to black and white with a threshold or dithering.
+// 3. Center it on 1728 pixels wide scan lines, an image taller than a page is
+// cut into pages and the last page is padded with white lines.
+// 4. Compress every page with CCITT Group 3 or Group 4.
+//
+// Parameters:
+//   - contents: The contents of the image file.
+//   - options: The compression, resolution, dithering and paper size of the TIFF image.
+//
+// Returns:
+//   - []byte: The contents of the TIFF image.
+//   - error: ErrConversionFailed if the image can't be decoded.
+func ImageToFaxTiff(contents []byte, options FaxTiffOptions) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(contents))
+	if err != nil {
+		return nil, fmt.Errorf("%w: the image can't be read: %v", ErrConversionFailed, err)
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() <= 0 || bounds.Dy() <= 0 {
+		return nil, fmt.Errorf("%w: the image is empty", ErrConversionFailed)
+	}
+
+	yResolution := options.yResolution()
+	paperWidth := int(math.Round(options.PageSize.Width / 72 * FAX_TIFF_X_RESOLUTION))
+	if paperWidth <= 0 || paperWidth > FAX_TIFF_WIDTH {
+		paperWidth = FAX_TIFF_WIDTH
+	}
+	pageLines := int(math.Round(options.PageSize.Height / 72 * float64(yResolution)))
+	if pageLines <= 0 {
+		pageLines = int(math.Round(PAGE_SIZE_A4.Height / 72 * float64(yResolution)))
+	}
+
+	scale := math.Min(1, float64(paperWidth)/float64(bounds.Dx()))
+	width := maxInt(1, int(math.Round(float64(bounds.Dx())*scale)))
+	height := maxInt(1, int(math.Round(float64(bounds.Dy())*scale*float64(yResolution)/FAX_TIFF_X_RESOLUTION)))
+
+	gray := scaleGray(imageLuminance(img), bounds.Dx(), bounds.Dy(), width, height)
+	var black []bool
+	if options.Dither {
+		black = ditherGray(gray, width, height)
+	} else {
+		black = thresholdGray(gray)
+	}
+
+	left := (FAX_TIFF_WIDTH - width) / 2
+	top := 0
+	if height < pageLines {
+		top = (pageLines - height) / 2
+	}
+
+	pageCount := (top + height + pageLines - 1) / pageLines
+	pages := make([][]byte, 0, pageCount)
+	for page := 0; page < pageCount; page++ {
+		rows := make([][]bool, pageLines)
+		for line := range rows {
+			rows[line] = make([]bool, FAX_TIFF_WIDTH)
+
+			y := page*pageLines + line - top
+			if y >= 0 && y < height {
+				copy(rows[line][left:], black[y*width:(y+1)*width])
+			}
+		}
+
+		if options.Group4 {
+			pages = append(pages, encodeCcittG4(rows, FAX_TIFF_WIDTH))
+		} else {
+			pages = append(pages, encodeCcittG3(rows))
+		}
+	}
+
+	return writeFaxTiff(pages, pageLines, options), nil
+}
+
+// imageLuminance returns the luminance of the pixels of an image, row by row,
+// drawn on white when it is transparent.
+func imageLuminance(img image.Image) []uint8 {
+	bounds := img.Bounds()
+	luminance := make([]uint8, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+
+			// The colors are premultiplied with the alpha, adding the missing
+			// part draws them on white.
+			white := 0xffff - a
+			r, g, b = r+white, g+white, b+white
+
+			luminance = append(luminance, uint8((299*r+587*g+114*b)/1000>>8))
+		}
+	}
+	return luminance
+}
+
+// scaleGray scales a grayscale image down, every pixel is the average of
+// the pixels of the source image it covers.
+func scaleGray(source []uint8, sourceWidth int, sourceHeight int, width int, height int) []uint8 {
+	scaled := make([]uint8, width*height)
+	for y := 0; y < height; y++ {
+		y0, y1 := scaledSpan(y, height, sourceHeight)
+		for x := 0; x < width; x++ {
+			x0, x1 := scaledSpan(x, width, sourceWidth)
+
+			sum := 0
+			for sy := y0; sy < y1; sy++ {
+				for _, value := range source[sy*sourceWidth+x0 : sy*sourceWidth+x1] {
+					sum += int(value)
+				}
+			}
+			scaled[y*width+x] = uint8(sum / ((y1 - y0) * (x1 - x0)))
+		}
+	}
+	return scaled
+}
+
+// scaledSpan returns the range of the source pixels covered by a scaled pixel,
+// at least one pixel.
+func scaledSpan(i int, size int, sourceSize int) (int, int) {
+	start := i * sourceSize / size
+	end := (i + 1) * sourceSize / size
+	if end <= start {
+		end = start + 1
+	}
+	return start, end
+}
+
+// thresholdGray converts a grayscale image to black and white, true is black.
+func thresholdGray(gray []uint8) []bool {
+	black := make([]bool, len(gray))
+	for i, value := range gray {
+		black[i] = value < FAX_TIFF_THRESHOLD
+	}
+	return black
+}
+
+// ditherGray converts a grayscale image to black and white with the
+// Floyd-Steinberg error diffusion, true is black.
+func ditherGray(gray []uint8, width int, height int) []bool {
+	black := make([]bool, len(gray))
+	current, next := make([]int, width+2), make([]int, width+2)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			value := int(gray[y*width+x]) + current[x+1]/16
+
+			output := 255
+			if value < FAX_TIFF_THRESHOLD {
+				output = 0
+				black[y*width+x] = true
+			}
+
+			diff := value - output
+			current[x+2] += diff * 7
+			next[x] += diff * 3
+			next[x+1] += diff * 5
+			next[x+2] += diff
+		}
+
+		current, next = next, current
+		for i := range next {
+			next[i] = 0
+		}
+	}
+	return black
+}
+
+// tiffEntry is an entry of a TIFF image file directory, values are SHORT,
+// LONG or the numerators of RATIONAL values over 1.
+type tiffEntry struct {
+	tag       uint16
+	valueType uint16
+	values    []uint32
+}
+
+// writeFaxTiff writes the compressed pages as a little endian TIFF file,
+// every page is one strip followed by its image file directory.
+func writeFaxTiff(pages [][]byte, pageLines int, options FaxTiffOptions) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{'I', 'I', 42, 0})
+
+	// The offset of the next directory is patched once it is written.
+	nextOffsetPos := buf.Len()
+	binary.Write(&buf, binary.LittleEndian, uint32(0))
+
+	compression, optionsTag := uint32(tiffCompressionG3), uint16(tiffTagT4Options)
+	if options.Group4 {
+		compression, optionsTag = tiffCompressionG4, tiffTagT6Options
+	}
+
+	for number, page := range pages {
+		stripOffset := buf.Len()
+		buf.Write(page)
+		if buf.Len()%2 != 0 {
+			buf.WriteByte(0)
+		}
+
+		entries := []tiffEntry{
+			{tiffTagNewSubfileType, tiffTypeLong, []uint32{tiffSubfileTypePage}},
+			{tiffTagImageWidth, tiffTypeLong, []uint32{FAX_TIFF_WIDTH}},
+			{tiffTagImageLength, tiffTypeLong, []uint32{uint32(pageLines)}},
+			{tiffTagBitsPerSample, tiffTypeShort, []uint32{1}},
+			{tiffTagCompression, tiffTypeShort, []uint32{compression}},
+			{tiffTagPhotometric, tiffTypeShort, []uint32{tiffPhotometricWhiteIs0}},
+			{tiffTagFillOrder, tiffTypeShort, []uint32{1}},
+			{tiffTagStripOffsets, tiffTypeLong, []uint32{uint32(stripOffset)}},
+			{tiffTagSamplesPerPixel, tiffTypeShort, []uint32{1}},
+			{tiffTagRowsPerStrip, tiffTypeLong, []uint32{uint32(pageLines)}},
+			{tiffTagStripByteCounts, tiffTypeLong, []uint32{uint32(len(page))}},
+			{tiffTagXResolution, tiffTypeRational, []uint32{FAX_TIFF_X_RESOLUTION}},
+			{tiffTagYResolution, tiffTypeRational, []uint32{uint32(options.yResolution())}},
+			{optionsTag, tiffTypeLong, []uint32{0}},
+			{tiffTagResolutionUnit, tiffTypeShort, []uint32{tiffResolutionUnitInch}},
+			{tiffTagPageNumber, tiffTypeShort, []uint32{uint32(number), uint32(len(pages))}},
+		}
+
+		binary.LittleEndian.PutUint32(buf.Bytes()[nextOffsetPos:], uint32(buf.Len()))
+		nextOffsetPos = writeTiffDirectory(&buf, entries)
+	}
+	return buf.Bytes()
+}
+
+// writeTiffDirectory writes an image file directory, the rational values are
+// written after it.
+//
+// Returns:
+//   - int: The position of the offset of the next directory, it is zero.
+func writeTiffDirectory(buf *bytes.Buffer, entries []tiffEntry) int {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].tag < entries[j].tag
+	})
+
+	directoryStart := buf.Len()
+	rationalOffset := directoryStart + 2 + 12*len(entries) + 4
+	var rationals []uint32
+
+	binary.Write(buf, binary.LittleEndian, uint16(len(entries)))
+	for _, entry := range entries {
+		binary.Write(buf, binary.LittleEndian, entry.tag)
+		binary.Write(buf, binary.LittleEndian, entry.valueType)
+		binary.Write(buf, binary.LittleEndian, uint32(len(entry.values)))
+
+		value := make([]byte, 4)
+		switch entry.valueType {
+		case tiffTypeShort:
+			for i, v := range entry.values {
+				binary.LittleEndian.PutUint16(value[2*i:], uint16(v))
+			}
+		case tiffTypeLong:
+			binary.LittleEndian.PutUint32(value, entry.values[0])
+		case tiffTypeRational:
+			binary.LittleEndian.PutUint32(value, uint32(rationalOffset+4*len(rationals)))
+			rationals = append(rationals, entry.values[0], 1)
+		}
+		buf.Write(value)
+	}
+
+	nextOffsetPos := buf.Len()
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+	for _, value := range rationals {
+		binary.Write(buf, binary.LittleEndian, value)
+	}
+	return nextOffsetPos
+}
@@ -0,0 +1,150 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// IMAGE_PAGE_MARGIN is the margin around the images converted to PDF pages, in points.
+const IMAGE_PAGE_MARGIN = 18.0
+
+// ImageToPdf converts a PNG or JPEG image to a PDF document of one page.
+// The image is centered on the page and scaled down to fit inside the
+// margins, smaller images are drawn at 72 pixels per inch. JPEG images are
+// embedded as they are, without decoding them.
+//
+// Parameters:
+//   - contents: The contents of the image file.
+//   - size: The size of the page.
+//
+// Returns:
+//   - []byte: The contents of the PDF document.
+//   - error: ErrConversionFailed if the image can't be decoded.
+func ImageToPdf(contents []byte, size PageSize) ([]byte, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(contents))
+	if err != nil {
+		return nil, fmt.Errorf("%w: the image can't be read: %v", ErrConversionFailed, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, fmt.Errorf("%w: the image is empty", ErrConversionFailed)
+	}
+
+	page := NewPdfPage(size)
+	x, y, width, height := fitImage(config.Width, config.Height, size)
+
+	if xobject, ok := newPdfJpegImage(contents, format, config); ok {
+		page.drawImage(x, y, width, height, xobject)
+		return WritePdf([]*PdfPage{page}), nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(contents))
+	if err != nil {
+		return nil, fmt.Errorf("%w: the image can't be read: %v", ErrConversionFailed, err)
+	}
+
+	page.Image(x, y, width, height, img)
+	return WritePdf([]*PdfPage{page}), nil
+}
+
+// fitImage centers an image on a page, scaling it down to fit inside the margins.
+//
+// Returns:
+//   - x, y: The position of the lower left corner of the image.
+//   - width, height: The size of the image in points.
+func fitImage(pixelWidth int, pixelHeight int, size PageSize) (float64, float64, float64, float64) {
+	width, height := float64(pixelWidth), float64(pixelHeight)
+	maxWidth, maxHeight := size.Width-2*IMAGE_PAGE_MARGIN, size.Height-2*IMAGE_PAGE_MARGIN
+
+	scale := 1.0
+	if width*scale > maxWidth {
+		scale = maxWidth / width
+	}
+	if height*scale > maxHeight {
+		scale = maxHeight / height
+	}
+
+	width, height = width*scale, height*scale
+	return (size.Width - width) / 2, (size.Height - height) / 2, width, height
+}
+
+// newPdfJpegImage creates an image XObject holding a JPEG file as it is.
+// CMYK images are left to newPdfImage, their colors are stored inverted by
+// some programs.
+//
+// Returns:
+//   - pdfStream: The image XObject.
+//   - bool: false if the image isn't a grayscale or RGB JPEG image.
+func newPdfJpegImage(contents []byte, format string, config image.Config) (pdfStream, bool) {
+	var colorSpace pdfName
+	switch {
+	case format != "jpeg":
+		return pdfStream{}, false
+	case config.ColorModel == color.GrayModel:
+		colorSpace = "DeviceGray"
+	case config.ColorModel == color.YCbCrModel:
+		colorSpace = "DeviceRGB"
+	default:
+		return pdfStream{}, false
+	}
+
+	return pdfStream{
+		Dict: pdfDict{
+			"Type":             pdfName("XObject"),
+			"Subtype":          pdfName("Image"),
+			"Width":            config.Width,
+			"Height":           config.Height,
+			"ColorSpace":       colorSpace,
+			"BitsPerComponent": 8,
+			"Filter":           pdfName("DCTDecode"),
+		},
+		Data: contents,
+	}, true
+}
+
+// newPdfImage creates a Flate compressed image XObject from a decoded image.
+// Grayscale images are stored with one component and the other images as
+// RGB, drawn on white when they are transparent.
+func newPdfImage(img image.Image) pdfStream {
+	bounds := img.Bounds()
+	_, gray := img.(*image.Gray)
+
+	components, colorSpace := 3, pdfName("DeviceRGB")
+	if gray {
+		components, colorSpace = 1, pdfName("DeviceGray")
+	}
+
+	samples := make([]byte, 0, bounds.Dx()*bounds.Dy()*components)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+
+			// The colors are premultiplied with the alpha, adding the missing
+			// part draws them on white.
+			white := 0xffff - a
+			r, g, b = r+white, g+white, b+white
+
+			if gray {
+				samples = append(samples, byte(r>>8))
+			} else {
+				samples = append(samples, byte(r>>8), byte(g>>8), byte(b>>8))
+			}
+		}
+	}
+
+	return pdfStream{
+		Dict: pdfDict{
+			"Type":             pdfName("XObject"),
+			"Subtype":          pdfName("Image"),
+			"Width":            bounds.Dx(),
+			"Height":           bounds.Dy(),
+			"ColorSpace":       colorSpace,
+			"BitsPerComponent": 8,
+			"Filter":           pdfName("FlateDecode"),
+		},
+		Data: deflate(samples),
+	}
+}
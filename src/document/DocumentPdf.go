@@ -0,0 +1,193 @@
+package document
+
+import (
+	"bytes"
+	"faxsender/src/utilities"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// pdfName is a PDF name object, written with a leading slash.
+type pdfName string
+
+// pdfRef is a reference to an indirect PDF object.
+type pdfRef struct {
+	ID         int
+	Generation int
+}
+
+// pdfDict is a PDF dictionary object.
+type pdfDict map[pdfName]interface{}
+
+// pdfArray is a PDF array object.
+type pdfArray []interface{}
+
+// pdfString is a PDF string object, it holds the bytes of the string and not
+// of its literal or hexadecimal form.
+type pdfString []byte
+
+// pdfStream is a PDF stream object, Data holds the encoded bytes of the stream.
+type pdfStream struct {
+	Dict pdfDict
+	Data []byte
+}
+
+// PageSize is the size of a page in PDF points, 72 points are one inch.
+type PageSize struct {
+	Width  float64
+	Height float64
+}
+
+// Page sizes of the documents generated by the application.
+var (
+	PAGE_SIZE_A4     = PageSize{Width: 595.28, Height: 841.89}
+	PAGE_SIZE_LETTER = PageSize{Width: 612, Height: 792}
+)
+
+// PageSizeByName returns the page size of a paper size of the configuration.
+//
+// Parameters:
+//   - paperSize: One of the utilities.PAPER_SIZE_* constants.
+//
+// Returns:
+//   - PageSize: The size of the paper, A4 for an unknown paper size.
+func PageSizeByName(paperSize string) PageSize {
+	if paperSize == utilities.PAPER_SIZE_LETTER {
+		return PAGE_SIZE_LETTER
+	}
+	return PAGE_SIZE_A4
+}
+
+// writePdfObject serializes a PDF object in its textual form.
+// The keys of the dictionaries are sorted, so the output is stable, and the
+// length of the streams is set to the length of their data.
+//
+// Parameters:
+//   - buf: The buffer the object is written to.
+//   - object: The object, nil is the null object.
+func writePdfObject(buf *bytes.Buffer, object interface{}) {
+	switch value := object.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(value))
+	case int:
+		buf.WriteString(strconv.Itoa(value))
+	case int64:
+		buf.WriteString(strconv.FormatInt(value, 10))
+	case float64:
+		buf.WriteString(formatPdfNumber(value))
+	case pdfName:
+		writePdfName(buf, value)
+	case pdfString:
+		fmt.Fprintf(buf, "<%X>", []byte(value))
+	case pdfRef:
+		fmt.Fprintf(buf, "%d %d R", value.ID, value.Generation)
+	case pdfArray:
+		buf.WriteByte('[')
+		for i, item := range value {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writePdfObject(buf, item)
+		}
+		buf.WriteByte(']')
+	case pdfDict:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, string(key))
+		}
+		sort.Strings(keys)
+
+		buf.WriteString("<<")
+		for _, key := range keys {
+			writePdfName(buf, pdfName(key))
+			buf.WriteByte(' ')
+			writePdfObject(buf, value[pdfName(key)])
+		}
+		buf.WriteString(">>")
+	case pdfStream:
+		dict := pdfDict{}
+		for key, item := range value.Dict {
+			dict[key] = item
+		}
+		dict["Length"] = len(value.Data)
+
+		writePdfObject(buf, dict)
+		buf.WriteString("\nstream\n")
+		buf.Write(value.Data)
+		buf.WriteString("\nendstream")
+	default:
+		buf.WriteString("null")
+	}
+}
+
+// writePdfName writes a name object, escaping the bytes that are not allowed
+// in names as #xx.
+func writePdfName(buf *bytes.Buffer, name pdfName) {
+	buf.WriteByte('/')
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < 0x21 || c > 0x7e || c == '#' || isPdfDelimiter(c) {
+			fmt.Fprintf(buf, "#%02X", c)
+			continue
+		}
+		buf.WriteByte(c)
+	}
+}
+
+// formatPdfNumber formats a real number with at most four decimals, PDF
+// readers don't accept exponents.
+func formatPdfNumber(value float64) string {
+	return strconv.FormatFloat(math.Round(value*10000)/10000, 'f', -1, 64)
+}
+
+// isPdfWhitespace checks if a byte is a PDF white-space character.
+func isPdfWhitespace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+// isPdfDelimiter checks if a byte is a PDF delimiter character.
+func isPdfDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// pdfInt returns the integer value of a PDF number object.
+//
+// Returns:
+//   - int: The value, real numbers are truncated.
+//   - bool: False if the object is not a number.
+func pdfInt(object interface{}) (int, bool) {
+	switch value := object.(type) {
+	case int:
+		return value, true
+	case int64:
+		return int(value), true
+	case float64:
+		return int(value), true
+	}
+	return 0, false
+}
+
+// pdfFloat returns the value of a PDF number object.
+//
+// Returns:
+//   - float64: The value.
+//   - bool: False if the object is not a number.
+func pdfFloat(object interface{}) (float64, bool) {
+	switch value := object.(type) {
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case float64:
+		return value, true
+	}
+	return 0, false
+}
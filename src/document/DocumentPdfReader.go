@@ -0,0 +1,1140 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// Constants for reading PDF documents.
+const (
+	PDF_HEADER_SEARCH_SIZE  = 1024
+	PDF_TRAILER_SEARCH_SIZE = 2048
+	PDF_MAX_NESTING_DEPTH   = 64
+	PDF_MAX_REFERENCE_DEPTH = 32
+)
+
+// Errors returned when reading PDF documents.
+var (
+	ErrNotPdf       = errors.New("the document is not a PDF file")
+	ErrPdfEncrypted = errors.New("the PDF document is encrypted")
+	ErrPdfDamaged   = errors.New("the PDF document is damaged")
+)
+
+// pdfObjectHeaderRegexp matches the header of an indirect object, it is used
+// to rebuild the cross-reference table of damaged documents.
+var pdfObjectHeaderRegexp = regexp.MustCompile(`(\d+)[ \t\r\n\f\x00]+(\d+)[ \t\r\n\f\x00]+obj\b`)
+
+// pdfXrefEntry is an entry of the cross-reference table of a PDF document.
+type pdfXrefEntry struct {
+	free       bool
+	compressed bool
+	offset     int // the offset of the object, or the ID of its object stream if compressed
+	index      int // the index of the object in its object stream
+	generation int
+}
+
+// PdfDocument is a PDF document read into memory. It reads the objects it
+// needs on demand and supports cross-reference tables, cross-reference
+// streams and object streams. A PdfDocument is not safe for concurrent use.
+type PdfDocument struct {
+	data          []byte
+	xref          map[int]pdfXrefEntry
+	trailer       pdfDict
+	startXref     int
+	xrefStream    bool
+	reconstructed bool
+
+	objects       map[int]interface{}
+	objectStreams map[int][]byte
+	resolving     map[int]bool
+}
+
+// ParsePdf reads a PDF document.
+// Steps:
+// 1. Check the PDF header.
+// 2. Load the cross-reference sections from the last one, following the previous sections.
+// 3. Rebuild the cross-reference table by scanning the objects if it is damaged.
+// 4. Reject encrypted documents, the application can't write encrypted objects.
+//
+// Parameters:
+//   - data: The contents of the PDF document.
+//
+// Returns:
+//   - *PdfDocument: The document.
+//   - error: ErrNotPdf, ErrPdfEncrypted or ErrPdfDamaged if the document can't be read.
+func ParsePdf(data []byte) (*PdfDocument, error) {
+	header := data
+	if len(header) > PDF_HEADER_SEARCH_SIZE {
+		header = header[:PDF_HEADER_SEARCH_SIZE]
+	}
+	if !bytes.Contains(header, []byte("%PDF-")) {
+		return nil, ErrNotPdf
+	}
+
+	d := &PdfDocument{
+		data:          data,
+		xref:          map[int]pdfXrefEntry{},
+		objects:       map[int]interface{}{},
+		objectStreams: map[int][]byte{},
+		resolving:     map[int]bool{},
+	}
+
+	err := d.loadXref()
+	if err == nil {
+		_, _, err = d.pagesRoot()
+	}
+	if err != nil {
+		if rebuildErr := d.reconstructXref(); rebuildErr != nil {
+			return nil, fmt.Errorf("%w: %v", ErrPdfDamaged, err)
+		}
+	}
+
+	if _, ok := d.trailer["Encrypt"]; ok {
+		return nil, ErrPdfEncrypted
+	}
+
+	if _, _, err := d.pagesRoot(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPdfDamaged, err)
+	}
+	return d, nil
+}
+
+// PageCount returns the number of pages of the document.
+//
+// Returns:
+//   - int: The number of pages.
+//   - error: ErrPdfDamaged if the page tree can't be read.
+func (d *PdfDocument) PageCount() (int, error) {
+	sizes, err := d.PageSizes()
+	if err != nil {
+		return 0, err
+	}
+	return len(sizes), nil
+}
+
+// PageSizes returns the size of each page of the document, from its media box.
+//
+// Returns:
+//   - []PageSize: The size of each page, in the page order.
+//   - error: ErrPdfDamaged if the page tree can't be read.
+func (d *PdfDocument) PageSizes() ([]PageSize, error) {
+	pagesRef, _, err := d.pagesRoot()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPdfDamaged, err)
+	}
+
+	sizes := make([]PageSize, 0)
+	err = d.walkPages(pagesRef, PAGE_SIZE_A4, map[int]bool{}, &sizes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPdfDamaged, err)
+	}
+	return sizes, nil
+}
+
+// pagesRoot returns the root node of the page tree, it must be an indirect object.
+func (d *PdfDocument) pagesRoot() (pdfRef, pdfDict, error) {
+	root, err := d.resolve(d.trailer["Root"])
+	if err != nil {
+		return pdfRef{}, nil, err
+	}
+	catalog, ok := root.(pdfDict)
+	if !ok {
+		return pdfRef{}, nil, errors.New("the document catalog is missing")
+	}
+
+	pagesRef, ok := catalog["Pages"].(pdfRef)
+	if !ok {
+		return pdfRef{}, nil, errors.New("the page tree is missing")
+	}
+
+	pages, err := d.resolve(pagesRef)
+	if err != nil {
+		return pdfRef{}, nil, err
+	}
+	pagesDict, ok := pages.(pdfDict)
+	if !ok {
+		return pdfRef{}, nil, errors.New("the page tree is not a dictionary")
+	}
+	return pagesRef, pagesDict, nil
+}
+
+// walkPages collects the sizes of the pages below a node of the page tree.
+//
+// Parameters:
+//   - node: The node of the page tree.
+//   - inherited: The media box size inherited from the parent nodes.
+//   - visited: The visited nodes, a node referenced twice ends the walk.
+//   - sizes: The collected page sizes.
+func (d *PdfDocument) walkPages(node interface{}, inherited PageSize, visited map[int]bool, sizes *[]PageSize) error {
+	if ref, ok := node.(pdfRef); ok {
+		if visited[ref.ID] {
+			return fmt.Errorf("the page tree node %d is referenced twice", ref.ID)
+		}
+		visited[ref.ID] = true
+	}
+
+	object, err := d.resolve(node)
+	if err != nil {
+		return err
+	}
+	dict, ok := object.(pdfDict)
+	if !ok {
+		return errors.New("a page tree node is not a dictionary")
+	}
+
+	size := inherited
+	if mediaBox, ok := d.mediaBoxSize(dict["MediaBox"]); ok {
+		size = mediaBox
+	}
+
+	kids, err := d.resolve(dict["Kids"])
+	if err != nil {
+		return err
+	}
+	kidsArray, isNode := kids.(pdfArray)
+	if !isNode || dict["Type"] == pdfName("Page") {
+		*sizes = append(*sizes, size)
+		return nil
+	}
+
+	for _, kid := range kidsArray {
+		if err := d.walkPages(kid, size, visited, sizes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mediaBoxSize returns the size of a media box rectangle.
+func (d *PdfDocument) mediaBoxSize(object interface{}) (PageSize, bool) {
+	object, err := d.resolve(object)
+	if err != nil {
+		return PageSize{}, false
+	}
+	box, ok := object.(pdfArray)
+	if !ok || len(box) != 4 {
+		return PageSize{}, false
+	}
+
+	var values [4]float64
+	for i, item := range box {
+		item, err = d.resolve(item)
+		if err != nil {
+			return PageSize{}, false
+		}
+		if values[i], ok = pdfFloat(item); !ok {
+			return PageSize{}, false
+		}
+	}
+	return PageSize{Width: math.Abs(values[2] - values[0]), Height: math.Abs(values[3] - values[1])}, true
+}
+
+// resolve follows the references until an object that is not a reference.
+// A reference to a missing object is the null object.
+func (d *PdfDocument) resolve(object interface{}) (interface{}, error) {
+	for depth := 0; depth < PDF_MAX_REFERENCE_DEPTH; depth++ {
+		ref, ok := object.(pdfRef)
+		if !ok {
+			return object, nil
+		}
+
+		var err error
+		object, err = d.object(ref.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, errors.New("the references are nested too deeply")
+}
+
+// object returns the indirect object with an ID, reading it on first use.
+func (d *PdfDocument) object(id int) (interface{}, error) {
+	if object, ok := d.objects[id]; ok {
+		return object, nil
+	}
+
+	entry, ok := d.xref[id]
+	if !ok || entry.free {
+		return nil, nil
+	}
+
+	if d.resolving[id] {
+		return nil, fmt.Errorf("the object %d references itself", id)
+	}
+	d.resolving[id] = true
+	defer delete(d.resolving, id)
+
+	var object interface{}
+	var err error
+	if entry.compressed {
+		object, err = d.compressedObject(entry)
+	} else {
+		var ref pdfRef
+		ref, object, err = d.parseIndirectObject(entry.offset)
+		if err == nil && ref.ID != id {
+			err = fmt.Errorf("the object at offset %d is %d instead of %d", entry.offset, ref.ID, id)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d.objects[id] = object
+	return object, nil
+}
+
+// compressedObject reads an object stored in an object stream.
+func (d *PdfDocument) compressedObject(entry pdfXrefEntry) (interface{}, error) {
+	data, ok := d.objectStreams[entry.offset]
+	if !ok {
+		object, err := d.object(entry.offset)
+		if err != nil {
+			return nil, err
+		}
+		stream, ok := object.(pdfStream)
+		if !ok {
+			return nil, fmt.Errorf("the object stream %d is not a stream", entry.offset)
+		}
+
+		data, err = d.decodeStream(stream)
+		if err != nil {
+			return nil, err
+		}
+		d.objectStreams[entry.offset] = data
+	}
+
+	stream := d.objects[entry.offset].(pdfStream)
+	count, _ := pdfInt(stream.Dict["N"])
+	first, _ := pdfInt(stream.Dict["First"])
+	if entry.index >= count {
+		return nil, fmt.Errorf("the object stream %d has no object %d", entry.offset, entry.index)
+	}
+
+	header := &pdfParser{data: data}
+	offset := 0
+	for i := 0; i <= entry.index; i++ {
+		if _, err := header.parseInt(); err != nil {
+			return nil, err
+		}
+		value, err := header.parseInt()
+		if err != nil {
+			return nil, err
+		}
+		offset = value
+	}
+
+	if first+offset >= len(data) {
+		return nil, fmt.Errorf("the object stream %d is truncated", entry.offset)
+	}
+	parser := &pdfParser{data: data, pos: first + offset}
+	return parser.parseObject(0)
+}
+
+// parseIndirectObject parses the indirect object starting at an offset.
+// The length of a stream is taken from its dictionary, or from the position
+// of the endstream keyword if the length is wrong.
+func (d *PdfDocument) parseIndirectObject(offset int) (pdfRef, interface{}, error) {
+	if offset < 0 || offset >= len(d.data) {
+		return pdfRef{}, nil, fmt.Errorf("the object offset %d is outside of the document", offset)
+	}
+
+	p := &pdfParser{data: d.data, pos: offset}
+	id, err := p.parseInt()
+	if err != nil {
+		return pdfRef{}, nil, err
+	}
+	generation, err := p.parseInt()
+	if err != nil {
+		return pdfRef{}, nil, err
+	}
+	if err := p.expectKeyword("obj"); err != nil {
+		return pdfRef{}, nil, err
+	}
+	ref := pdfRef{ID: id, Generation: generation}
+
+	object, err := p.parseObject(0)
+	if err != nil {
+		return ref, nil, err
+	}
+
+	dict, ok := object.(pdfDict)
+	if !ok || p.token() != "stream" {
+		return ref, object, nil
+	}
+
+	if p.pos < len(d.data) && d.data[p.pos] == '\r' {
+		p.pos++
+	}
+	if p.pos < len(d.data) && d.data[p.pos] == '\n' {
+		p.pos++
+	}
+	start := p.pos
+
+	length := -1
+	if value, err := d.resolve(dict["Length"]); err == nil {
+		if value, ok := pdfInt(value); ok {
+			length = value
+		}
+	}
+
+	if length < 0 || start+length > len(d.data) || !d.isEndStream(start+length) {
+		end := bytes.Index(d.data[start:], []byte("endstream"))
+		if end < 0 {
+			return ref, nil, fmt.Errorf("the stream of the object %d has no end", id)
+		}
+		length = len(bytes.TrimRight(d.data[start:start+end], "\r\n"))
+	}
+
+	return ref, pdfStream{Dict: dict, Data: d.data[start : start+length]}, nil
+}
+
+// isEndStream checks if the endstream keyword follows an offset.
+func (d *PdfDocument) isEndStream(offset int) bool {
+	p := &pdfParser{data: d.data, pos: offset}
+	p.skipSpace()
+	return bytes.HasPrefix(d.data[p.pos:], []byte("endstream"))
+}
+
+// decodeStream decodes the data of a stream, only the Flate filter with or
+// without PNG predictors is supported.
+func (d *PdfDocument) decodeStream(stream pdfStream) ([]byte, error) {
+	filter, err := d.resolve(stream.Dict["Filter"])
+	if err != nil {
+		return nil, err
+	}
+	params, err := d.resolve(stream.Dict["DecodeParms"])
+	if err != nil {
+		return nil, err
+	}
+
+	if filters, ok := filter.(pdfArray); ok {
+		if len(filters) > 1 {
+			return nil, errors.New("streams with several filters are not supported")
+		}
+		filter = nil
+		if len(filters) == 1 {
+			filter = filters[0]
+		}
+		if paramsArray, ok := params.(pdfArray); ok && len(paramsArray) > 0 {
+			params, _ = d.resolve(paramsArray[0])
+		}
+	}
+
+	switch filter {
+	case nil:
+		return stream.Data, nil
+	case pdfName("FlateDecode"), pdfName("Fl"):
+	default:
+		return nil, fmt.Errorf("the stream filter %v is not supported", filter)
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(stream.Data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+
+	paramsDict, _ := params.(pdfDict)
+	predictor, _ := pdfInt(paramsDict["Predictor"])
+	if predictor < 10 {
+		if predictor > 1 {
+			return nil, fmt.Errorf("the predictor %d is not supported", predictor)
+		}
+		return data, nil
+	}
+
+	columns, colors, bitsPerComponent := 1, 1, 8
+	if value, ok := pdfInt(paramsDict["Columns"]); ok {
+		columns = value
+	}
+	if value, ok := pdfInt(paramsDict["Colors"]); ok {
+		colors = value
+	}
+	if value, ok := pdfInt(paramsDict["BitsPerComponent"]); ok {
+		bitsPerComponent = value
+	}
+	return removePngPredictor(data, (columns*colors*bitsPerComponent+7)/8, (colors*bitsPerComponent+7)/8)
+}
+
+// removePngPredictor reverses the PNG predictors applied to the rows of a stream.
+//
+// Parameters:
+//   - data: The predicted rows, each one starting with its predictor type.
+//   - rowLength: The number of bytes of a row, without the predictor type.
+//   - pixelLength: The number of bytes of a pixel, at least one.
+//
+// Returns:
+//   - []byte: The rows without the predictor types.
+//   - error: An error if a row has an unknown predictor type.
+func removePngPredictor(data []byte, rowLength int, pixelLength int) ([]byte, error) {
+	if rowLength <= 0 {
+		return nil, errors.New("the predictor columns are invalid")
+	}
+	if pixelLength < 1 {
+		pixelLength = 1
+	}
+
+	result := make([]byte, 0, len(data))
+	previous := make([]byte, rowLength)
+	for start := 0; start+1 <= len(data); start += rowLength + 1 {
+		end := start + 1 + rowLength
+		if end > len(data) {
+			end = len(data)
+		}
+		row := make([]byte, rowLength)
+		copy(row, data[start+1:end])
+
+		for i := range row {
+			var left, upLeft byte
+			if i >= pixelLength {
+				left = row[i-pixelLength]
+				upLeft = previous[i-pixelLength]
+			}
+			up := previous[i]
+
+			switch data[start] {
+			case 0:
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paethPredictor(left, up, upLeft)
+			default:
+				return nil, fmt.Errorf("the PNG predictor %d is unknown", data[start])
+			}
+		}
+
+		result = append(result, row...)
+		previous = row
+	}
+	return result, nil
+}
+
+// paethPredictor returns the Paeth predictor of a byte.
+func paethPredictor(left byte, up byte, upLeft byte) byte {
+	p := int(left) + int(up) - int(upLeft)
+	pa, pb, pc := abs(p-int(left)), abs(p-int(up)), abs(p-int(upLeft))
+	if pa <= pb && pa <= pc {
+		return left
+	}
+	if pb <= pc {
+		return up
+	}
+	return upLeft
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+// loadXref loads the cross-reference sections from the last one, the
+// entries of the newer sections replace those of the older ones.
+func (d *PdfDocument) loadXref() error {
+	offset, err := d.findStartXref()
+	if err != nil {
+		return err
+	}
+	d.startXref = offset
+
+	visited := map[int]bool{}
+	for first := true; ; first = false {
+		if visited[offset] {
+			break
+		}
+		visited[offset] = true
+
+		trailer, isStream, err := d.loadXrefSection(offset)
+		if err != nil {
+			return err
+		}
+
+		if first {
+			d.trailer = pdfDict{}
+			d.xrefStream = isStream
+		}
+		for key, value := range trailer {
+			if _, ok := d.trailer[key]; !ok {
+				d.trailer[key] = value
+			}
+		}
+
+		if streamOffset, ok := pdfInt(trailer["XRefStm"]); ok && !visited[streamOffset] {
+			visited[streamOffset] = true
+			if _, _, err := d.loadXrefSection(streamOffset); err != nil {
+				return err
+			}
+		}
+
+		prev, ok := pdfInt(trailer["Prev"])
+		if !ok {
+			break
+		}
+		offset = prev
+	}
+
+	if _, ok := d.trailer["Root"]; !ok {
+		return errors.New("the trailer has no document catalog")
+	}
+	return nil
+}
+
+// findStartXref returns the offset of the last cross-reference section.
+func (d *PdfDocument) findStartXref() (int, error) {
+	tail := len(d.data) - PDF_TRAILER_SEARCH_SIZE
+	if tail < 0 {
+		tail = 0
+	}
+
+	index := bytes.LastIndex(d.data[tail:], []byte("startxref"))
+	if index < 0 {
+		return 0, errors.New("the startxref keyword is missing")
+	}
+
+	p := &pdfParser{data: d.data, pos: tail + index + len("startxref")}
+	return p.parseInt()
+}
+
+// loadXrefSection loads the cross-reference table or stream at an offset.
+//
+// Returns:
+//   - pdfDict: The trailer of the section, the dictionary of a stream.
+//   - bool: True if the section is a cross-reference stream.
+//   - error: An error if the section can't be read.
+func (d *PdfDocument) loadXrefSection(offset int) (pdfDict, bool, error) {
+	if offset < 0 || offset >= len(d.data) {
+		return nil, false, fmt.Errorf("the cross-reference offset %d is outside of the document", offset)
+	}
+
+	p := &pdfParser{data: d.data, pos: offset}
+	p.skipSpace()
+	if bytes.HasPrefix(d.data[p.pos:], []byte("xref")) {
+		p.pos += len("xref")
+		trailer, err := d.loadXrefTable(p)
+		return trailer, false, err
+	}
+
+	trailer, err := d.loadXrefStream(offset)
+	return trailer, true, err
+}
+
+// loadXrefTable loads the subsections of a cross-reference table and its trailer.
+func (d *PdfDocument) loadXrefTable(p *pdfParser) (pdfDict, error) {
+	for {
+		p.skipSpace()
+		if bytes.HasPrefix(d.data[p.pos:], []byte("trailer")) {
+			p.pos += len("trailer")
+			object, err := p.parseObject(0)
+			if err != nil {
+				return nil, err
+			}
+			trailer, ok := object.(pdfDict)
+			if !ok {
+				return nil, errors.New("the trailer is not a dictionary")
+			}
+			return trailer, nil
+		}
+
+		start, err := p.parseInt()
+		if err != nil {
+			return nil, err
+		}
+		count, err := p.parseInt()
+		if err != nil {
+			return nil, err
+		}
+
+		for id := start; id < start+count; id++ {
+			offset, err := p.parseInt()
+			if err != nil {
+				return nil, err
+			}
+			generation, err := p.parseInt()
+			if err != nil {
+				return nil, err
+			}
+			kind := p.token()
+			if kind != "n" && kind != "f" {
+				return nil, fmt.Errorf("the cross-reference entry of the object %d is invalid", id)
+			}
+
+			if _, ok := d.xref[id]; !ok && id > 0 {
+				d.xref[id] = pdfXrefEntry{free: kind == "f", offset: offset, generation: generation}
+			}
+		}
+	}
+}
+
+// loadXrefStream loads the entries of a cross-reference stream.
+func (d *PdfDocument) loadXrefStream(offset int) (pdfDict, error) {
+	_, object, err := d.parseIndirectObject(offset)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := object.(pdfStream)
+	if !ok {
+		return nil, fmt.Errorf("the cross-reference at offset %d is not a stream", offset)
+	}
+
+	data, err := d.decodeStream(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	widths, ok := stream.Dict["W"].(pdfArray)
+	if !ok || len(widths) != 3 {
+		return nil, errors.New("the cross-reference stream has no field widths")
+	}
+	var fieldWidths [3]int
+	entryWidth := 0
+	for i, width := range widths {
+		fieldWidths[i], _ = pdfInt(width)
+		if fieldWidths[i] < 0 || fieldWidths[i] > 8 {
+			return nil, errors.New("the cross-reference stream field widths are invalid")
+		}
+		entryWidth += fieldWidths[i]
+	}
+	if entryWidth == 0 {
+		return nil, errors.New("the cross-reference stream field widths are invalid")
+	}
+
+	size, _ := pdfInt(stream.Dict["Size"])
+	index, ok := stream.Dict["Index"].(pdfArray)
+	if !ok {
+		index = pdfArray{0, size}
+	}
+
+	position := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, _ := pdfInt(index[i])
+		count, _ := pdfInt(index[i+1])
+
+		for id := start; id < start+count; id++ {
+			if position+entryWidth > len(data) {
+				return nil, errors.New("the cross-reference stream is truncated")
+			}
+
+			var fields [3]int
+			for field, width := range fieldWidths {
+				for b := 0; b < width; b++ {
+					fields[field] = fields[field]<<8 | int(data[position])
+					position++
+				}
+			}
+			if fieldWidths[0] == 0 {
+				fields[0] = 1
+			}
+
+			if _, ok := d.xref[id]; ok || id == 0 {
+				continue
+			}
+			switch fields[0] {
+			case 0:
+				d.xref[id] = pdfXrefEntry{free: true}
+			case 1:
+				d.xref[id] = pdfXrefEntry{offset: fields[1], generation: fields[2]}
+			case 2:
+				d.xref[id] = pdfXrefEntry{compressed: true, offset: fields[1], index: fields[2]}
+			}
+		}
+	}
+	return stream.Dict, nil
+}
+
+// reconstructXref rebuilds the cross-reference table of a damaged document
+// by scanning it for object headers, the last object with an ID wins.
+// The trailer is the last trailer dictionary or cross-reference stream, or
+// a trailer pointing to the last document catalog.
+func (d *PdfDocument) reconstructXref() error {
+	d.xref = map[int]pdfXrefEntry{}
+	d.objects = map[int]interface{}{}
+	d.objectStreams = map[int][]byte{}
+	d.trailer = nil
+	d.reconstructed = true
+
+	for _, match := range pdfObjectHeaderRegexp.FindAllSubmatchIndex(d.data, -1) {
+		id, err := strconv.Atoi(string(d.data[match[2]:match[3]]))
+		if err != nil || id <= 0 {
+			continue
+		}
+		generation, _ := strconv.Atoi(string(d.data[match[4]:match[5]]))
+		d.xref[id] = pdfXrefEntry{offset: match[0], generation: generation}
+	}
+
+	headers := make(map[int]pdfXrefEntry, len(d.xref))
+	for id, entry := range d.xref {
+		headers[id] = entry
+	}
+
+	var catalog pdfRef
+	for id, entry := range headers {
+		_, object, err := d.parseIndirectObject(entry.offset)
+		if err != nil {
+			continue
+		}
+
+		dict, _ := object.(pdfDict)
+		if stream, ok := object.(pdfStream); ok {
+			dict = stream.Dict
+		}
+
+		switch dict["Type"] {
+		case pdfName("Catalog"):
+			if id > catalog.ID {
+				catalog = pdfRef{ID: id, Generation: entry.generation}
+			}
+		case pdfName("ObjStm"):
+			d.indexObjectStream(id, object.(pdfStream))
+		}
+	}
+
+	if index := bytes.LastIndex(d.data, []byte("trailer")); index >= 0 {
+		p := &pdfParser{data: d.data, pos: index + len("trailer")}
+		if object, err := p.parseObject(0); err == nil {
+			d.trailer, _ = object.(pdfDict)
+		}
+	}
+
+	if d.trailer == nil || d.trailer["Root"] == nil {
+		if catalog.ID == 0 {
+			return errors.New("the document catalog is missing")
+		}
+		d.trailer = pdfDict{"Root": catalog}
+	}
+	delete(d.trailer, "Prev")
+	delete(d.trailer, "XRefStm")
+	return nil
+}
+
+// indexObjectStream adds the objects of an object stream to the rebuilt
+// cross-reference table, unless they are also stored outside of it.
+func (d *PdfDocument) indexObjectStream(id int, stream pdfStream) {
+	data, err := d.decodeStream(stream)
+	if err != nil {
+		return
+	}
+
+	count, _ := pdfInt(stream.Dict["N"])
+	header := &pdfParser{data: data}
+	for index := 0; index < count; index++ {
+		objectID, err := header.parseInt()
+		if err != nil {
+			return
+		}
+		if _, err := header.parseInt(); err != nil {
+			return
+		}
+		if _, ok := d.xref[objectID]; !ok && objectID > 0 {
+			d.xref[objectID] = pdfXrefEntry{compressed: true, offset: id, index: index}
+		}
+	}
+}
+
+// pdfParser parses PDF objects from a byte slice.
+type pdfParser struct {
+	data []byte
+	pos  int
+}
+
+// skipSpace skips the white-space and the comments.
+func (p *pdfParser) skipSpace() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if isPdfWhitespace(c) {
+			p.pos++
+			continue
+		}
+		if c == '%' {
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+// token reads the next run of regular characters.
+func (p *pdfParser) token() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.data) && !isPdfWhitespace(p.data[p.pos]) && !isPdfDelimiter(p.data[p.pos]) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+// expectKeyword reads a keyword and fails if it is another one.
+func (p *pdfParser) expectKeyword(keyword string) error {
+	start := p.pos
+	if token := p.token(); token != keyword {
+		return fmt.Errorf("expected '%s' at offset %d, found '%s'", keyword, start, token)
+	}
+	return nil
+}
+
+// parseInt reads an integer.
+func (p *pdfParser) parseInt() (int, error) {
+	start := p.pos
+	token := p.token()
+	value, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, fmt.Errorf("expected an integer at offset %d, found '%s'", start, token)
+	}
+	return value, nil
+}
+
+// parseObject parses the next object, an integer followed by a generation
+// number and the R keyword is a reference.
+func (p *pdfParser) parseObject(depth int) (interface{}, error) {
+	if depth > PDF_MAX_NESTING_DEPTH {
+		return nil, errors.New("the objects are nested too deeply")
+	}
+
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	c := p.data[p.pos]
+	switch {
+	case c == '/':
+		return p.parseName(), nil
+	case c == '(':
+		return p.parseLiteralString()
+	case c == '<' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '<':
+		return p.parseDict(depth)
+	case c == '<':
+		return p.parseHexString()
+	case c == '[':
+		return p.parseArray(depth)
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return p.parseNumberOrRef()
+	}
+
+	start := p.pos
+	switch token := p.token(); token {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	default:
+		if token == "" {
+			p.pos++
+		}
+		return nil, fmt.Errorf("unexpected token '%s' at offset %d", token, start)
+	}
+}
+
+// parseName parses a name, decoding the #xx escapes.
+func (p *pdfParser) parseName() pdfName {
+	p.pos++
+	start := p.pos
+	for p.pos < len(p.data) && !isPdfWhitespace(p.data[p.pos]) && !isPdfDelimiter(p.data[p.pos]) {
+		p.pos++
+	}
+
+	raw := p.data[start:p.pos]
+	if !bytes.Contains(raw, []byte("#")) {
+		return pdfName(raw)
+	}
+
+	name := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			if value, err := strconv.ParseUint(string(raw[i+1:i+3]), 16, 8); err == nil {
+				name = append(name, byte(value))
+				i += 2
+				continue
+			}
+		}
+		name = append(name, raw[i])
+	}
+	return pdfName(name)
+}
+
+// parseLiteralString parses a literal string with balanced parentheses and escapes.
+func (p *pdfParser) parseLiteralString() (pdfString, error) {
+	p.pos++
+	result := make([]byte, 0)
+	nesting := 0
+
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+
+		switch c {
+		case '(':
+			nesting++
+		case ')':
+			if nesting == 0 {
+				return result, nil
+			}
+			nesting--
+		case '\\':
+			if p.pos >= len(p.data) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			c = p.data[p.pos]
+			p.pos++
+
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+					p.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					value := int(c - '0')
+					for i := 0; i < 2 && p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '7'; i++ {
+						value = value*8 + int(p.data[p.pos]-'0')
+						p.pos++
+					}
+					c = byte(value)
+				}
+			}
+		}
+		result = append(result, c)
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+// parseHexString parses a hexadecimal string, a missing last digit is zero.
+func (p *pdfParser) parseHexString() (pdfString, error) {
+	p.pos++
+	digits := make([]byte, 0)
+
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+
+		switch {
+		case c == '>':
+			if len(digits)%2 == 1 {
+				digits = append(digits, '0')
+			}
+			result := make([]byte, len(digits)/2)
+			for i := range result {
+				value, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+				result[i] = byte(value)
+			}
+			return result, nil
+		case isPdfWhitespace(c):
+		case (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F'):
+			digits = append(digits, c)
+		default:
+			return nil, fmt.Errorf("invalid hexadecimal string at offset %d", p.pos-1)
+		}
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+// parseArray parses an array.
+func (p *pdfParser) parseArray(depth int) (pdfArray, error) {
+	p.pos++
+	result := pdfArray{}
+
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if p.data[p.pos] == ']' {
+			p.pos++
+			return result, nil
+		}
+
+		item, err := p.parseObject(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+}
+
+// parseDict parses a dictionary.
+func (p *pdfParser) parseDict(depth int) (pdfDict, error) {
+	p.pos += 2
+	result := pdfDict{}
+
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if bytes.HasPrefix(p.data[p.pos:], []byte(">>")) {
+			p.pos += 2
+			return result, nil
+		}
+		if p.data[p.pos] != '/' {
+			return nil, fmt.Errorf("expected a dictionary key at offset %d", p.pos)
+		}
+
+		key := p.parseName()
+		value, err := p.parseObject(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = value
+	}
+}
+
+// parseNumberOrRef parses a number, or a reference if the number is followed
+// by a generation number and the R keyword.
+func (p *pdfParser) parseNumberOrRef() (interface{}, error) {
+	start := p.pos
+	token := p.token()
+
+	id, err := strconv.Atoi(token)
+	if err != nil {
+		value, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s' at offset %d", token, start)
+		}
+		return value, nil
+	}
+
+	end := p.pos
+	if generation, err := strconv.Atoi(p.token()); err == nil && id >= 0 && generation >= 0 {
+		p.skipSpace()
+		if p.pos < len(p.data) && p.data[p.pos] == 'R' &&
+			(p.pos+1 == len(p.data) || isPdfWhitespace(p.data[p.pos+1]) || isPdfDelimiter(p.data[p.pos+1])) {
+			p.pos++
+			return pdfRef{ID: id, Generation: generation}, nil
+		}
+	}
+
+	p.pos = end
+	return id, nil
+}
@@ -0,0 +1,429 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"sort"
+)
+
+// Constants for the standard fonts used on the generated pages, every PDF
+// reader has them so they are not embedded.
+const (
+	PDF_FONT_HELVETICA      = "Helvetica"
+	PDF_FONT_HELVETICA_BOLD = "Helvetica-Bold"
+	PDF_FONT_COURIER        = "Courier"
+
+	// PDF_COURIER_CHAR_WIDTH is the width of a Courier glyph relative to the font size.
+	PDF_COURIER_CHAR_WIDTH = 0.6
+)
+
+// PDF_HEADER starts the documents written by the application, the binary
+// comment marks the file as binary for transfer programs.
+const PDF_HEADER = "%PDF-1.4\n%\xE2\xE3\xCF\xD3\n"
+
+// winAnsiSpecials maps the characters of the WinAnsi encoding that are not
+// at their Latin-1 position.
+var winAnsiSpecials = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9A, '›': 0x9B, 'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// PdfPage is a page drawn by the application with the standard fonts.
+type PdfPage struct {
+	size    PageSize
+	content bytes.Buffer
+	fonts   []string
+	images  []pdfStream
+}
+
+// NewPdfPage creates a new empty page.
+//
+// Parameters:
+//   - size: The size of the page.
+//
+// Returns:
+//   - *PdfPage: The created page.
+func NewPdfPage(size PageSize) *PdfPage {
+	return &PdfPage{size: size}
+}
+
+// Size returns the size of the page.
+func (p *PdfPage) Size() PageSize {
+	return p.size
+}
+
+// Text draws a line of text, the characters missing from the WinAnsi
+// encoding are drawn as question marks.
+//
+// Parameters:
+//   - x: The horizontal position of the start of the text, from the left edge.
+//   - y: The vertical position of the baseline, from the bottom edge.
+//   - font: One of the PDF_FONT_* constants.
+//   - fontSize: The font size in points.
+//   - text: The text.
+func (p *PdfPage) Text(x float64, y float64, font string, fontSize float64, text string) {
+	fmt.Fprintf(&p.content, "BT /%s %s Tf %s %s Td <%X> Tj ET\n",
+		p.fontResource(font), formatPdfNumber(fontSize), formatPdfNumber(x), formatPdfNumber(y), encodeWinAnsi(text))
+}
+
+// Line draws a straight line.
+//
+// Parameters:
+//   - x1, y1: The start of the line.
+//   - x2, y2: The end of the line.
+//   - width: The width of the line in points.
+func (p *PdfPage) Line(x1 float64, y1 float64, x2 float64, y2 float64, width float64) {
+	fmt.Fprintf(&p.content, "%s w %s %s m %s %s l S\n", formatPdfNumber(width),
+		formatPdfNumber(x1), formatPdfNumber(y1), formatPdfNumber(x2), formatPdfNumber(y2))
+}
+
+// Image draws an image scaled to a rectangle, its transparent parts are drawn on white.
+//
+// Parameters:
+//   - x, y: The position of the lower left corner of the rectangle.
+//   - width, height: The size of the rectangle in points.
+//   - img: The image.
+func (p *PdfPage) Image(x float64, y float64, width float64, height float64, img image.Image) {
+	p.drawImage(x, y, width, height, newPdfImage(img))
+}
+
+// drawImage draws an image XObject scaled to a rectangle.
+func (p *PdfPage) drawImage(x float64, y float64, width float64, height float64, xobject pdfStream) {
+	p.images = append(p.images, xobject)
+	fmt.Fprintf(&p.content, "q %s 0 0 %s %s %s cm /Im%d Do Q\n", formatPdfNumber(width), formatPdfNumber(height),
+		formatPdfNumber(x), formatPdfNumber(y), len(p.images))
+}
+
+// fontResource returns the resource name of a font, adding it to the page on first use.
+func (p *PdfPage) fontResource(font string) string {
+	for i, name := range p.fonts {
+		if name == font {
+			return fmt.Sprintf("F%d", i+1)
+		}
+	}
+	p.fonts = append(p.fonts, font)
+	return fmt.Sprintf("F%d", len(p.fonts))
+}
+
+// encodeWinAnsi encodes a text in the WinAnsi encoding of the standard fonts.
+func encodeWinAnsi(text string) []byte {
+	result := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r == '\t':
+			result = append(result, ' ')
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			result = append(result, byte(r))
+		default:
+			if b, ok := winAnsiSpecials[r]; ok {
+				result = append(result, b)
+			} else {
+				result = append(result, '?')
+			}
+		}
+	}
+	return result
+}
+
+// WritePdf writes a new PDF document with the pages.
+//
+// Parameters:
+//   - pages: The pages of the document.
+//
+// Returns:
+//   - []byte: The contents of the PDF document.
+func WritePdf(pages []*PdfPage) []byte {
+	w := newPdfObjectWriter(len(PDF_HEADER), 1)
+	pagesRef := w.reserve()
+	catalogRef := w.reserve()
+
+	kids := pdfArray{}
+	for _, page := range pages {
+		kids = append(kids, w.writePage(page, pagesRef))
+	}
+
+	w.write(pagesRef, pdfDict{"Type": pdfName("Pages"), "Kids": kids, "Count": len(kids)})
+	w.write(catalogRef, pdfDict{"Type": pdfName("Catalog"), "Pages": pagesRef})
+	w.writeXrefTable(pdfDict{"Root": catalogRef}, -1)
+
+	return append([]byte(PDF_HEADER), w.buf.Bytes()...)
+}
+
+// PrependPages adds pages before the first page of the document.
+// The document is not rewritten, the pages and the new root of the page tree
+// are appended to it in an incremental update, with a cross-reference
+// section of the same kind as the last one of the document.
+//
+// Parameters:
+//   - pages: The pages to add.
+//
+// Returns:
+//   - []byte: The contents of the updated PDF document.
+//   - error: ErrPdfDamaged if the page tree can't be read.
+func (d *PdfDocument) PrependPages(pages ...*PdfPage) ([]byte, error) {
+	pagesRef, pagesDict, err := d.pagesRoot()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPdfDamaged, err)
+	}
+
+	kids, err := d.resolve(pagesDict["Kids"])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPdfDamaged, err)
+	}
+	kidsArray, ok := kids.(pdfArray)
+	if !ok {
+		return nil, fmt.Errorf("%w: the page tree has no kids", ErrPdfDamaged)
+	}
+
+	count, err := d.PageCount()
+	if err != nil {
+		return nil, err
+	}
+
+	nextID, _ := pdfInt(d.trailer["Size"])
+	for id := range d.xref {
+		if id >= nextID {
+			nextID = id + 1
+		}
+	}
+
+	var out bytes.Buffer
+	out.Write(d.data)
+	if len(d.data) > 0 && d.data[len(d.data)-1] != '\n' && d.data[len(d.data)-1] != '\r' {
+		out.WriteByte('\n')
+	}
+
+	w := newPdfObjectWriter(out.Len(), nextID)
+	newKids := pdfArray{}
+	for _, page := range pages {
+		newKids = append(newKids, w.writePage(page, pagesRef))
+	}
+
+	updatedPages := pdfDict{}
+	for key, value := range pagesDict {
+		updatedPages[key] = value
+	}
+	updatedPages["Kids"] = append(newKids, kidsArray...)
+	updatedPages["Count"] = count + len(pages)
+	w.write(pagesRef, updatedPages)
+
+	trailer := pdfDict{}
+	for _, key := range []pdfName{"Root", "Info", "ID"} {
+		if value, ok := d.trailer[key]; ok {
+			trailer[key] = value
+		}
+	}
+
+	switch {
+	case d.reconstructed:
+		for id, entry := range d.xref {
+			if _, ok := w.entries[id]; !ok && !entry.free {
+				w.entries[id] = entry
+			}
+		}
+		w.writeXrefStream(trailer, -1)
+	case d.xrefStream:
+		w.writeXrefStream(trailer, d.startXref)
+	default:
+		w.writeXrefTable(trailer, d.startXref)
+	}
+
+	out.Write(w.buf.Bytes())
+	return out.Bytes(), nil
+}
+
+// pdfObjectWriter writes indirect objects and the cross-reference section
+// listing them, at the end of a document or of a new one.
+type pdfObjectWriter struct {
+	buf     bytes.Buffer
+	base    int
+	nextID  int
+	entries map[int]pdfXrefEntry
+}
+
+// newPdfObjectWriter creates a new pdfObjectWriter.
+//
+// Parameters:
+//   - base: The offset in the document of the first written byte.
+//   - nextID: The first free object ID.
+//
+// Returns:
+//   - *pdfObjectWriter: The created writer.
+func newPdfObjectWriter(base int, nextID int) *pdfObjectWriter {
+	return &pdfObjectWriter{
+		base:    base,
+		nextID:  nextID,
+		entries: map[int]pdfXrefEntry{},
+	}
+}
+
+// reserve reserves the ID of a new object.
+func (w *pdfObjectWriter) reserve() pdfRef {
+	ref := pdfRef{ID: w.nextID}
+	w.nextID++
+	return ref
+}
+
+// write writes an indirect object and records its offset.
+func (w *pdfObjectWriter) write(ref pdfRef, object interface{}) {
+	w.entries[ref.ID] = pdfXrefEntry{offset: w.base + w.buf.Len(), generation: ref.Generation}
+
+	fmt.Fprintf(&w.buf, "%d %d obj\n", ref.ID, ref.Generation)
+	writePdfObject(&w.buf, object)
+	w.buf.WriteString("\nendobj\n")
+}
+
+// writePage writes a page, its content stream and its images.
+//
+// Parameters:
+//   - page: The page.
+//   - parent: The node of the page tree the page is added to.
+//
+// Returns:
+//   - pdfRef: The reference to the written page.
+func (w *pdfObjectWriter) writePage(page *PdfPage, parent pdfRef) pdfRef {
+	contentRef := w.reserve()
+	w.write(contentRef, pdfStream{Dict: pdfDict{"Filter": pdfName("FlateDecode")}, Data: deflate(page.content.Bytes())})
+
+	fonts := pdfDict{}
+	for i, font := range page.fonts {
+		fonts[pdfName(fmt.Sprintf("F%d", i+1))] = pdfDict{
+			"Type":     pdfName("Font"),
+			"Subtype":  pdfName("Type1"),
+			"BaseFont": pdfName(font),
+			"Encoding": pdfName("WinAnsiEncoding"),
+		}
+	}
+
+	images := pdfDict{}
+	for i, image := range page.images {
+		imageRef := w.reserve()
+		w.write(imageRef, image)
+		images[pdfName(fmt.Sprintf("Im%d", i+1))] = imageRef
+	}
+
+	pageRef := w.reserve()
+	w.write(pageRef, pdfDict{
+		"Type":      pdfName("Page"),
+		"Parent":    parent,
+		"MediaBox":  pdfArray{0, 0, page.size.Width, page.size.Height},
+		"Resources": pdfDict{"Font": fonts, "XObject": images},
+		"Contents":  contentRef,
+	})
+	return pageRef
+}
+
+// sortedIDs returns the IDs of the written objects in increasing order.
+func (w *pdfObjectWriter) sortedIDs() []int {
+	ids := make([]int, 0, len(w.entries))
+	for id := range w.entries {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// writeXrefTable writes a cross-reference table and its trailer.
+//
+// Parameters:
+//   - trailer: The entries of the trailer, the size and the previous section are added.
+//   - prev: The offset of the previous cross-reference section, -1 for a new document.
+func (w *pdfObjectWriter) writeXrefTable(trailer pdfDict, prev int) {
+	offset := w.base + w.buf.Len()
+	w.buf.WriteString("xref\n")
+
+	ids := w.sortedIDs()
+	if prev < 0 {
+		ids = append([]int{0}, ids...)
+	}
+
+	for start := 0; start < len(ids); {
+		end := start + 1
+		for end < len(ids) && ids[end] == ids[end-1]+1 {
+			end++
+		}
+
+		fmt.Fprintf(&w.buf, "%d %d\n", ids[start], end-start)
+		for _, id := range ids[start:end] {
+			if id == 0 {
+				w.buf.WriteString("0000000000 65535 f \n")
+				continue
+			}
+			entry := w.entries[id]
+			fmt.Fprintf(&w.buf, "%010d %05d n \n", entry.offset, entry.generation)
+		}
+		start = end
+	}
+
+	trailer["Size"] = w.nextID
+	if prev >= 0 {
+		trailer["Prev"] = prev
+	}
+	w.buf.WriteString("trailer\n")
+	writePdfObject(&w.buf, trailer)
+	fmt.Fprintf(&w.buf, "\nstartxref\n%d\n%%%%EOF\n", offset)
+}
+
+// writeXrefStream writes a cross-reference stream, it is used to update
+// documents whose last cross-reference section is a stream.
+//
+// Parameters:
+//   - trailer: The entries of the trailer, the size and the previous section are added.
+//   - prev: The offset of the previous cross-reference section, -1 for none.
+func (w *pdfObjectWriter) writeXrefStream(trailer pdfDict, prev int) {
+	streamRef := w.reserve()
+	offset := w.base + w.buf.Len()
+	w.entries[streamRef.ID] = pdfXrefEntry{offset: offset}
+
+	ids := w.sortedIDs()
+	index := pdfArray{}
+	var data bytes.Buffer
+	for start := 0; start < len(ids); {
+		end := start + 1
+		for end < len(ids) && ids[end] == ids[end-1]+1 {
+			end++
+		}
+		index = append(index, ids[start], end-start)
+
+		for _, id := range ids[start:end] {
+			entry := w.entries[id]
+			kind, field2, field3 := 1, entry.offset, entry.generation
+			if entry.compressed {
+				kind, field3 = 2, entry.index
+			}
+			data.Write([]byte{byte(kind),
+				byte(field2 >> 24), byte(field2 >> 16), byte(field2 >> 8), byte(field2),
+				byte(field3 >> 8), byte(field3)})
+		}
+		start = end
+	}
+
+	dict := pdfDict{}
+	for key, value := range trailer {
+		dict[key] = value
+	}
+	dict["Type"] = pdfName("XRef")
+	dict["Size"] = w.nextID
+	dict["W"] = pdfArray{1, 4, 2}
+	dict["Index"] = index
+	if prev >= 0 {
+		dict["Prev"] = prev
+	}
+
+	fmt.Fprintf(&w.buf, "%d %d obj\n", streamRef.ID, streamRef.Generation)
+	writePdfObject(&w.buf, pdfStream{Dict: dict, Data: data.Bytes()})
+	fmt.Fprintf(&w.buf, "\nendobj\nstartxref\n%d\n%%%%EOF\n", offset)
+}
+
+// deflate compresses data with the Flate filter.
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	writer := zlib.NewWriter(&buf)
+	writer.Write(data)
+	writer.Close()
+	return buf.Bytes()
+}
@@ -0,0 +1,407 @@
+package document
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"faxsender/src/utilities"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"golang.org/x/image/tiff"
+)
+
+// Constants for the preview of documents.
+const (
+	// PREVIEW_RENDER_TIMEOUT is the maximum duration of the rendering of a PDF page.
+	PREVIEW_RENDER_TIMEOUT = 30 * time.Second
+
+	// PREVIEW_MAX_TIFF_PAGES limits the pages read from a TIFF image, a
+	// damaged file may link its directories in a loop.
+	PREVIEW_MAX_TIFF_PAGES = 10000
+
+	// PDF_RENDERER_INPUT_NAME is the name of the PDF document given to the
+	// PDF renderer and PDF_RENDERER_OUTPUT_NAME the name, without extension,
+	// of the image it writes.
+	PDF_RENDERER_INPUT_NAME  = "document.pdf"
+	PDF_RENDERER_OUTPUT_NAME = "page"
+)
+
+// Errors returned by the preview of documents.
+var (
+	ErrPreviewUnsupported  = errors.New("documents of this type can't be previewed")
+	ErrRendererUnavailable = errors.New("no PDF renderer is installed to draw the pages")
+)
+
+// pdfRendererNames are the commands searched in the PATH to render PDF pages.
+var pdfRendererNames = []string{"pdftoppm"}
+
+// tiffPage is a page of a TIFF image.
+type tiffPage struct {
+	offset      uint32
+	width       int
+	height      int
+	xResolution float64
+	yResolution float64
+}
+
+// DocumentPreview reads the pages of a document to show them before it is sent.
+// PDF documents, TIFF images and PNG or JPEG images can be previewed. The
+// pages of the PDF documents are rendered by pdftoppm, without it they are
+// shown as blank pages of their size. A preview isn't safe for concurrent use.
+type DocumentPreview struct {
+	contents    []byte
+	contentType string
+
+	pdfPageSizes []PageSize
+	tiffPages    []tiffPage
+	tiffOrder    binary.ByteOrder
+	image        image.Image
+
+	pdfRenderer string
+	tempDir     string
+}
+
+// CanPreview reports whether documents of a content type can be previewed.
+//
+// Parameters:
+//   - contentType: The content type of the document.
+//
+// Returns:
+//   - bool: true for PDF documents, TIFF images and PNG or JPEG images.
+func CanPreview(contentType string) bool {
+	switch contentType {
+	case utilities.PDF_CONTENT_TYPE, utilities.TIFF_CONTENT_TYPE,
+		utilities.PNG_CONTENT_TYPE, utilities.JPEG_CONTENT_TYPE, utilities.JPG_CONTENT_TYPE:
+		return true
+	}
+	return false
+}
+
+// NewDocumentPreview reads the pages of a document.
+//
+// Parameters:
+//   - contents: The contents of the document.
+//   - contentType: The content type of the document.
+//
+// Returns:
+//   - *DocumentPreview: The preview, Close must be called once it is unused.
+//   - error: ErrPreviewUnsupported for other content types, or the error reading the document.
+func NewDocumentPreview(contents []byte, contentType string) (*DocumentPreview, error) {
+	p := &DocumentPreview{
+		contents:    contents,
+		contentType: contentType,
+	}
+
+	switch contentType {
+	case utilities.PDF_CONTENT_TYPE:
+		doc, err := ParsePdf(contents)
+		if err != nil {
+			return nil, err
+		}
+		if p.pdfPageSizes, err = doc.PageSizes(); err != nil {
+			return nil, err
+		}
+	case utilities.TIFF_CONTENT_TYPE:
+		if err := p.readTiffPages(); err != nil {
+			return nil, err
+		}
+	case utilities.PNG_CONTENT_TYPE, utilities.JPEG_CONTENT_TYPE, utilities.JPG_CONTENT_TYPE:
+		img, _, err := image.Decode(bytes.NewReader(contents))
+		if err != nil {
+			return nil, fmt.Errorf("the image can't be read: %v", err)
+		}
+		p.image = img
+	default:
+		return nil, fmt.Errorf("%w: '%s'", ErrPreviewUnsupported, contentType)
+	}
+	return p, nil
+}
+
+// PageCount returns the number of pages of the document.
+func (p *DocumentPreview) PageCount() int {
+	switch {
+	case p.pdfPageSizes != nil:
+		return len(p.pdfPageSizes)
+	case p.tiffPages != nil:
+		return len(p.tiffPages)
+	}
+	return 1
+}
+
+// Thumbnail draws a page of the document scaled down to fit a square.
+//
+// Parameters:
+//   - ctx: The context of the rendering, cancelling it stops the PDF renderer.
+//   - page: The index of the page, from 0.
+//   - size: The side of the square in pixels.
+//
+// Returns:
+//   - image.Image: The thumbnail of the page.
+//   - error: ErrRendererUnavailable if pdftoppm isn't installed, or the error drawing the page.
+func (p *DocumentPreview) Thumbnail(ctx context.Context, page int, size int) (image.Image, error) {
+	if page < 0 || page >= p.PageCount() {
+		return nil, fmt.Errorf("the document has no page %d", page+1)
+	}
+
+	switch {
+	case p.pdfPageSizes != nil:
+		return p.renderPdfPage(ctx, page, size)
+	case p.tiffPages != nil:
+		return p.decodeTiffPage(page, size)
+	}
+	return scaleThumbnail(p.image, 1, size), nil
+}
+
+// PlaceholderThumbnail draws a blank page of the size of a page of the
+// document, for the pages that can't be drawn.
+//
+// Parameters:
+//   - page: The index of the page, from 0.
+//   - size: The side of the square the page fits in, in pixels.
+//
+// Returns:
+//   - image.Image: The blank page with a gray border.
+func (p *DocumentPreview) PlaceholderThumbnail(page int, size int) image.Image {
+	pageSize := PAGE_SIZE_A4
+	switch {
+	case page >= 0 && page < len(p.pdfPageSizes):
+		pageSize = p.pdfPageSizes[page]
+	case page >= 0 && page < len(p.tiffPages) && p.tiffPages[page].width > 0 && p.tiffPages[page].height > 0:
+		tiffPage := p.tiffPages[page]
+		pageSize = PageSize{Width: float64(tiffPage.width) / tiffPage.xResolution, Height: float64(tiffPage.height) / tiffPage.yResolution}
+	}
+
+	scale := float64(size) / math.Max(pageSize.Width, pageSize.Height)
+	width := maxInt(2, int(pageSize.Width*scale))
+	height := maxInt(2, int(pageSize.Height*scale))
+
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			value := uint8(255)
+			if x == 0 || y == 0 || x == width-1 || y == height-1 {
+				value = 160
+			}
+			img.SetGray(x, y, color.Gray{Y: value})
+		}
+	}
+	return img
+}
+
+// Close removes the temporary files of the preview.
+func (p *DocumentPreview) Close() {
+	if p.tempDir != "" {
+		_ = os.RemoveAll(p.tempDir)
+		p.tempDir = ""
+	}
+}
+
+// renderPdfPage renders a page of a PDF document with pdftoppm.
+// Steps:
+// 1. Find pdftoppm.
+// 2. Write the document to a temporary directory, once for all pages.
+// 3. Render the page as a PNG image scaled to the thumbnail size and read it.
+func (p *DocumentPreview) renderPdfPage(ctx context.Context, page int, size int) (image.Image, error) {
+	if p.pdfRenderer == "" {
+		for _, name := range pdfRendererNames {
+			if rendererPath, err := exec.LookPath(name); err == nil {
+				p.pdfRenderer = rendererPath
+				break
+			}
+		}
+		if p.pdfRenderer == "" {
+			return nil, ErrRendererUnavailable
+		}
+	}
+
+	if p.tempDir == "" {
+		dir, err := os.MkdirTemp("", "faxsender-preview-")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(dir, PDF_RENDERER_INPUT_NAME), p.contents, 0600); err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, err
+		}
+		p.tempDir = dir
+	}
+
+	// The image of the previous page is removed, so it isn't read if the renderer fails silently.
+	outputPath := filepath.Join(p.tempDir, PDF_RENDERER_OUTPUT_NAME)
+	_ = os.Remove(outputPath + "." + utilities.PNG_FILE_EXTENSION)
+
+	pageNumber := strconv.Itoa(page + 1)
+	err := utilities.ExecuteOnTerminalWithTimeout(ctx, PREVIEW_RENDER_TIMEOUT, p.pdfRenderer, "-f", pageNumber, "-l", pageNumber,
+		"-singlefile", "-png", "-scale-to", strconv.Itoa(size), filepath.Join(p.tempDir, PDF_RENDERER_INPUT_NAME), outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("the page %d can't be rendered: %v", page+1, err)
+	}
+
+	file, err := os.Open(outputPath + "." + utilities.PNG_FILE_EXTENSION)
+	if err != nil {
+		return nil, fmt.Errorf("the PDF renderer didn't draw the page %d", page+1)
+	}
+	defer file.Close()
+
+	return png.Decode(file)
+}
+
+// readTiffPages reads the image file directories of a TIFF image, the
+// offset, size and resolution of every page.
+func (p *DocumentPreview) readTiffPages() error {
+	if len(p.contents) < 8 {
+		return fmt.Errorf("the TIFF image is truncated")
+	}
+
+	switch string(p.contents[:4]) {
+	case "II\x2a\x00":
+		p.tiffOrder = binary.LittleEndian
+	case "MM\x00\x2a":
+		p.tiffOrder = binary.BigEndian
+	default:
+		return fmt.Errorf("the document isn't a TIFF image")
+	}
+
+	p.tiffPages = make([]tiffPage, 0, 1)
+	for offset := p.tiffOrder.Uint32(p.contents[4:]); offset != 0; {
+		if len(p.tiffPages) == PREVIEW_MAX_TIFF_PAGES {
+			return fmt.Errorf("the TIFF image has more than %d pages", PREVIEW_MAX_TIFF_PAGES)
+		}
+
+		page, next, err := p.readTiffDirectory(offset)
+		if err != nil {
+			return err
+		}
+		p.tiffPages = append(p.tiffPages, page)
+		offset = next
+	}
+
+	if len(p.tiffPages) == 0 {
+		return fmt.Errorf("the TIFF image has no page")
+	}
+	return nil
+}
+
+// readTiffDirectory reads an image file directory of a TIFF image.
+//
+// Returns:
+//   - tiffPage: The page of the directory.
+//   - uint32: The offset of the next directory, 0 for the last page.
+//   - error: An error if the directory is truncated.
+func (p *DocumentPreview) readTiffDirectory(offset uint32) (tiffPage, uint32, error) {
+	page := tiffPage{offset: offset, xResolution: 1, yResolution: 1}
+	truncated := fmt.Errorf("the TIFF image is truncated")
+
+	start := int64(offset)
+	if start+2 > int64(len(p.contents)) {
+		return page, 0, truncated
+	}
+	count := int64(p.tiffOrder.Uint16(p.contents[start:]))
+	end := start + 2 + 12*count
+	if end+4 > int64(len(p.contents)) {
+		return page, 0, truncated
+	}
+
+	for entry := start + 2; entry < end; entry += 12 {
+		tag := p.tiffOrder.Uint16(p.contents[entry:])
+		valueType := p.tiffOrder.Uint16(p.contents[entry+2:])
+		value := p.contents[entry+8 : entry+12]
+
+		switch tag {
+		case tiffTagImageWidth, tiffTagImageLength:
+			size := int(p.tiffOrder.Uint32(value))
+			if valueType == tiffTypeShort {
+				size = int(p.tiffOrder.Uint16(value))
+			}
+			if tag == tiffTagImageWidth {
+				page.width = size
+			} else {
+				page.height = size
+			}
+		case tiffTagXResolution, tiffTagYResolution:
+			rational := int64(p.tiffOrder.Uint32(value))
+			if valueType != tiffTypeRational || rational+8 > int64(len(p.contents)) {
+				continue
+			}
+			numerator := p.tiffOrder.Uint32(p.contents[rational:])
+			denominator := p.tiffOrder.Uint32(p.contents[rational+4:])
+			if numerator == 0 || denominator == 0 {
+				continue
+			}
+			if tag == tiffTagXResolution {
+				page.xResolution = float64(numerator) / float64(denominator)
+			} else {
+				page.yResolution = float64(numerator) / float64(denominator)
+			}
+		}
+	}
+	return page, p.tiffOrder.Uint32(p.contents[end:]), nil
+}
+
+// decodeTiffPage decodes a page of a TIFF image. The decoder reads the
+// first page only, so it is given a copy whose header points to the page.
+// Pages of different horizontal and vertical resolutions, like fax pages,
+// are stretched to their proportions on paper.
+func (p *DocumentPreview) decodeTiffPage(page int, size int) (image.Image, error) {
+	contents := append([]byte{}, p.contents...)
+	p.tiffOrder.PutUint32(contents[4:], p.tiffPages[page].offset)
+
+	img, err := tiff.Decode(bytes.NewReader(contents))
+	if err != nil {
+		return nil, fmt.Errorf("the page %d can't be read: %v", page+1, err)
+	}
+
+	aspect := p.tiffPages[page].xResolution / p.tiffPages[page].yResolution
+	return scaleThumbnail(img, aspect, size), nil
+}
+
+// scaleThumbnail scales an image down to fit a square, every pixel is the
+// average of the pixels it covers. Transparent images are drawn on white.
+//
+// Parameters:
+//   - img: The image.
+//   - aspect: The height of a pixel of the image relative to its width.
+//   - size: The side of the square in pixels.
+//
+// Returns:
+//   - *image.RGBA: The thumbnail.
+func scaleThumbnail(img image.Image, aspect float64, size int) *image.RGBA {
+	bounds := img.Bounds()
+	sourceWidth, sourceHeight := bounds.Dx(), bounds.Dy()
+
+	width, height := float64(sourceWidth), float64(sourceHeight)*aspect
+	scale := math.Min(1, float64(size)/math.Max(width, height))
+	thumbnailWidth := maxInt(1, int(math.Round(width*scale)))
+	thumbnailHeight := maxInt(1, int(math.Round(height*scale)))
+
+	thumbnail := image.NewRGBA(image.Rect(0, 0, thumbnailWidth, thumbnailHeight))
+	for y := 0; y < thumbnailHeight; y++ {
+		y0, y1 := scaledSpan(y, thumbnailHeight, sourceHeight)
+		for x := 0; x < thumbnailWidth; x++ {
+			x0, x1 := scaledSpan(x, thumbnailWidth, sourceWidth)
+
+			var r, g, b int
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					white := 0xffff - pa
+					r, g, b = r+int((pr+white)>>8), g+int((pg+white)>>8), b+int((pb+white)>>8)
+				}
+			}
+
+			count := (y1 - y0) * (x1 - x0)
+			thumbnail.SetRGBA(x, y, color.RGBA{R: uint8(r / count), G: uint8(g / count), B: uint8(b / count), A: 255})
+		}
+	}
+	return thumbnail
+}
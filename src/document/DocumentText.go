@@ -0,0 +1,126 @@
+package document
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Constants for the layout of the pages converted from text files, in points.
+const (
+	TEXT_PAGE_MARGIN = 56.0
+	TEXT_FONT_SIZE   = 10.0
+	TEXT_LINE_HEIGHT = 12.0
+
+	// TEXT_TAB_WIDTH is the number of columns between two tab stops.
+	TEXT_TAB_WIDTH = 8
+)
+
+// TextToPdf converts a plain text file to a PDF document.
+// The text is drawn in Courier, long lines are wrapped and a form feed
+// starts a new page. UTF-8 and UTF-16 files with a byte order mark are
+// decoded, other files that aren't valid UTF-8 are read as Windows-1252.
+//
+// Parameters:
+//   - contents: The contents of the text file.
+//   - size: The size of the pages.
+//
+// Returns:
+//   - []byte: The contents of the PDF document, with one empty page for an empty file.
+func TextToPdf(contents []byte, size PageSize) []byte {
+	text := decodeText(contents)
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	text = strings.TrimRight(text, "\n\f")
+
+	maxChars := int((size.Width - 2*TEXT_PAGE_MARGIN) / (TEXT_FONT_SIZE * PDF_COURIER_CHAR_WIDTH))
+	top := size.Height - TEXT_PAGE_MARGIN
+
+	pages := []*PdfPage{NewPdfPage(size)}
+	y := top
+	for i, section := range strings.Split(text, "\f") {
+		if i > 0 {
+			pages = append(pages, NewPdfPage(size))
+			y = top
+		}
+
+		for _, line := range strings.Split(section, "\n") {
+			for _, wrapped := range WrapText(expandTabs(line), maxChars) {
+				y -= TEXT_LINE_HEIGHT
+				if y < TEXT_PAGE_MARGIN {
+					pages = append(pages, NewPdfPage(size))
+					y = top - TEXT_LINE_HEIGHT
+				}
+				if strings.TrimSpace(wrapped) != "" {
+					pages[len(pages)-1].Text(TEXT_PAGE_MARGIN, y, PDF_FONT_COURIER, TEXT_FONT_SIZE, wrapped)
+				}
+			}
+		}
+	}
+
+	return WritePdf(pages)
+}
+
+// decodeText decodes the contents of a text file into a string.
+func decodeText(contents []byte) string {
+	switch {
+	case bytes.HasPrefix(contents, []byte{0xEF, 0xBB, 0xBF}):
+		return string(contents[3:])
+	case bytes.HasPrefix(contents, []byte{0xFF, 0xFE}):
+		return decodeUtf16(contents[2:], false)
+	case bytes.HasPrefix(contents, []byte{0xFE, 0xFF}):
+		return decodeUtf16(contents[2:], true)
+	case utf8.Valid(contents):
+		return string(contents)
+	}
+
+	winAnsi := make(map[byte]rune, len(winAnsiSpecials))
+	for r, b := range winAnsiSpecials {
+		winAnsi[b] = r
+	}
+
+	runes := make([]rune, 0, len(contents))
+	for _, b := range contents {
+		if r, ok := winAnsi[b]; ok {
+			runes = append(runes, r)
+		} else {
+			runes = append(runes, rune(b))
+		}
+	}
+	return string(runes)
+}
+
+// decodeUtf16 decodes UTF-16 text in the given byte order.
+func decodeUtf16(contents []byte, bigEndian bool) string {
+	units := make([]uint16, 0, len(contents)/2)
+	for i := 0; i+1 < len(contents); i += 2 {
+		if bigEndian {
+			units = append(units, uint16(contents[i])<<8|uint16(contents[i+1]))
+		} else {
+			units = append(units, uint16(contents[i+1])<<8|uint16(contents[i]))
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// expandTabs replaces the tabs of a line with spaces up to the next tab stop.
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+
+	var expanded strings.Builder
+	column := 0
+	for _, r := range line {
+		if r == '\t' {
+			spaces := TEXT_TAB_WIDTH - column%TEXT_TAB_WIDTH
+			expanded.WriteString(strings.Repeat(" ", spaces))
+			column += spaces
+			continue
+		}
+		expanded.WriteRune(r)
+		column++
+	}
+	return expanded.String()
+}
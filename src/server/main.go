@@ -1,13 +1,17 @@
 package main
 
 import (
+	"crypto/tls"
 	"faxsender/src/api"
 	"faxsender/src/utilities"
 	"faxsender/src/utilities/config"
 	"faxsender/src/utilities/logger"
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -80,33 +84,96 @@ func InitLogConfig() {
 //
 // This function retrieves the server configuration, initializes a Gin router,
 // sets up API routes using the InitRouters function from the api package,
-// and then starts the server by calling the listenWithoutCertificates function.
+// resumes the fax jobs left unfinished by a previous run, starts the scheduler
+// of the scheduled faxes, the workers of the outbound queue and the sync of the
+// fax history, and then starts the server by calling the listenWithCertificates
+// function when TLS is enabled, or the listenWithoutCertificates function.
 //
-// It logs an informational message indicating the port on which the server is
-// about to listen before initiating the server startup process.
+// The routes require the API token, generated at the first start. It logs an
+// informational message indicating the address on which the server is about to
+// listen before initiating the server startup process, and a warning when the
+// address isn't a loopback address. Without a configured certificate, a
+// self-signed certificate is generated at the first start.
 func StartServer() {
 	cfg := *config.Inst()
 	port := cfg.GetPortNumber()
+	bindAddress := cfg.GetBindAddress()
+
+	apiToken, err := api.LoadOrCreateApiToken()
+	if err != nil {
+		logger.Inst().Error(fmt.Sprintf("failed to load the API token: %v", err))
+		os.Exit(utilities.ERROR_CODE_API_TOKEN_NOT_AVAILABLE)
+	}
 
 	router := gin.Default()
-	api.InitRouters(router)
+	api.InitRouters(router, apiToken)
+	api.ResumeUnfinishedFaxJobs()
+	api.StartFaxScheduler()
+	api.StartFaxQueue()
+	api.StartSentFaxFollower()
+	api.StartFaxHistorySync()
+	api.StartWebhookDeliveries()
+
+	if ip := net.ParseIP(bindAddress); bindAddress != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		logger.Inst().Warn(fmt.Sprintf("the server listens on %s, other hosts can reach it", bindAddress))
+	}
+
+	if !cfg.GetTLS() {
+		logger.Inst().Info(fmt.Sprintf("going to listen on %s port %d", bindAddress, port))
+		listenWithoutCertificates(router, bindAddress, port)
+		return
+	}
+
+	certificate, err := api.LoadOrCreateTLSCertificate(cfg.GetTLSCertFile(), cfg.GetTLSKeyFile(), bindAddress)
+	if err != nil {
+		logger.Inst().Error(fmt.Sprintf("failed to load the TLS certificate: %v", err))
+		os.Exit(utilities.ERROR_CODE_TLS_CERTIFICATE_NOT_AVAILABLE)
+	}
+
+	logger.Inst().Info(fmt.Sprintf("going to listen on %s port %d with TLS %s or later", bindAddress, port, cfg.GetTLSMinVersion()))
+	listenWithCertificates(router, bindAddress, port, api.NewServerTLSConfig(certificate, cfg.GetTLSMinVersion()))
+}
+
+// listenWithCertificates starts the HTTPS server to listen on the specified address and port.
+//
+// Parameters:
+//   - router: A pointer to a Gin Engine instance, which represents the HTTP router.
+//   - bindAddress: The IP address or host name on which the server will listen.
+//   - port: An integer specifying the port on which the server will listen.
+//   - tlsConfig: The TLS configuration holding the certificate and the minimum TLS version.
+//
+// Returns:
+//
+//	This function does not return any values. If an error occurs during server startup,
+//	an error message is logged using the application-wide logger.
+func listenWithCertificates(router *gin.Engine, bindAddress string, port int, tlsConfig *tls.Config) {
+	server := &http.Server{
+		Addr:      net.JoinHostPort(bindAddress, strconv.Itoa(port)),
+		Handler:   router,
+		TLSConfig: tlsConfig,
+	}
 
-	logger.Inst().Info(fmt.Sprintf("going to listen on port %d", port))
-	listenWithoutCertificates(router, port)
+	// The certificate is in the TLS configuration, not in files.
+	err := server.ListenAndServeTLS("", "")
+	if err != nil {
+		logger.Inst().Error(fmt.Sprintf("failed to start the server:%v", err))
+		return
+	}
 }
 
-// listenWithoutCertificates starts the server to listen on the specified port.
+// listenWithoutCertificates starts the server to listen on the specified address and port.
 //
 // Parameters:
 //   - router: A pointer to a Gin Engine instance, which represents the HTTP router.
+//   - bindAddress: The IP address or host name on which the server will listen.
 //   - port: An integer specifying the port on which the server will listen.
 //
 // Returns:
 //
 //	This function does not return any values. If an error occurs during server startup,
 //	an error message is logged using the application-wide logger.
-func listenWithoutCertificates(router *gin.Engine, port int) {
-	err := router.Run(fmt.Sprintf("0.0.0.0:%d", port))
+func listenWithoutCertificates(router *gin.Engine, bindAddress string, port int) {
+	err := router.Run(net.JoinHostPort(bindAddress, strconv.Itoa(port)))
 	if err != nil {
 		logger.Inst().Error(fmt.Sprintf("failed to start the server:%v", err))
 		return
@@ -1,6 +1,7 @@
 package tabs
 
 import (
+	"context"
 	"faxsender/src/api"
 	"fmt"
 
@@ -117,7 +118,7 @@ func (a *AccountsInfoTab) initUI() {
 // Returns:
 //   - bool: True if data is loaded successfully, false otherwise.
 func (a *AccountsInfoTab) loadData() bool {
-	account_info, err := (*a.api).GetAccountInfo()
+	account_info, err := (*a.api).GetAccountInfo(context.Background())
 	if err != nil {
 		return false
 	}
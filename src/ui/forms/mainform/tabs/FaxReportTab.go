@@ -1,9 +1,13 @@
 package tabs
 
 import (
+	"context"
 	"faxsender/src/api"
 	"faxsender/src/ui/forms"
+	"faxsender/src/utilities/logger"
 	"fmt"
+	"strings"
+	"time"
 
 	"fyne.io/fyne"
 	"fyne.io/fyne/container"
@@ -12,7 +16,13 @@ import (
 	"fyne.io/fyne/widget"
 )
 
-const NUMBER_OF_FAXES = 10
+// Constants for the filters of the fax report.
+const (
+	REPORT_DATE_FORMAT      = "2006-01-02"
+	REPORT_ALL_STATUSES     = "All statuses"
+	REPORT_DATE_PLACEHOLDER = "YYYY-MM-DD"
+	REPORT_PAGE_SIZE        = 25
+)
 
 // FaxReportTab is a tab for displaying outbound fax reports.
 type FaxReportTab struct {
@@ -23,11 +33,24 @@ type FaxReportTab struct {
 	mainContainer *fyne.Container
 
 	headerContainer *fyne.Container
+	filterContainer *fyne.Container
 	faxList         *fyne.Container
 	updateButton    *widget.Button
+	searchButton    *widget.Button
+	previousButton  *widget.Button
+	nextButton      *widget.Button
+	pageLabel       *widget.Label
+
+	fromEntry    *widget.Entry
+	toEntry      *widget.Entry
+	numberEntry  *widget.Entry
+	titleEntry   *widget.Entry
+	statusSelect *widget.Select
 
 	ITab
-	lastFaxes []api.FaxData
+	lastFaxes []api.FaxHistoryRecord
+	offset    int
+	total     int
 }
 
 // NewFaxReportTab creates a new instance of FaxReportTab.
@@ -49,7 +72,9 @@ func NewFaxReportTab(apiInst *api.IApiUICalls, parent *fyne.Window) *FaxReportTa
 //
 // Steps:
 // 1. Create and configure UI components such as labels, buttons, and containers.
-// 2. Set up the layout of the components using containers and layouts.
+// 2. Create the filters of the search over the local fax history.
+// 3. Create the buttons stepping through the pages of found faxes.
+// 4. Set up the layout of the components using containers and layouts.
 //
 // Parameters:
 //
@@ -59,6 +84,7 @@ func NewFaxReportTab(apiInst *api.IApiUICalls, parent *fyne.Window) *FaxReportTa
 //
 //	None
 func (f *FaxReportTab) initUI() {
+	f.initFilters()
 
 	f.headerContainer = fyne.NewContainerWithLayout(layout.NewGridLayoutWithColumns(5),
 		widget.NewLabel("Date and Time"),
@@ -71,50 +97,157 @@ func (f *FaxReportTab) initUI() {
 	f.updateButton = widget.NewButton("Update", f.onLoadClick)
 	f.updateButton.Icon = theme.DownloadIcon()
 
+	f.searchButton = widget.NewButton("Search", f.onSearchClick)
+	f.searchButton.Icon = theme.SearchIcon()
+
+	f.previousButton = widget.NewButton("Previous", f.onPreviousClick)
+	f.previousButton.Icon = theme.NavigateBackIcon()
+
+	f.nextButton = widget.NewButton("Next", f.onNextClick)
+	f.nextButton.Icon = theme.NavigateNextIcon()
+
+	f.pageLabel = widget.NewLabel("")
+	f.updatePager()
+
 	f.faxList = container.NewVBox()
 
 	f.mainContainer = container.NewGridWithRows(1,
-		container.NewVScroll(container.NewVBox(container.NewHBox(f.updateButton),
+		container.NewVScroll(container.NewVBox(container.NewHBox(f.updateButton, f.searchButton),
+			f.filterContainer,
 			f.headerContainer,
 			f.faxList,
+			container.NewHBox(f.previousButton, f.pageLabel, f.nextButton),
 		)),
 	)
 }
 
-// loadData fetches the latest fax data from the API.
+// initFilters initializes the filters of the fax history search.
+func (f *FaxReportTab) initFilters() {
+	f.fromEntry = widget.NewEntry()
+	f.fromEntry.SetPlaceHolder("From " + REPORT_DATE_PLACEHOLDER)
+
+	f.toEntry = widget.NewEntry()
+	f.toEntry.SetPlaceHolder("To " + REPORT_DATE_PLACEHOLDER)
+
+	f.numberEntry = widget.NewEntry()
+	f.numberEntry.SetPlaceHolder("Fax Number")
+
+	f.titleEntry = widget.NewEntry()
+	f.titleEntry.SetPlaceHolder("Title")
+
+	f.statusSelect = widget.NewSelect([]string{
+		REPORT_ALL_STATUSES,
+		api.ICT_STATUS_DONE,
+		api.ICT_STATUS_COMPLETED,
+		api.ICT_STATUS_FAILED,
+		api.ICT_STATUS_BUSY,
+		api.ICT_STATUS_NO_ANSWER,
+	}, nil)
+	f.statusSelect.SetSelected(REPORT_ALL_STATUSES)
+
+	f.filterContainer = container.NewGridWithColumns(5, f.fromEntry, f.toEntry, f.numberEntry, f.titleEntry, f.statusSelect)
+}
+
+// buildQuery builds the fax history query of the current page from the filters.
+// The "To" date is included, the query ends at the start of the next day.
+//
+// Returns:
+//   - api.FaxHistoryQuery: The query of the filters.
+//   - error: An error if a date is not in the YYYY-MM-DD format.
+func (f *FaxReportTab) buildQuery() (api.FaxHistoryQuery, error) {
+	query := api.FaxHistoryQuery{
+		Number: strings.TrimSpace(f.numberEntry.Text),
+		Title:  strings.TrimSpace(f.titleEntry.Text),
+		Offset: f.offset,
+		Limit:  REPORT_PAGE_SIZE,
+	}
+
+	if f.statusSelect.Selected != REPORT_ALL_STATUSES {
+		query.Status = f.statusSelect.Selected
+	}
+
+	if text := strings.TrimSpace(f.fromEntry.Text); text != "" {
+		from, err := time.ParseInLocation(REPORT_DATE_FORMAT, text, time.Local)
+		if err != nil {
+			return query, fmt.Errorf("the from date '%s' is not in the %s format", text, REPORT_DATE_PLACEHOLDER)
+		}
+		query.From = from
+	}
+
+	if text := strings.TrimSpace(f.toEntry.Text); text != "" {
+		to, err := time.ParseInLocation(REPORT_DATE_FORMAT, text, time.Local)
+		if err != nil {
+			return query, fmt.Errorf("the to date '%s' is not in the %s format", text, REPORT_DATE_PLACEHOLDER)
+		}
+		query.To = to.AddDate(0, 0, 1)
+	}
+
+	return query, nil
+}
+
+// loadData searches the current page of the local fax history with the filters.
 //
 // Steps:
-// 1. Call the API to retrieve the latest fax data.
-// 2. Handle any errors during the data retrieval process.
+// 1. Build the query from the filters.
+// 2. Call the API to search the fax history.
+// 3. Handle any errors during the data retrieval process.
+// 4. Keep the found faxes and their total number for the pager.
 //
 // Returns:
 //   - bool: True if data is loaded successfully, false otherwise.
 func (f *FaxReportTab) loadData() bool {
-	Faxes, err := (*f.api).GetLastFaxes(NUMBER_OF_FAXES)
-	f.lastFaxes = Faxes
+	query, err := f.buildQuery()
 	if err != nil {
-		fmt.Println("Error fetching data:", err)
-		// Handle error (log, display a message, etc.)
+		logger.Inst().Error(err.Error())
 		return false
 	}
 
+	page, err := (*f.api).SearchFaxHistory(context.Background(), query)
+	if err != nil {
+		logger.Inst().Error(fmt.Sprintf("error searching the fax history: %v", err))
+		return false
+	}
+
+	f.lastFaxes = page.Records
+	f.total = page.Total
 	return true
 }
 
-// loadDataIntoUI populates the UI components with the fetched fax data.
+// updatePager shows the current page and enables the buttons of the pages that exist.
+func (f *FaxReportTab) updatePager() {
+	pages := (f.total + REPORT_PAGE_SIZE - 1) / REPORT_PAGE_SIZE
+	if pages == 0 {
+		pages = 1
+	}
+	f.pageLabel.SetText(fmt.Sprintf("Page %d of %d (%d faxes)", f.offset/REPORT_PAGE_SIZE+1, pages, f.total))
+
+	if f.offset > 0 {
+		f.previousButton.Enable()
+	} else {
+		f.previousButton.Disable()
+	}
+
+	if f.offset+REPORT_PAGE_SIZE < f.total {
+		f.nextButton.Enable()
+	} else {
+		f.nextButton.Disable()
+	}
+}
+
+// loadDataIntoUI populates the UI components with the found faxes.
 //
 // Parameters:
-//   - lastFaxes: A slice containing the latest fax data.
+//   - lastFaxes: A slice containing the faxes of the fax history.
 //
 // Returns:
 //
 //	None
-func (f *FaxReportTab) loadDataIntoUI(lastFaxes []api.FaxData) {
+func (f *FaxReportTab) loadDataIntoUI(lastFaxes []api.FaxHistoryRecord) {
 	f.faxList.Objects = nil
 
 	for _, fax := range lastFaxes {
 		labels := []fyne.CanvasObject{
-			widget.NewLabel(fax.DateTime.Format("2006_01_02 15:04:05")),
+			widget.NewLabel(fax.SentAt.Local().Format("2006_01_02 15:04:05")),
 			widget.NewLabel(fax.Title),
 			widget.NewLabel(fax.DestinationFax),
 			widget.NewLabel(fax.CallerID),
@@ -151,8 +284,9 @@ func (f *FaxReportTab) IsDataLoaded() bool {
 // onLoadClick is the callback function for the update button.
 //
 // Steps:
-// 1. Fetch the latest fax data from the API.
-// 2. Populate the UI components with the fetched data.
+// 1. Sync the fax history with the ICT transmissions list.
+// 2. Search the fax history with the filters.
+// 3. Populate the UI components with the found faxes.
 //
 // Parameters:
 //
@@ -162,13 +296,56 @@ func (f *FaxReportTab) IsDataLoaded() bool {
 //
 //	None
 func (f *FaxReportTab) onLoadClick() {
+	err := (*f.api).SyncFaxHistory(context.Background())
+	if err != nil {
+		logger.Inst().Error(fmt.Sprintf("error syncing the fax history: %v", err))
+	}
+
+	f.onSearchClick()
+}
+
+// onSearchClick is the callback function for the search button, it searches
+// the local fax history without syncing it and shows the first page.
+func (f *FaxReportTab) onSearchClick() {
+	if _, err := f.buildQuery(); err != nil {
+		forms.ShowError(err.Error(), f.parent)
+		return
+	}
+
+	f.offset = 0
+	if f.showPage() {
+		forms.ShowInfo("Data Loaded", "the data is loaded!", f.parent)
+	}
+}
+
+// onPreviousClick is the callback function for the previous button.
+func (f *FaxReportTab) onPreviousClick() {
+	f.offset -= REPORT_PAGE_SIZE
+	if f.offset < 0 {
+		f.offset = 0
+	}
+	f.showPage()
+}
+
+// onNextClick is the callback function for the next button.
+func (f *FaxReportTab) onNextClick() {
+	f.offset += REPORT_PAGE_SIZE
+	f.showPage()
+}
+
+// showPage loads the current page of the search and populates the UI components with it.
+//
+// Returns:
+//   - bool: True if the page is loaded successfully, false otherwise.
+func (f *FaxReportTab) showPage() bool {
 	f.faxList.Hide()
 	if !f.loadData() {
 		forms.ShowError("data cannot be loaded!", f.parent)
-		return
+		return false
 	}
 
 	f.loadDataIntoUI(f.lastFaxes)
+	f.updatePager()
 	f.faxList.Show()
-	forms.ShowInfo("Data Loaded", "the data is loaded!", f.parent)
+	return true
 }
@@ -1,6 +1,7 @@
 package tabs
 
 import (
+	"context"
 	"faxsender/src/api"
 	"faxsender/src/ui/forms"
 	"faxsender/src/utilities/logger"
@@ -92,7 +93,7 @@ func (s *SettingsTab) initUI() {
 // Returns:
 //   - bool: True if settings were loaded successfully, false otherwise.
 func (s *SettingsTab) loadData() bool {
-	savedSettings, err := (*s.api).LoadSettings()
+	savedSettings, err := (*s.api).LoadSettings(context.Background())
 	if err != nil {
 		logger.Inst().Error(err.Error())
 		forms.ShowError("can't load settings from server", s.parent)
@@ -166,7 +167,7 @@ func (s *SettingsTab) onSubmitClick() {
 		Hostname: s.hostnameEntry.Text,
 	}
 
-	err = (*s.api).SaveSettings(userData)
+	err = (*s.api).SaveSettings(context.Background(), userData)
 	if err != nil {
 		logger.Inst().Error(err.Error())
 		forms.ShowError("error in save settings!", s.parent)
@@ -191,7 +192,7 @@ func (s *SettingsTab) onSubmitClick() {
 //
 //	None
 func (s *SettingsTab) onLogoutClick() {
-	err := (*s.api).Logout()
+	err := (*s.api).Logout(context.Background())
 	if err != nil {
 		logger.Inst().Error(err.Error())
 		forms.ShowError("error in logout!", s.parent)
@@ -0,0 +1,174 @@
+package sendfaxform
+
+import (
+	"context"
+	"faxsender/src/api"
+	"faxsender/src/utilities/logger"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/widget"
+)
+
+// Constants for the autocomplete of the fax number.
+const (
+	CONTACT_AUTOCOMPLETE_MIN_LENGTH  int           = 3
+	CONTACT_AUTOCOMPLETE_DELAY       time.Duration = 300 * time.Millisecond
+	CONTACT_AUTOCOMPLETE_TIMEOUT     time.Duration = 10 * time.Second
+	CONTACT_AUTOCOMPLETE_LIMIT       int           = 10
+	CONTACT_AUTOCOMPLETE_PLACEHOLDER string        = "Matching contacts"
+)
+
+// ContactAutocomplete suggests the ICT contacts matching the text of an entry.
+// The contacts are searched once the user stops typing, picking one of them
+// calls the pick callback.
+type ContactAutocomplete struct {
+	apiUI            api.IApiUICalls
+	entry            *widget.Entry
+	suggestionSelect *widget.Select
+	onPick           func(api.ContactResponse)
+
+	mutex    sync.Mutex
+	contacts []api.ContactResponse
+	timer    *time.Timer
+	cancel   context.CancelFunc
+	picking  bool
+}
+
+// NewContactAutocomplete creates a new instance of ContactAutocomplete.
+// It replaces the OnChanged callback of the entry.
+//
+// Parameters:
+//   - apiUI: The API the contacts are searched with.
+//   - entry: The entry the search text is typed in.
+//   - onPick: Called with the contact the user picked.
+//
+// Returns:
+//   - *ContactAutocomplete: The created ContactAutocomplete instance.
+func NewContactAutocomplete(apiUI api.IApiUICalls, entry *widget.Entry, onPick func(api.ContactResponse)) *ContactAutocomplete {
+	a := &ContactAutocomplete{
+		apiUI:  apiUI,
+		entry:  entry,
+		onPick: onPick,
+	}
+
+	a.suggestionSelect = widget.NewSelect([]string{}, a.onSuggestionSelected)
+	a.suggestionSelect.PlaceHolder = CONTACT_AUTOCOMPLETE_PLACEHOLDER
+	a.suggestionSelect.Disable()
+
+	entry.OnChanged = a.onTextChanged
+	return a
+}
+
+// GetSuggestionSelect returns the select listing the matching contacts.
+func (a *ContactAutocomplete) GetSuggestionSelect() *widget.Select {
+	return a.suggestionSelect
+}
+
+// onTextChanged searches the contacts once the text stops changing for the autocomplete delay.
+func (a *ContactAutocomplete) onTextChanged(text string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.picking {
+		return
+	}
+
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+
+	text = strings.TrimSpace(text)
+	if len(text) < CONTACT_AUTOCOMPLETE_MIN_LENGTH {
+		a.setSuggestionsLocked(nil)
+		return
+	}
+
+	a.timer = time.AfterFunc(CONTACT_AUTOCOMPLETE_DELAY, func() {
+		a.search(text)
+	})
+}
+
+// search searches the contacts matching the text and shows them, the
+// results are dropped if the text changed in the meantime.
+//
+// Parameters:
+//   - text: The search text.
+func (a *ContactAutocomplete) search(text string) {
+	a.mutex.Lock()
+	if a.cancel != nil {
+		a.cancel()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), CONTACT_AUTOCOMPLETE_TIMEOUT)
+	a.cancel = cancel
+	a.mutex.Unlock()
+	defer cancel()
+
+	contacts, err := a.apiUI.SearchContacts(ctx, text, CONTACT_AUTOCOMPLETE_LIMIT)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Inst().Error(fmt.Sprintf("error searching the contacts: %v", err))
+		}
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if strings.TrimSpace(a.entry.Text) != text {
+		return
+	}
+	a.setSuggestionsLocked(contacts)
+}
+
+// setSuggestionsLocked shows the contacts in the suggestion select, it is disabled if there are none.
+func (a *ContactAutocomplete) setSuggestionsLocked(contacts []api.ContactResponse) {
+	a.contacts = contacts
+
+	options := make([]string, 0, len(contacts))
+	for _, contact := range contacts {
+		options = append(options, contactLabel(contact))
+	}
+
+	a.suggestionSelect.Options = options
+	a.suggestionSelect.ClearSelected()
+	if len(options) == 0 {
+		a.suggestionSelect.Disable()
+	} else {
+		a.suggestionSelect.Enable()
+	}
+}
+
+// onSuggestionSelected picks the selected contact without searching again for its phone number.
+func (a *ContactAutocomplete) onSuggestionSelected(selected string) {
+	if selected == "" {
+		return
+	}
+
+	a.mutex.Lock()
+	index := a.suggestionSelect.SelectedIndex()
+	if index < 0 || index >= len(a.contacts) {
+		a.mutex.Unlock()
+		return
+	}
+	contact := a.contacts[index]
+	a.picking = true
+	a.mutex.Unlock()
+
+	a.onPick(contact)
+
+	a.mutex.Lock()
+	a.picking = false
+	a.mutex.Unlock()
+}
+
+// contactLabel returns the label of a contact in the suggestion select.
+func contactLabel(contact api.ContactResponse) string {
+	name := strings.TrimSpace(contact.FirstName + " " + contact.LastName)
+	if name == "" {
+		return contact.Phone
+	}
+	return fmt.Sprintf("%s <%s>", name, contact.Phone)
+}
@@ -0,0 +1,139 @@
+package sendfaxform
+
+import (
+	"fmt"
+	"time"
+
+	"fyne.io/fyne"
+	"fyne.io/fyne/container"
+	"fyne.io/fyne/widget"
+)
+
+// Constants for the options of the date time picker.
+const (
+	DATE_PICKER_DAYS        int    = 30
+	DATE_PICKER_FORMAT      string = "Mon 2006-01-02"
+	TIME_PICKER_MINUTE_STEP int    = 5
+	SCHEDULED_TIME_FORMAT   string = "Mon 2006-01-02 15:04"
+)
+
+// DateTimePicker lets the user choose the time a fax is sent at.
+// The time is only used while the "Send later" checkbox is checked.
+type DateTimePicker struct {
+	enableCheck  *widget.Check
+	dateSelect   *widget.Select
+	hourSelect   *widget.Select
+	minuteSelect *widget.Select
+
+	mainContainer *fyne.Container
+
+	dates []time.Time
+}
+
+// NewDateTimePicker creates a new instance of DateTimePicker.
+// The dates start today and the time is preset to the next hour.
+//
+// Returns:
+//   - *DateTimePicker: The created DateTimePicker instance.
+func NewDateTimePicker() *DateTimePicker {
+	p := &DateTimePicker{}
+
+	p.dateSelect = widget.NewSelect(p.dateOptions(), nil)
+	p.hourSelect = widget.NewSelect(numberOptions(0, 24, 1), nil)
+	p.minuteSelect = widget.NewSelect(numberOptions(0, 60, TIME_PICKER_MINUTE_STEP), nil)
+
+	p.enableCheck = widget.NewCheck("Send later", func(checked bool) {
+		p.setPickersEnabled(checked)
+	})
+
+	p.Reset()
+
+	p.mainContainer = container.NewGridWithColumns(4, p.enableCheck, p.dateSelect, p.hourSelect, p.minuteSelect)
+	return p
+}
+
+// GetMainContainer returns the container of the picker.
+func (p *DateTimePicker) GetMainContainer() *fyne.Container {
+	return p.mainContainer
+}
+
+// IsEnabled checks if the fax should be sent later.
+func (p *DateTimePicker) IsEnabled() bool {
+	return p.enableCheck.Checked
+}
+
+// Time returns the chosen time in the local time zone.
+//
+// Returns:
+//   - time.Time: The chosen time.
+//   - error: An error if no date or time has been chosen.
+func (p *DateTimePicker) Time() (time.Time, error) {
+	dateIndex := p.dateSelect.SelectedIndex()
+	if dateIndex < 0 || dateIndex >= len(p.dates) {
+		return time.Time{}, fmt.Errorf("choose the date the fax is sent at")
+	}
+
+	var hour, minute int
+	if _, err := fmt.Sscanf(p.hourSelect.Selected, "%d", &hour); err != nil {
+		return time.Time{}, fmt.Errorf("choose the hour the fax is sent at")
+	}
+	if _, err := fmt.Sscanf(p.minuteSelect.Selected, "%d", &minute); err != nil {
+		return time.Time{}, fmt.Errorf("choose the minute the fax is sent at")
+	}
+
+	date := p.dates[dateIndex]
+	return time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, time.Local), nil
+}
+
+// Reset unchecks the picker and presets it to the next hour.
+func (p *DateTimePicker) Reset() {
+	p.dateSelect.Options = p.dateOptions()
+
+	next := time.Now().Truncate(time.Hour).Add(time.Hour)
+	dateIndex := 0
+	if next.Day() != time.Now().Day() {
+		dateIndex = 1
+	}
+
+	p.dateSelect.SetSelectedIndex(dateIndex)
+	p.hourSelect.SetSelected(fmt.Sprintf("%02d", next.Hour()))
+	p.minuteSelect.SetSelected(fmt.Sprintf("%02d", 0))
+
+	p.enableCheck.SetChecked(false)
+	p.setPickersEnabled(false)
+}
+
+// setPickersEnabled enables or disables the date and time selects.
+func (p *DateTimePicker) setPickersEnabled(enabled bool) {
+	for _, picker := range []*widget.Select{p.dateSelect, p.hourSelect, p.minuteSelect} {
+		if enabled {
+			picker.Enable()
+		} else {
+			picker.Disable()
+		}
+	}
+}
+
+// dateOptions fills the dates of the picker starting today and returns their labels.
+func (p *DateTimePicker) dateOptions() []string {
+	today := time.Now()
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.Local)
+
+	p.dates = make([]time.Time, 0, DATE_PICKER_DAYS)
+	options := make([]string, 0, DATE_PICKER_DAYS)
+	for day := 0; day < DATE_PICKER_DAYS; day++ {
+		date := today.AddDate(0, 0, day)
+		p.dates = append(p.dates, date)
+		options = append(options, date.Format(DATE_PICKER_FORMAT))
+	}
+	return options
+}
+
+// numberOptions returns the two digit labels from start up to end with the given step.
+func numberOptions(start int, end int, step int) []string {
+	options := make([]string, 0)
+	for number := start; number < end; number += step {
+		options = append(options, fmt.Sprintf("%02d", number))
+	}
+	return options
+}
@@ -0,0 +1,291 @@
+package sendfaxform
+
+import (
+	"context"
+	"errors"
+	"faxsender/src/document"
+	"faxsender/src/utilities"
+	"faxsender/src/utilities/logger"
+	"fmt"
+	"image"
+	"os"
+	"sync"
+
+	"fyne.io/fyne"
+	"fyne.io/fyne/canvas"
+	"fyne.io/fyne/container"
+	"fyne.io/fyne/theme"
+	"fyne.io/fyne/widget"
+)
+
+// Constants for the document preview.
+const (
+	PREVIEW_THUMBNAIL_SIZE int = 240
+
+	PREVIEW_NO_DOCUMENT_STRING   string = "No document"
+	PREVIEW_LOADING_STRING       string = "Loading the preview..."
+	PREVIEW_UNSUPPORTED_STRING   string = "The pages are counted once the document is converted"
+	PREVIEW_NO_RENDERER_STRING   string = "Install pdftoppm (poppler-utils) to see the pages"
+	PREVIEW_PAGE_NUMBER_FORMAT   string = "Page %d of %d"
+	PREVIEW_PAGE_COUNT_FORMAT    string = "%d pages"
+	PREVIEW_SINGLE_PAGE_STRING   string = "1 page"
+	PREVIEW_UNKNOWN_PAGES_STRING string = "an unknown number of pages"
+	PREVIEW_LOAD_ERROR_FORMAT    string = "The document can't be previewed: %v"
+	PREVIEW_RENDER_ERROR_FORMAT  string = "The page can't be drawn: %v"
+)
+
+// PreviewPanel shows the page count and the pages of the document to send,
+// one thumbnail at a time with buttons to step through the pages. The pages
+// are read and drawn in the background.
+type PreviewPanel struct {
+	// mutex guards the state of the panel below, it isn't held while a page
+	// is drawn so the form doesn't wait for the PDF renderer.
+	mutex   sync.Mutex
+	preview *document.DocumentPreview
+
+	// generation counts the loaded documents, a background load of an older
+	// document doesn't update the panel.
+	generation int
+	page       int
+	pageCount  int
+
+	// renderMutex serializes the use of the previews, which aren't safe for concurrent use.
+	renderMutex sync.Mutex
+
+	countLabel     *widget.Label
+	pageLabel      *widget.Label
+	messageLabel   *widget.Label
+	thumbnail      *canvas.Image
+	previousButton *widget.Button
+	nextButton     *widget.Button
+	mainContainer  *fyne.Container
+}
+
+// NewPreviewPanel creates a new instance of PreviewPanel without a document.
+//
+// Returns:
+//   - *PreviewPanel: The created PreviewPanel instance.
+func NewPreviewPanel() *PreviewPanel {
+	p := &PreviewPanel{}
+
+	p.countLabel = widget.NewLabel(PREVIEW_NO_DOCUMENT_STRING)
+	p.countLabel.TextStyle = fyne.TextStyle{Bold: true}
+	p.pageLabel = widget.NewLabel("")
+	p.messageLabel = widget.NewLabel("")
+	p.messageLabel.Wrapping = fyne.TextWrapWord
+
+	p.thumbnail = canvas.NewImageFromImage(nil)
+	p.thumbnail.FillMode = canvas.ImageFillContain
+	p.thumbnail.SetMinSize(fyne.NewSize(PREVIEW_THUMBNAIL_SIZE, PREVIEW_THUMBNAIL_SIZE))
+
+	p.previousButton = widget.NewButtonWithIcon("", theme.NavigateBackIcon(), func() { p.stepPage(-1) })
+	p.nextButton = widget.NewButtonWithIcon("", theme.NavigateNextIcon(), func() { p.stepPage(1) })
+
+	p.mainContainer = container.NewVBox(
+		p.countLabel,
+		p.thumbnail,
+		container.NewBorder(nil, nil, p.previousButton, p.nextButton, p.pageLabel),
+		p.messageLabel,
+	)
+
+	p.updateControls(0, 0)
+	return p
+}
+
+// GetMainContainer returns the container of the panel.
+func (p *PreviewPanel) GetMainContainer() *fyne.Container {
+	return p.mainContainer
+}
+
+// PageCount returns the page count of the previewed document.
+//
+// Returns:
+//   - int: The page count, 0 if it isn't known.
+func (p *PreviewPanel) PageCount() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.pageCount
+}
+
+// Load previews a document in the background, replacing the previous one.
+//
+// Steps:
+// 1. Close the previous document and clear the panel.
+// 2. Read the document and count its pages in the background.
+// 3. Show the page count and the first page.
+//
+// Parameters:
+//   - filePath: The path of the document, empty to clear the panel.
+func (p *PreviewPanel) Load(filePath string) {
+	p.mutex.Lock()
+	p.generation++
+	generation := p.generation
+	previous := p.preview
+	p.preview, p.page, p.pageCount = nil, 0, 0
+	p.mutex.Unlock()
+
+	p.setThumbnail(nil, "")
+	p.pageLabel.SetText("")
+	p.updateControls(0, 0)
+
+	if filePath == "" {
+		p.countLabel.SetText(PREVIEW_NO_DOCUMENT_STRING)
+	} else {
+		p.countLabel.SetText(PREVIEW_LOADING_STRING)
+	}
+
+	go func() {
+		if previous != nil {
+			p.renderMutex.Lock()
+			previous.Close()
+			p.renderMutex.Unlock()
+		}
+		if filePath != "" {
+			p.load(generation, filePath)
+		}
+	}()
+}
+
+// load reads the document of a load in the background, then shows its first page.
+func (p *PreviewPanel) load(generation int, filePath string) {
+	preview, err := openPreview(filePath)
+
+	p.mutex.Lock()
+	if generation != p.generation {
+		p.mutex.Unlock()
+		if preview != nil {
+			preview.Close()
+		}
+		return
+	}
+	if err == nil {
+		p.preview, p.pageCount = preview, preview.PageCount()
+	}
+	pageCount := p.pageCount
+	p.mutex.Unlock()
+
+	switch {
+	case errors.Is(err, document.ErrPreviewUnsupported):
+		p.countLabel.SetText(PREVIEW_UNSUPPORTED_STRING)
+		return
+	case err != nil:
+		logger.Inst().Error(fmt.Sprintf("error previewing the document '%s': %v", filePath, err))
+		p.countLabel.SetText(fmt.Sprintf(PREVIEW_LOAD_ERROR_FORMAT, err))
+		return
+	}
+
+	p.countLabel.SetText(pageCountText(pageCount))
+	p.stepPage(0)
+}
+
+// openPreview reads a document file and creates its preview.
+func openPreview(filePath string) (*document.DocumentPreview, error) {
+	contentType := utilities.GetContentType(utilities.ExtractFileExtension(filePath))
+	if !document.CanPreview(contentType) {
+		return nil, document.ErrPreviewUnsupported
+	}
+
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return document.NewDocumentPreview(contents, contentType)
+}
+
+// stepPage shows the page a number of pages after the shown page, the page
+// is drawn in the background.
+//
+// Parameters:
+//   - step: The number of pages to step, negative to step back.
+func (p *PreviewPanel) stepPage(step int) {
+	p.mutex.Lock()
+	page := p.page + step
+	if p.preview == nil || page < 0 || page >= p.pageCount {
+		p.mutex.Unlock()
+		return
+	}
+	p.page = page
+	generation, pageCount := p.generation, p.pageCount
+	p.mutex.Unlock()
+
+	p.pageLabel.SetText(fmt.Sprintf(PREVIEW_PAGE_NUMBER_FORMAT, page+1, pageCount))
+	p.updateControls(page, pageCount)
+
+	go p.drawPage(generation, page)
+}
+
+// drawPage draws a page in the background, a page that can't be drawn is
+// shown as a blank page. The thumbnail is updated if the page is still the
+// shown page of the same document.
+func (p *PreviewPanel) drawPage(generation int, page int) {
+	p.renderMutex.Lock()
+	defer p.renderMutex.Unlock()
+
+	p.mutex.Lock()
+	preview := p.preview
+	current := generation == p.generation && page == p.page
+	p.mutex.Unlock()
+	if !current {
+		return
+	}
+
+	message := ""
+	img, err := preview.Thumbnail(context.Background(), page, PREVIEW_THUMBNAIL_SIZE)
+	if err != nil {
+		if errors.Is(err, document.ErrRendererUnavailable) {
+			message = PREVIEW_NO_RENDERER_STRING
+		} else {
+			logger.Inst().Error(err.Error())
+			message = fmt.Sprintf(PREVIEW_RENDER_ERROR_FORMAT, err)
+		}
+		img = preview.PlaceholderThumbnail(page, PREVIEW_THUMBNAIL_SIZE)
+	}
+
+	// A newer document or page may have been chosen while the page was drawn.
+	p.mutex.Lock()
+	current = generation == p.generation && page == p.page
+	p.mutex.Unlock()
+	if current {
+		p.setThumbnail(img, message)
+	}
+}
+
+// setThumbnail shows a drawn page and the message of its drawing.
+func (p *PreviewPanel) setThumbnail(img image.Image, message string) {
+	p.thumbnail.Image = img
+	p.thumbnail.Refresh()
+	p.messageLabel.SetText(message)
+}
+
+// updateControls enables the buttons stepping to the previous and the next page.
+func (p *PreviewPanel) updateControls(page int, pageCount int) {
+	if page > 0 {
+		p.previousButton.Enable()
+	} else {
+		p.previousButton.Disable()
+	}
+
+	if page+1 < pageCount {
+		p.nextButton.Enable()
+	} else {
+		p.nextButton.Disable()
+	}
+}
+
+// pageCountText describes a page count.
+//
+// Parameters:
+//   - pageCount: The page count, 0 if it isn't known.
+//
+// Returns:
+//   - string: The description of the page count.
+func pageCountText(pageCount int) string {
+	switch pageCount {
+	case 0:
+		return PREVIEW_UNKNOWN_PAGES_STRING
+	case 1:
+		return PREVIEW_SINGLE_PAGE_STRING
+	}
+	return fmt.Sprintf(PREVIEW_PAGE_COUNT_FORMAT, pageCount)
+}
@@ -0,0 +1,130 @@
+package sendfaxform
+
+import (
+	"faxsender/src/api"
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne"
+	"fyne.io/fyne/container"
+	"fyne.io/fyne/theme"
+	"fyne.io/fyne/widget"
+)
+
+// RecipientListEditor is an editable list of fax recipients for broadcasts.
+type RecipientListEditor struct {
+	recipients []api.Contact
+
+	titleLabel    *widget.Label
+	listContainer *fyne.Container
+	mainContainer *fyne.Container
+
+	onAdd func() (api.Contact, bool)
+}
+
+// NewRecipientListEditor creates a new instance of RecipientListEditor.
+//
+// Parameters:
+//   - onAdd: Called when the add button is pressed, it returns the recipient
+//     to add and false if there is no valid recipient to add.
+//
+// Returns:
+//   - *RecipientListEditor: The created RecipientListEditor instance.
+func NewRecipientListEditor(onAdd func() (api.Contact, bool)) *RecipientListEditor {
+	e := &RecipientListEditor{
+		recipients: make([]api.Contact, 0),
+		onAdd:      onAdd,
+	}
+
+	e.titleLabel = widget.NewLabel("")
+	e.listContainer = container.NewVBox()
+
+	addButton := widget.NewButtonWithIcon("Add Recipient", theme.ContentAddIcon(), e.onAddClick)
+	clearButton := widget.NewButtonWithIcon("Clear", theme.DeleteIcon(), e.Clear)
+
+	e.mainContainer = container.NewVBox(
+		container.NewBorder(nil, nil, e.titleLabel, container.NewHBox(addButton, clearButton)),
+		e.listContainer,
+	)
+
+	e.refresh()
+	return e
+}
+
+// GetMainContainer returns the container of the editor.
+func (e *RecipientListEditor) GetMainContainer() *fyne.Container {
+	return e.mainContainer
+}
+
+// Recipients returns a copy of the recipients in the list.
+func (e *RecipientListEditor) Recipients() []api.Contact {
+	return append([]api.Contact{}, e.recipients...)
+}
+
+// Clear removes all recipients from the list.
+func (e *RecipientListEditor) Clear() {
+	e.recipients = e.recipients[:0]
+	e.refresh()
+}
+
+// onAddClick handles the click event of the "Add Recipient" button.
+//
+// Steps:
+// 1. Get the recipient to add from the form.
+// 2. Skip it if its fax number is already in the list.
+// 3. Add it to the list and refresh the rows.
+func (e *RecipientListEditor) onAddClick() {
+	contact, ok := e.onAdd()
+	if !ok {
+		return
+	}
+
+	for _, recipient := range e.recipients {
+		if strings.TrimSpace(recipient.Phone) == strings.TrimSpace(contact.Phone) {
+			return
+		}
+	}
+
+	e.recipients = append(e.recipients, contact)
+	e.refresh()
+}
+
+// remove removes the recipient at the given index from the list.
+func (e *RecipientListEditor) remove(index int) {
+	if index < 0 || index >= len(e.recipients) {
+		return
+	}
+
+	e.recipients = append(e.recipients[:index], e.recipients[index+1:]...)
+	e.refresh()
+}
+
+// refresh rebuilds the rows of the list from the recipients.
+func (e *RecipientListEditor) refresh() {
+	rows := make([]fyne.CanvasObject, 0, len(e.recipients))
+	for i, recipient := range e.recipients {
+		index := i
+		removeButton := widget.NewButtonWithIcon("", theme.ContentRemoveIcon(), func() {
+			e.remove(index)
+		})
+		rows = append(rows, container.NewBorder(nil, nil, nil, removeButton, widget.NewLabel(describeRecipient(recipient))))
+	}
+
+	e.listContainer.Objects = rows
+	e.listContainer.Refresh()
+
+	if len(e.recipients) == 0 {
+		e.titleLabel.SetText("Broadcast Recipients: none, the fax is sent to the number above")
+	} else {
+		e.titleLabel.SetText(fmt.Sprintf("Broadcast Recipients: %d", len(e.recipients)))
+	}
+}
+
+// describeRecipient returns the text of the row of a recipient.
+func describeRecipient(contact api.Contact) string {
+	name := strings.TrimSpace(contact.FirstName + " " + contact.LastName)
+	if name == "" {
+		return contact.Phone
+	}
+	return fmt.Sprintf("%s (%s)", contact.Phone, name)
+}
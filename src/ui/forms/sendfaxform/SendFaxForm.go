@@ -1,6 +1,7 @@
 package sendfaxform
 
 import (
+	"context"
 	"faxsender/src/api"
 	"faxsender/src/ui/forms"
 	"faxsender/src/utilities"
@@ -8,6 +9,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"fyne.io/fyne"
 	"fyne.io/fyne/app"
@@ -29,9 +31,25 @@ const (
 
 	PHONE_LIST_DEFAULT_STRING string = "Choose Caller ID*"
 
+	COVER_TEMPLATE_NONE_STRING string = "No cover page template"
+
+	UPLOAD_FORMAT_PDF_STRING     string = "Upload as PDF"
+	UPLOAD_FORMAT_TIFF_G3_STRING string = "Upload as TIFF (G3)"
+	UPLOAD_FORMAT_TIFF_G4_STRING string = "Upload as TIFF (G4)"
+
+	RESOLUTION_STANDARD_STRING string = "Standard resolution"
+	RESOLUTION_FINE_STRING     string = "Fine resolution"
+
 	IS_NOT_SELECTED_STRING string = ""
 )
 
+// uploadFormats maps the upload format options to the upload formats of the transmission.
+var uploadFormats = map[string]string{
+	UPLOAD_FORMAT_PDF_STRING:     utilities.UPLOAD_FORMAT_PDF,
+	UPLOAD_FORMAT_TIFF_G3_STRING: utilities.UPLOAD_FORMAT_TIFF_G3,
+	UPLOAD_FORMAT_TIFF_G4_STRING: utilities.UPLOAD_FORMAT_TIFF_G4,
+}
+
 type SendFaxFormSignal func(...int)
 
 // SendFaxForm is a form for sending a fax, providing user input fields and options.
@@ -39,27 +57,36 @@ type SendFaxForm struct {
 	app    *fyne.App
 	window *fyne.Window
 
-	firstNameEntry   *widget.Entry
-	lastNameEntry    *widget.Entry
-	emailEntry       *widget.Entry
-	faxNumberEntry   *widget.Entry
-	companyEntry     *widget.Entry
-	descriptionEntry *widget.Entry
-	custom1Entry     *widget.Entry
-	custom2Entry     *widget.Entry
-	custom3Entry     *widget.Entry
-	titleEntry       *widget.Entry
-	retryEntry       *widget.Select
-	accountPhoneList *widget.Select
-	sendButton       *widget.Button
-	selectContainer  container.Scroll
-	filePathLable    *widget.Entry
-
-	infoEntryLayout *fyne.Container
+	firstNameEntry    *widget.Entry
+	lastNameEntry     *widget.Entry
+	emailEntry        *widget.Entry
+	faxNumberEntry    *widget.Entry
+	companyEntry      *widget.Entry
+	descriptionEntry  *widget.Entry
+	custom1Entry      *widget.Entry
+	custom2Entry      *widget.Entry
+	custom3Entry      *widget.Entry
+	titleEntry        *widget.Entry
+	retryEntry        *widget.Select
+	accountPhoneList  *widget.Select
+	coverTemplateList *widget.Select
+	uploadFormatList  *widget.Select
+	resolutionList    *widget.Select
+	sendButton        *widget.Button
+	cancelButton      *widget.Button
+	selectContainer   container.Scroll
+	filePathLable     *widget.Entry
+
+	infoEntryLayout     *fyne.Container
+	contactAutocomplete *ContactAutocomplete
+	recipientEditor     *RecipientListEditor
+	sendLaterPicker     *DateTimePicker
+	previewPanel        *PreviewPanel
 
 	formLayout        *fyne.Container
 	coverPageCheckbox *fyne.Container
 	printCheckbox     *fyne.Container
+	ditherCheckbox    *fyne.Container
 	buttonContainer   *fyne.Container
 
 	apiUI api.IApiUICalls
@@ -73,6 +100,8 @@ type SendFaxForm struct {
 	documentRecord  api.DocumentRecord
 	fileModel       api.SendFileInfo
 
+	cancelSend context.CancelFunc
+
 	filePath     string
 	fileContents []byte
 	SignalFunc   SendFaxFormSignal
@@ -124,12 +153,13 @@ func (r *SendFaxForm) CheckPathWithPanic() {
 //
 // Steps:
 // 1. Initialize input entries (text fields).
-// 2. Initialize information layout.
-// 3. Initialize checkboxes.
+// 2. Initialize information layout and the broadcast recipient list.
+// 3. Initialize checkboxes and the send later picker.
 // 4. Initialize retry combo box.
-// 5. Initialize phone list combo box.
-// 6. Initialize send button.
+// 5. Initialize phone list, cover page template and upload format combo boxes.
+// 6. Initialize send button and the preview of the document.
 // 7. Initialize form layout.
+// 8. Load the options of the combo boxes and the preview of the document.
 //
 // Parameters:
 //
@@ -160,15 +190,23 @@ func (f *SendFaxForm) InitControls() {
 	fileContainer := container.NewBorder(nil, nil, fileLable, browseButton, f.filePathLable)
 
 	f.initInputEntries()
+	f.contactAutocomplete = NewContactAutocomplete(f.apiUI, f.faxNumberEntry, f.fillContactEntries)
 	f.initInformationsLayout()
+	f.recipientEditor = NewRecipientListEditor(f.addRecipientFromEntries)
 	f.initCheckBoxes()
+	f.sendLaterPicker = NewDateTimePicker()
 	f.initRetryCombobox()
 	f.initPhoneListCombobox()
+	f.initCoverTemplateCombobox()
+	f.initUploadFormatComboboxes()
 	f.initSendButton()
+	f.previewPanel = NewPreviewPanel()
 	f.initFormLayout(uploadTitle, recipientInfoTitle, fileContainer)
 
 	(*f.window).SetContent(f.formLayout)
 	f.InitAccountPhoneListOptions()
+	f.InitCoverTemplateOptions()
+	f.previewPanel.Load(f.filePath)
 
 }
 
@@ -194,6 +232,7 @@ func (f *SendFaxForm) initInformationsLayout() {
 		container.NewGridWithColumns(3,
 			f.faxNumberEntry,
 			f.companyEntry,
+			f.contactAutocomplete.GetSuggestionSelect(),
 		),
 		container.NewGridWithColumns(1,
 			f.descriptionEntry,
@@ -206,10 +245,24 @@ func (f *SendFaxForm) initInformationsLayout() {
 	)
 }
 
+// fillContactEntries fills the recipient entries with an ICT contact picked
+// from the fax number suggestions.
+//
+// Parameters:
+//   - contact: The picked contact.
+func (f *SendFaxForm) fillContactEntries(contact api.ContactResponse) {
+	f.firstNameEntry.SetText(contact.FirstName)
+	f.lastNameEntry.SetText(contact.LastName)
+	f.emailEntry.SetText(contact.Email)
+	f.faxNumberEntry.SetText(contact.Phone)
+	f.descriptionEntry.SetText(contact.Description)
+}
+
 // initFormLayout initializes the overall layout of the form.
 //
 // Steps:
 // 1. Create the layout with multiple sections using container layouts.
+// 2. Show the preview of the document on the right of the sections.
 //
 // Parameters:
 //   - recipientInfoTitle: Label for recipient information.
@@ -219,20 +272,26 @@ func (f *SendFaxForm) initInformationsLayout() {
 //
 //	None
 func (f *SendFaxForm) initFormLayout(uploadTitle *widget.Label, recipientInfoTitle *widget.Label, fileContainer *fyne.Container) {
-	f.formLayout = container.NewVBox(
+	sections := container.NewVBox(
 		f.titleEntry,
 		uploadTitle,
 		container.NewVBox(fileContainer, recipientInfoTitle),
 		f.infoEntryLayout,
-		container.NewGridWithColumns(5, f.coverPageCheckbox, f.printCheckbox),
-		container.NewGridWithColumns(3, f.retryEntry, f.accountPhoneList, f.sendButton),
+		f.recipientEditor.GetMainContainer(),
+		container.NewGridWithColumns(5, f.coverPageCheckbox, f.printCheckbox, f.coverTemplateList),
+		container.NewGridWithColumns(5, f.uploadFormatList, f.resolutionList, f.ditherCheckbox),
+		f.sendLaterPicker.GetMainContainer(),
+		container.NewGridWithColumns(4, f.retryEntry, f.accountPhoneList, f.sendButton, f.cancelButton),
 	)
+
+	f.formLayout = container.NewBorder(nil, nil, nil, f.previewPanel.GetMainContainer(), sections)
 }
 
-// initSendButton initializes the send button.
+// initSendButton initializes the send and cancel buttons.
 //
 // Steps:
 // 1. Create a "Send" button with an icon.
+// 2. Create a disabled "Cancel" button, it is enabled while a send is running.
 //
 // Parameters:
 //
@@ -245,6 +304,10 @@ func (f *SendFaxForm) initSendButton() {
 	f.sendButton = widget.NewButton("Send", f.onSendClick)
 	f.sendButton.Icon = theme.MailSendIcon()
 	f.sendButton.Resize(fyne.NewSize(200, 50))
+
+	f.cancelButton = widget.NewButton("Cancel", f.onCancelClick)
+	f.cancelButton.Icon = theme.CancelIcon()
+	f.cancelButton.Disable()
 }
 
 // initPhoneListCombobox initializes the combo box for selecting a phone number.
@@ -269,6 +332,75 @@ func (f *SendFaxForm) initPhoneListCombobox() {
 	f.accountPhoneList.PlaceHolder = PHONE_LIST_DEFAULT_STRING
 }
 
+// initCoverTemplateCombobox initializes the combo box for selecting the cover page template.
+//
+// Steps:
+// 1. Create a select widget for the cover page templates, a template replaces
+// the cover page of the fax server.
+//
+// Parameters:
+//
+//	None
+//
+// Returns:
+//
+//	None
+func (f *SendFaxForm) initCoverTemplateCombobox() {
+	f.coverTemplateList = widget.NewSelect([]string{COVER_TEMPLATE_NONE_STRING}, func(selected string) {
+		if selected == COVER_TEMPLATE_NONE_STRING {
+			f.transmission.CoverPageTemplate = ""
+		} else if selected != IS_NOT_SELECTED_STRING {
+			f.transmission.CoverPageTemplate = selected
+		}
+	})
+
+	f.coverTemplateList.PlaceHolder = COVER_TEMPLATE_NONE_STRING
+}
+
+// initUploadFormatComboboxes initializes the combo boxes for selecting the
+// upload format and the fax resolution.
+//
+// Steps:
+// 1. Create a select widget for the upload format, images can be uploaded as
+// TIFF images compressed with CCITT Group 3 or Group 4 instead of PDF.
+// 2. Create a select widget for the resolution of the TIFF images, it is
+// enabled with a TIFF upload format like the dithering checkbox.
+//
+// Parameters:
+//
+//	None
+//
+// Returns:
+//
+//	None
+func (f *SendFaxForm) initUploadFormatComboboxes() {
+	f.resolutionList = widget.NewSelect([]string{RESOLUTION_STANDARD_STRING, RESOLUTION_FINE_STRING}, func(selected string) {
+		if selected == RESOLUTION_FINE_STRING {
+			f.transmission.FaxResolution = utilities.FAX_RESOLUTION_FINE
+		} else if selected != IS_NOT_SELECTED_STRING {
+			f.transmission.FaxResolution = utilities.FAX_RESOLUTION_STANDARD
+		}
+	})
+	f.resolutionList.PlaceHolder = RESOLUTION_STANDARD_STRING
+	f.resolutionList.Disable()
+
+	f.uploadFormatList = widget.NewSelect([]string{UPLOAD_FORMAT_PDF_STRING, UPLOAD_FORMAT_TIFF_G3_STRING, UPLOAD_FORMAT_TIFF_G4_STRING}, func(selected string) {
+		if selected == IS_NOT_SELECTED_STRING {
+			return
+		}
+
+		f.transmission.UploadFormat = uploadFormats[selected]
+		if f.transmission.UploadFormat == utilities.UPLOAD_FORMAT_PDF {
+			f.resolutionList.Disable()
+			f.ditherCheckbox.Hide()
+		} else {
+			f.resolutionList.Enable()
+			f.ditherCheckbox.Show()
+		}
+	})
+	f.uploadFormatList.PlaceHolder = UPLOAD_FORMAT_PDF_STRING
+}
+
 // initRetryCombobox initializes the combo box for selecting retry options.
 //
 // Steps:
@@ -341,10 +473,11 @@ func (f *SendFaxForm) initInputEntries() {
 	f.titleEntry.PlaceHolder = "Title*"
 }
 
-// initCheckBoxes initializes checkboxes for cover page and print options.
+// initCheckBoxes initializes checkboxes for cover page, print and dithering options.
 //
 // Steps:
 // 1. Create checkboxes for cover page and print.
+// 2. Create the dithering checkbox, shown with a TIFF upload format.
 //
 // Parameters:
 //
@@ -372,6 +505,11 @@ func (f *SendFaxForm) initCheckBoxes() {
 	f.transmission.IsPrint = utilities.WITH_PRINT
 
 	f.printCheckbox.Hidden = true
+
+	f.ditherCheckbox = container.NewHBox(widget.NewCheck("Dither", func(checked bool) {
+		f.transmission.Dithering = checked
+	}))
+	f.ditherCheckbox.Hidden = true
 }
 
 // InitAccountPhoneListOptions initializes the phone list combo box with account phone numbers.
@@ -390,7 +528,7 @@ func (f *SendFaxForm) initCheckBoxes() {
 func (f *SendFaxForm) InitAccountPhoneListOptions() {
 	var phoneNumbers []string
 
-	accounts, err := f.apiUI.GetAllAccounts()
+	accounts, err := f.apiUI.GetAllAccounts(context.Background())
 	f.allAccounts = accounts
 	if err != nil {
 		logger.Inst().Error(err.Error())
@@ -402,6 +540,28 @@ func (f *SendFaxForm) InitAccountPhoneListOptions() {
 	f.accountPhoneList.Options = append([]string{PHONE_LIST_DEFAULT_STRING}, phoneNumbers...)
 }
 
+// InitCoverTemplateOptions initializes the cover page template combo box with the templates.
+//
+// Steps:
+// 1. Fetch the names of the cover page templates from the API.
+// 2. Populate the combo box options, the first option sends no template.
+//
+// Parameters:
+//
+//	None
+//
+// Returns:
+//
+//	None
+func (f *SendFaxForm) InitCoverTemplateOptions() {
+	names, err := f.apiUI.GetCoverPageTemplates(context.Background())
+	if err != nil {
+		logger.Inst().Error(err.Error())
+		return
+	}
+	f.coverTemplateList.Options = append([]string{COVER_TEMPLATE_NONE_STRING}, names...)
+}
+
 // handleAccountSelection handles the selection of an account phone number.
 //
 // Parameters:
@@ -478,6 +638,7 @@ func (f *SendFaxForm) openFileDialog() {
 		fileAbsolutePath := strings.ReplaceAll(fileUrl.String(), "file://", "")
 		f.filePathLable.SetText(fileAbsolutePath)
 		f.filePath = fileAbsolutePath
+		f.previewPanel.Load(fileAbsolutePath)
 	}, *f.window)
 	fileDialog.SetFilter(storage.NewExtensionFileFilter(utilities.AllValidExtensions()))
 	fileDialog.Show()
@@ -487,8 +648,10 @@ func (f *SendFaxForm) openFileDialog() {
 //
 // Steps:
 // 1. Prepare contact, document record, transmission, and file model data.
-// 2. Call the API to send the fax with the prepared data.
-// 3. Handle any errors and display an error message if necessary.
+// 2. Ask the user to confirm the send with the page count of the document.
+// 3. Enable the "Cancel" button and create the context of the send.
+// 4. Send the fax, schedule it if "Send later" is checked, or broadcast it if the
+// recipient list is not empty, in the background.
 //
 // Parameters:
 //
@@ -498,20 +661,14 @@ func (f *SendFaxForm) openFileDialog() {
 //
 //	None
 func (f *SendFaxForm) onSendClick() {
+	recipients := f.recipientEditor.Recipients()
 
-	if f.faxNumberEntry.Text == "" || f.titleEntry.Text == "" || f.transmission.AccountID == "" {
+	if (f.faxNumberEntry.Text == "" && len(recipients) == 0) || f.titleEntry.Text == "" || f.transmission.AccountID == "" {
 		forms.ShowError("Required fields cannot be empty", f.window)
 		return
 	}
 
-	f.sendButton.Disable()
-
-	f.contact = api.Contact{
-		FirstName: f.firstNameEntry.Text,
-		LastName:  f.lastNameEntry.Text,
-		Email:     f.emailEntry.Text,
-		Phone:     f.faxNumberEntry.Text,
-	}
+	f.contact = f.contactFromEntries()
 	f.documentRecord = api.DocumentRecord{
 		Title:       f.titleEntry.Text,
 		Description: f.descriptionEntry.Text,
@@ -523,29 +680,379 @@ func (f *SendFaxForm) onSendClick() {
 		IsCoverPage: f.transmission.IsCoverPage,
 		IsPrint:     f.transmission.IsPrint,
 		TryAllowed:  f.transmission.TryAllowed,
+
+		CoverPageTemplate: f.transmission.CoverPageTemplate,
+		UploadFormat:      f.transmission.UploadFormat,
+		FaxResolution:     f.transmission.FaxResolution,
+		Dithering:         f.transmission.Dithering,
 	}
 
 	f.fileModel = api.SendFileInfo{
 		ContentType: f.fileModel.ContentType,
 	}
 
-	f.readFileContents(f.filePath)
 	fileExtension := utilities.ExtractFileExtension(f.filePath)
 	f.fileModel.ContentType = utilities.GetContentType(fileExtension)
 
-	err := f.apiUI.SendFax(f.contact, f.documentRecord, f.transmission, f.fileContents, f.fileModel)
+	if f.sendLaterPicker.IsEnabled() {
+		f.onScheduleClick(recipients)
+		return
+	}
 
-	f.sendButton.Enable()
+	f.confirmSend(recipients, "", func() {
+		ctx := f.startSend()
 
+		if len(recipients) > 0 {
+			f.readFileContents(f.filePath)
+			go f.broadcast(ctx, recipients)
+			return
+		}
+
+		go f.send(ctx)
+	})
+}
+
+// confirmSend asks the user to confirm a send, telling the page count of the
+// document from the preview and the recipients.
+//
+// Parameters:
+//   - recipients: The recipients of the recipient list, empty to send to the recipient entries.
+//   - sendAt: The time a scheduled fax is sent at, empty to send it now.
+//   - onConfirm: Called when the user confirms the send.
+func (f *SendFaxForm) confirmSend(recipients []api.Contact, sendAt string, onConfirm func()) {
+	pages := pageCountText(f.previewPanel.PageCount())
+	if f.transmission.CoverPageTemplate != "" || f.transmission.IsCoverPage == utilities.WITH_COVER {
+		pages += " and a cover page"
+	}
+
+	to := f.contact.Phone
+	if len(recipients) > 0 {
+		to = fmt.Sprintf("%d recipients", len(recipients))
+	}
+
+	msg := fmt.Sprintf("Send %s to %s?", pages, to)
+	if sendAt != "" {
+		msg = fmt.Sprintf("Send %s to %s on %s?", pages, to, sendAt)
+	}
+
+	forms.ShowConfirm("Send fax", msg, f.window, func(confirmed bool) {
+		if confirmed {
+			onConfirm()
+		}
+	})
+}
+
+// send adds the fax to the recipient of the recipient information entries to
+// the outbound queue.
+//
+// Steps:
+// 1. Open the document file and stream it to the queue with the prepared data.
+// 2. Handle any errors and display a message describing the failed step if necessary.
+// 3. Follow the queued fax and then the status of its transmission in the background.
+//
+// Parameters:
+//   - ctx: The context of the send, it is cancelled by the "Cancel" button.
+func (f *SendFaxForm) send(ctx context.Context) {
+	file, err := os.Open(f.filePath)
 	if err != nil {
+		f.finishSend()
 		logger.Inst().Error(err.Error())
-		forms.ShowError("error in sending the fax", f.window)
+		forms.ShowError(fmt.Sprintf("Failed to open the file '%s'", f.filePath), f.window)
+		return
+	}
+	defer file.Close()
+
+	queuedFax, err := f.apiUI.EnqueueFax(ctx, f.contact, f.documentRecord, f.transmission, file, f.fileModel)
+
+	f.finishSend()
+
+	if err != nil {
+		f.showSendError(err)
 		return
 	}
-	forms.ShowInfo("success", "the fax has been sent!", f.window)
+	forms.ShowInfo("success", fmt.Sprintf("the fax has been queued as job %s", queuedFax.ID), f.window)
+
+	go f.followQueuedFax(queuedFax.ID)
+}
+
+// followQueuedFax follows the events of the send job of a queued fax. The
+// steps are logged, the faxes are refreshed once it has been sent, and the
+// final status of its transmission is shown. A failed fax is shown with its last error.
+//
+// Parameters:
+//   - queuedID: The job ID of the queued fax.
+func (f *SendFaxForm) followQueuedFax(queuedID string) {
+	err := f.apiUI.FollowJobEvents(context.Background(), queuedID, 0, func(event api.JobEvent) {
+		logger.Inst().Info(fmt.Sprintf("the queued fax %s: %s", queuedID, event.Message))
+
+		switch {
+		case event.Type == api.JOB_EVENT_SENT:
+			f.SignalFunc()
+		case event.Type == api.JOB_EVENT_FAILED:
+			forms.ShowError(fmt.Sprintf("the queued fax %s failed: %s", queuedID, event.Error), f.window)
+		case event.Final && event.Error != "":
+			logger.Inst().Error(event.Error)
+		case event.Final && event.FaxStatus != nil:
+			f.showFaxStatus(*event.FaxStatus)
+		}
+	})
+	if err != nil {
+		logger.Inst().Error(err.Error())
+	}
+}
+
+// onScheduleClick checks the chosen send time and schedules the fax in the background.
+//
+// Parameters:
+//   - recipients: The recipients of the recipient list, broadcasts can not be scheduled.
+func (f *SendFaxForm) onScheduleClick(recipients []api.Contact) {
+	if len(recipients) > 0 {
+		forms.ShowError("A broadcast to a recipient list can not be sent later", f.window)
+		return
+	}
+
+	sendAt, err := f.sendLaterPicker.Time()
+	if err != nil {
+		forms.ShowError(err.Error(), f.window)
+		return
+	}
+
+	if !sendAt.After(time.Now()) {
+		forms.ShowError("The time the fax is sent at must be in the future", f.window)
+		return
+	}
+
+	f.confirmSend(recipients, sendAt.Format(SCHEDULED_TIME_FORMAT), func() {
+		ctx := f.startSend()
+		go f.schedule(ctx, sendAt)
+	})
+}
+
+// schedule schedules the fax to the recipient of the recipient information entries.
+//
+// Steps:
+// 1. Open the document file and stream it to the API with the prepared data and the send time.
+// 2. Handle any errors and display a message describing the failed step if necessary.
+//
+// Parameters:
+//   - ctx: The context of the request, it is cancelled by the "Cancel" button.
+//   - sendAt: The time the fax is sent at.
+func (f *SendFaxForm) schedule(ctx context.Context, sendAt time.Time) {
+	file, err := os.Open(f.filePath)
+	if err != nil {
+		f.finishSend()
+		logger.Inst().Error(err.Error())
+		forms.ShowError(fmt.Sprintf("Failed to open the file '%s'", f.filePath), f.window)
+		return
+	}
+	defer file.Close()
+
+	scheduledFax, err := f.apiUI.ScheduleFax(ctx, f.contact, f.documentRecord, f.transmission, file, f.fileModel, sendAt)
+
+	f.finishSend()
+
+	if err != nil {
+		f.showSendError(err)
+		return
+	}
+
+	f.sendLaterPicker.Reset()
+	forms.ShowInfo("success", fmt.Sprintf("the fax has been scheduled for %s", scheduledFax.SendAt.Local().Format(SCHEDULED_TIME_FORMAT)), f.window)
+	f.SignalFunc()
+}
+
+// broadcast sends the fax to all recipients of the recipient list.
+//
+// Steps:
+// 1. Call the API to broadcast the fax with the prepared data.
+// 2. Show a summary of the sent and failed recipients.
+//
+// Parameters:
+//   - ctx: The context of the send, it is cancelled by the "Cancel" button.
+//   - recipients: The recipients of the fax.
+func (f *SendFaxForm) broadcast(ctx context.Context, recipients []api.Contact) {
+	results, err := f.apiUI.BroadcastFax(ctx, recipients, f.documentRecord, f.transmission, f.fileContents, f.fileModel)
+
+	f.finishSend()
+
+	if err != nil {
+		f.showSendError(err)
+		return
+	}
+
+	sentCount := 0
+	failures := make([]string, 0)
+	for _, result := range results {
+		if result.Error == nil {
+			sentCount++
+			continue
+		}
+		logger.Inst().Error(fmt.Sprintf("broadcast to %s failed: %v", result.Phone, result.Error))
+		failures = append(failures, fmt.Sprintf("%s: %s", result.Phone, describeSendError(result.Error)))
+	}
+
+	if len(failures) > 0 {
+		forms.ShowError(fmt.Sprintf("the fax has been queued for %d of %d recipients\n%s",
+			sentCount, len(results), strings.Join(failures, "\n")), f.window)
+	} else {
+		forms.ShowInfo("success", fmt.Sprintf("the fax has been queued for %d recipients", sentCount), f.window)
+		f.recipientEditor.Clear()
+	}
 	f.SignalFunc()
 }
 
+// startSend switches the buttons to the sending state and creates the context
+// of the send, the "Cancel" button cancels it.
+//
+// Returns:
+//   - context.Context: The context of the send.
+func (f *SendFaxForm) startSend() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancelSend = cancel
+
+	f.sendButton.Disable()
+	f.cancelButton.Enable()
+	return ctx
+}
+
+// finishSend switches the buttons back once the send has finished.
+func (f *SendFaxForm) finishSend() {
+	if f.cancelSend != nil {
+		f.cancelSend()
+		f.cancelSend = nil
+	}
+
+	f.cancelButton.Disable()
+	f.sendButton.Enable()
+}
+
+// onCancelClick handles the click event of the "Cancel" button.
+// It cancels the running send, which aborts its in-flight step and deletes
+// the objects already created on the fax server.
+func (f *SendFaxForm) onCancelClick() {
+	if f.cancelSend != nil {
+		f.cancelButton.Disable()
+		f.cancelSend()
+	}
+}
+
+// showSendError shows the error of a failed send, or a notice if it was cancelled.
+//
+// Parameters:
+//   - err: The error returned by the API.
+func (f *SendFaxForm) showSendError(err error) {
+	if api.ToApiError(err).Code == api.ERROR_CODE_CANCELED {
+		forms.ShowInfo("cancelled", "the fax has not been sent", f.window)
+		return
+	}
+
+	logger.Inst().Error(err.Error())
+	forms.ShowError(describeSendError(err), f.window)
+}
+
+// contactFromEntries builds the recipient from the recipient information entries.
+func (f *SendFaxForm) contactFromEntries() api.Contact {
+	return api.Contact{
+		FirstName:   f.firstNameEntry.Text,
+		LastName:    f.lastNameEntry.Text,
+		Email:       f.emailEntry.Text,
+		Phone:       f.faxNumberEntry.Text,
+		Description: f.descriptionEntry.Text,
+		Custom1:     f.custom1Entry.Text,
+		Custom2:     f.custom2Entry.Text,
+		Custom3:     f.custom3Entry.Text,
+	}
+}
+
+// addRecipientFromEntries returns the recipient of the entries for the recipient
+// list and clears the entries for the next one.
+//
+// Returns:
+//   - api.Contact: The recipient to add.
+//   - bool: False if the fax number is empty.
+func (f *SendFaxForm) addRecipientFromEntries() (api.Contact, bool) {
+	if strings.TrimSpace(f.faxNumberEntry.Text) == "" {
+		forms.ShowError("Fax Number cannot be empty", f.window)
+		return api.Contact{}, false
+	}
+
+	contact := f.contactFromEntries()
+
+	f.firstNameEntry.SetText("")
+	f.lastNameEntry.SetText("")
+	f.emailEntry.SetText("")
+	f.faxNumberEntry.SetText("")
+
+	return contact, true
+}
+
+// showFaxStatus shows the final state of a sent fax.
+//
+// Parameters:
+//   - faxStatus: The final status of the sent transmission.
+func (f *SendFaxForm) showFaxStatus(faxStatus api.FaxStatus) {
+	message := fmt.Sprintf("the fax to %s finished with status: %s", faxStatus.DestinationFax, faxStatus.Status)
+	if faxStatus.Response != "" {
+		message = fmt.Sprintf("%s (%s)", message, faxStatus.Response)
+	}
+	forms.ShowInfo("fax status", message, f.window)
+	f.SignalFunc()
+}
+
+// describeSendError builds the message shown to the user for a failed send.
+//
+// Steps:
+// 1. Convert the error into an ApiError to get its stable code.
+// 2. Pick a message for the code and add the failed step and the ICT response.
+//
+// Parameters:
+//   - err: The error returned by SendFax.
+//
+// Returns:
+//   - string: The message to show in the error dialog.
+func describeSendError(err error) string {
+	apiErr := api.ToApiError(err)
+
+	var msg string
+	switch apiErr.Code {
+	case api.ERROR_CODE_SETTINGS_NOT_FOUND:
+		msg = "you are not logged in, please save your settings first"
+	case api.ERROR_CODE_AUTHENTICATION_FAILED:
+		msg = "the login has expired or the credentials are wrong, please log in again"
+	case api.ERROR_CODE_ICT_UNREACHABLE:
+		msg = "the fax server can not be reached"
+	case api.ERROR_CODE_ICT_SERVER_ERROR:
+		msg = "the fax server had an internal error, please try again later"
+	case api.ERROR_CODE_ICT_INVALID_RESPONSE:
+		msg = "the fax server sent a response that could not be read"
+	case api.ERROR_CODE_INVALID_FAX_NUMBER:
+		msg = "the fax number was rejected by the fax server"
+	case api.ERROR_CODE_DOCUMENT_REJECTED, api.ERROR_CODE_UPLOAD_REJECTED:
+		msg = "the document was rejected by the fax server"
+	case api.ERROR_CODE_TRANSMISSION_REJECTED, api.ERROR_CODE_PROGRAM_FAILED:
+		msg = "the fax server could not prepare the fax"
+	case api.ERROR_CODE_SEND_FAILED:
+		msg = "the fax server could not send the fax"
+	case api.ERROR_CODE_COVER_PAGE_FAILED, api.ERROR_CODE_NOT_FOUND, api.ERROR_CODE_CONVERSION_FAILED:
+		msg = apiErr.Message
+	case api.ERROR_CODE_CONVERTER_UNAVAILABLE:
+		msg = fmt.Sprintf("office documents are converted to PDF with LibreOffice, please install it "+
+			"or set office_converter in %s, or send the document as a PDF file\n%s", utilities.CONFIG_FILE_NAME, apiErr.Message)
+	default:
+		msg = "error in sending the fax"
+	}
+
+	if apiErr.Step != "" {
+		msg = fmt.Sprintf("%s (step: %s)", msg, apiErr.Step)
+	}
+
+	if apiErr.ICTBody != "" {
+		msg = fmt.Sprintf("%s\n%s", msg, apiErr.ICTBody)
+	}
+
+	return msg
+}
+
 func (f *SendFaxForm) GetMainContainer() *fyne.Container {
 	return f.formLayout
 }
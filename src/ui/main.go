@@ -1,6 +1,7 @@
 package main
 
 import (
+	"faxsender/src/api"
 	"faxsender/src/ui/forms/mainform"
 	"faxsender/src/ui/forms/sendfaxform"
 	"faxsender/src/utilities"
@@ -51,6 +52,8 @@ func main() {
 	}
 
 	logger.InitLog()
+	api.StartFaxQueue()
+	api.StartFaxHistorySync()
 
 	if showFaxSender {
 		faxSenderForm := sendfaxform.NewSendFaxForm(filePath, nil)
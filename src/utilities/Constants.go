@@ -1,5 +1,7 @@
 package utilities
 
+import "time"
+
 const (
 	APP_NAME              string = "Print2Fax"
 	APP_EXEC_FILE_NAME    string = "fax_sender"
@@ -8,13 +10,28 @@ const (
 	DEFAULT_LISTEN_PORT   int    = 11111
 	CHARS                 string = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	API_PATHS             string = "/api/v1"
+	API_V2_PATHS          string = "/api/v2"
 	SECRET_KEY            string = "FAX_SENDER"
 	SETTINGS_FILE_NAME    string = "settings.bin"
+	JOBS_DIR_NAME         string = "jobs"
+	SCHEDULED_DIR_NAME    string = "scheduled"
+	QUEUE_DIR_NAME        string = "queue"
+	HISTORY_FILE_NAME     string = "history.json"
+	COVER_PAGES_DIR_NAME  string = "coverpages"
+	CONVERSIONS_DIR_NAME  string = "conversions"
+	API_TOKEN_FILE_NAME   string = "api_token"
+	TLS_CERT_FILE_NAME    string = "tls_cert.pem"
+	TLS_KEY_FILE_NAME     string = "tls_key.pem"
 	ENCRYPTION_KEY        string = "0123456789012345" // the key size should be at least 16
 	SEPARATOR             string = "======================================"
 	JSON_CONTENT_TYPE     string = "application/json"
 	LOCALHOST             string = "127.0.0.1"
+	DEFAULT_BIND_ADDRESS  string = LOCALHOST
 	HTTP_SCHEMA           string = "http"
+	HTTPS_SCHEMA          string = "https"
+
+	WEBHOOKS_FILE_NAME           string = "webhooks.json"
+	WEBHOOK_DELIVERIES_FILE_NAME string = "webhook_deliveries.json"
 
 	WITH_COVER    string = "1"
 	WITHOUT_COVER string = "0"
@@ -22,7 +39,36 @@ const (
 	WITH_PRINT    string = "1"
 	WITHOUT_PRINT string = "0"
 
-	TWO_GB_SIZE int64 = 2_147_483_648
+	DEFAULT_MAX_UPLOAD_SIZE int64 = 256 << 20
+
+	DEFAULT_FAX_PROVIDER string = "ict"
+
+	DEFAULT_QUEUE_WORKERS int = 2
+
+	DEFAULT_COVER_PAGE_NOTICE string = "CONFIDENTIALITY NOTICE: This fax may contain confidential information intended only for the recipient named above. If you are not the intended recipient, please notify the sender and destroy all copies of this fax."
+
+	PAPER_SIZE_A4      string = "a4"
+	PAPER_SIZE_LETTER  string = "letter"
+	DEFAULT_PAPER_SIZE string = PAPER_SIZE_A4
+
+	DEFAULT_CONVERSION_TIMEOUT time.Duration = 2 * time.Minute
+
+	TLS_VERSION_1_2         string = "1.2"
+	TLS_VERSION_1_3         string = "1.3"
+	DEFAULT_TLS_MIN_VERSION string = TLS_VERSION_1_2
+
+	UPLOAD_FORMAT_PDF     string = "pdf"
+	UPLOAD_FORMAT_TIFF_G3 string = "tiff_g3"
+	UPLOAD_FORMAT_TIFF_G4 string = "tiff_g4"
+
+	FAX_RESOLUTION_STANDARD string = "standard"
+	FAX_RESOLUTION_FINE     string = "fine"
+
+	DEFAULT_ICT_RETRY_MAX_ATTEMPTS int           = 4
+	DEFAULT_ICT_RETRY_MAX_DELAY    time.Duration = 30 * time.Second
+
+	DEFAULT_WEBHOOK_RETRY_MAX_ATTEMPTS int           = 8
+	DEFAULT_WEBHOOK_RETRY_MAX_DELAY    time.Duration = 10 * time.Minute
 
 	ERROR_CODE_NOT_ENOUGH_ARGUMENT                int = -1
 	ERROR_CODE_UNKOWN_COMMAND                     int = -2
@@ -33,4 +79,6 @@ const (
 	ERROR_CODE_WORKING_DIR_NOT_FOUND              int = -7
 	ERROR_CODE_IN_INIT_FILE                       int = -8
 	ERROR_CODE_VERSION_FILE_NOT_FOUND             int = -9
+	ERROR_CODE_API_TOKEN_NOT_AVAILABLE            int = -10
+	ERROR_CODE_TLS_CERTIFICATE_NOT_AVAILABLE      int = -11
 )
@@ -2,12 +2,18 @@ package utilities
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"sync"
+	"time"
 )
 
+// ErrExecutionTimeout is returned when a command is killed because it ran longer than its timeout.
+var ErrExecutionTimeout = errors.New("the command took too long and was stopped")
+
 // TerminalArgs defines the arguments for executing a command on the terminal.
 type TerminalArgs struct {
 	Command string
@@ -40,6 +46,32 @@ func ExecuteOnTerminal(command string, args ...string) error {
 	return getOutput(cmd)
 }
 
+// ExecuteOnTerminalWithTimeout executes a terminal command and kills it once it
+// runs longer than the timeout or the context is cancelled.
+//
+// Parameters:
+//   - ctx: The context of the execution, cancelling it kills the command.
+//   - timeout: The maximum duration of the command.
+//   - command: The command to be executed.
+//   - args: Command-line arguments.
+//
+// Returns:
+//   - error: ErrExecutionTimeout if the command timed out, or an error if the execution of the command fails.
+func ExecuteOnTerminalWithTimeout(ctx context.Context, timeout time.Duration, command string, args ...string) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(timeoutCtx, command, args...)
+	err := getOutput(cmd)
+	if err != nil && errors.Is(timeoutCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		return fmt.Errorf("%w: %s ran longer than %v", ErrExecutionTimeout, command, timeout)
+	}
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
 // generateCmdWithTerminalArgs creates an exec.Cmd with the specified terminal arguments.
 func generateCmdWithTerminalArgs(terminalArgs *TerminalArgs) *exec.Cmd {
 	cmd := exec.Command(terminalArgs.Command, terminalArgs.Args...)
@@ -8,6 +8,8 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -23,7 +25,15 @@ const (
 	ODT_FILE_EXTENSION   string = "odt"
 	EMPTY_FILE_EXTENSION string = ""
 
-	MS_WORD_CONTENT_TYPE string = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	MS_WORD_CONTENT_TYPE        string = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	MS_WORD_LEGACY_CONTENT_TYPE string = "application/msword"
+	ODT_CONTENT_TYPE            string = "application/vnd.oasis.opendocument.text"
+	PDF_CONTENT_TYPE            string = "application/pdf"
+	TEXT_CONTENT_TYPE           string = "text/plain"
+	JPEG_CONTENT_TYPE           string = "image/jpeg"
+	JPG_CONTENT_TYPE            string = "image/jpg"
+	PNG_CONTENT_TYPE            string = "image/png"
+	TIFF_CONTENT_TYPE           string = "image/tiff"
 )
 
 // GetExecutablePath returns the path to the directory where the executable is located.
@@ -120,6 +130,174 @@ func GetSystemSettingsPath() (string, error) {
 	return path.Join(exec, SETTINGS_FILE_NAME), nil
 }
 
+// GetJobsPath returns the path to the directory where the fax jobs are stored.
+//
+// Returns:
+//   - string: The path to the jobs directory.
+//   - error: An error if the path cannot be determined.
+func GetJobsPath() (string, error) {
+	exec, err := GetExecutablePath()
+
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(exec, JOBS_DIR_NAME), nil
+}
+
+// GetScheduledPath returns the path to the directory where the scheduled faxes are stored.
+//
+// Returns:
+//   - string: The path to the scheduled faxes directory.
+//   - error: An error if the path cannot be determined.
+func GetScheduledPath() (string, error) {
+	exec, err := GetExecutablePath()
+
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(exec, SCHEDULED_DIR_NAME), nil
+}
+
+// GetQueuePath returns the path to the directory where the outbound queue is stored.
+//
+// Returns:
+//   - string: The path to the queue directory.
+//   - error: An error if the path cannot be determined.
+func GetQueuePath() (string, error) {
+	exec, err := GetExecutablePath()
+
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(exec, QUEUE_DIR_NAME), nil
+}
+
+// GetHistoryPath returns the path to the file where the fax history is stored.
+//
+// Returns:
+//   - string: The path to the fax history file.
+//   - error: An error if the path cannot be determined.
+func GetHistoryPath() (string, error) {
+	exec, err := GetExecutablePath()
+
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(exec, HISTORY_FILE_NAME), nil
+}
+
+// GetCoverPagesPath returns the path to the directory where the cover page templates are stored.
+//
+// Returns:
+//   - string: The path to the cover page templates directory.
+//   - error: An error if the path cannot be determined.
+func GetCoverPagesPath() (string, error) {
+	exec, err := GetExecutablePath()
+
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(exec, COVER_PAGES_DIR_NAME), nil
+}
+
+// GetConversionsPath returns the path to the directory where the converted documents are cached.
+//
+// Returns:
+//   - string: The path to the conversions directory.
+//   - error: An error if the path cannot be determined.
+func GetConversionsPath() (string, error) {
+	exec, err := GetExecutablePath()
+
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(exec, CONVERSIONS_DIR_NAME), nil
+}
+
+// GetApiTokenPath returns the path to the file holding the token of the daemon REST API.
+//
+// Returns:
+//   - string: The path to the API token file.
+//   - error: An error if the path cannot be determined.
+func GetApiTokenPath() (string, error) {
+	exec, err := GetExecutablePath()
+
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(exec, API_TOKEN_FILE_NAME), nil
+}
+
+// GetTLSCertPath returns the path to the certificate file the daemon generates
+// when no certificate is configured.
+//
+// Returns:
+//   - string: The path to the generated certificate file.
+//   - error: An error if the path cannot be determined.
+func GetTLSCertPath() (string, error) {
+	exec, err := GetExecutablePath()
+
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(exec, TLS_CERT_FILE_NAME), nil
+}
+
+// GetTLSKeyPath returns the path to the private key file the daemon generates
+// when no certificate is configured.
+//
+// Returns:
+//   - string: The path to the generated private key file.
+//   - error: An error if the path cannot be determined.
+func GetTLSKeyPath() (string, error) {
+	exec, err := GetExecutablePath()
+
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(exec, TLS_KEY_FILE_NAME), nil
+}
+
+// GetWebhooksPath returns the path to the file where the webhook subscriptions are stored.
+//
+// Returns:
+//   - string: The path to the webhook subscriptions file.
+//   - error: An error if the path cannot be determined.
+func GetWebhooksPath() (string, error) {
+	exec, err := GetExecutablePath()
+
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(exec, WEBHOOKS_FILE_NAME), nil
+}
+
+// GetWebhookDeliveriesPath returns the path to the file where the log of the
+// webhook deliveries is stored.
+//
+// Returns:
+//   - string: The path to the webhook delivery log file.
+//   - error: An error if the path cannot be determined.
+func GetWebhookDeliveriesPath() (string, error) {
+	exec, err := GetExecutablePath()
+
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(exec, WEBHOOK_DELIVERIES_FILE_NAME), nil
+}
+
 // CheckIfFileExists checks if a file exists at the specified path.
 //
 // Parameters:
@@ -154,15 +332,16 @@ func GetDocsFilePath() (string, error) {
 //   - string: The corresponding content type.
 func GetContentType(extension string) string {
 	contentTypes := map[string]string{
-		PDF_FILE_EXTENSION:  "application/pdf",
-		JPEG_FILE_EXTENSION: "image/jpeg",
-		JPG_FILE_EXTENSION:  "image/jpg",
-		PNG_FILE_EXTENSION:  "image/png",
-		TIFF_FILE_EXTENSION: "image/tiff",
-		TIF_FILE_EXTENSION:  "image/tiff",
+		TEXT_FILE_EXTENSION: TEXT_CONTENT_TYPE,
+		PDF_FILE_EXTENSION:  PDF_CONTENT_TYPE,
+		JPEG_FILE_EXTENSION: JPEG_CONTENT_TYPE,
+		JPG_FILE_EXTENSION:  JPG_CONTENT_TYPE,
+		PNG_FILE_EXTENSION:  PNG_CONTENT_TYPE,
+		TIFF_FILE_EXTENSION: TIFF_CONTENT_TYPE,
+		TIF_FILE_EXTENSION:  TIFF_CONTENT_TYPE,
 		DOCX_FILE_EXTENSION: MS_WORD_CONTENT_TYPE,
-		DOC_FILE_EXTENSION:  MS_WORD_CONTENT_TYPE,
-		ODT_FILE_EXTENSION:  "application/vnd.oasis.opendocument.text",
+		DOC_FILE_EXTENSION:  MS_WORD_LEGACY_CONTENT_TYPE,
+		ODT_FILE_EXTENSION:  ODT_CONTENT_TYPE,
 	}
 
 	return contentTypes[strings.ToLower(extension)]
@@ -222,6 +401,158 @@ func InitProjectFiles() error {
 	return nil
 }
 
+// WriteFileAtomic writes data to a temporary file of its own and renames it to
+// the file path, so readers never see a partially written file and concurrent
+// writers, e.g. the daemon and the UI, don't overwrite each other's temporary file.
+// Steps:
+// 1. Create a uniquely named temporary file next to the file.
+// 2. Write the data and flush it to the disk, so a crash doesn't leave an empty file.
+// 3. Rename the temporary file to the file path, removing it if any step fails.
+//
+// Parameters:
+//   - filePath: The path of the file to be written to.
+//   - data: The data to be written to the file.
+//   - permission: The file permission (e.g., 0644).
+//
+// Returns:
+//   - error: An error if the write or rename operation fails.
+func WriteFileAtomic(filePath string, data []byte, permission fs.FileMode) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tempFilePath := tempFile.Name()
+
+	err = tempFile.Chmod(permission)
+	if err == nil {
+		_, err = tempFile.Write(data)
+	}
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFilePath, filePath)
+	}
+
+	if err != nil {
+		os.Remove(tempFilePath)
+		return err
+	}
+	return nil
+}
+
+// staleLockFileCount makes the names of the stale lock files taken over by this process unique.
+var staleLockFileCount uint64
+
+// CreateLockFile creates a lock file, so only one process holds it. The holder
+// refreshes the lock file with RefreshLockFile, a lock file older than the lease
+// is left by a crashed process and is taken over.
+// Steps:
+// 1. Create the lock file, failing if it exists.
+// 2. If the existing lock file is within its lease, it is held.
+// 3. Otherwise rename it to a name of its own, so only one process takes it over.
+// 4. If the renamed file isn't the stale one, a process took the lock over
+// between the check and the rename: give the file back and report the lock held.
+// 5. Remove the stale file and create the lock file again.
+//
+// Parameters:
+//   - lockFilePath: The path of the lock file.
+//   - lease: The time a lock file stays held without being refreshed.
+//
+// Returns:
+//   - bool: False if another holder has the lock.
+//   - error: An error if the lock file can not be created.
+func CreateLockFile(lockFilePath string, lease time.Duration) (bool, error) {
+	for {
+		lockFile, err := os.OpenFile(lockFilePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			return true, lockFile.Close()
+		}
+		if !os.IsExist(err) {
+			return false, err
+		}
+
+		info, err := os.Stat(lockFilePath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if time.Since(info.ModTime()) < lease {
+			return false, nil
+		}
+
+		stalePath := fmt.Sprintf("%s.%d.%d", lockFilePath, os.Getpid(), atomic.AddUint64(&staleLockFileCount, 1))
+		err = os.Rename(lockFilePath, stalePath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+
+		renamed, err := os.Stat(stalePath)
+		if err == nil && !os.SameFile(info, renamed) {
+			// The link fails if yet another process created the lock meanwhile, it holds it then.
+			os.Link(stalePath, lockFilePath)
+			os.Remove(stalePath)
+			return false, nil
+		}
+
+		err = os.Remove(stalePath)
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+}
+
+// RefreshLockFile extends the lease of a held lock file.
+//
+// Parameters:
+//   - lockFilePath: The path of the lock file.
+//
+// Returns:
+//   - error: An error if the lock file can not be touched.
+func RefreshLockFile(lockFilePath string) error {
+	now := time.Now()
+	return os.Chtimes(lockFilePath, now, now)
+}
+
+// RemoveLockFile releases a held lock file, a missing lock file is released already.
+//
+// Parameters:
+//   - lockFilePath: The path of the lock file.
+//
+// Returns:
+//   - error: An error if the lock file can not be removed.
+func RemoveLockFile(lockFilePath string) error {
+	err := os.Remove(lockFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// IsLockFileHeld checks if a lock file exists and is within its lease.
+//
+// Parameters:
+//   - lockFilePath: The path of the lock file.
+//   - lease: The time a lock file stays held without being refreshed.
+//
+// Returns:
+//   - bool: True if a holder has the lock.
+func IsLockFileHeld(lockFilePath string, lease time.Duration) bool {
+	info, err := os.Stat(lockFilePath)
+	if err != nil {
+		return false
+	}
+	return time.Since(info.ModTime()) < lease
+}
+
 // CreateDirectory creates a directory with the specified path.
 //
 // Parameters:
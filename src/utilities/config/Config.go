@@ -3,6 +3,8 @@ package config
 import (
 	"faxsender/src/utilities"
 	"os"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -15,9 +17,27 @@ var (
 
 // Config represents the application configuration.
 type Config struct {
-	PortNumber int  `yaml:"port"`
-	Verbose    bool `yaml:"verbose"`
-	IConfig    `yaml:"-"`
+	PortNumber          int           `yaml:"port"`
+	BindAddress         string        `yaml:"bind_address"`
+	TLS                 bool          `yaml:"tls"`
+	TLSCertFile         string        `yaml:"tls_cert_file"`
+	TLSKeyFile          string        `yaml:"tls_key_file"`
+	TLSMinVersion       string        `yaml:"tls_min_version"`
+	Verbose             bool          `yaml:"verbose"`
+	ICTRetryMaxAttempts int           `yaml:"ict_retry_max_attempts"`
+	ICTRetryMaxDelay    time.Duration `yaml:"ict_retry_max_delay"`
+	MaxUploadSize       int64         `yaml:"max_upload_size"`
+	FaxProvider         string        `yaml:"fax_provider"`
+	QueueWorkers        int           `yaml:"queue_workers"`
+	CoverPageNotice     string        `yaml:"cover_page_notice"`
+	OfficeConverter     string        `yaml:"office_converter"`
+	ConversionTimeout   time.Duration `yaml:"conversion_timeout"`
+	PaperSize           string        `yaml:"paper_size"`
+
+	WebhookRetryMaxAttempts int           `yaml:"webhook_retry_max_attempts"`
+	WebhookRetryMaxDelay    time.Duration `yaml:"webhook_retry_max_delay"`
+
+	IConfig `yaml:"-"`
 }
 
 // newConfig creates a new configuration and returns it as an IConfig instance.
@@ -59,8 +79,22 @@ func createConfigIfNotExists() error {
 
 	if !utilities.CheckIfFileExists(path) {
 		config := &Config{
-			PortNumber: utilities.DEFAULT_LISTEN_PORT,
-			Verbose:    false,
+			PortNumber:          utilities.DEFAULT_LISTEN_PORT,
+			BindAddress:         utilities.DEFAULT_BIND_ADDRESS,
+			TLS:                 true,
+			TLSMinVersion:       utilities.DEFAULT_TLS_MIN_VERSION,
+			Verbose:             false,
+			ICTRetryMaxAttempts: utilities.DEFAULT_ICT_RETRY_MAX_ATTEMPTS,
+			ICTRetryMaxDelay:    utilities.DEFAULT_ICT_RETRY_MAX_DELAY,
+			MaxUploadSize:       utilities.DEFAULT_MAX_UPLOAD_SIZE,
+			FaxProvider:         utilities.DEFAULT_FAX_PROVIDER,
+			QueueWorkers:        utilities.DEFAULT_QUEUE_WORKERS,
+			CoverPageNotice:     utilities.DEFAULT_COVER_PAGE_NOTICE,
+			ConversionTimeout:   utilities.DEFAULT_CONVERSION_TIMEOUT,
+			PaperSize:           utilities.DEFAULT_PAPER_SIZE,
+
+			WebhookRetryMaxAttempts: utilities.DEFAULT_WEBHOOK_RETRY_MAX_ATTEMPTS,
+			WebhookRetryMaxDelay:    utilities.DEFAULT_WEBHOOK_RETRY_MAX_DELAY,
 		}
 
 		bytes, err := yaml.Marshal(config)
@@ -127,6 +161,59 @@ func (c Config) GetPortNumber() int {
 	return c.PortNumber
 }
 
+// GetBindAddress returns the address the daemon REST API listens on.
+// Configuration files without the option listen on the loopback interface only.
+//
+// Returns:
+//   - string: The IP address or host name to bind to.
+func (c Config) GetBindAddress() string {
+	bindAddress := strings.TrimSpace(c.BindAddress)
+	if bindAddress == "" {
+		return utilities.DEFAULT_BIND_ADDRESS
+	}
+	return bindAddress
+}
+
+// GetTLS returns whether the daemon REST API is served over HTTPS.
+// Configuration files without the option serve plain HTTP.
+//
+// Returns:
+//   - bool: True if the API is served over HTTPS, false otherwise.
+func (c Config) GetTLS() bool {
+	return c.TLS
+}
+
+// GetTLSCertFile returns the path to the PEM certificate file of the daemon.
+// When neither the certificate nor the key is configured, the daemon generates
+// a self-signed certificate on first start.
+//
+// Returns:
+//   - string: The path to the certificate file, empty if none is configured.
+func (c Config) GetTLSCertFile() string {
+	return strings.TrimSpace(c.TLSCertFile)
+}
+
+// GetTLSKeyFile returns the path to the PEM private key file of the daemon.
+//
+// Returns:
+//   - string: The path to the private key file, empty if none is configured.
+func (c Config) GetTLSKeyFile() string {
+	return strings.TrimSpace(c.TLSKeyFile)
+}
+
+// GetTLSMinVersion returns the minimum TLS version accepted by the daemon.
+// Configuration files without the option or with an unknown version use the default.
+//
+// Returns:
+//   - string: One of the TLS_VERSION_* constants.
+func (c Config) GetTLSMinVersion() string {
+	version := strings.TrimSpace(c.TLSMinVersion)
+	if version != utilities.TLS_VERSION_1_2 && version != utilities.TLS_VERSION_1_3 {
+		return utilities.DEFAULT_TLS_MIN_VERSION
+	}
+	return version
+}
+
 // GetVerbose returns whether the application is in verbose mode from the configuration.
 //
 // Returns:
@@ -134,3 +221,134 @@ func (c Config) GetPortNumber() int {
 func (c Config) GetVerbose() bool {
 	return c.Verbose
 }
+
+// GetICTRetryMaxAttempts returns the maximum number of attempts of a retried ICT call.
+// Configuration files without the option use the default.
+//
+// Returns:
+//   - int: The maximum number of attempts, including the first one.
+func (c Config) GetICTRetryMaxAttempts() int {
+	if c.ICTRetryMaxAttempts <= 0 {
+		return utilities.DEFAULT_ICT_RETRY_MAX_ATTEMPTS
+	}
+	return c.ICTRetryMaxAttempts
+}
+
+// GetICTRetryMaxDelay returns the maximum delay between two attempts of an ICT call.
+// Configuration files without the option use the default.
+//
+// Returns:
+//   - time.Duration: The maximum delay.
+func (c Config) GetICTRetryMaxDelay() time.Duration {
+	if c.ICTRetryMaxDelay <= 0 {
+		return utilities.DEFAULT_ICT_RETRY_MAX_DELAY
+	}
+	return c.ICTRetryMaxDelay
+}
+
+// GetWebhookRetryMaxAttempts returns the maximum number of attempts of a webhook delivery.
+// Configuration files without the option use the default.
+//
+// Returns:
+//   - int: The maximum number of attempts, including the first one.
+func (c Config) GetWebhookRetryMaxAttempts() int {
+	if c.WebhookRetryMaxAttempts <= 0 {
+		return utilities.DEFAULT_WEBHOOK_RETRY_MAX_ATTEMPTS
+	}
+	return c.WebhookRetryMaxAttempts
+}
+
+// GetWebhookRetryMaxDelay returns the maximum delay between two attempts of a webhook delivery.
+// Configuration files without the option use the default.
+//
+// Returns:
+//   - time.Duration: The maximum delay.
+func (c Config) GetWebhookRetryMaxDelay() time.Duration {
+	if c.WebhookRetryMaxDelay <= 0 {
+		return utilities.DEFAULT_WEBHOOK_RETRY_MAX_DELAY
+	}
+	return c.WebhookRetryMaxDelay
+}
+
+// GetMaxUploadSize returns the maximum size of an uploaded document in bytes.
+// Configuration files without the option use the default.
+//
+// Returns:
+//   - int64: The maximum size in bytes.
+func (c Config) GetMaxUploadSize() int64 {
+	if c.MaxUploadSize <= 0 {
+		return utilities.DEFAULT_MAX_UPLOAD_SIZE
+	}
+	return c.MaxUploadSize
+}
+
+// GetFaxProvider returns the name of the fax provider faxes are sent through.
+// Configuration files without the option use the default.
+//
+// Returns:
+//   - string: The name of the fax provider.
+func (c Config) GetFaxProvider() string {
+	if c.FaxProvider == "" {
+		return utilities.DEFAULT_FAX_PROVIDER
+	}
+	return c.FaxProvider
+}
+
+// GetQueueWorkers returns the number of workers sending the queued faxes in parallel.
+// Configuration files without the option use the default.
+//
+// Returns:
+//   - int: The number of queue workers.
+func (c Config) GetQueueWorkers() int {
+	if c.QueueWorkers <= 0 {
+		return utilities.DEFAULT_QUEUE_WORKERS
+	}
+	return c.QueueWorkers
+}
+
+// GetCoverPageNotice returns the confidentiality notice printed on the cover pages.
+// Configuration files without the option use the default.
+//
+// Returns:
+//   - string: The confidentiality notice.
+func (c Config) GetCoverPageNotice() string {
+	if c.CoverPageNotice == "" {
+		return utilities.DEFAULT_COVER_PAGE_NOTICE
+	}
+	return c.CoverPageNotice
+}
+
+// GetOfficeConverter returns the headless office converter used to convert
+// office documents to PDF documents, as a command name or a path.
+// Configuration files without the option search the PATH for LibreOffice.
+//
+// Returns:
+//   - string: The office converter, empty to search for it.
+func (c Config) GetOfficeConverter() string {
+	return c.OfficeConverter
+}
+
+// GetConversionTimeout returns the maximum duration of the conversion of an office document.
+// Configuration files without the option use the default.
+//
+// Returns:
+//   - time.Duration: The maximum duration of a conversion.
+func (c Config) GetConversionTimeout() time.Duration {
+	if c.ConversionTimeout <= 0 {
+		return utilities.DEFAULT_CONVERSION_TIMEOUT
+	}
+	return c.ConversionTimeout
+}
+
+// GetPaperSize returns the paper size of the pages rendered from text files and images.
+// Configuration files without the option or with an unknown size use the default.
+//
+// Returns:
+//   - string: One of the PAPER_SIZE_* constants.
+func (c Config) GetPaperSize() string {
+	paperSize := strings.ToLower(strings.TrimSpace(c.PaperSize))
+	if paperSize != utilities.PAPER_SIZE_A4 && paperSize != utilities.PAPER_SIZE_LETTER {
+		return utilities.DEFAULT_PAPER_SIZE
+	}
+	return paperSize
+}
@@ -1,13 +1,79 @@
 package config
 
+import "time"
+
 // IConfig is an interface representing the application configuration.
 type IConfig interface {
 	// GetPortNumber retrieves the port number from the configuration.
 	// Returns:
 	//   - int: The port number.
 	GetPortNumber() int
+	// GetBindAddress retrieves the address the daemon REST API listens on.
+	// Returns:
+	//   - string: The IP address or host name to bind to.
+	GetBindAddress() string
+	// GetTLS checks whether the daemon REST API is served over HTTPS.
+	// Returns:
+	//   - bool: True if the API is served over HTTPS, false otherwise.
+	GetTLS() bool
+	// GetTLSCertFile retrieves the path to the PEM certificate file of the daemon.
+	// Returns:
+	//   - string: The path to the certificate file, empty if none is configured.
+	GetTLSCertFile() string
+	// GetTLSKeyFile retrieves the path to the PEM private key file of the daemon.
+	// Returns:
+	//   - string: The path to the private key file, empty if none is configured.
+	GetTLSKeyFile() string
+	// GetTLSMinVersion retrieves the minimum TLS version accepted by the daemon.
+	// Returns:
+	//   - string: One of the TLS_VERSION_* constants.
+	GetTLSMinVersion() string
 	// GetVerbose checks whether the application is in verbose mode from the configuration.
 	// Returns:
 	//   - bool: True if the application is in verbose mode, false otherwise.
 	GetVerbose() bool
+	// GetICTRetryMaxAttempts retrieves the maximum number of attempts of a retried ICT call.
+	// Returns:
+	//   - int: The maximum number of attempts, including the first one.
+	GetICTRetryMaxAttempts() int
+	// GetICTRetryMaxDelay retrieves the maximum delay between two attempts of an ICT call.
+	// Returns:
+	//   - time.Duration: The maximum delay.
+	GetICTRetryMaxDelay() time.Duration
+	// GetWebhookRetryMaxAttempts retrieves the maximum number of attempts of a webhook delivery.
+	// Returns:
+	//   - int: The maximum number of attempts, including the first one.
+	GetWebhookRetryMaxAttempts() int
+	// GetWebhookRetryMaxDelay retrieves the maximum delay between two attempts of a webhook delivery.
+	// Returns:
+	//   - time.Duration: The maximum delay.
+	GetWebhookRetryMaxDelay() time.Duration
+	// GetMaxUploadSize retrieves the maximum size of an uploaded document.
+	// Returns:
+	//   - int64: The maximum size in bytes.
+	GetMaxUploadSize() int64
+	// GetFaxProvider retrieves the name of the fax provider faxes are sent through.
+	// Returns:
+	//   - string: The name of the fax provider.
+	GetFaxProvider() string
+	// GetQueueWorkers retrieves the number of workers sending the queued faxes.
+	// Returns:
+	//   - int: The number of queue workers.
+	GetQueueWorkers() int
+	// GetCoverPageNotice retrieves the confidentiality notice printed on the cover pages.
+	// Returns:
+	//   - string: The confidentiality notice.
+	GetCoverPageNotice() string
+	// GetOfficeConverter retrieves the headless office converter, empty to search for it.
+	// Returns:
+	//   - string: The command name or path of the office converter.
+	GetOfficeConverter() string
+	// GetConversionTimeout retrieves the maximum duration of the conversion of an office document.
+	// Returns:
+	//   - time.Duration: The maximum duration of a conversion.
+	GetConversionTimeout() time.Duration
+	// GetPaperSize retrieves the paper size of the pages rendered from text files and images.
+	// Returns:
+	//   - string: One of the PAPER_SIZE_* constants.
+	GetPaperSize() string
 }
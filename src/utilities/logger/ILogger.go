@@ -6,6 +6,10 @@ type ILogger interface {
 	// Parameters:
 	//   - message: The message to be logged.
 	Info(message string)
+	// Warn logs a warning message.
+	// Parameters:
+	//   - message: The warning message to be logged.
+	Warn(message string)
 	// Error logs an error message.
 	// Parameters:
 	//   - message: The error message to be logged.
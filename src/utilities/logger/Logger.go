@@ -128,6 +128,11 @@ func (l *Logger) Info(message string) {
 	zapLogger.Info(message)
 }
 
+// Warn logs a warning message.
+func (l *Logger) Warn(message string) {
+	zapLogger.Warn(message)
+}
+
 // Error logs an error message.
 func (l *Logger) Error(message string) {
 	zapLogger.Error(message)
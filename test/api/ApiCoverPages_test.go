@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"faxsender/src/api"
+	"faxsender/src/document"
+	"testing"
+)
+
+func TestSendFaxWithCoverPage(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	record, transmission, fileModel := newTransmission("cover page")
+	ctx := context.Background()
+
+	templates, err := calls.GetCoverPageTemplates(ctx)
+	if err != nil || len(templates) == 0 || templates[0] != document.DEFAULT_COVER_PAGE_TEMPLATE_NAME {
+		t.Fatalf("expected the default template, got %v, %v", templates, err)
+	}
+
+	page := document.NewPdfPage(document.PAGE_SIZE_A4)
+	page.Text(72, 720, document.PDF_FONT_COURIER, 12, "body")
+	pdf := document.WritePdf([]*document.PdfPage{page})
+
+	transmission.CoverPageTemplate = document.DEFAULT_COVER_PAGE_TEMPLATE_NAME
+	transmissionID, err := calls.SendFax(ctx, api.Contact{FirstName: "Ada", Phone: "+15551234567"}, record, transmission, pdf, fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sent, _ := fake.Transmission(transmissionID)
+	if sent.Transmission.IsCoverPage != 0 {
+		t.Errorf("the cover page of the fax server should be switched off, got %d", sent.Transmission.IsCoverPage)
+	}
+
+	sentDocument, _ := fake.TransmissionDocument(transmissionID)
+	doc, err := document.ParsePdf(sentDocument.Media)
+	if err != nil {
+		t.Fatalf("the sent document can't be read: %v", err)
+	}
+	if count, _ := doc.PageCount(); count != 2 {
+		t.Errorf("expected the cover page and the document page, got %d pages", count)
+	}
+}
+
+func TestSendFaxWithCoverPageErrors(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	record, transmission, fileModel := newTransmission("cover page errors")
+	ctx := context.Background()
+	contact := api.Contact{Phone: "+15551234567"}
+
+	transmission.CoverPageTemplate = "missing"
+	_, err := calls.SendFax(ctx, contact, record, transmission, document.WritePdf([]*document.PdfPage{document.NewPdfPage(document.PAGE_SIZE_A4)}), fileModel)
+	expectApiError(t, err, api.ERROR_CODE_NOT_FOUND)
+
+	transmission.CoverPageTemplate = document.DEFAULT_COVER_PAGE_TEMPLATE_NAME
+	_, err = calls.SendFax(ctx, contact, record, transmission, []byte(FAKE_DOCUMENT), fileModel)
+	expectApiError(t, err, api.ERROR_CODE_COVER_PAGE_FAILED)
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"faxsender/src/api"
+	"faxsender/src/document"
+	"faxsender/src/utilities"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+func TestSendFaxConvertsTextDocument(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	record, transmission, _ := newTransmission("text document")
+	fileModel := api.SendFileInfo{ContentType: utilities.TEXT_CONTENT_TYPE}
+
+	transmission.CoverPageTemplate = document.DEFAULT_COVER_PAGE_TEMPLATE_NAME
+	transmissionID, err := calls.SendFax(context.Background(), api.Contact{Phone: "+15551234567"}, record, transmission, []byte("hello\nworld\n"), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sentDocument, _ := fake.TransmissionDocument(transmissionID)
+	if sentDocument.ContentType != utilities.PDF_CONTENT_TYPE {
+		t.Errorf("expected a PDF document, got %q", sentDocument.ContentType)
+	}
+
+	doc, err := document.ParsePdf(sentDocument.Media)
+	if err != nil {
+		t.Fatalf("the sent document can't be read: %v", err)
+	}
+	if count, _ := doc.PageCount(); count != 2 {
+		t.Errorf("expected the cover page and the text page, got %d pages", count)
+	}
+}
+
+func TestEnqueueFaxRejectsInvalidImage(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	record, transmission, _ := newTransmission("invalid image")
+	fileModel := api.SendFileInfo{ContentType: utilities.PNG_CONTENT_TYPE}
+
+	_, err := calls.EnqueueFax(context.Background(), api.Contact{Phone: "+15551234567"}, record, transmission, strings.NewReader("not a png"), fileModel)
+	expectApiError(t, err, api.ERROR_CODE_CONVERSION_FAILED)
+}
+
+func TestSendFaxAsFaxTiff(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	record, transmission, _ := newTransmission("tiff image")
+	fileModel := api.SendFileInfo{ContentType: utilities.PNG_CONTENT_TYPE}
+
+	var pngFile bytes.Buffer
+	png.Encode(&pngFile, image.NewGray(image.Rect(0, 0, 100, 100)))
+
+	transmission.UploadFormat = utilities.UPLOAD_FORMAT_TIFF_G4
+	transmission.FaxResolution = utilities.FAX_RESOLUTION_FINE
+	transmissionID, err := calls.SendFax(context.Background(), api.Contact{Phone: "+15551234567"}, record, transmission, pngFile.Bytes(), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sentDocument, _ := fake.TransmissionDocument(transmissionID)
+	if sentDocument.ContentType != utilities.TIFF_CONTENT_TYPE {
+		t.Fatalf("expected a TIFF image, got %q", sentDocument.ContentType)
+	}
+	if page, err := tiff.Decode(bytes.NewReader(sentDocument.Media)); err != nil || page.Bounds().Dx() != document.FAX_TIFF_WIDTH {
+		t.Errorf("the sent image isn't a fax TIFF image: %v", err)
+	}
+
+	transmission.CoverPageTemplate = document.DEFAULT_COVER_PAGE_TEMPLATE_NAME
+	_, err = calls.SendFax(context.Background(), api.Contact{Phone: "+15551234567"}, record, transmission, pngFile.Bytes(), fileModel)
+	expectApiError(t, err, api.ERROR_CODE_COVER_PAGE_FAILED)
+
+	transmission.CoverPageTemplate = ""
+	_, err = calls.SendFax(context.Background(), api.Contact{Phone: "+15551234567"}, record, transmission, []byte("text"),
+		api.SendFileInfo{ContentType: utilities.TEXT_CONTENT_TYPE})
+	expectApiError(t, err, api.ERROR_CODE_CONVERSION_FAILED)
+
+	transmission.UploadFormat = "gif"
+	_, err = calls.SendFax(context.Background(), api.Contact{Phone: "+15551234567"}, record, transmission, pngFile.Bytes(), fileModel)
+	expectApiError(t, err, api.ERROR_CODE_INVALID_REQUEST)
+}
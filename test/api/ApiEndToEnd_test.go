@@ -0,0 +1,354 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"faxsender/src/api"
+	"faxsender/src/api/icttest"
+	"faxsender/src/utilities"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	FAKE_USERNAME = "user@example.com"
+	FAKE_PASSWORD = "secret"
+	FAKE_DOCUMENT = "%PDF-1.4 fake document"
+)
+
+func newFakeServer(t *testing.T) *icttest.FakeICTServer {
+	fake := icttest.NewFakeICTServer(FAKE_USERNAME, FAKE_PASSWORD)
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+func newDirectCalls(t *testing.T, userData api.UserData) api.IApiUICalls {
+	calls := api.NewApiServerDirectCalls()
+	if err := calls.SaveSettings(context.Background(), userData); err != nil {
+		t.Fatalf("saving the settings failed: %v", err)
+	}
+	return calls
+}
+
+// newTransmission returns the fields of a send, the title keeps the fax job
+// of every test apart.
+func newTransmission(title string) (api.DocumentRecord, api.Transmission, api.SendFileInfo) {
+	document := api.DocumentRecord{Title: title}
+	transmission := api.Transmission{
+		Title:      title,
+		AccountID:  icttest.FAKE_ACCOUNT_ID,
+		IsPrint:    "1",
+		TryAllowed: "1",
+	}
+	return document, transmission, api.SendFileInfo{ContentType: "application/pdf"}
+}
+
+func expectApiError(t *testing.T, err error, code string) *api.ApiError {
+	t.Helper()
+
+	var apiErr *api.ApiError
+	if !errors.As(err, &apiErr) || apiErr.Code != code {
+		t.Fatalf("expected a %s error, got %v", code, err)
+	}
+	return apiErr
+}
+
+func TestSendFaxEndToEnd(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("send")
+
+	transmissionID, err := calls.SendFax(context.Background(), api.Contact{Phone: "+15551234567"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sent, ok := fake.Transmission(transmissionID)
+	if !ok || !sent.Sent {
+		t.Fatalf("the transmission %d has not been sent", transmissionID)
+	}
+
+	sentDocument, _ := fake.TransmissionDocument(transmissionID)
+	if string(sentDocument.Media) != FAKE_DOCUMENT {
+		t.Errorf("unexpected document %q", sentDocument.Media)
+	}
+
+	faxStatus, err := calls.GetFaxStatus(context.Background(), transmissionID)
+	if err != nil || !faxStatus.IsFinal || faxStatus.DestinationFax != "+15551234567" {
+		t.Errorf("unexpected status %+v, %v", faxStatus, err)
+	}
+}
+
+func TestSendFaxReauthenticatesExpiredToken(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+
+	if _, err := calls.GetAllAccounts(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fake.ExpireTokens()
+
+	accounts, err := calls.GetAllAccounts(context.Background())
+	if err != nil || len(accounts) != 1 {
+		t.Fatalf("unexpected accounts %v, %v", accounts, err)
+	}
+
+	if fake.Requests(icttest.ROUTE_AUTHENTICATE) != 2 {
+		t.Errorf("expected 2 authentications, got %d", fake.Requests(icttest.ROUTE_AUTHENTICATE))
+	}
+}
+
+func TestSettingsChangedByAnotherProcess(t *testing.T) {
+	oldFake := newFakeServer(t)
+	newFake := newFakeServer(t)
+	calls := newDirectCalls(t, newFake.UserData())
+	settingsFilePath, _ := utilities.GetSystemSettingsPath()
+	newSettings, _ := os.ReadFile(settingsFilePath)
+
+	calls = newDirectCalls(t, oldFake.UserData())
+	if _, err := calls.GetAllAccounts(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The other process saves new settings, the cached provider of the old ones is dropped.
+	time.Sleep(10 * time.Millisecond)
+	if err := os.WriteFile(settingsFilePath, newSettings, 0644); err != nil {
+		t.Fatalf("writing the settings failed: %v", err)
+	}
+	if _, err := calls.GetAllAccounts(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if oldFake.Requests(icttest.ROUTE_ACCOUNTS) != 1 || newFake.Requests(icttest.ROUTE_ACCOUNTS) != 1 {
+		t.Errorf("the accounts have been listed %d times with the old settings and %d times with the new ones",
+			oldFake.Requests(icttest.ROUTE_ACCOUNTS), newFake.Requests(icttest.ROUTE_ACCOUNTS))
+	}
+
+	// The other process logs out.
+	os.Remove(settingsFilePath)
+	_, err := calls.GetAllAccounts(context.Background())
+	expectApiError(t, err, api.ERROR_CODE_SETTINGS_NOT_FOUND)
+}
+
+func TestSendFaxRetriesTransientUploadFailure(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("retry")
+
+	fake.FailNext(icttest.ROUTE_MEDIA, http.StatusServiceUnavailable, 2)
+
+	transmissionID, err := calls.SendFax(context.Background(), api.Contact{Phone: "+15551234567"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fake.Requests(icttest.ROUTE_MEDIA) != 3 {
+		t.Errorf("expected 3 uploads, got %d", fake.Requests(icttest.ROUTE_MEDIA))
+	}
+
+	sentDocument, _ := fake.TransmissionDocument(transmissionID)
+	if string(sentDocument.Media) != FAKE_DOCUMENT {
+		t.Errorf("the retried upload sent %q", sentDocument.Media)
+	}
+}
+
+func TestSendFaxRollsBackRejectedTransmission(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("rollback")
+
+	fake.FailNext(icttest.ROUTE_TRANSMISSIONS, http.StatusUnprocessableEntity, 1)
+
+	_, err := calls.SendFax(context.Background(), api.Contact{Phone: "+15551234567"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+
+	apiErr := expectApiError(t, err, api.ERROR_CODE_TRANSMISSION_REJECTED)
+	if apiErr.Step != api.ICT_STEP_TRANSMISSION || apiErr.ICTStatus != http.StatusUnprocessableEntity {
+		t.Errorf("unexpected error details %+v", apiErr)
+	}
+
+	if fake.ObjectCount() != 0 {
+		t.Errorf("%d objects were left on the ICT server", fake.ObjectCount())
+	}
+}
+
+func TestSendFaxMalformedResponse(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("malformed response")
+
+	// A 200 response whose body isn't an ID.
+	fake.FailNext(icttest.ROUTE_PROGRAMS, http.StatusOK, 1)
+
+	_, err := calls.SendFax(context.Background(), api.Contact{Phone: "+15551234567"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+
+	apiErr := expectApiError(t, err, api.ERROR_CODE_ICT_INVALID_RESPONSE)
+	if apiErr.Step != api.ICT_STEP_PROGRAM || fake.Requests(icttest.ROUTE_PROGRAMS) != 1 {
+		t.Errorf("unexpected error details %+v after %d requests", apiErr, fake.Requests(icttest.ROUTE_PROGRAMS))
+	}
+}
+
+func TestSendFaxCancelled(t *testing.T) {
+	for _, cancelledRoute := range []icttest.FakeRoute{icttest.ROUTE_PROGRAMS, icttest.ROUTE_SEND} {
+		t.Run(string(cancelledRoute), func(t *testing.T) {
+			fake := newFakeServer(t)
+			calls := newDirectCalls(t, fake.UserData())
+			title := "cancel " + string(cancelledRoute)
+			document, transmission, fileModel := newTransmission(title)
+
+			fake.SetLatency(cancelledRoute, 500*time.Millisecond)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				for fake.Requests(cancelledRoute) == 0 {
+					time.Sleep(5 * time.Millisecond)
+				}
+				cancel()
+			}()
+
+			_, err := calls.SendFax(ctx, api.Contact{Phone: "+15551234567"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+			expectApiError(t, err, api.ERROR_CODE_CANCELED)
+
+			if cancelledRoute != icttest.ROUTE_SEND {
+				if findFaxJob(t, title) != nil || fake.ObjectCount() != 0 {
+					t.Errorf("the cancelled send left its job or %d objects", fake.ObjectCount())
+				}
+				return
+			}
+
+			// The send request may have reached the ICT server, the job is kept and resumed.
+			if findFaxJob(t, title) == nil || fake.ObjectCount() != 4 {
+				t.Fatalf("the cancelled send step removed its job or left %d objects", fake.ObjectCount())
+			}
+
+			fake.SetLatency(cancelledRoute, 0)
+			transmissionID, err := calls.SendFax(context.Background(), api.Contact{Phone: "+15551234567"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+			if err != nil {
+				t.Fatalf("resuming the send failed: %v", err)
+			}
+			if sent, ok := fake.Transmission(transmissionID); !ok || !sent.Sent || findFaxJob(t, title) != nil {
+				t.Errorf("the resumed transmission %d has not been sent", transmissionID)
+			}
+		})
+	}
+}
+
+func TestAuthenticationFailure(t *testing.T) {
+	fake := newFakeServer(t)
+	userData := fake.UserData()
+	userData.Password = "wrong"
+	calls := newDirectCalls(t, userData)
+
+	_, err := calls.GetAccountInfo(context.Background())
+	expectApiError(t, err, api.ERROR_CODE_AUTHENTICATION_FAILED)
+}
+
+func TestBroadcastFaxEndToEnd(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("broadcast")
+
+	contacts := []api.Contact{{Phone: "+15551234567"}, {Phone: ""}, {Phone: "+15557654321"}}
+	results, err := calls.BroadcastFax(context.Background(), contacts, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(results) != 3 || results[0].Error != nil || results[2].Error != nil {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	expectApiError(t, results[1].Error, api.ERROR_CODE_INVALID_FAX_NUMBER)
+
+	if fake.Requests(icttest.ROUTE_MEDIA) != 1 {
+		t.Errorf("the document was uploaded %d times", fake.Requests(icttest.ROUTE_MEDIA))
+	}
+}
+
+func TestSendFaxInvalidAccountID(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("invalid account")
+	transmission.AccountID = "main"
+
+	_, err := calls.SendFax(context.Background(), api.Contact{Phone: "+15551234567"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+	expectApiError(t, err, api.ERROR_CODE_INVALID_REQUEST)
+
+	_, err = calls.BroadcastFax(context.Background(), []api.Contact{{Phone: "+15551234567"}}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+	expectApiError(t, err, api.ERROR_CODE_INVALID_REQUEST)
+
+	if fake.Requests(icttest.ROUTE_DOCUMENTS) != 0 || fake.ObjectCount() != 0 {
+		t.Errorf("%d objects were created for the invalid account", fake.ObjectCount())
+	}
+}
+
+func TestRoutesEndToEnd(t *testing.T) {
+	fake := newFakeServer(t)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api.InitRouters(router, loadApiToken(t))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ui := api.NewApiUI(server.Listener.Addr().(*net.TCPAddr).Port)
+	ctx := context.Background()
+
+	if err := ui.SaveSettings(ctx, fake.UserData()); err != nil {
+		t.Fatalf("saving the settings failed: %v", err)
+	}
+
+	accounts, err := ui.GetAllAccounts(ctx)
+	if err != nil || len(accounts) != 1 || accounts[0].AccountID != icttest.FAKE_ACCOUNT_ID {
+		t.Fatalf("unexpected accounts %v, %v", accounts, err)
+	}
+
+	document, transmission, fileModel := newTransmission("routes")
+	transmissionID, err := ui.SendFax(ctx, api.Contact{Phone: "+15551234567"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sentDocument, _ := fake.TransmissionDocument(transmissionID)
+	if string(sentDocument.Media) != FAKE_DOCUMENT {
+		t.Errorf("unexpected document %q", sentDocument.Media)
+	}
+
+	faxStatus, err := ui.GetFaxStatus(ctx, transmissionID)
+	if err != nil || !faxStatus.IsFinal {
+		t.Errorf("unexpected status %+v, %v", faxStatus, err)
+	}
+
+	if err := ui.SyncFaxHistory(ctx); err != nil {
+		t.Errorf("syncing the fax history failed: %v", err)
+	}
+
+	history, err := ui.SearchFaxHistory(ctx, api.FaxHistoryQuery{Title: "routes", From: time.Now().Add(-time.Hour), Limit: 1})
+	if err != nil || len(history.Records) != 1 || history.Records[0].TransmissionID != transmissionID {
+		t.Errorf("unexpected fax history %+v, %v", history, err)
+	}
+
+	transmissions, err := ui.QueryTransmissions(ctx, api.TransmissionQuery{Status: api.ICT_STATUS_DONE, IsPrint: "1"})
+	if err != nil || transmissions.Total != 1 || transmissions.Faxes[0].TransmissionID != transmissionID {
+		t.Errorf("unexpected transmissions %+v, %v", transmissions, err)
+	}
+
+	results, err := ui.BroadcastFax(ctx, []api.Contact{{Phone: "+15551234567"}, {Phone: "+15557654321"}}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+	if err != nil || len(results) != 2 || results[0].Error != nil || results[1].Error != nil {
+		t.Errorf("unexpected broadcast results %+v, %v", results, err)
+	}
+
+	document, transmission, fileModel = newTransmission("routes failure")
+	fake.FailNext(icttest.ROUTE_SEND, http.StatusUnprocessableEntity, 1)
+
+	_, err = ui.SendFax(ctx, api.Contact{Phone: "+15551234567"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+	apiErr := expectApiError(t, err, api.ERROR_CODE_SEND_FAILED)
+	if apiErr.Step != api.ICT_STEP_SEND {
+		t.Errorf("unexpected step %s", apiErr.Step)
+	}
+}
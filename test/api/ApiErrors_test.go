@@ -0,0 +1,24 @@
+package api
+
+import (
+	"faxsender/src/api"
+	"net/http"
+	"testing"
+)
+
+func TestICTErrorCodeOfContactStep(t *testing.T) {
+	expected := map[int]string{
+		http.StatusBadRequest:          api.ERROR_CODE_INVALID_FAX_NUMBER,
+		http.StatusUnprocessableEntity: api.ERROR_CODE_INVALID_FAX_NUMBER,
+		http.StatusNotFound:            api.ERROR_CODE_ICT_REQUEST_FAILED,
+		http.StatusConflict:            api.ERROR_CODE_ICT_REQUEST_FAILED,
+		http.StatusForbidden:           api.ERROR_CODE_AUTHENTICATION_FAILED,
+	}
+
+	for statusCode, code := range expected {
+		ictErr := &api.ICTError{Step: api.ICT_STEP_CONTACT, StatusCode: statusCode}
+		if ictErr.Code() != code {
+			t.Errorf("the status %d is %s, want %s", statusCode, ictErr.Code(), code)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"faxsender/src/api"
+	"faxsender/src/api/icttest"
+	"faxsender/src/utilities"
+	"testing"
+	"time"
+)
+
+func TestFaxHistoryRecordsAndSyncsSentFax(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("history")
+	ctx := context.Background()
+
+	transmissionID, err := calls.SendFax(ctx, api.Contact{FirstName: "Ada", LastName: "Lovelace", Phone: "+1 (555) 888-0000"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	page, err := calls.SearchFaxHistory(ctx, api.FaxHistoryQuery{Number: "5558880000", Title: "HISTORY"})
+	if err != nil || len(page.Records) != 1 || page.Total != 1 {
+		t.Fatalf("unexpected page %+v, %v", page, err)
+	}
+	records := page.Records
+
+	documentHash := sha256.Sum256([]byte(FAKE_DOCUMENT))
+	record := records[0]
+	if record.TransmissionID != transmissionID || record.DocumentHash != hex.EncodeToString(documentHash[:]) ||
+		record.RecipientName != "Ada Lovelace" || record.Source != api.FAX_HISTORY_SOURCE_APP {
+		t.Errorf("unexpected record %+v", record)
+	}
+
+	fake.SetTransmissionStatus(transmissionID, api.ICT_STATUS_BUSY)
+	if err := calls.SyncFaxHistory(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	page, err = calls.SearchFaxHistory(ctx, api.FaxHistoryQuery{Title: "history", Status: api.ICT_STATUS_BUSY})
+	if err != nil || len(page.Records) != 1 {
+		t.Fatalf("unexpected page %+v, %v", page, err)
+	}
+	records = page.Records
+	if !records[0].IsFinal || records[0].CallerID != icttest.FAKE_ACCOUNT_PHONE {
+		t.Errorf("the record was not synced: %+v", records[0])
+	}
+}
+
+func TestFaxHistoryQuery(t *testing.T) {
+	sentAt := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	record := api.FaxHistoryRecord{Title: "Quarterly Report", DestinationFax: "+49 30 1234567", Status: "done", SentAt: sentAt}
+
+	cases := []struct {
+		query   api.FaxHistoryQuery
+		matches bool
+	}{
+		{api.FaxHistoryQuery{}, true},
+		{api.FaxHistoryQuery{Number: "301234"}, true},
+		{api.FaxHistoryQuery{Number: "999"}, false},
+		{api.FaxHistoryQuery{Title: "quarterly"}, true},
+		{api.FaxHistoryQuery{Status: "DONE"}, true},
+		{api.FaxHistoryQuery{Status: "failed"}, false},
+		{api.FaxHistoryQuery{From: sentAt, To: sentAt.Add(time.Hour)}, true},
+		{api.FaxHistoryQuery{To: sentAt}, false},
+		{api.FaxHistoryQuery{From: sentAt.Add(time.Second)}, false},
+		{api.FaxHistoryQuery{Title: "report", Offset: 10, Limit: 5}, true},
+	}
+
+	for _, c := range cases {
+		if c.query.Matches(record) != c.matches {
+			t.Errorf("the query %+v should match: %v", c.query, c.matches)
+		}
+
+		parsed, err := api.ParseFaxHistoryQuery(c.query.Values())
+		if err != nil || parsed.Matches(record) != c.matches || parsed.Offset != c.query.Offset || parsed.Limit != c.query.Limit {
+			t.Errorf("the encoded query %+v changed: %+v, %v", c.query, parsed, err)
+		}
+	}
+}
+
+func TestFaxHistoryWaitsForOtherProcess(t *testing.T) {
+	historyFilePath, _ := utilities.GetHistoryPath()
+	lockFilePath := historyFilePath + api.FAX_HISTORY_LOCK_EXTENSION
+
+	// Another process is changing the history.
+	if locked, err := utilities.CreateLockFile(lockFilePath, api.FAX_HISTORY_LOCK_LEASE); !locked || err != nil {
+		t.Fatalf("locking the history failed: %v", err)
+	}
+
+	recorded := make(chan error, 1)
+	go func() {
+		recorded <- api.RecordSentFax(api.FaxHistoryRecord{TransmissionID: 987654, Title: "history lock", Source: api.FAX_HISTORY_SOURCE_APP})
+	}()
+
+	select {
+	case err := <-recorded:
+		t.Fatalf("the fax has been recorded while the history was locked: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	utilities.RemoveLockFile(lockFilePath)
+	if err := <-recorded; err != nil {
+		t.Fatalf("recording the fax failed: %v", err)
+	}
+
+	page, err := api.SearchFaxHistory(api.FaxHistoryQuery{Title: "history lock", Limit: 10})
+	if err != nil || page.Total != 1 {
+		t.Errorf("unexpected history %+v, %v", page, err)
+	}
+}
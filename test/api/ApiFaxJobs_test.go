@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"faxsender/src/api"
+	"faxsender/src/api/icttest"
+	"net/http"
+	"testing"
+)
+
+// findFaxJob returns the stored job of the send with the given title.
+func findFaxJob(t *testing.T, title string) *api.FaxJob {
+	t.Helper()
+
+	jobs, err := api.LoadUnfinishedFaxJobs()
+	if err != nil {
+		t.Fatalf("loading the fax jobs failed: %v", err)
+	}
+	for _, job := range jobs {
+		if job.Document.Title == title {
+			return job
+		}
+	}
+	return nil
+}
+
+func TestSendFaxResumesEveryStep(t *testing.T) {
+	creationRoutes := []icttest.FakeRoute{
+		icttest.ROUTE_CONTACTS,
+		icttest.ROUTE_DOCUMENTS,
+		icttest.ROUTE_MEDIA,
+		icttest.ROUTE_PROGRAMS,
+		icttest.ROUTE_TRANSMISSIONS,
+		icttest.ROUTE_SEND,
+	}
+
+	for _, failingRoute := range creationRoutes {
+		t.Run(string(failingRoute), func(t *testing.T) {
+			fake := newFakeServer(t)
+			calls := newDirectCalls(t, fake.UserData())
+			title := "resume " + string(failingRoute)
+			document, transmission, fileModel := newTransmission(title)
+
+			// Every attempt of the retry policy fails, so the send fails with a resumable error.
+			fake.FailNext(failingRoute, http.StatusServiceUnavailable, 3)
+
+			_, err := calls.SendFax(context.Background(), api.Contact{Phone: "+15551234567"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+			expectApiError(t, err, api.ERROR_CODE_ICT_SERVER_ERROR)
+
+			job := findFaxJob(t, title)
+			if job == nil {
+				t.Fatalf("the job of the failed send has not been kept")
+			}
+
+			transmissionID, err := calls.SendFax(context.Background(), api.Contact{Phone: "+15551234567"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+			if err != nil {
+				t.Fatalf("resuming the send failed: %v", err)
+			}
+
+			for _, route := range creationRoutes {
+				expected := 1
+				if route == failingRoute {
+					expected += 3
+				}
+				if fake.Requests(route) != expected {
+					t.Errorf("expected %d %s requests, got %d", expected, route, fake.Requests(route))
+				}
+			}
+
+			if fake.ObjectCount() != 4 {
+				t.Errorf("expected 4 objects on the ICT server, got %d", fake.ObjectCount())
+			}
+
+			sent, ok := fake.Transmission(transmissionID)
+			sentDocument, _ := fake.TransmissionDocument(transmissionID)
+			if !ok || !sent.Sent || string(sentDocument.Media) != FAKE_DOCUMENT {
+				t.Errorf("the transmission %d has not been sent with the document", transmissionID)
+			}
+
+			if findFaxJob(t, title) != nil {
+				t.Errorf("the job %s has not been removed", job.ID)
+			}
+		})
+	}
+}
+
+func TestSendFaxDoesNotResumeRejectedDocument(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	title := "rejected document"
+	document, transmission, fileModel := newTransmission(title)
+
+	fake.FailNext(icttest.ROUTE_MEDIA, http.StatusUnprocessableEntity, 1)
+
+	_, err := calls.SendFax(context.Background(), api.Contact{Phone: "+15551234567"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+	if err == nil {
+		t.Fatalf("the rejected upload has been sent")
+	}
+
+	if findFaxJob(t, title) != nil || fake.ObjectCount() != 0 {
+		t.Errorf("the rejected send left its job or %d objects", fake.ObjectCount())
+	}
+}
+
+func TestRunFaxJobConflict(t *testing.T) {
+	fake := newFakeServer(t)
+	client := api.NewICTClient(fake.UserData())
+	client.SetRetryPolicy(api.LoadRetryPolicy())
+	title := "conflict"
+	document, transmission, fileModel := newTransmission(title)
+
+	job, err := api.CreateFaxJob(api.Contact{Phone: "+15551234567"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("creating the job failed: %v", err)
+	}
+	if _, err := client.RunFaxJob(context.Background(), job); err != nil {
+		t.Fatalf("running the job failed: %v", err)
+	}
+
+	// The job has finished, running it again must not send it twice.
+	_, err = client.RunFaxJob(context.Background(), job)
+	expectApiError(t, err, api.ERROR_CODE_CONFLICT)
+	if fake.Requests(icttest.ROUTE_SEND) != 1 {
+		t.Errorf("the job has been sent %d times", fake.Requests(icttest.ROUTE_SEND))
+	}
+}
+
+func TestDiscardFaxJob(t *testing.T) {
+	fake := newFakeServer(t)
+	client := api.NewICTClient(fake.UserData())
+	client.SetRetryPolicy(api.LoadRetryPolicy())
+	title := "discard"
+	document, transmission, fileModel := newTransmission(title)
+
+	fake.FailNext(icttest.ROUTE_PROGRAMS, http.StatusServiceUnavailable, 3)
+
+	job, _ := api.CreateFaxJob(api.Contact{Phone: "+15551234567"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+	_, err := client.RunFaxJob(context.Background(), job)
+	var ictErr *api.ICTError
+	if !errors.As(err, &ictErr) || findFaxJob(t, title) == nil {
+		t.Fatalf("expected a kept job after %v", err)
+	}
+
+	if err := client.DiscardFaxJob(context.Background(), job); err != nil {
+		t.Fatalf("discarding the job failed: %v", err)
+	}
+	if findFaxJob(t, title) != nil || fake.ObjectCount() != 0 {
+		t.Errorf("the discarded job left its job or %d objects", fake.ObjectCount())
+	}
+}
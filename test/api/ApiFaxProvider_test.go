@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"faxsender/src/api"
+	"io"
+	"testing"
+)
+
+type stubFaxProvider struct {
+	userData api.UserData
+}
+
+func (p *stubFaxProvider) Authenticate(ctx context.Context) (*api.AuthResponse, error) {
+	return &api.AuthResponse{Email: p.userData.Username}, nil
+}
+
+func (p *stubFaxProvider) ListAccounts(ctx context.Context) ([]api.AccountResponse, error) {
+	return nil, nil
+}
+
+func (p *stubFaxProvider) SendDocument(ctx context.Context, contact api.Contact, document api.DocumentRecord,
+	transmission api.Transmission, file io.Reader, fileModel api.SendFileInfo) (int, error) {
+	return 1, nil
+}
+
+func (p *stubFaxProvider) GetStatus(ctx context.Context, transmissionID int) (*api.FaxStatus, error) {
+	return &api.FaxStatus{TransmissionID: transmissionID}, nil
+}
+
+func (p *stubFaxProvider) ListTransmissions(ctx context.Context) ([]api.FaxResponse, error) {
+	return nil, nil
+}
+
+func TestFaxProviderRegistry(t *testing.T) {
+	api.RegisterFaxProvider("Stub", func(userData api.UserData) (api.FaxProvider, error) {
+		return &stubFaxProvider{userData: userData}, nil
+	})
+
+	provider, err := api.NewFaxProvider("stub", api.UserData{Username: "user@example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	authResponse, _ := provider.Authenticate(context.Background())
+	if authResponse.Email != "user@example.com" {
+		t.Errorf("the provider was created without the user data: %+v", authResponse)
+	}
+
+	names := api.FaxProviderNames()
+	if len(names) < 2 || names[0] != api.FAX_PROVIDER_ICT || names[1] != "stub" {
+		t.Errorf("unexpected provider names %v", names)
+	}
+}
+
+func TestFaxProviderNotFound(t *testing.T) {
+	_, err := api.NewFaxProvider("missing", api.UserData{})
+
+	var apiErr *api.ApiError
+	if !errors.As(err, &apiErr) || apiErr.Code != api.ERROR_CODE_PROVIDER_NOT_FOUND {
+		t.Errorf("expected a %s error, got %v", api.ERROR_CODE_PROVIDER_NOT_FOUND, err)
+	}
+}
@@ -0,0 +1,270 @@
+package api
+
+import (
+	"context"
+	"faxsender/src/api"
+	"faxsender/src/api/icttest"
+	"faxsender/src/utilities"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runFaxQueue runs a queue with short intervals until the test ends.
+func runFaxQueue(t *testing.T, calls api.IApiUICalls) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		api.NewFaxQueue(calls, 2, 10*time.Millisecond).Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func followQueuedFax(t *testing.T, calls api.IApiUICalls, queuedID string) *api.QueuedFax {
+	t.Helper()
+
+	poller := api.NewFaxStatusPoller(calls, 10*time.Millisecond, 5*time.Second)
+	queuedFax, err := poller.FollowQueuedFax(context.Background(), queuedID, nil)
+	if err != nil {
+		t.Fatalf("following the queued fax failed: %v", err)
+	}
+	return queuedFax
+}
+
+func TestFaxQueueSendsQueuedFax(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("queue")
+
+	queuedFax, err := calls.EnqueueFax(context.Background(), api.Contact{Phone: "+15551234567"}, document, transmission, strings.NewReader(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if queuedFax.ID == "" || queuedFax.Status != api.QUEUED_FAX_STATUS_QUEUED {
+		t.Fatalf("unexpected queued fax %+v", queuedFax)
+	}
+
+	runFaxQueue(t, calls)
+
+	queuedFax = followQueuedFax(t, calls, queuedFax.ID)
+	if queuedFax.Status != api.QUEUED_FAX_STATUS_SENT || queuedFax.Attempts != 1 {
+		t.Fatalf("unexpected queued fax %+v", queuedFax)
+	}
+
+	sentDocument, ok := fake.TransmissionDocument(queuedFax.TransmissionID)
+	if !ok || string(sentDocument.Media) != FAKE_DOCUMENT {
+		t.Errorf("unexpected document %q", sentDocument.Media)
+	}
+}
+
+func TestFaxQueueRecoversInterruptedFax(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("queue recovery")
+
+	queuedFax, err := api.CreateQueuedFax(api.Contact{Phone: "+15551234567"}, document, transmission, strings.NewReader(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	queuedFax.Status = api.QUEUED_FAX_STATUS_SENDING
+	queuedFax.Attempts = 1
+	if err := api.SaveQueuedFax(queuedFax); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	runFaxQueue(t, calls)
+
+	queuedFax = followQueuedFax(t, calls, queuedFax.ID)
+	if queuedFax.Status != api.QUEUED_FAX_STATUS_SENT || queuedFax.Attempts != 2 {
+		t.Errorf("unexpected queued fax %+v", queuedFax)
+	}
+}
+
+func TestFaxQueueMarksRejectedFaxFailed(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("queue failure")
+
+	fake.FailNext(icttest.ROUTE_TRANSMISSIONS, http.StatusUnprocessableEntity, 1)
+
+	queuedFax, err := calls.EnqueueFax(context.Background(), api.Contact{Phone: "+15551234567"}, document, transmission, strings.NewReader(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	runFaxQueue(t, calls)
+
+	queuedFax = followQueuedFax(t, calls, queuedFax.ID)
+	if queuedFax.Status != api.QUEUED_FAX_STATUS_FAILED || queuedFax.LastError == "" {
+		t.Errorf("unexpected queued fax %+v", queuedFax)
+	}
+}
+
+// waitForFaxJobRemoved waits until the job of the send with the given title has been removed.
+func waitForFaxJobRemoved(t *testing.T, title string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for findFaxJob(t, title) != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("the job of %q has not been removed", title)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFaxQueueDiscardsJobOfFailedFax(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	title := "queue gives up"
+	document, transmission, fileModel := newTransmission(title)
+
+	queuedFax, err := api.CreateQueuedFax(api.Contact{Phone: "+15551234567"}, document, transmission, strings.NewReader(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The last attempt fails with a resumable error, the fax is given up.
+	queuedFax.Attempts = api.FAX_QUEUE_MAX_ATTEMPTS - 1
+	api.SaveQueuedFax(queuedFax)
+	fake.FailNext(icttest.ROUTE_PROGRAMS, http.StatusServiceUnavailable, 3)
+
+	runFaxQueue(t, calls)
+
+	queuedFax = followQueuedFax(t, calls, queuedFax.ID)
+	if queuedFax.Status != api.QUEUED_FAX_STATUS_FAILED {
+		t.Fatalf("unexpected queued fax %+v", queuedFax)
+	}
+
+	waitForFaxJobRemoved(t, title)
+	if fake.ObjectCount() != 0 {
+		t.Errorf("the failed fax left %d objects", fake.ObjectCount())
+	}
+}
+
+func TestFaxQueueDoesNotResendSentJob(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	title := "queue crash after send"
+	document, transmission, fileModel := newTransmission(title)
+	ctx := context.Background()
+
+	queuedFax, err := api.CreateQueuedFax(api.Contact{Phone: "+15551234567"}, document, transmission, strings.NewReader(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A previous run sent the fax and stopped before it saved the fax as sent.
+	ownerCtx := api.WithFaxJobOwner(ctx, api.QUEUED_FAX_JOB_OWNER_PREFIX+queuedFax.ID)
+	transmissionID, err := calls.SendFaxReader(ownerCtx, api.Contact{Phone: "+15551234567"}, document, transmission, strings.NewReader(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if job := findFaxJob(t, title); job == nil || !job.Checkpoint.Sent {
+		t.Fatalf("the sent job of the queued fax has not been kept: %+v", job)
+	}
+
+	queuedFax.Status = api.QUEUED_FAX_STATUS_SENDING
+	queuedFax.Attempts = 1
+	api.SaveQueuedFax(queuedFax)
+
+	runFaxQueue(t, calls)
+
+	queuedFax = followQueuedFax(t, calls, queuedFax.ID)
+	if queuedFax.Status != api.QUEUED_FAX_STATUS_SENT || queuedFax.TransmissionID != transmissionID {
+		t.Errorf("unexpected queued fax %+v, want transmission %d", queuedFax, transmissionID)
+	}
+	if fake.Requests(icttest.ROUTE_SEND) != 1 {
+		t.Errorf("the fax has been sent %d times", fake.Requests(icttest.ROUTE_SEND))
+	}
+	waitForFaxJobRemoved(t, title)
+}
+
+func TestQueuedFaxClaim(t *testing.T) {
+	document, transmission, fileModel := newTransmission("queue claim")
+
+	queuedFax, err := api.CreateQueuedFax(api.Contact{Phone: "+15551234567"}, document, transmission, strings.NewReader(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	queuedFax.Status = api.QUEUED_FAX_STATUS_FAILED
+	defer api.SaveQueuedFax(queuedFax)
+
+	if claimed, err := api.ClaimQueuedFax(queuedFax.ID); !claimed || err != nil {
+		t.Fatalf("the first claim failed: %v", err)
+	}
+	if claimed, _ := api.ClaimQueuedFax(queuedFax.ID); claimed {
+		t.Fatalf("the fax was claimed twice")
+	}
+
+	if err := api.ReleaseQueuedFax(queuedFax.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claimed, err := api.ClaimQueuedFax(queuedFax.ID); !claimed || err != nil {
+		t.Fatalf("the released fax could not be claimed: %v", err)
+	}
+
+	// The claim of a crashed process is taken over once its lease has expired.
+	queuePath, _ := utilities.GetQueuePath()
+	expired := time.Now().Add(-api.QUEUED_FAX_CLAIM_LEASE - time.Second)
+	os.Chtimes(path.Join(queuePath, queuedFax.ID+api.QUEUED_FAX_LOCK_EXTENSION), expired, expired)
+	if claimed, err := api.ClaimQueuedFax(queuedFax.ID); !claimed || err != nil {
+		t.Fatalf("the expired claim has not been taken over: %v", err)
+	}
+	if claimed, _ := api.ClaimQueuedFax(queuedFax.ID); claimed {
+		t.Fatalf("the taken over claim was claimed again")
+	}
+	api.ReleaseQueuedFax(queuedFax.ID)
+}
+
+func TestQueueRoutes(t *testing.T) {
+	fake := newFakeServer(t)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api.InitRouters(router, loadApiToken(t))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ui := api.NewApiUI(server.Listener.Addr().(*net.TCPAddr).Port)
+	ctx := context.Background()
+
+	if err := ui.SaveSettings(ctx, fake.UserData()); err != nil {
+		t.Fatalf("saving the settings failed: %v", err)
+	}
+
+	document, transmission, fileModel := newTransmission("queue routes")
+	queuedFax, err := ui.EnqueueFax(ctx, api.Contact{Phone: "+15551234567"}, document, transmission, strings.NewReader(FAKE_DOCUMENT), fileModel)
+	if err != nil || queuedFax.ID == "" {
+		t.Fatalf("unexpected queued fax %+v, %v", queuedFax, err)
+	}
+
+	runFaxQueue(t, ui)
+
+	queuedFax = followQueuedFax(t, ui, queuedFax.ID)
+	if queuedFax.Status != api.QUEUED_FAX_STATUS_SENT {
+		t.Fatalf("unexpected queued fax %+v", queuedFax)
+	}
+
+	queuedFaxes, err := ui.GetQueuedFaxes(ctx)
+	if err != nil || len(queuedFaxes) == 0 {
+		t.Errorf("unexpected queued faxes %+v, %v", queuedFaxes, err)
+	}
+
+	_, err = ui.GetQueuedFax(ctx, "missing")
+	expectApiError(t, err, api.ERROR_CODE_NOT_FOUND)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"faxsender/src/api"
+	"testing"
+	"time"
+)
+
+type stubStatusApi struct {
+	api.IApiUICalls
+	statuses []string
+	calls    int
+}
+
+func (s *stubStatusApi) GetFaxStatus(ctx context.Context, transmissionID int) (*api.FaxStatus, error) {
+	status := s.statuses[s.calls]
+	if s.calls < len(s.statuses)-1 {
+		s.calls++
+	}
+	return &api.FaxStatus{
+		TransmissionID: transmissionID,
+		Status:         status,
+		IsFinal:        api.IsFinalFaxStatus(status),
+	}, nil
+}
+
+func TestIsFinalFaxStatus(t *testing.T) {
+	for _, status := range []string{"done", "Failed", "busy", "no answer", "NO_ANSWER"} {
+		if !api.IsFinalFaxStatus(status) {
+			t.Errorf("the status '%s' should be final", status)
+		}
+	}
+
+	for _, status := range []string{"", "pending", "processing"} {
+		if api.IsFinalFaxStatus(status) {
+			t.Errorf("the status '%s' should not be final", status)
+		}
+	}
+}
+
+func TestFaxStatusPollerFollow(t *testing.T) {
+	stub := &stubStatusApi{statuses: []string{"pending", "pending", "processing", "done"}}
+	poller := api.NewFaxStatusPoller(stub, time.Millisecond, time.Second)
+
+	changes := make([]string, 0)
+	faxStatus, err := poller.Follow(context.Background(), 7, func(status api.FaxStatus) {
+		changes = append(changes, status.Status)
+	})
+	if err != nil {
+		t.Fatalf("the poller failed: %v", err)
+	}
+
+	if faxStatus.Status != "done" || faxStatus.TransmissionID != 7 {
+		t.Errorf("the wrong final status: %+v", faxStatus)
+	}
+
+	if len(changes) != 3 {
+		t.Errorf("the status changes should be reported once each: %v", changes)
+	}
+}
+
+func TestFaxStatusPollerTimeout(t *testing.T) {
+	stub := &stubStatusApi{statuses: []string{"pending"}}
+	poller := api.NewFaxStatusPoller(stub, time.Millisecond, 5*time.Millisecond)
+
+	_, err := poller.Follow(context.Background(), 7, nil)
+	if err == nil {
+		t.Error("the poller should time out")
+	}
+}
+
+func TestFaxStatusPollerCancel(t *testing.T) {
+	stub := &stubStatusApi{statuses: []string{"pending"}}
+	poller := api.NewFaxStatusPoller(stub, time.Hour, 2*time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go cancel()
+
+	_, err := poller.Follow(ctx, 7, nil)
+	if err != context.Canceled {
+		t.Errorf("the poller should stop when the context is cancelled: %v", err)
+	}
+}
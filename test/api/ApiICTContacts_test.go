@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"faxsender/src/api"
+	"faxsender/src/api/icttest"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSendFaxReusesExistingContact(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("reuse contact")
+	ctx := context.Background()
+
+	contactID := fake.AddContact(api.Contact{FirstName: "Ada", Phone: "+1 (555) 123-4567"})
+
+	transmissionID, err := calls.SendFax(ctx, api.Contact{Phone: "+15551234567"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sent, _ := fake.Transmission(transmissionID)
+	if sent.Transmission.ContactID != contactID || fake.Requests(icttest.ROUTE_CONTACTS) != 0 {
+		t.Errorf("the contact %d was not reused: %+v, %d created", contactID, sent, fake.Requests(icttest.ROUTE_CONTACTS))
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := calls.SendFax(ctx, api.Contact{Phone: "+15559876543"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if fake.Requests(icttest.ROUTE_CONTACTS) != 1 || len(fake.Contacts()) != 2 {
+		t.Errorf("expected one created contact, got %d requests and %d contacts", fake.Requests(icttest.ROUTE_CONTACTS), len(fake.Contacts()))
+	}
+}
+
+func TestRollbackKeepsReusedContact(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("rollback reused contact")
+
+	contactID := fake.AddContact(api.Contact{Phone: "+15551234567"})
+	fake.FailNext(icttest.ROUTE_TRANSMISSIONS, http.StatusUnprocessableEntity, 1)
+
+	_, err := calls.SendFax(context.Background(), api.Contact{Phone: "+15551234567"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+	expectApiError(t, err, api.ERROR_CODE_TRANSMISSION_REJECTED)
+
+	if _, ok := fake.Contacts()[contactID]; !ok || fake.ObjectCount() != 1 {
+		t.Errorf("the reused contact was deleted or objects were left: %d objects", fake.ObjectCount())
+	}
+}
+
+func TestSearchContactsRoute(t *testing.T) {
+	fake := newFakeServer(t)
+	fake.AddContact(api.Contact{FirstName: "Ada", LastName: "Lovelace", Phone: "+1 555 123 4567"})
+	fake.AddContact(api.Contact{FirstName: "Charles", LastName: "Babbage", Phone: "+44 20 7946 0000"})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api.InitRouters(router, loadApiToken(t))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ui := api.NewApiUI(server.Listener.Addr().(*net.TCPAddr).Port)
+	ctx := context.Background()
+
+	if err := ui.SaveSettings(ctx, fake.UserData()); err != nil {
+		t.Fatalf("saving the settings failed: %v", err)
+	}
+
+	cases := map[string]int{"lovelace": 1, "555123": 1, "+44 20": 1, "": 2, "nobody": 0}
+	for text, count := range cases {
+		contacts, err := ui.SearchContacts(ctx, text, 0)
+		if err != nil || len(contacts) != count {
+			t.Errorf("searching '%s' returned %+v, %v", text, contacts, err)
+		}
+	}
+
+	contacts, err := ui.SearchContacts(ctx, "", 1)
+	if err != nil || len(contacts) != 1 {
+		t.Errorf("the limit was ignored: %+v, %v", contacts, err)
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"faxsender/src/api"
+	"faxsender/src/api/icttest"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newRetryingClient returns an ICT client of the fake server retrying with the
+// given maximum delay, the backoff itself is short.
+func newRetryingClient(fake *icttest.FakeICTServer, maxDelay time.Duration) *api.ICTClient {
+	client := api.NewICTClient(fake.UserData())
+	client.SetRetryPolicy(api.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: maxDelay})
+	return client
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := api.RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    time.Second,
+	}
+
+	for attempt := 1; attempt <= 40; attempt++ {
+		limit := policy.MaxDelay
+		if attempt <= 4 {
+			limit = policy.BaseDelay << uint(attempt-1)
+		}
+
+		for i := 0; i < 20; i++ {
+			delay := policy.Backoff(attempt)
+			if delay < 0 || delay > limit {
+				t.Fatalf("the backoff of attempt %d is out of range: %v > %v", attempt, delay, limit)
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	delay, ok := api.ParseRetryAfter("7", now)
+	if !ok || delay != 7*time.Second {
+		t.Errorf("the wrong delay for seconds: %v %v", delay, ok)
+	}
+
+	delay, ok = api.ParseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now)
+	if !ok || delay != 90*time.Second {
+		t.Errorf("the wrong delay for an HTTP date: %v %v", delay, ok)
+	}
+
+	for _, value := range []string{"", "-1", "soon"} {
+		if _, ok := api.ParseRetryAfter(value, now); ok {
+			t.Errorf("the value '%s' should be rejected", value)
+		}
+	}
+}
+
+func TestRetryHonoursRetryAfter(t *testing.T) {
+	fake := newFakeServer(t)
+	client := newRetryingClient(fake, 5*time.Second)
+
+	fake.FailNextWithHeaders(icttest.ROUTE_DOCUMENTS, http.StatusServiceUnavailable, 1, map[string]string{"Retry-After": "1"})
+
+	start := time.Now()
+	if _, err := client.CreateDocumentRecord(context.Background(), api.DocumentRecord{Title: "retry after"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("the request has been retried after %v, before the Retry-After delay", elapsed)
+	}
+	if fake.Requests(icttest.ROUTE_DOCUMENTS) != 2 {
+		t.Errorf("expected 2 requests, got %d", fake.Requests(icttest.ROUTE_DOCUMENTS))
+	}
+}
+
+func TestRetryThrottledRequest(t *testing.T) {
+	fake := newFakeServer(t)
+	client := newRetryingClient(fake, 10*time.Millisecond)
+
+	fake.FailNext(icttest.ROUTE_DOCUMENTS, http.StatusTooManyRequests, 1)
+
+	if _, err := client.CreateDocumentRecord(context.Background(), api.DocumentRecord{Title: "throttled"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fake.Requests(icttest.ROUTE_DOCUMENTS) != 2 {
+		t.Errorf("expected 2 requests, got %d", fake.Requests(icttest.ROUTE_DOCUMENTS))
+	}
+}
+
+func TestRetrySkipsFailedPost(t *testing.T) {
+	fake := newFakeServer(t)
+	client := newRetryingClient(fake, 10*time.Millisecond)
+
+	// The ICT server may have created the document before it failed.
+	fake.FailNext(icttest.ROUTE_DOCUMENTS, http.StatusInternalServerError, 1)
+
+	_, err := client.CreateDocumentRecord(context.Background(), api.DocumentRecord{Title: "failed post"})
+	expectApiError(t, api.ToApiError(err), api.ERROR_CODE_ICT_SERVER_ERROR)
+	if fake.Requests(icttest.ROUTE_DOCUMENTS) != 1 {
+		t.Errorf("the POST has been sent %d times", fake.Requests(icttest.ROUTE_DOCUMENTS))
+	}
+}
+
+func TestRetryStopsWhenCancelled(t *testing.T) {
+	fake := newFakeServer(t)
+	client := newRetryingClient(fake, time.Minute)
+
+	fake.FailNextWithHeaders(icttest.ROUTE_DOCUMENTS, http.StatusServiceUnavailable, 1, map[string]string{"Retry-After": "60"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for fake.Requests(icttest.ROUTE_DOCUMENTS) == 0 {
+			time.Sleep(5 * time.Millisecond)
+		}
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := client.CreateDocumentRecord(ctx, api.DocumentRecord{Title: "cancelled backoff"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled request, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the backoff has not been stopped, the request returned after %v", elapsed)
+	}
+	if fake.Requests(icttest.ROUTE_DOCUMENTS) != 1 {
+		t.Errorf("expected 1 request, got %d", fake.Requests(icttest.ROUTE_DOCUMENTS))
+	}
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"faxsender/src/api"
+	"faxsender/src/api/icttest"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readJobEvents reads a job event stream to its end, checking that the id and
+// event fields match the data of every event.
+func readJobEvents(t *testing.T, body io.Reader) []api.JobEvent {
+	t.Helper()
+
+	var events []api.JobEvent
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		if name, value, ok := strings.Cut(line, ": "); ok {
+			fields[name] = value
+			continue
+		}
+
+		var event api.JobEvent
+		if err := json.Unmarshal([]byte(fields["data"]), &event); err != nil {
+			t.Fatalf("decoding the event %q failed: %v", fields["data"], err)
+		}
+		if fields["id"] != strconv.Itoa(event.ID) || fields["event"] != event.Type {
+			t.Errorf("the fields %v don't match the event %+v", fields, event)
+		}
+		events = append(events, event)
+		fields = map[string]string{}
+	}
+	return events
+}
+
+func TestJobEventsStream(t *testing.T) {
+	fake := newFakeServer(t)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api.InitRouters(router, loadApiToken(t))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ui := api.NewApiUI(server.Listener.Addr().(*net.TCPAddr).Port)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := ui.SaveSettings(ctx, fake.UserData()); err != nil {
+		t.Fatalf("saving the settings failed: %v", err)
+	}
+
+	document, transmission, fileModel := newTransmission("job events")
+	queuedFax, err := ui.EnqueueFax(ctx, api.Contact{Phone: "+15551234567"}, document, transmission, strings.NewReader(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	runFaxQueue(t, newDirectCalls(t, fake.UserData()))
+
+	var events []api.JobEvent
+	err = ui.FollowJobEvents(ctx, queuedFax.ID, 0, func(event api.JobEvent) {
+		events = append(events, event)
+	})
+	if err != nil {
+		t.Fatalf("following the job failed: %v", err)
+	}
+
+	want := []string{api.JOB_EVENT_QUEUED,
+		string(api.ICT_STEP_CONTACT), string(api.ICT_STEP_DOCUMENT), string(api.ICT_STEP_UPLOAD),
+		string(api.ICT_STEP_PROGRAM), string(api.ICT_STEP_TRANSMISSION), string(api.ICT_STEP_SEND),
+		api.JOB_EVENT_SENT, api.JOB_EVENT_STATUS}
+	if len(events) != len(want) {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	for i, event := range events {
+		name := event.Type
+		if event.Type == api.JOB_EVENT_STEP {
+			name = string(event.Step)
+		}
+		if name != want[i] || event.ID != i+1 || event.JobID != queuedFax.ID || event.Message == "" {
+			t.Errorf("event %d is %+v, want %s", i+1, event, want[i])
+		}
+	}
+
+	last := events[len(events)-1]
+	if !last.Final || last.FaxStatus == nil || !last.FaxStatus.IsFinal || last.TransmissionID == 0 {
+		t.Errorf("unexpected final event %+v", last)
+	}
+
+	// A client reconnecting with the last event it has only gets the next ones.
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v1/"+api.API_UI_JOBS+"/"+queuedFax.ID+"/"+api.API_UI_JOB_EVENTS, nil)
+	req.Header.Set(api.AUTHORIZATION_HEADER, api.BEARER_PREFIX+ui.(*api.ApiUI).Token)
+	req.Header.Set(api.LAST_EVENT_ID_HEADER, "7")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("the events request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != api.EVENT_STREAM_CONTENT_TYPE {
+		t.Errorf("unexpected content type %q", contentType)
+	}
+	replayed := readJobEvents(t, resp.Body)
+	if len(replayed) != 2 || replayed[0].ID != 8 || replayed[0].Type != api.JOB_EVENT_SENT {
+		t.Errorf("unexpected replayed events %+v", replayed)
+	}
+
+	err = ui.FollowJobEvents(ctx, "missing", 0, func(api.JobEvent) {})
+	expectApiError(t, err, api.ERROR_CODE_NOT_FOUND)
+}
+
+func TestJobEventsFailedFax(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("job events failure")
+
+	fake.FailNext(icttest.ROUTE_TRANSMISSIONS, http.StatusUnprocessableEntity, 1)
+
+	queuedFax, err := calls.EnqueueFax(context.Background(), api.Contact{Phone: "+15551234567"}, document, transmission, strings.NewReader(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	runFaxQueue(t, calls)
+
+	var last api.JobEvent
+	steps := 0
+	err = calls.FollowJobEvents(context.Background(), queuedFax.ID, 0, func(event api.JobEvent) {
+		if event.Type == api.JOB_EVENT_STEP {
+			steps++
+		}
+		last = event
+	})
+	if err != nil {
+		t.Fatalf("following the job failed: %v", err)
+	}
+
+	if last.Type != api.JOB_EVENT_FAILED || !last.Final || last.Error == "" || steps != 4 {
+		t.Errorf("unexpected final event %+v after %d steps", last, steps)
+	}
+}
+
+func TestSentFaxFollower(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("followed by the daemon")
+	subscription := newWebhookReceiver(t)
+
+	// The fax has been sent by the queue of the UI, or by a run of the daemon that stopped since.
+	transmissionID, err := calls.SendFaxReader(context.Background(), api.Contact{Phone: "+15551234567"}, document, transmission, strings.NewReader(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	queuedFax, err := api.CreateQueuedFax(api.Contact{Phone: "+15551234567"}, document, transmission, strings.NewReader(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	queuedFax.Status = api.QUEUED_FAX_STATUS_SENT
+	queuedFax.TransmissionID = transmissionID
+	api.SaveQueuedFax(queuedFax)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go api.RunSentFaxFollower(ctx, calls, 10*time.Millisecond)
+
+	waitForWebhookEvents(t, subscription.ID, queuedFax.ID, api.WEBHOOK_EVENT_SENT, api.WEBHOOK_EVENT_DELIVERED)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		queuedFax, _ = api.LoadQueuedFax(queuedFax.ID)
+		if queuedFax.DeliveryFollowed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the delivery of the queued fax has not been saved: %+v", queuedFax)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if queuedFax.FaxStatus == nil || !queuedFax.FaxStatus.IsFinal || queuedFax.DeliveryError != "" {
+		t.Errorf("unexpected delivery %+v", queuedFax)
+	}
+
+	// The followed fax is not followed again.
+	requests := fake.Requests(icttest.ROUTE_TRANSMISSION_STATUS)
+	time.Sleep(50 * time.Millisecond)
+	if fake.Requests(icttest.ROUTE_TRANSMISSION_STATUS) != requests {
+		t.Errorf("the delivery of the queued fax is followed again")
+	}
+}
+
+func TestSentFaxFollowedOnce(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("followed once")
+
+	transmissionID, err := calls.SendFaxReader(context.Background(), api.Contact{Phone: "+15551234567"}, document, transmission, strings.NewReader(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	queuedFax, err := api.CreateQueuedFax(api.Contact{Phone: "+15551234567"}, document, transmission, strings.NewReader(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	queuedFax.Status = api.QUEUED_FAX_STATUS_SENT
+	queuedFax.TransmissionID = transmissionID
+	api.SaveQueuedFax(queuedFax)
+
+	// The status is slow, the followers find the fax while it is followed.
+	fake.SetLatency(icttest.ROUTE_TRANSMISSION_STATUS, 200*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		go api.RunSentFaxFollower(ctx, calls, 10*time.Millisecond)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		queuedFax, _ = api.LoadQueuedFax(queuedFax.ID)
+		if queuedFax.DeliveryFollowed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the delivery of the queued fax has not been saved: %+v", queuedFax)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if fake.Requests(icttest.ROUTE_TRANSMISSION_STATUS) != 1 {
+		t.Errorf("the status has been polled %d times", fake.Requests(icttest.ROUTE_TRANSMISSION_STATUS))
+	}
+}
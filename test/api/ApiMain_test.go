@@ -0,0 +1,55 @@
+package api
+
+import (
+	"faxsender/src/utilities"
+	"faxsender/src/utilities/logger"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+)
+
+// TEST_CONFIG keeps the retries of the end-to-end tests short.
+const TEST_CONFIG = `port: 11111
+verbose: false
+ict_retry_max_attempts: 3
+ict_retry_max_delay: 10ms
+webhook_retry_max_attempts: 3
+webhook_retry_max_delay: 10ms
+max_upload_size: 1048576
+fax_provider: ict
+`
+
+// TestMain runs the tests in a temporary working directory, so the settings,
+// the config and the jobs written by the end-to-end tests are thrown away.
+func TestMain(m *testing.M) {
+	os.Exit(runInTempDir(m))
+}
+
+func runInTempDir(m *testing.M) int {
+	workingDir, err := os.MkdirTemp("", "faxsender-test-")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer os.RemoveAll(workingDir)
+
+	if err := os.Chdir(workingDir); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	binPath, _ := utilities.GetExecutablePath()
+	if err := os.MkdirAll(utilities.GetLogsPath(), 0755); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	if err := os.WriteFile(path.Join(binPath, utilities.CONFIG_FILE_NAME), []byte(TEST_CONFIG), 0644); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	logger.InitLog()
+	return m.Run()
+}
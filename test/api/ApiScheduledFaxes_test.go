@@ -0,0 +1,177 @@
+package api
+
+import (
+	"context"
+	"faxsender/src/api"
+	"faxsender/src/api/icttest"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestScheduledFaxLifecycle(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("scheduled")
+	ctx := context.Background()
+
+	sendAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	scheduled, err := calls.ScheduleFax(ctx, api.Contact{Phone: "+15551234567"}, document, transmission, strings.NewReader(FAKE_DOCUMENT), fileModel, sendAt)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer calls.CancelScheduledFax(ctx, scheduled.ID)
+
+	if scheduled.Status != api.SCHEDULED_FAX_STATUS_PENDING || !scheduled.SendAt.Equal(sendAt) {
+		t.Errorf("unexpected scheduled fax %+v", scheduled)
+	}
+
+	rescheduleAt := sendAt.Add(time.Hour)
+	rescheduled, err := calls.RescheduleFax(ctx, scheduled.ID, rescheduleAt)
+	if err != nil || !rescheduled.SendAt.Equal(rescheduleAt) {
+		t.Fatalf("unexpected rescheduled fax %+v, %v", rescheduled, err)
+	}
+
+	scheduledFaxes, err := calls.GetScheduledFaxes(ctx)
+	if err != nil || len(scheduledFaxes) != 1 || !scheduledFaxes[0].SendAt.Equal(rescheduleAt) {
+		t.Fatalf("unexpected scheduled faxes %+v, %v", scheduledFaxes, err)
+	}
+
+	if nextDue := api.NewFaxScheduler(calls, 0).RunDue(ctx, time.Now()); !nextDue.Equal(rescheduleAt) {
+		t.Errorf("unexpected next due time %v", nextDue)
+	}
+	if fake.Requests(icttest.ROUTE_SEND) != 0 {
+		t.Errorf("a fax was sent before it came due")
+	}
+
+	if err := calls.CancelScheduledFax(ctx, scheduled.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = calls.RescheduleFax(ctx, scheduled.ID, rescheduleAt)
+	expectApiError(t, err, api.ERROR_CODE_NOT_FOUND)
+}
+
+func TestFaxSchedulerSendsDueFax(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("scheduler")
+	ctx := context.Background()
+	subscription := newWebhookReceiver(t)
+
+	scheduled, err := calls.ScheduleFax(ctx, api.Contact{Phone: "+15551234567"}, document, transmission, strings.NewReader(FAKE_DOCUMENT), fileModel, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if nextDue := api.NewFaxScheduler(calls, 0).RunDue(ctx, time.Now()); !nextDue.IsZero() {
+		t.Errorf("unexpected next due time %v", nextDue)
+	}
+
+	if fake.Requests(icttest.ROUTE_SEND) != 1 {
+		t.Fatalf("expected 1 send, got %d", fake.Requests(icttest.ROUTE_SEND))
+	}
+
+	scheduledFaxes, err := calls.GetScheduledFaxes(ctx)
+	if err != nil || len(scheduledFaxes) != 0 {
+		t.Errorf("the sent fax %s is still scheduled: %+v, %v", scheduled.ID, scheduledFaxes, err)
+	}
+
+	waitForWebhookEvents(t, subscription.ID, scheduled.ID, api.WEBHOOK_EVENT_QUEUED, api.WEBHOOK_EVENT_SENT, api.WEBHOOK_EVENT_DELIVERED)
+}
+
+func TestFaxSchedulerDiscardsJobOfFailedFax(t *testing.T) {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	title := "scheduler gives up"
+	document, transmission, fileModel := newTransmission(title)
+	ctx := context.Background()
+
+	scheduled, err := calls.ScheduleFax(ctx, api.Contact{Phone: "+15551234567"}, document, transmission, strings.NewReader(FAKE_DOCUMENT), fileModel, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The failed fax would be listed by the other tests.
+	t.Cleanup(func() { calls.CancelScheduledFax(ctx, scheduled.ID) })
+	scheduler := api.NewFaxScheduler(calls, 0)
+
+	fake.FailNext(icttest.ROUTE_PROGRAMS, http.StatusServiceUnavailable, 3)
+	if retryAt := scheduler.RunDue(ctx, time.Now()); retryAt.IsZero() {
+		t.Fatalf("the transient failure is not retried")
+	}
+
+	job := findFaxJob(t, title)
+	if job == nil || job.Owner != api.SCHEDULED_FAX_JOB_OWNER_PREFIX+scheduled.ID {
+		t.Fatalf("unexpected job %+v of the retried fax", job)
+	}
+
+	// The last attempt fails too, the fax is given up.
+	scheduledFax, _ := api.LoadScheduledFax(scheduled.ID)
+	scheduledFax.Attempts = api.SCHEDULED_FAX_MAX_ATTEMPTS - 1
+	scheduledFax.SendAt = time.Now().Add(-time.Second)
+	api.SaveScheduledFax(scheduledFax)
+
+	fake.FailNext(icttest.ROUTE_PROGRAMS, http.StatusServiceUnavailable, 3)
+	scheduler.RunDue(ctx, time.Now())
+
+	scheduledFax, _ = api.LoadScheduledFax(scheduled.ID)
+	if scheduledFax.Status != api.SCHEDULED_FAX_STATUS_FAILED {
+		t.Errorf("unexpected status %s", scheduledFax.Status)
+	}
+	if fake.Requests(icttest.ROUTE_DOCUMENTS) != 1 {
+		t.Errorf("the retry created %d documents", fake.Requests(icttest.ROUTE_DOCUMENTS))
+	}
+	if findFaxJob(t, title) != nil || fake.ObjectCount() != 0 {
+		t.Errorf("the failed fax left its job or %d objects", fake.ObjectCount())
+	}
+}
+
+func TestScheduledFaxRoutes(t *testing.T) {
+	fake := newFakeServer(t)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api.InitRouters(router, loadApiToken(t))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ui := api.NewApiUI(server.Listener.Addr().(*net.TCPAddr).Port)
+	ctx := context.Background()
+
+	if err := ui.SaveSettings(ctx, fake.UserData()); err != nil {
+		t.Fatalf("saving the settings failed: %v", err)
+	}
+
+	document, transmission, fileModel := newTransmission("scheduled routes")
+	sendAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	scheduled, err := ui.ScheduleFax(ctx, api.Contact{Phone: "+15551234567"}, document, transmission, strings.NewReader(FAKE_DOCUMENT), fileModel, sendAt)
+	if err != nil || !scheduled.SendAt.Equal(sendAt) {
+		t.Fatalf("unexpected scheduled fax %+v, %v", scheduled, err)
+	}
+
+	rescheduled, err := ui.RescheduleFax(ctx, scheduled.ID, sendAt.Add(time.Hour))
+	if err != nil || !rescheduled.SendAt.Equal(sendAt.Add(time.Hour)) {
+		t.Fatalf("unexpected rescheduled fax %+v, %v", rescheduled, err)
+	}
+
+	scheduledFaxes, err := ui.GetScheduledFaxes(ctx)
+	if err != nil || len(scheduledFaxes) != 1 || scheduledFaxes[0].ID != scheduled.ID {
+		t.Fatalf("unexpected scheduled faxes %+v, %v", scheduledFaxes, err)
+	}
+
+	if err := ui.CancelScheduledFax(ctx, scheduled.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = ui.CancelScheduledFax(ctx, scheduled.ID)
+	expectApiError(t, err, api.ERROR_CODE_NOT_FOUND)
+
+	if fake.Requests(icttest.ROUTE_SEND) != 0 {
+		t.Errorf("a scheduled fax was sent")
+	}
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"faxsender/src/api"
+	"faxsender/src/api/icttest"
+	"faxsender/src/utilities"
+	"faxsender/src/utilities/config"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newRoutesUI starts the routes of the API server and returns a client of them.
+func newRoutesUI(t *testing.T, userData api.UserData) (api.IApiUICalls, *httptest.Server) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api.InitRouters(router, loadApiToken(t))
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	ui := api.NewApiUI(server.Listener.Addr().(*net.TCPAddr).Port)
+	if err := ui.SaveSettings(context.Background(), userData); err != nil {
+		t.Fatalf("saving the settings failed: %v", err)
+	}
+	return ui, server
+}
+
+// expectNoSpoolFiles checks that the uploads didn't leave a spool file in the jobs directory.
+func expectNoSpoolFiles(t *testing.T) {
+	t.Helper()
+
+	jobsPath, _ := utilities.GetJobsPath()
+	spoolFiles, _ := filepath.Glob(path.Join(jobsPath, api.SPOOL_FILE_PATTERN))
+	if len(spoolFiles) != 0 {
+		t.Errorf("the uploads left the spool files %v", spoolFiles)
+	}
+}
+
+func TestSendFaxRouteRejectsOversizedUpload(t *testing.T) {
+	fake := newFakeServer(t)
+	ui, _ := newRoutesUI(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("oversized upload")
+
+	maxUploadSize := (*config.Inst()).GetMaxUploadSize()
+
+	_, err := ui.SendFax(context.Background(), api.Contact{Phone: "+15551234567"}, document, transmission,
+		bytes.Repeat([]byte("x"), int(maxUploadSize)+1), fileModel)
+	expectApiError(t, err, api.ERROR_CODE_UPLOAD_TOO_LARGE)
+
+	if fake.Requests(icttest.ROUTE_DOCUMENTS) != 0 {
+		t.Errorf("the oversized document has been sent to the ICT server")
+	}
+	expectNoSpoolFiles(t)
+
+	// A document of exactly the maximum size is accepted.
+	transmissionID, err := ui.SendFax(context.Background(), api.Contact{Phone: "+15551234567"}, document, transmission,
+		bytes.Repeat([]byte("x"), int(maxUploadSize)), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sentDocument, _ := fake.TransmissionDocument(transmissionID)
+	if int64(len(sentDocument.Media)) != maxUploadSize {
+		t.Errorf("uploaded %d bytes, want %d", len(sentDocument.Media), maxUploadSize)
+	}
+	expectNoSpoolFiles(t)
+}
+
+func TestSendFaxRouteRequiresFileLast(t *testing.T) {
+	fake := newFakeServer(t)
+	_, server := newRoutesUI(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("file first")
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fileField, _ := writer.CreateFormFile(api.UPLOAD_FILE_FIELD_NAME, api.UPLOAD_FILE_NAME)
+	fileField.Write([]byte(FAKE_DOCUMENT))
+	for name, value := range map[string]interface{}{
+		"contact":      api.Contact{Phone: "+15551234567"},
+		"document":     document,
+		"transmission": transmission,
+		"fileModel":    fileModel,
+	} {
+		data, _ := json.Marshal(value)
+		writer.WriteField(name, string(data))
+	}
+	writer.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+path.Join(utilities.API_PATHS, api.API_UI_SEND_FAX), body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set(api.AUTHORIZATION_HEADER, api.BEARER_PREFIX+loadApiToken(t))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("posting the form failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var apiErr api.ApiError
+	json.NewDecoder(resp.Body).Decode(&apiErr)
+	if resp.StatusCode != http.StatusBadRequest || apiErr.Code != api.ERROR_CODE_INVALID_REQUEST {
+		t.Errorf("the file sent before the fields returned %d %+v", resp.StatusCode, apiErr)
+	}
+
+	if fake.Requests(icttest.ROUTE_DOCUMENTS) != 0 {
+		t.Errorf("the form has been sent to the ICT server")
+	}
+}
+
+func TestSendFaxRouteRetriesStreamedUpload(t *testing.T) {
+	fake := newFakeServer(t)
+	ui, _ := newRoutesUI(t, fake.UserData())
+	document, transmission, fileModel := newTransmission("retried streamed upload")
+
+	// The upload body is a pipe read once, the retry must open the document again.
+	fake.FailNext(icttest.ROUTE_MEDIA, http.StatusServiceUnavailable, 1)
+
+	transmissionID, err := ui.SendFax(context.Background(), api.Contact{Phone: "+15551234567"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fake.Requests(icttest.ROUTE_MEDIA) != 2 {
+		t.Errorf("expected 2 uploads, got %d", fake.Requests(icttest.ROUTE_MEDIA))
+	}
+
+	sentDocument, _ := fake.TransmissionDocument(transmissionID)
+	if string(sentDocument.Media) != FAKE_DOCUMENT {
+		t.Errorf("the retried upload sent %q", sentDocument.Media)
+	}
+	expectNoSpoolFiles(t)
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"faxsender/src/api"
+	"faxsender/src/utilities"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoadOrCreateTLSCertificate(t *testing.T) {
+	certificate, err := api.LoadOrCreateTLSCertificate("", "", "192.0.2.10")
+	if err != nil {
+		t.Fatalf("creating the certificate failed: %v", err)
+	}
+	if err := certificate.Leaf.VerifyHostname("192.0.2.10"); err != nil {
+		t.Errorf("the certificate isn't valid for the bind address: %v", err)
+	}
+	if err := certificate.Leaf.VerifyHostname("localhost"); err != nil {
+		t.Errorf("the certificate isn't valid for localhost: %v", err)
+	}
+
+	keyPath, _ := utilities.GetTLSKeyPath()
+	if info, err := os.Stat(keyPath); err != nil || info.Mode().Perm() != api.TLS_KEY_FILE_PERMISSION {
+		t.Errorf("the key file is missing or readable by other users: %v, %v", info, err)
+	}
+
+	again, err := api.LoadOrCreateTLSCertificate("", "", "192.0.2.10")
+	if err != nil || !again.Leaf.Equal(certificate.Leaf) {
+		t.Errorf("the generated certificate isn't reused: %v", err)
+	}
+
+	certPath, _ := utilities.GetTLSCertPath()
+	configured, err := api.LoadOrCreateTLSCertificate(certPath, keyPath, "")
+	if err != nil || !configured.Leaf.Equal(certificate.Leaf) {
+		t.Errorf("the configured certificate isn't loaded: %v", err)
+	}
+
+	if _, err := api.LoadOrCreateTLSCertificate(certPath, "", ""); err == nil {
+		t.Errorf("a certificate without its key is accepted")
+	}
+}
+
+func TestApiUIPinnedCertificate(t *testing.T) {
+	certificate, err := api.LoadOrCreateTLSCertificate("", "", utilities.LOCALHOST)
+	if err != nil {
+		t.Fatalf("creating the certificate failed: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api.InitRouters(router, loadApiToken(t))
+	server := httptest.NewUnstartedServer(router)
+	server.TLS = api.NewServerTLSConfig(certificate, utilities.TLS_VERSION_1_3)
+	server.StartTLS()
+	defer server.Close()
+
+	ui := api.NewApiUI(server.Listener.Addr().(*net.TCPAddr).Port).(*api.ApiUI)
+	ui.PinCertificate(certificate.Leaf)
+
+	if _, err := ui.GetCoverPageTemplates(context.Background()); err != nil {
+		t.Errorf("the call over HTTPS failed: %v", err)
+	}
+
+	// A daemon presenting another certificate is refused.
+	other := httptest.NewTLSServer(router)
+	defer other.Close()
+
+	ui.Port = other.Listener.Addr().(*net.TCPAddr).Port
+	if _, err := ui.GetCoverPageTemplates(context.Background()); !errors.Is(err, api.ErrCertificateNotPinned) {
+		t.Errorf("the call to another certificate returned %v, want %v", err, api.ErrCertificateNotPinned)
+	}
+
+	// The daemon refuses the clients below the minimum TLS version.
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS12,
+	}}}
+	if resp, err := client.Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Errorf("a TLS 1.2 client is accepted with the TLS 1.3 minimum version")
+	}
+}
+
+// writeCertificate writes a certificate to a PEM file.
+func writeCertificate(t *testing.T, certFile string, certificate *x509.Certificate) {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: api.PEM_CERTIFICATE_BLOCK, Bytes: certificate.Raw})
+	if err := os.WriteFile(certFile, data, 0644); err != nil {
+		t.Fatalf("writing the certificate failed: %v", err)
+	}
+}
+
+func TestApiUIPinsDaemonCertificateLazily(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api.InitRouters(router, loadApiToken(t))
+	server := httptest.NewTLSServer(router)
+	defer server.Close()
+
+	// The UI starts before the daemon generated its certificate.
+	certFile := path.Join(t.TempDir(), "daemon.pem")
+	ui := api.NewApiUI(server.Listener.Addr().(*net.TCPAddr).Port).(*api.ApiUI)
+	ui.PinDaemonCertificate(certFile)
+
+	if _, err := ui.GetCoverPageTemplates(context.Background()); err == nil {
+		t.Fatalf("the call succeeded without the certificate of the daemon")
+	}
+
+	writeCertificate(t, certFile, server.Certificate())
+	if _, err := ui.GetCoverPageTemplates(context.Background()); err != nil {
+		t.Fatalf("the call with the certificate written since failed: %v", err)
+	}
+
+	// The daemon serves another certificate, it is pinned again without failing the call.
+	certificate, err := api.LoadOrCreateTLSCertificate("", "", utilities.LOCALHOST)
+	if err != nil {
+		t.Fatalf("creating the certificate failed: %v", err)
+	}
+	other := httptest.NewUnstartedServer(router)
+	other.TLS = api.NewServerTLSConfig(certificate, utilities.TLS_VERSION_1_3)
+	other.StartTLS()
+	defer other.Close()
+
+	writeCertificate(t, certFile, certificate.Leaf)
+	ui.Port = other.Listener.Addr().(*net.TCPAddr).Port
+	if _, err := ui.GetCoverPageTemplates(context.Background()); err != nil {
+		t.Errorf("the call after the certificate changed failed: %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"faxsender/src/api"
+	"faxsender/src/utilities"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadApiToken returns the API token of the test working directory.
+func loadApiToken(t *testing.T) string {
+	t.Helper()
+
+	token, err := api.LoadOrCreateApiToken()
+	if err != nil {
+		t.Fatalf("loading the API token failed: %v", err)
+	}
+	return token
+}
+
+func TestLoadOrCreateApiToken(t *testing.T) {
+	token := loadApiToken(t)
+	if len(token) != 2*api.API_TOKEN_SIZE {
+		t.Errorf("the token %q has %d characters, want %d", token, len(token), 2*api.API_TOKEN_SIZE)
+	}
+
+	if again := loadApiToken(t); again != token {
+		t.Errorf("the token changed from %q to %q", token, again)
+	}
+
+	tokenPath, _ := utilities.GetApiTokenPath()
+	info, err := os.Stat(tokenPath)
+	if err != nil {
+		t.Fatalf("the token file is missing: %v", err)
+	}
+	if info.Mode().Perm() != api.API_TOKEN_FILE_PERMISSION {
+		t.Errorf("the token file permission is %v, want %v", info.Mode().Perm(), api.API_TOKEN_FILE_PERMISSION)
+	}
+
+	// A token file readable by other users is restricted to its owner.
+	if err := os.Chmod(tokenPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if again := loadApiToken(t); again != token {
+		t.Errorf("the token changed from %q to %q", token, again)
+	}
+	if info, _ := os.Stat(tokenPath); info.Mode().Perm() != api.API_TOKEN_FILE_PERMISSION {
+		t.Errorf("the token file permission is still %v", info.Mode().Perm())
+	}
+
+	binPath, _ := utilities.GetExecutablePath()
+	entries, _ := os.ReadDir(binPath)
+	for _, entry := range entries {
+		if path.Ext(entry.Name()) == ".tmp" {
+			t.Errorf("the temporary token file %s is left", entry.Name())
+		}
+	}
+}
+
+func TestApiTokenRequired(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	token := loadApiToken(t)
+	api.InitRouters(router, token)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	url := server.URL + path.Join(utilities.API_PATHS, api.API_UI_COVER_PAGES)
+	cases := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong token", api.BEARER_PREFIX + "0123", http.StatusUnauthorized},
+		{"token without bearer", token, http.StatusUnauthorized},
+		{"token", api.BEARER_PREFIX + token, http.StatusOK},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		if c.authorization != "" {
+			req.Header.Set(api.AUTHORIZATION_HEADER, c.authorization)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: the request failed: %v", c.name, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != c.status {
+			t.Errorf("%s: the status is %d, want %d", c.name, resp.StatusCode, c.status)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"faxsender/src/api"
+	"faxsender/src/api/icttest"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueryTransmissions(t *testing.T) {
+	for _, queries := range []bool{true, false} {
+		t.Run(fmt.Sprintf("server queries %v", queries), func(t *testing.T) {
+			fake := newFakeServer(t)
+			fake.SetQuerySupport(queries)
+			calls := newDirectCalls(t, fake.UserData())
+			ctx := context.Background()
+
+			var transmissionIDs []int
+			for i := 0; i < 5; i++ {
+				document, transmission, fileModel := newTransmission(fmt.Sprintf("query %d", i))
+				if i == 4 {
+					transmission.IsPrint = "0"
+				}
+				transmissionID, err := calls.SendFax(ctx, api.Contact{Phone: "+15551234567"}, document, transmission, []byte(FAKE_DOCUMENT), fileModel)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				transmissionIDs = append(transmissionIDs, transmissionID)
+			}
+			fake.SetTransmissionStatus(transmissionIDs[0], api.ICT_STATUS_FAILED)
+
+			page, err := calls.QueryTransmissions(ctx, api.TransmissionQuery{Limit: 3, IsPrint: "1"})
+			if err != nil || page.Total != 4 || len(page.Faxes) != 3 {
+				t.Fatalf("unexpected first page %+v, %v", page, err)
+			}
+
+			next, err := calls.QueryTransmissions(ctx, api.TransmissionQuery{Offset: 3, Limit: 3, IsPrint: "1"})
+			if err != nil || next.Total != 4 || len(next.Faxes) != 1 {
+				t.Fatalf("unexpected second page %+v, %v", next, err)
+			}
+
+			seen := map[int]bool{}
+			for _, fax := range append(page.Faxes, next.Faxes...) {
+				if fax.IsPrint != "1" || seen[fax.TransmissionID] {
+					t.Errorf("unexpected fax %+v", fax)
+				}
+				seen[fax.TransmissionID] = true
+			}
+
+			failed, err := calls.QueryTransmissions(ctx, api.TransmissionQuery{Status: api.ICT_STATUS_FAILED, AccountID: icttest.FAKE_ACCOUNT_ID})
+			if err != nil || failed.Total != 1 || failed.Faxes[0].TransmissionID != transmissionIDs[0] {
+				t.Errorf("unexpected failed transmissions %+v, %v", failed, err)
+			}
+
+			future, err := calls.QueryTransmissions(ctx, api.TransmissionQuery{From: time.Now().Add(time.Hour)})
+			if err != nil || future.Total != 0 || len(future.Faxes) != 0 {
+				t.Errorf("unexpected future transmissions %+v, %v", future, err)
+			}
+		})
+	}
+}
+
+func TestParseTransmissionQuery(t *testing.T) {
+	query := api.TransmissionQuery{
+		Offset:    20,
+		Limit:     10,
+		From:      time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC),
+		To:        time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC),
+		Status:    api.ICT_STATUS_DONE,
+		AccountID: "7",
+		IsPrint:   "1",
+	}
+
+	parsed, err := api.ParseTransmissionQuery(query.Values())
+	if err != nil || parsed != query {
+		t.Errorf("the encoded query %+v changed: %+v, %v", query, parsed, err)
+	}
+
+	parsed, err = api.ParseTransmissionQuery(api.TransmissionQuery{Limit: 100000}.Values())
+	if err != nil || parsed.Limit != api.TRANSMISSION_QUERY_MAX_LIMIT {
+		t.Errorf("the limit was not clamped: %+v, %v", parsed, err)
+	}
+
+	invalid := query.Values()
+	invalid.Set(api.TRANSMISSION_QUERY_PARAM_IS_PRINT, "yes")
+	_, err = api.ParseTransmissionQuery(invalid)
+	expectApiError(t, err, api.ERROR_CODE_INVALID_REQUEST)
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"faxsender/src/api"
+	"faxsender/src/api/icttest"
+	"faxsender/src/utilities"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// v2Client calls the v2 API of a test daemon with the API token.
+type v2Client struct {
+	t      *testing.T
+	server *httptest.Server
+	token  string
+}
+
+func newV2Client(t *testing.T) *v2Client {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	token := loadApiToken(t)
+	api.InitRouters(router, token)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return &v2Client{t: t, server: server, token: token}
+}
+
+// do sends a request and decodes the JSON body of the response into target, if any.
+func (c *v2Client) do(method string, resource string, contentType string, body io.Reader, target interface{}) *http.Response {
+	c.t.Helper()
+
+	req, _ := http.NewRequest(method, c.server.URL+utilities.API_V2_PATHS+"/"+resource, body)
+	req.Header.Set(api.AUTHORIZATION_HEADER, api.BEARER_PREFIX+c.token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s failed: %v", method, resource, err)
+	}
+	defer resp.Body.Close()
+
+	if target != nil {
+		if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+			c.t.Fatalf("decoding the response of %s %s failed: %v", method, resource, err)
+		}
+	}
+	return resp
+}
+
+// stream sends a GET request and returns the response with its body left open.
+func (c *v2Client) stream(resource string) *http.Response {
+	c.t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, c.server.URL+utilities.API_V2_PATHS+"/"+resource, nil)
+	req.Header.Set(api.AUTHORIZATION_HEADER, api.BEARER_PREFIX+c.token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("GET %s failed: %v", resource, err)
+	}
+	c.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// expectV2Error checks the status and the code of an error envelope.
+func (c *v2Client) expectV2Error(method string, resource string, body io.Reader, status int, code string) {
+	c.t.Helper()
+
+	var envelope api.ErrorEnvelope
+	resp := c.do(method, resource, utilities.JSON_CONTENT_TYPE, body, &envelope)
+	if resp.StatusCode != status || envelope.Error.Code != code || envelope.Error.Message == "" {
+		c.t.Errorf("%s %s returned %d %+v, want %d %s", method, resource, resp.StatusCode, envelope, status, code)
+	}
+}
+
+// newFaxBody builds the multipart body of POST /faxes.
+func newFaxBody(t *testing.T, request api.FaxRequest, fileName string, document string) (io.Reader, string) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	faxHeader := textproto.MIMEHeader{}
+	faxHeader.Set("Content-Disposition", `form-data; name="`+api.V2_FAX_FIELD_NAME+`"`)
+	faxHeader.Set("Content-Type", utilities.JSON_CONTENT_TYPE)
+	faxPart, _ := writer.CreatePart(faxHeader)
+	if err := json.NewEncoder(faxPart).Encode(request); err != nil {
+		t.Fatal(err)
+	}
+
+	documentPart, _ := writer.CreateFormFile(api.V2_DOCUMENT_FIELD_NAME, fileName)
+	io.WriteString(documentPart, document)
+	writer.Close()
+
+	return body, writer.FormDataContentType()
+}
+
+func TestV2Resources(t *testing.T) {
+	fake := newFakeServer(t)
+	client := newV2Client(t)
+
+	userData, _ := json.Marshal(fake.UserData())
+	var settings api.Settings
+	resp := client.do(http.MethodPut, api.API_V2_SETTINGS, utilities.JSON_CONTENT_TYPE, bytes.NewReader(userData), &settings)
+	if resp.StatusCode != http.StatusOK || settings.Username != FAKE_USERNAME {
+		t.Fatalf("saving the settings returned %d %+v", resp.StatusCode, settings)
+	}
+
+	var raw map[string]interface{}
+	client.do(http.MethodGet, api.API_V2_SETTINGS, "", nil, &raw)
+	if _, ok := raw["password"]; ok || raw["username"] != FAKE_USERNAME {
+		t.Errorf("unexpected settings %v", raw)
+	}
+
+	var accounts []api.AccountResponse
+	client.do(http.MethodGet, api.API_V2_ACCOUNTS, "", nil, &accounts)
+	if len(accounts) != 1 || accounts[0].AccountID != icttest.FAKE_ACCOUNT_ID {
+		t.Errorf("unexpected accounts %+v", accounts)
+	}
+
+	request := api.FaxRequest{
+		Recipient: api.Contact{Phone: "+15551234567"},
+		Title:     "v2 resources",
+		AccountID: icttest.FAKE_ACCOUNT_ID,
+		Print:     true,
+	}
+	runFaxQueue(t, newDirectCalls(t, fake.UserData()))
+
+	body, contentType := newFaxBody(t, request, "document.pdf", FAKE_DOCUMENT)
+	var queued api.QueuedFax
+	resp = client.do(http.MethodPost, api.API_V2_FAXES, contentType, body, &queued)
+	if resp.StatusCode != http.StatusAccepted || queued.ID == "" {
+		t.Fatalf("sending the fax returned %d %+v", resp.StatusCode, queued)
+	}
+	if location := resp.Header.Get("Location"); location != utilities.API_V2_PATHS+"/jobs/"+queued.ID {
+		t.Errorf("unexpected location %q", location)
+	}
+
+	events := readJobEvents(t, client.stream("jobs/"+queued.ID+"/events").Body)
+	if len(events) == 0 || !events[len(events)-1].Final || events[len(events)-1].TransmissionID == 0 {
+		t.Fatalf("unexpected job events %+v", events)
+	}
+	sent := events[len(events)-1]
+
+	client.do(http.MethodGet, "jobs/"+queued.ID, "", nil, &queued)
+	if queued.Status != api.QUEUED_FAX_STATUS_SENT || queued.TransmissionID != sent.TransmissionID {
+		t.Errorf("unexpected job %+v", queued)
+	}
+
+	sentDocument, _ := fake.TransmissionDocument(sent.TransmissionID)
+	if string(sentDocument.Media) != FAKE_DOCUMENT {
+		t.Errorf("unexpected document %q", sentDocument.Media)
+	}
+
+	var faxStatus api.FaxStatus
+	client.do(http.MethodGet, "faxes/"+strconv.Itoa(sent.TransmissionID), "", nil, &faxStatus)
+	if faxStatus.TransmissionID != sent.TransmissionID || !faxStatus.IsFinal {
+		t.Errorf("unexpected status %+v", faxStatus)
+	}
+
+	var page api.TransmissionPage
+	client.do(http.MethodGet, api.API_V2_FAXES+"?is_print=1", "", nil, &page)
+	if page.Total != 1 || page.Faxes[0].TransmissionID != sent.TransmissionID {
+		t.Errorf("unexpected faxes %+v", page)
+	}
+
+	if resp := client.do(http.MethodDelete, api.API_V2_SESSION, "", nil, nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("deleting the session returned %d", resp.StatusCode)
+	}
+	client.expectV2Error(http.MethodGet, api.API_V2_SETTINGS, nil, http.StatusPreconditionFailed, api.ERROR_CODE_SETTINGS_NOT_FOUND)
+}
+
+func TestV2ErrorEnvelopes(t *testing.T) {
+	client := newV2Client(t)
+
+	client.expectV2Error(http.MethodGet, "faxes/abc", nil, http.StatusBadRequest, api.ERROR_CODE_INVALID_REQUEST)
+	client.expectV2Error(http.MethodGet, "unknown", nil, http.StatusNotFound, api.ERROR_CODE_NOT_FOUND)
+	client.expectV2Error(http.MethodPut, api.API_V2_SETTINGS, bytes.NewReader([]byte(`{"username":"user"}`)),
+		http.StatusBadRequest, api.ERROR_CODE_INVALID_REQUEST)
+
+	body, contentType := newFaxBody(t, api.FaxRequest{Title: "no recipient", AccountID: icttest.FAKE_ACCOUNT_ID}, "document.pdf", FAKE_DOCUMENT)
+	var envelope api.ErrorEnvelope
+	resp := client.do(http.MethodPost, api.API_V2_FAXES, contentType, body, &envelope)
+	if resp.StatusCode != http.StatusBadRequest || envelope.Error.Message != "the recipient.phone field is required" {
+		t.Errorf("a fax without recipient returned %d %+v", resp.StatusCode, envelope)
+	}
+
+	// The token is checked before the routes, with the envelope of the API version.
+	client.token = "wrong"
+	client.expectV2Error(http.MethodGet, api.API_V2_ACCOUNTS, nil, http.StatusUnauthorized, api.ERROR_CODE_UNAUTHORIZED)
+
+	var v1Error api.ApiError
+	resp, _ = http.Get(client.server.URL + utilities.API_PATHS + "/" + api.API_UI_COVER_PAGES)
+	json.NewDecoder(resp.Body).Decode(&v1Error)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || v1Error.Code != api.ERROR_CODE_UNAUTHORIZED || v1Error.Message == "" {
+		t.Errorf("the v1 error envelope changed: %d %+v", resp.StatusCode, v1Error)
+	}
+}
+
+func TestV2OpenApiDocument(t *testing.T) {
+	client := newV2Client(t)
+
+	var document struct {
+		OpenApi    string                                       `json:"openapi"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Required   []string               `json:"required"`
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	resp := client.do(http.MethodGet, api.API_V2_OPENAPI, "", nil, &document)
+	if resp.StatusCode != http.StatusOK || document.OpenApi != api.OPENAPI_VERSION {
+		t.Fatalf("the OpenAPI document returned %d %q", resp.StatusCode, document.OpenApi)
+	}
+
+	operations := map[string][]string{
+		"/faxes":                    {"get", "post"},
+		"/faxes/{id}":               {"get"},
+		"/jobs/{id}":                {"get"},
+		"/jobs/{id}/events":         {"get"},
+		"/webhooks":                 {"get", "post"},
+		"/webhooks/{id}":            {"get", "put", "delete"},
+		"/webhooks/{id}/deliveries": {"get"},
+		"/accounts":                 {"get"},
+		"/settings":                 {"get", "put"},
+		"/session":                  {"delete"},
+	}
+	for path, methods := range operations {
+		for _, method := range methods {
+			if _, ok := document.Paths[path][method]; !ok {
+				t.Errorf("the operation %s %s is missing", method, path)
+			}
+		}
+	}
+
+	faxRequest := document.Components.Schemas["FaxRequest"]
+	if len(faxRequest.Required) != 3 || faxRequest.Properties["recipient"] == nil {
+		t.Errorf("unexpected FaxRequest schema %+v", faxRequest)
+	}
+	if _, ok := document.Components.Schemas["ErrorEnvelope"]; !ok {
+		t.Errorf("the ErrorEnvelope schema is missing")
+	}
+}
@@ -0,0 +1,296 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"faxsender/src/api"
+	"faxsender/src/api/icttest"
+	"faxsender/src/utilities"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver records the webhook requests, it fails the first request of
+// each delivery of the failing event.
+type webhookReceiver struct {
+	mutex        sync.Mutex
+	failingEvent string
+	requests     []*http.Request
+	bodies       [][]byte
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	retried := false
+	for _, previous := range r.requests {
+		retried = retried || previous.Header.Get(api.WEBHOOK_DELIVERY_HEADER) == req.Header.Get(api.WEBHOOK_DELIVERY_HEADER)
+	}
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+
+	if req.Header.Get(api.WEBHOOK_EVENT_HEADER) == r.failingEvent && !retried {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// newWebhookReceiver subscribes a receiver to all the webhook events, the
+// subscription is deleted at the end of the test.
+func newWebhookReceiver(t *testing.T) *api.WebhookSubscription {
+	receiverServer := httptest.NewServer(&webhookReceiver{})
+	t.Cleanup(receiverServer.Close)
+
+	subscription, err := api.CreateWebhookSubscription(api.WebhookRequest{URL: receiverServer.URL})
+	if err != nil {
+		t.Fatalf("creating the webhook failed: %v", err)
+	}
+	t.Cleanup(func() { api.DeleteWebhookSubscription(subscription.ID) })
+	return subscription
+}
+
+// waitForWebhookEvents waits until the given webhook events of a job have been delivered.
+func waitForWebhookEvents(t *testing.T, subscriptionID string, jobID string, events ...string) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		deliveries, _ := api.LoadWebhookDeliveries(subscriptionID)
+		delivered := map[string]bool{}
+		for _, delivery := range deliveries {
+			if delivery.JobID == jobID && delivery.Status == api.WEBHOOK_DELIVERY_STATUS_DELIVERED {
+				delivered[delivery.Event] = true
+			}
+		}
+
+		missing := 0
+		for _, event := range events {
+			if !delivered[event] {
+				missing++
+			}
+		}
+		if missing == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the events %v of the job %s have not been delivered: %+v", events, jobID, deliveries)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	fake := newFakeServer(t)
+	client := newV2Client(t)
+
+	receiver := &webhookReceiver{failingEvent: api.WEBHOOK_EVENT_QUEUED}
+	receiverServer := httptest.NewServer(receiver)
+	defer receiverServer.Close()
+
+	request, _ := json.Marshal(api.WebhookRequest{URL: receiverServer.URL + "/hooks"})
+	var subscription api.WebhookSubscription
+	resp := client.do(http.MethodPost, api.API_V2_WEBHOOKS, utilities.JSON_CONTENT_TYPE, bytes.NewReader(request), &subscription)
+	if resp.StatusCode != http.StatusCreated || subscription.ID == "" || subscription.Secret == "" {
+		t.Fatalf("creating the webhook returned %d %+v", resp.StatusCode, subscription)
+	}
+	// The subscription would receive the events of the other tests.
+	t.Cleanup(func() { api.DeleteWebhookSubscription(subscription.ID) })
+
+	var subscriptions []api.WebhookSubscription
+	client.do(http.MethodGet, api.API_V2_WEBHOOKS, "", nil, &subscriptions)
+	if len(subscriptions) != 1 || subscriptions[0].ID != subscription.ID || subscriptions[0].Secret != "" {
+		t.Errorf("unexpected webhooks %+v", subscriptions)
+	}
+
+	runFaxQueue(t, newDirectCalls(t, fake.UserData()))
+	userData, _ := json.Marshal(fake.UserData())
+	client.do(http.MethodPut, api.API_V2_SETTINGS, utilities.JSON_CONTENT_TYPE, bytes.NewReader(userData), nil)
+
+	body, contentType := newFaxBody(t, api.FaxRequest{
+		Recipient: api.Contact{Phone: "+15551234567"},
+		Title:     "webhooks",
+		AccountID: icttest.FAKE_ACCOUNT_ID,
+	}, "document.pdf", FAKE_DOCUMENT)
+	var queued api.QueuedFax
+	client.do(http.MethodPost, api.API_V2_FAXES, contentType, body, &queued)
+	readJobEvents(t, client.stream("jobs/"+queued.ID+"/events").Body)
+
+	var deliveries []api.WebhookDelivery
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		client.do(http.MethodGet, "webhooks/"+subscription.ID+"/deliveries", "", nil, &deliveries)
+		delivered := 0
+		for _, delivery := range deliveries {
+			if delivery.JobID == queued.ID && delivery.Status == api.WEBHOOK_DELIVERY_STATUS_DELIVERED {
+				delivered++
+			}
+		}
+		if delivered == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected deliveries %+v", deliveries)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	attempts := map[string]int{}
+	for _, delivery := range deliveries {
+		attempts[delivery.Event] = delivery.Attempts
+	}
+	if attempts[api.WEBHOOK_EVENT_QUEUED] != 2 || attempts[api.WEBHOOK_EVENT_SENT] != 1 || attempts[api.WEBHOOK_EVENT_DELIVERED] != 1 {
+		t.Errorf("unexpected attempts %v", attempts)
+	}
+
+	receiver.mutex.Lock()
+	defer receiver.mutex.Unlock()
+	for i, req := range receiver.requests {
+		var payload api.WebhookPayload
+		if err := json.Unmarshal(receiver.bodies[i], &payload); err != nil {
+			t.Fatalf("decoding the payload %q failed: %v", receiver.bodies[i], err)
+		}
+		if payload.JobID != queued.ID {
+			continue
+		}
+
+		signature := api.SignWebhookPayload(subscription.Secret, req.Header.Get(api.WEBHOOK_TIMESTAMP_HEADER), receiver.bodies[i])
+		if req.Header.Get(api.WEBHOOK_SIGNATURE_HEADER) != signature || req.URL.Path != "/hooks" {
+			t.Errorf("the request %d has the signature %q, want %q", i, req.Header.Get(api.WEBHOOK_SIGNATURE_HEADER), signature)
+		}
+		if payload.Event != req.Header.Get(api.WEBHOOK_EVENT_HEADER) || payload.ID != req.Header.Get(api.WEBHOOK_DELIVERY_HEADER) {
+			t.Errorf("the payload %+v doesn't match the headers %v", payload, req.Header)
+		}
+		if payload.Event == api.WEBHOOK_EVENT_DELIVERED && (payload.FaxStatus == nil || payload.TransmissionID == 0) {
+			t.Errorf("unexpected delivered payload %+v", payload)
+		}
+	}
+}
+
+func TestWebhookSubscriptions(t *testing.T) {
+	client := newV2Client(t)
+
+	client.expectV2Error(http.MethodPost, api.API_V2_WEBHOOKS, bytes.NewReader([]byte(`{"url":"ftp://example.com"}`)),
+		http.StatusBadRequest, api.ERROR_CODE_INVALID_REQUEST)
+	client.expectV2Error(http.MethodPost, api.API_V2_WEBHOOKS, bytes.NewReader([]byte(`{"url":"https://example.com","events":["fax.lost"]}`)),
+		http.StatusBadRequest, api.ERROR_CODE_INVALID_REQUEST)
+
+	var subscription api.WebhookSubscription
+	client.do(http.MethodPost, api.API_V2_WEBHOOKS, utilities.JSON_CONTENT_TYPE,
+		bytes.NewReader([]byte(`{"url":"https://example.com","events":["fax.failed"],"secret":"s3cret"}`)), &subscription)
+	if subscription.Secret != "s3cret" {
+		t.Errorf("unexpected webhook %+v", subscription)
+	}
+
+	var updated api.WebhookSubscription
+	client.do(http.MethodPut, "webhooks/"+subscription.ID, utilities.JSON_CONTENT_TYPE,
+		bytes.NewReader([]byte(`{"url":"https://example.org","events":["fax.delivered","fax.failed"]}`)), &updated)
+	if updated.URL != "https://example.org" || len(updated.Events) != 2 || updated.Secret != "" {
+		t.Errorf("unexpected updated webhook %+v", updated)
+	}
+
+	if resp := client.do(http.MethodDelete, "webhooks/"+subscription.ID, "", nil, nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("deleting the webhook returned %d", resp.StatusCode)
+	}
+	client.expectV2Error(http.MethodGet, "webhooks/"+subscription.ID, nil, http.StatusNotFound, api.ERROR_CODE_NOT_FOUND)
+	client.expectV2Error(http.MethodGet, "webhooks/"+subscription.ID+"/deliveries", nil, http.StatusNotFound, api.ERROR_CODE_NOT_FOUND)
+}
+
+// scheduleWebhookFax schedules a fax in an hour, publishing its queued event
+// to the webhooks. The fax is cancelled at the end of the test.
+func scheduleWebhookFax(t *testing.T, title string) *api.ScheduledFax {
+	fake := newFakeServer(t)
+	calls := newDirectCalls(t, fake.UserData())
+	document, transmission, fileModel := newTransmission(title)
+	ctx := context.Background()
+
+	scheduled, err := calls.ScheduleFax(ctx, api.Contact{Phone: "+15551234567"}, document, transmission, strings.NewReader(FAKE_DOCUMENT), fileModel, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("scheduling the fax failed: %v", err)
+	}
+	t.Cleanup(func() { calls.CancelScheduledFax(ctx, scheduled.ID) })
+	return scheduled
+}
+
+// readWebhookDeliveryLog reads the delivery log file without locking it.
+func readWebhookDeliveryLog(t *testing.T) []api.WebhookDelivery {
+	deliveriesFilePath, _ := utilities.GetWebhookDeliveriesPath()
+
+	var deliveries []api.WebhookDelivery
+	data, _ := os.ReadFile(deliveriesFilePath)
+	if err := json.Unmarshal(data, &deliveries); err != nil {
+		t.Fatalf("reading the delivery log failed: %v", err)
+	}
+	return deliveries
+}
+
+func TestWebhookDeliveryLogKeepsPendingDeliveries(t *testing.T) {
+	subscription := newWebhookReceiver(t)
+	deliveriesFilePath, _ := utilities.GetWebhookDeliveriesPath()
+
+	// The oldest delivery is still pending, the log is full of delivered ones.
+	now := time.Now()
+	deliveries := []api.WebhookDelivery{{ID: "pending-delivery", SubscriptionID: subscription.ID, Event: api.WEBHOOK_EVENT_SENT,
+		JobID: "pending-job", Status: api.WEBHOOK_DELIVERY_STATUS_PENDING, NextAttemptAt: now.Add(time.Hour), Payload: json.RawMessage(`{}`), CreatedAt: now.Add(-time.Hour)}}
+	for i := 0; i < api.WEBHOOK_DELIVERY_LOG_SIZE; i++ {
+		deliveries = append(deliveries, api.WebhookDelivery{ID: "delivered-" + strconv.Itoa(i), SubscriptionID: subscription.ID, Event: api.WEBHOOK_EVENT_SENT,
+			JobID: "delivered-job", Status: api.WEBHOOK_DELIVERY_STATUS_DELIVERED, Payload: json.RawMessage(`{}`), CreatedAt: now})
+	}
+	data, _ := json.Marshal(deliveries)
+	if err := os.WriteFile(deliveriesFilePath, data, 0600); err != nil {
+		t.Fatalf("writing the delivery log failed: %v", err)
+	}
+
+	scheduled := scheduleWebhookFax(t, "webhook log")
+	waitForWebhookEvents(t, subscription.ID, scheduled.ID, api.WEBHOOK_EVENT_QUEUED)
+
+	logged := readWebhookDeliveryLog(t)
+	pending := false
+	for _, delivery := range logged {
+		pending = pending || delivery.ID == "pending-delivery"
+	}
+	if !pending || len(logged) != api.WEBHOOK_DELIVERY_LOG_SIZE {
+		t.Errorf("the log has %d deliveries, the pending one kept: %v", len(logged), pending)
+	}
+}
+
+func TestWebhookDeliveryWaitsForOtherProcess(t *testing.T) {
+	subscription := newWebhookReceiver(t)
+	deliveriesFilePath, _ := utilities.GetWebhookDeliveriesPath()
+	lockFilePath := deliveriesFilePath + api.WEBHOOK_DELIVERY_LOCK_EXTENSION
+
+	// Another process is checking the log for the same event, the deliveries
+	// of the other tests may still be writing it.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		locked, err := utilities.CreateLockFile(lockFilePath, api.WEBHOOK_DELIVERY_LOCK_LEASE)
+		if err != nil || time.Now().After(deadline) {
+			t.Fatalf("locking the delivery log failed: %v", err)
+		}
+		if locked {
+			break
+		}
+		time.Sleep(api.WEBHOOK_DELIVERY_LOCK_RETRY)
+	}
+	defer utilities.RemoveLockFile(lockFilePath)
+	scheduled := scheduleWebhookFax(t, "webhook lock")
+
+	time.Sleep(50 * time.Millisecond)
+	for _, delivery := range readWebhookDeliveryLog(t) {
+		if delivery.JobID == scheduled.ID {
+			t.Fatalf("the delivery has been created while the log was locked: %+v", delivery)
+		}
+	}
+
+	utilities.RemoveLockFile(lockFilePath)
+	waitForWebhookEvents(t, subscription.ID, scheduled.ID, api.WEBHOOK_EVENT_QUEUED)
+}
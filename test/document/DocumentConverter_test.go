@@ -0,0 +1,140 @@
+package document
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"faxsender/src/document"
+	"faxsender/src/utilities"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func expectPageCount(t *testing.T, pdf []byte, expected int) {
+	t.Helper()
+
+	doc, err := document.ParsePdf(pdf)
+	if err != nil {
+		t.Fatalf("parsing the document failed: %v", err)
+	}
+	if count, _ := doc.PageCount(); count != expected {
+		t.Errorf("expected %d pages, got %d", expected, count)
+	}
+}
+
+func TestTextToPdf(t *testing.T) {
+	var text strings.Builder
+	for i := 1; i <= 100; i++ {
+		fmt.Fprintf(&text, "line %d\r\n", i)
+	}
+	text.WriteString("\fa\tb\n")
+	text.WriteString(strings.Repeat("x", 100))
+
+	pdf := document.TextToPdf([]byte(text.String()), document.PAGE_SIZE_A4)
+	expectPageCount(t, pdf, 3)
+
+	texts := drawnTexts(t, pdf)
+	if len(texts) != 103 || texts[0] != "line 1" || texts[99] != "line 100" || texts[100] != "a       b" {
+		t.Fatalf("unexpected texts %q", texts)
+	}
+	if len(texts[101]) != 80 || len(texts[102]) != 20 {
+		t.Errorf("the long line should be wrapped at 80 characters, got %q", texts[101:])
+	}
+
+	latin1 := drawnTexts(t, document.TextToPdf([]byte("caf\xe9 \x93quoted\x94"), document.PAGE_SIZE_A4))
+	if len(latin1) != 1 || latin1[0] != "caf\xe9 \x93quoted\x94" {
+		t.Errorf("the Windows-1252 text wasn't kept, got %q", latin1)
+	}
+
+	expectPageCount(t, document.TextToPdf(nil, document.PAGE_SIZE_LETTER), 1)
+}
+
+func TestImageToPdf(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2000, 100))
+	for x := 0; x < 2000; x++ {
+		img.Set(x, x%100, color.RGBA{R: 255, A: 255})
+	}
+
+	var pngFile, jpegFile bytes.Buffer
+	png.Encode(&pngFile, img)
+	jpeg.Encode(&jpegFile, img, nil)
+
+	for name, contents := range map[string][]byte{"png": pngFile.Bytes(), "jpeg": jpegFile.Bytes()} {
+		pdf, err := document.ImageToPdf(contents, document.PAGE_SIZE_A4)
+		if err != nil {
+			t.Fatalf("%s: converting the image failed: %v", name, err)
+		}
+		expectPageCount(t, pdf, 1)
+
+		if name == "jpeg" && !bytes.Contains(pdf, jpegFile.Bytes()) {
+			t.Errorf("the JPEG image should be embedded as it is")
+		}
+	}
+
+	if _, err := document.ImageToPdf([]byte("not an image"), document.PAGE_SIZE_A4); !errors.Is(err, document.ErrConversionFailed) {
+		t.Errorf("expected ErrConversionFailed, got %v", err)
+	}
+}
+
+// writeFakeConverter writes a shell script standing in for the office
+// converter, it runs the command in the output directory given by --outdir.
+func writeFakeConverter(t *testing.T, command string) string {
+	t.Helper()
+
+	script := "#!/bin/sh\nwhile [ $# -gt 1 ]; do\n  if [ \"$1\" = \"--outdir\" ]; then cd \"$2\"; fi\n  shift\ndone\n" + command + "\n"
+	scriptPath := filepath.Join(t.TempDir(), "converter")
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return scriptPath
+}
+
+func TestConvertOfficeDocument(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake office converter is a shell script")
+	}
+
+	ctx := context.Background()
+	fixturePath := filepath.Join(t.TempDir(), "converted.pdf")
+	fixture := newTestPdf(document.PAGE_SIZE_A4, document.PAGE_SIZE_A4)
+	if err := os.WriteFile(fixturePath, fixture, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cacheDir := t.TempDir()
+	converter := document.NewDocumentConverter(writeFakeConverter(t, "cp "+fixturePath+" document.pdf"),
+		time.Minute, document.PAGE_SIZE_A4, cacheDir)
+
+	pdf, err := converter.ConvertToPdf(ctx, []byte("docx contents"), utilities.MS_WORD_CONTENT_TYPE)
+	if err != nil || !bytes.Equal(pdf, fixture) {
+		t.Fatalf("unexpected conversion %d bytes, %v", len(pdf), err)
+	}
+
+	failing := document.NewDocumentConverter(writeFakeConverter(t, "exit 1"), time.Minute, document.PAGE_SIZE_A4, cacheDir)
+	if pdf, err := failing.ConvertToPdf(ctx, []byte("docx contents"), utilities.MS_WORD_CONTENT_TYPE); err != nil || !bytes.Equal(pdf, fixture) {
+		t.Errorf("the cached conversion should be used, got %d bytes, %v", len(pdf), err)
+	}
+	if _, err := failing.ConvertToPdf(ctx, []byte("other contents"), utilities.MS_WORD_CONTENT_TYPE); !errors.Is(err, document.ErrConversionFailed) {
+		t.Errorf("expected ErrConversionFailed, got %v", err)
+	}
+
+	slow := document.NewDocumentConverter(writeFakeConverter(t, "exec sleep 5"), 100*time.Millisecond, document.PAGE_SIZE_A4, "")
+	if _, err := slow.ConvertToPdf(ctx, []byte("odt contents"), utilities.ODT_CONTENT_TYPE); !errors.Is(err, document.ErrConversionFailed) ||
+		!strings.Contains(err.Error(), "didn't finish") {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+
+	missing := document.NewDocumentConverter("missing-office-converter", time.Minute, document.PAGE_SIZE_A4, "")
+	if _, err := missing.ConvertToPdf(ctx, []byte("doc contents"), utilities.MS_WORD_LEGACY_CONTENT_TYPE); !errors.Is(err, document.ErrConverterUnavailable) {
+		t.Errorf("expected ErrConverterUnavailable, got %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package document
+
+import (
+	"errors"
+	"faxsender/src/document"
+	"faxsender/src/utilities"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the tests in a temporary working directory, so the cover
+// page templates written by the tests are thrown away.
+func TestMain(m *testing.M) {
+	os.Exit(runInTempDir(m))
+}
+
+func runInTempDir(m *testing.M) int {
+	workingDir, err := os.MkdirTemp("", "faxsender-document-test-")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer os.RemoveAll(workingDir)
+
+	if err := os.Chdir(workingDir); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return m.Run()
+}
+
+func newCoverPageData() document.CoverPageData {
+	return document.CoverPageData{
+		Sender:    document.CoverPageParty{FirstName: "Ada", LastName: "Lovelace", Company: "Analytical Engines", Phone: "+15550000000"},
+		Recipient: document.CoverPageParty{FirstName: "Charles", LastName: "Babbage", Phone: "+15551234567", Custom1: "Ref 42"},
+		Title:     "Quarterly report",
+		Date:      "March 1, 2024",
+		Notice:    "CONFIDENTIAL",
+	}
+}
+
+func TestPrependCoverPage(t *testing.T) {
+	pdf := newTestPdf(document.PAGE_SIZE_LETTER, document.PAGE_SIZE_A4)
+
+	updated, err := document.PrependCoverPage(pdf, document.DEFAULT_COVER_PAGE_TEMPLATE, newCoverPageData())
+	if err != nil {
+		t.Fatalf("adding the cover page failed: %v", err)
+	}
+	expectPageSizes(t, updated, document.PAGE_SIZE_LETTER, document.PAGE_SIZE_LETTER, document.PAGE_SIZE_A4)
+
+	texts := strings.Join(drawnTexts(t, updated), "\n")
+	for _, expected := range []string{"FAX", "Quarterly report", "Charles Babbage", "Ada Lovelace", "Analytical Engines",
+		"Pages:   3 (including this cover page)", "Ref 42", "CONFIDENTIAL"} {
+		if !strings.Contains(texts, expected) {
+			t.Errorf("the cover page doesn't contain %q:\n%s", expected, texts)
+		}
+	}
+	if strings.Contains(texts, "Email:") {
+		t.Errorf("the empty email lines should be left out:\n%s", texts)
+	}
+}
+
+func TestRenderInvalidCoverPageTemplate(t *testing.T) {
+	for _, templateText := range []string{"{{.Title", "{{.Unknown}}"} {
+		_, err := document.RenderCoverPage(templateText, newCoverPageData(), document.PAGE_SIZE_A4)
+		if !errors.Is(err, document.ErrCoverPageTemplateInvalid) {
+			t.Errorf("%q: expected ErrCoverPageTemplateInvalid, got %v", templateText, err)
+		}
+	}
+}
+
+func TestCoverPageTemplates(t *testing.T) {
+	names, err := document.ListCoverPageTemplates()
+	if err != nil || len(names) != 1 || names[0] != document.DEFAULT_COVER_PAGE_TEMPLATE_NAME {
+		t.Fatalf("expected the default template, got %v, %v", names, err)
+	}
+
+	dir, _ := utilities.GetCoverPagesPath()
+	urgentPath := path.Join(dir, "urgent.txt")
+	if err := os.WriteFile(urgentPath, []byte("# URGENT {{.Title}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(urgentPath) })
+
+	names, _ = document.ListCoverPageTemplates()
+	if strings.Join(names, ",") != "default,urgent" {
+		t.Errorf("unexpected templates %v", names)
+	}
+
+	templateText, err := document.LoadCoverPageTemplate("urgent")
+	if err != nil || templateText != "# URGENT {{.Title}}" {
+		t.Errorf("unexpected template %q, %v", templateText, err)
+	}
+
+	for _, name := range []string{"missing", "../urgent", ""} {
+		if _, err := document.LoadCoverPageTemplate(name); !errors.Is(err, document.ErrCoverPageTemplateNotFound) {
+			t.Errorf("%q: expected ErrCoverPageTemplateNotFound, got %v", name, err)
+		}
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	cases := map[string][]string{
+		"":                      {""},
+		"short":                 {"short"},
+		"Name:    Ada Lovelace": {"Name:    Ada", "Lovelace"},
+		"abcdefghijklmnop":      {"abcdefghijkl", "mnop"},
+	}
+
+	for line, expected := range cases {
+		if wrapped := document.WrapText(line, 12); strings.Join(wrapped, "|") != strings.Join(expected, "|") {
+			t.Errorf("%q: expected %q, got %q", line, expected, wrapped)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package document
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"faxsender/src/document"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+// tiffPageCount counts the image file directories of a little endian TIFF file.
+func tiffPageCount(t *testing.T, contents []byte) int {
+	t.Helper()
+
+	if !bytes.HasPrefix(contents, []byte{'I', 'I', 42, 0}) {
+		t.Fatalf("not a little endian TIFF file")
+	}
+
+	count := 0
+	for offset := binary.LittleEndian.Uint32(contents[4:]); offset != 0; count++ {
+		entries := binary.LittleEndian.Uint16(contents[offset:])
+		offset = binary.LittleEndian.Uint32(contents[int(offset)+2+12*int(entries):])
+	}
+	return count
+}
+
+func TestImageToFaxTiff(t *testing.T) {
+	// A gray gradient 3000 pixels wide, with a black square in its top left corner.
+	img := image.NewGray(image.Rect(0, 0, 3000, 4000))
+	for y := 0; y < 4000; y++ {
+		for x := 0; x < 3000; x++ {
+			value := uint8(x * 255 / 3000)
+			if x < 600 && y < 600 {
+				value = 0
+			}
+			img.SetGray(x, y, color.Gray{Y: value})
+		}
+	}
+
+	var pngFile bytes.Buffer
+	png.Encode(&pngFile, img)
+
+	tests := []struct {
+		name    string
+		options document.FaxTiffOptions
+		pages   int
+		lines   int
+	}{
+		{"g3 standard", document.FaxTiffOptions{PageSize: document.PAGE_SIZE_A4}, 1, 1146},
+		{"g4 fine dithered", document.FaxTiffOptions{Group4: true, Fine: true, Dither: true, PageSize: document.PAGE_SIZE_A4}, 1, 2292},
+		{"g3 letter", document.FaxTiffOptions{PageSize: document.PAGE_SIZE_LETTER}, 2, 1078},
+	}
+
+	for _, test := range tests {
+		contents, err := document.ImageToFaxTiff(pngFile.Bytes(), test.options)
+		if err != nil {
+			t.Fatalf("%s: converting the image failed: %v", test.name, err)
+		}
+		if pages := tiffPageCount(t, contents); pages != test.pages {
+			t.Errorf("%s: expected %d pages, got %d", test.name, test.pages, pages)
+		}
+
+		page, err := tiff.Decode(bytes.NewReader(contents))
+		if err != nil {
+			t.Fatalf("%s: decoding the first page failed: %v", test.name, err)
+		}
+
+		bounds := page.Bounds()
+		if bounds.Dx() != document.FAX_TIFF_WIDTH || bounds.Dy() != test.lines {
+			t.Fatalf("%s: unexpected page size %v", test.name, bounds)
+		}
+
+		// The image is scaled down to the paper width, the A4 page is padded
+		// on both sides and at the top to center it.
+		gray := func(x int, y int) uint8 {
+			return color.GrayModel.Convert(page.At(x, y)).(color.Gray).Y
+		}
+		if gray(100, 100) != 0 {
+			t.Errorf("%s: the black square is missing", test.name)
+		}
+		if !test.options.Dither && gray(1700, 100) != 255 {
+			t.Errorf("%s: the light end of the gradient should be white", test.name)
+		}
+		if test.options.PageSize == document.PAGE_SIZE_A4 && (gray(5, 100) != 255 || gray(100, 10) != 255) {
+			t.Errorf("%s: the page should be padded with white", test.name)
+		}
+	}
+
+	if _, err := document.ImageToFaxTiff([]byte("not an image"), document.FaxTiffOptions{}); !errors.Is(err, document.ErrConversionFailed) {
+		t.Errorf("expected ErrConversionFailed, got %v", err)
+	}
+}
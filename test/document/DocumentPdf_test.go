@@ -0,0 +1,213 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"faxsender/src/document"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var (
+	streamRegexp = regexp.MustCompile(`(?s)stream\n(.*?)\nendstream`)
+	textRegexp   = regexp.MustCompile(`<([0-9A-F]*)> Tj`)
+)
+
+// newTestPdf writes a document with one page per size.
+func newTestPdf(sizes ...document.PageSize) []byte {
+	pages := make([]*document.PdfPage, 0, len(sizes))
+	for i, size := range sizes {
+		page := document.NewPdfPage(size)
+		page.Text(72, size.Height-72, document.PDF_FONT_COURIER, 12, fmt.Sprintf("page %d", i+1))
+		pages = append(pages, page)
+	}
+	return document.WritePdf(pages)
+}
+
+// drawnTexts returns the texts drawn by the Flate compressed content streams of a document.
+func drawnTexts(t *testing.T, pdf []byte) []string {
+	t.Helper()
+
+	texts := make([]string, 0)
+	for _, match := range streamRegexp.FindAllSubmatch(pdf, -1) {
+		reader, err := zlib.NewReader(bytes.NewReader(match[1]))
+		if err != nil {
+			continue
+		}
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			continue
+		}
+
+		for _, text := range textRegexp.FindAllSubmatch(content, -1) {
+			decoded, _ := hex.DecodeString(string(text[1]))
+			texts = append(texts, string(decoded))
+		}
+	}
+	return texts
+}
+
+// newXrefStreamPdf builds a PDF 1.5 document storing its objects in an object
+// stream, indexed by a cross-reference stream with a PNG predictor.
+func newXrefStreamPdf() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.5\n")
+
+	objects := []string{
+		"<</Type/Catalog/Pages 2 0 R>>",
+		"<</Type/Pages/Kids[3 0 R]/Count 1/MediaBox[0 0 612 792]>>",
+		"<</Type/Page/Parent 2 0 R/Contents 5 0 R>>",
+	}
+	var header, body bytes.Buffer
+	for i, object := range objects {
+		fmt.Fprintf(&header, "%d %d ", i+1, body.Len())
+		body.WriteString(object + "\n")
+	}
+	objectStream := append(header.Bytes(), body.Bytes()...)
+
+	offsets := make([]int, 7)
+	offsets[5] = buf.Len()
+	buf.WriteString("5 0 obj\n<</Length 5>>\nstream\nBT ET\nendstream\nendobj\n")
+
+	offsets[4] = buf.Len()
+	compressed := deflateBytes(objectStream)
+	fmt.Fprintf(&buf, "4 0 obj\n<</Type/ObjStm/N 3/First %d/Filter/FlateDecode/Length %d>>\nstream\n", header.Len(), len(compressed))
+	buf.Write(compressed)
+	buf.WriteString("\nendstream\nendobj\n")
+
+	offsets[6] = buf.Len()
+	rows := [][]byte{{0, 0, 0, 0, 0, 0xff, 0xff}}
+	for id := 1; id <= 3; id++ {
+		rows = append(rows, []byte{2, 0, 0, 0, 4, 0, byte(id - 1)})
+	}
+	for id := 4; id <= 6; id++ {
+		offset := offsets[id]
+		rows = append(rows, []byte{1, byte(offset >> 24), byte(offset >> 16), byte(offset >> 8), byte(offset), 0, 0})
+	}
+
+	var predicted bytes.Buffer
+	previous := make([]byte, 7)
+	for _, row := range rows {
+		predicted.WriteByte(2)
+		for i := range row {
+			predicted.WriteByte(row[i] - previous[i])
+		}
+		previous = row
+	}
+
+	compressed = deflateBytes(predicted.Bytes())
+	fmt.Fprintf(&buf, "6 0 obj\n<</Type/XRef/Size 7/W[1 4 2]/Root 1 0 R/Filter/FlateDecode/DecodeParms<</Predictor 12/Columns 7>>/Length %d>>\nstream\n", len(compressed))
+	buf.Write(compressed)
+	fmt.Fprintf(&buf, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", offsets[6])
+	return buf.Bytes()
+}
+
+func deflateBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	writer := zlib.NewWriter(&buf)
+	writer.Write(data)
+	writer.Close()
+	return buf.Bytes()
+}
+
+func expectPageSizes(t *testing.T, pdf []byte, expected ...document.PageSize) {
+	t.Helper()
+
+	doc, err := document.ParsePdf(pdf)
+	if err != nil {
+		t.Fatalf("parsing the document failed: %v", err)
+	}
+
+	sizes, err := doc.PageSizes()
+	if err != nil {
+		t.Fatalf("reading the pages failed: %v", err)
+	}
+	if fmt.Sprint(sizes) != fmt.Sprint(expected) {
+		t.Fatalf("expected the pages %v, got %v", expected, sizes)
+	}
+}
+
+func TestWriteAndParsePdf(t *testing.T) {
+	pdf := newTestPdf(document.PAGE_SIZE_A4, document.PAGE_SIZE_LETTER, document.PAGE_SIZE_A4)
+	expectPageSizes(t, pdf, document.PAGE_SIZE_A4, document.PAGE_SIZE_LETTER, document.PAGE_SIZE_A4)
+
+	texts := drawnTexts(t, pdf)
+	if strings.Join(texts, ",") != "page 1,page 2,page 3" {
+		t.Errorf("unexpected texts %q", texts)
+	}
+}
+
+func TestPrependPages(t *testing.T) {
+	cases := map[string][]byte{
+		"xref table":  newTestPdf(document.PAGE_SIZE_A4, document.PAGE_SIZE_A4),
+		"xref stream": newXrefStreamPdf(),
+	}
+
+	for name, pdf := range cases {
+		doc, err := document.ParsePdf(pdf)
+		if err != nil {
+			t.Fatalf("%s: parsing the document failed: %v", name, err)
+		}
+		count, _ := doc.PageCount()
+
+		cover := document.NewPdfPage(document.PAGE_SIZE_LETTER)
+		cover.Text(72, 700, document.PDF_FONT_HELVETICA_BOLD, 24, "cover")
+		updated, err := doc.PrependPages(cover)
+		if err != nil {
+			t.Fatalf("%s: prepending failed: %v", name, err)
+		}
+
+		if !bytes.HasPrefix(updated, pdf) {
+			t.Errorf("%s: the document was rewritten instead of updated", name)
+		}
+
+		updatedDoc, err := document.ParsePdf(updated)
+		if err != nil {
+			t.Fatalf("%s: parsing the updated document failed: %v", name, err)
+		}
+		if updatedCount, _ := updatedDoc.PageCount(); updatedCount != count+1 {
+			t.Errorf("%s: expected %d pages, got %d", name, count+1, updatedCount)
+		}
+
+		texts := drawnTexts(t, updated)
+		if len(texts) == 0 || texts[len(texts)-1] != "cover" {
+			t.Errorf("%s: the cover page text is missing: %q", name, texts)
+		}
+	}
+}
+
+func TestParseDamagedPdf(t *testing.T) {
+	pdf := newTestPdf(document.PAGE_SIZE_A4, document.PAGE_SIZE_LETTER)
+	index := bytes.LastIndex(pdf, []byte("startxref"))
+	damaged := append(append([]byte{}, pdf[:index]...), []byte("startxref\n99999999\n%%EOF\n")...)
+
+	expectPageSizes(t, damaged, document.PAGE_SIZE_A4, document.PAGE_SIZE_LETTER)
+
+	doc, _ := document.ParsePdf(damaged)
+	updated, err := doc.PrependPages(document.NewPdfPage(document.PAGE_SIZE_A4))
+	if err != nil {
+		t.Fatalf("prepending failed: %v", err)
+	}
+	expectPageSizes(t, updated, document.PAGE_SIZE_A4, document.PAGE_SIZE_A4, document.PAGE_SIZE_LETTER)
+}
+
+func TestParseInvalidPdf(t *testing.T) {
+	if _, err := document.ParsePdf([]byte("plain text")); !errors.Is(err, document.ErrNotPdf) {
+		t.Errorf("expected ErrNotPdf, got %v", err)
+	}
+
+	if _, err := document.ParsePdf([]byte("%PDF-1.4\ngarbage")); !errors.Is(err, document.ErrPdfDamaged) {
+		t.Errorf("expected ErrPdfDamaged, got %v", err)
+	}
+
+	pdf := newTestPdf(document.PAGE_SIZE_A4)
+	encrypted := bytes.Replace(pdf, []byte("trailer\n<<"), []byte("trailer\n<</Encrypt 99 0 R"), 1)
+	if _, err := document.ParsePdf(encrypted); !errors.Is(err, document.ErrPdfEncrypted) {
+		t.Errorf("expected ErrPdfEncrypted, got %v", err)
+	}
+}
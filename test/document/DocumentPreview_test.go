@@ -0,0 +1,121 @@
+package document
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"faxsender/src/document"
+	"faxsender/src/utilities"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPreviewFaxTiff(t *testing.T) {
+	var pngFile bytes.Buffer
+	png.Encode(&pngFile, image.NewGray(image.Rect(0, 0, 1728, 3000)))
+
+	contents, err := document.ImageToFaxTiff(pngFile.Bytes(), document.FaxTiffOptions{Group4: true, PageSize: document.PAGE_SIZE_A4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	preview, err := document.NewDocumentPreview(contents, utilities.TIFF_CONTENT_TYPE)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer preview.Close()
+
+	if preview.PageCount() != 2 {
+		t.Fatalf("expected 2 pages, got %d", preview.PageCount())
+	}
+
+	// The fax pages have half the vertical resolution, they are stretched to
+	// the proportions of the A4 paper.
+	thumbnail, err := preview.Thumbnail(context.Background(), 1, 200)
+	if err != nil {
+		t.Fatalf("the second page can't be drawn: %v", err)
+	}
+	if bounds := thumbnail.Bounds(); bounds.Dy() != 200 || bounds.Dx() < 145 || bounds.Dx() > 155 {
+		t.Errorf("unexpected thumbnail size %v", bounds)
+	}
+
+	if _, err := preview.Thumbnail(context.Background(), 2, 200); err == nil {
+		t.Errorf("expected an error for a missing page")
+	}
+}
+
+func TestPreviewImageAndUnsupported(t *testing.T) {
+	var pngFile bytes.Buffer
+	png.Encode(&pngFile, image.NewGray(image.Rect(0, 0, 50, 10)))
+
+	preview, err := document.NewDocumentPreview(pngFile.Bytes(), utilities.PNG_CONTENT_TYPE)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer preview.Close()
+
+	thumbnail, err := preview.Thumbnail(context.Background(), 0, 200)
+	if err != nil || preview.PageCount() != 1 || thumbnail.Bounds().Dx() != 50 {
+		t.Errorf("small images shouldn't be scaled up, got %d pages, %v, %v", preview.PageCount(), thumbnail.Bounds(), err)
+	}
+
+	if _, err := document.NewDocumentPreview([]byte("text"), utilities.TEXT_CONTENT_TYPE); !errors.Is(err, document.ErrPreviewUnsupported) {
+		t.Errorf("expected ErrPreviewUnsupported, got %v", err)
+	}
+}
+
+func TestPreviewPdf(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake PDF renderer is a shell script")
+	}
+
+	preview, err := document.NewDocumentPreview(newTestPdf(document.PAGE_SIZE_A4, document.PAGE_SIZE_LETTER, document.PAGE_SIZE_A4), utilities.PDF_CONTENT_TYPE)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer preview.Close()
+
+	if preview.PageCount() != 3 {
+		t.Fatalf("expected 3 pages, got %d", preview.PageCount())
+	}
+
+	// Without pdftoppm the pages are blank pages of their size.
+	t.Setenv("PATH", t.TempDir())
+	if _, err := preview.Thumbnail(context.Background(), 0, 100); !errors.Is(err, document.ErrRendererUnavailable) {
+		t.Errorf("expected ErrRendererUnavailable, got %v", err)
+	}
+	if bounds := preview.PlaceholderThumbnail(1, 100).Bounds(); bounds.Dx() != 77 || bounds.Dy() != 100 {
+		t.Errorf("unexpected Letter placeholder size %v", bounds)
+	}
+
+	// The fake renderer copies the image of the page given by -f.
+	rendererDir := t.TempDir()
+	for number := 1; number <= 2; number++ {
+		var page bytes.Buffer
+		png.Encode(&page, image.NewGray(image.Rect(0, 0, 10*number, 40)))
+		if err := os.WriteFile(filepath.Join(rendererDir, fmt.Sprintf("page%d.png", number)), page.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	script := "#!/bin/sh\nfor last; do :; done\ncp \"" + rendererDir + "/page$2.png\" \"$last.png\"\n"
+	if err := os.WriteFile(filepath.Join(rendererDir, "pdftoppm"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	preview, err = document.NewDocumentPreview(newTestPdf(document.PAGE_SIZE_A4, document.PAGE_SIZE_A4), utilities.PDF_CONTENT_TYPE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer preview.Close()
+
+	t.Setenv("PATH", rendererDir+string(os.PathListSeparator)+"/bin"+string(os.PathListSeparator)+"/usr/bin")
+	thumbnail, err := preview.Thumbnail(context.Background(), 1, 100)
+	if err != nil || thumbnail.Bounds().Dx() != 20 {
+		t.Errorf("expected the rendered second page, got %v", err)
+	}
+}
@@ -2,8 +2,13 @@ package utilities
 
 import (
 	"faxsender/src/utilities"
+	"os"
+	"path"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 const (
@@ -31,3 +36,66 @@ func TestGetExtension(t *testing.T) {
 		t.Error("the file extension could not recognized!!!")
 	}
 }
+
+func TestCreateLockFile(t *testing.T) {
+	lockFilePath := path.Join(t.TempDir(), "job.lock")
+
+	locked, err := utilities.CreateLockFile(lockFilePath, time.Minute)
+	if err != nil || !locked {
+		t.Fatalf("the free lock could not be created: %v", err)
+	}
+
+	locked, err = utilities.CreateLockFile(lockFilePath, time.Minute)
+	if err != nil || locked || !utilities.IsLockFileHeld(lockFilePath, time.Minute) {
+		t.Fatalf("the held lock has been created again: %v", err)
+	}
+
+	// A lock that hasn't been refreshed within the lease is taken over.
+	stale := time.Now().Add(-2 * time.Minute)
+	os.Chtimes(lockFilePath, stale, stale)
+
+	locked, err = utilities.CreateLockFile(lockFilePath, time.Minute)
+	if err != nil || !locked {
+		t.Fatalf("the stale lock has not been taken over: %v", err)
+	}
+
+	entries, _ := os.ReadDir(path.Dir(lockFilePath))
+	if len(entries) != 1 {
+		t.Errorf("the takeover left %d files", len(entries))
+	}
+
+	if err := utilities.RemoveLockFile(lockFilePath); err != nil || utilities.IsLockFileHeld(lockFilePath, time.Minute) {
+		t.Errorf("the lock has not been removed: %v", err)
+	}
+}
+
+func TestWriteFileAtomicConcurrentWriters(t *testing.T) {
+	dir := t.TempDir()
+	filePath := path.Join(dir, "history.json")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := strings.Repeat(strconv.Itoa(i), 64*1024)
+			if err := utilities.WriteFileAtomic(filePath, []byte(data), 0600); err != nil {
+				t.Errorf("writing the file failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	data, _ := os.ReadFile(filePath)
+	if len(data) != 64*1024 || strings.Count(string(data), string(data[:1])) != len(data) {
+		t.Errorf("the writers mixed their data in a file of %d bytes", len(data))
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("the writers left %d files", len(entries))
+	}
+	if info, err := os.Stat(filePath); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("unexpected file %v, %v", info, err)
+	}
+}